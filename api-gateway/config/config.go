@@ -1,19 +1,148 @@
 package config
 
 import (
+	"log"
+	"net/netip"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
 	UserServiceURL         string
+	MessageServiceURL      string
 	NotificationServiceURL string
 	KafkaServiceURL        string
+	JWKSURL                string
+	JWKSCacheTTL           time.Duration
+	WebSocketPingInterval  time.Duration
+	WebSocketPongTimeout   time.Duration
+	// Deadline for draining requests and connections on shutdown
+	ShutdownTimeout time.Duration
+	// Proxies whose X-Forwarded-For headers are believed, as addresses or
+	// CIDR ranges. Other peers are taken to be the client itself.
+	TrustedProxies []netip.Prefix
+
+	// Attachments are kept on the local filesystem below StoragePath, or in
+	// an S3-compatible bucket when StorageBackend is "s3"
+	StorageBackend string
+	StoragePath    string
+	S3Endpoint     string
+	S3Region       string
+	S3Bucket       string
+	S3AccessKey    string
+	S3SecretKey    string
+	// Deadline of each request to the bucket, uploads included
+	S3Timeout time.Duration
+	// Largest accepted upload, in bytes
+	MaxAttachmentSize int64
+	// Media types accepted for upload, as detected from the file's content
+	AttachmentTypes []string
+	// Key signing download URLs, shared by every replica of the gateway
+	DownloadURLSecret string
+	DownloadURLTTL    time.Duration
+	// Uploads not sent with a message within UnsentAttachmentTTL are deleted,
+	// checked every AttachmentPurgeInterval
+	UnsentAttachmentTTL     time.Duration
+	AttachmentPurgeInterval time.Duration
+	// User searches allowed to each user per window, to deter enumerating
+	// the directory
+	UserSearchLimit  int64
+	UserSearchWindow time.Duration
+	// User lookups allowed to each user per window, for the same reason
+	UserLookupLimit  int64
+	UserLookupWindow time.Duration
 }
 
 func LoadConfig() *Config {
 	return &Config{
 		UserServiceURL:         os.Getenv("USER_SERVICE_URL"),
+		MessageServiceURL:      os.Getenv("MESSAGE_SERVICE_URL"),
 		NotificationServiceURL: os.Getenv("NOTIFICATION_SERVICE_URL"),
 		KafkaServiceURL:        os.Getenv("KAFKA_BROKER"),
+		JWKSURL:                os.Getenv("JWKS_URL"),
+		JWKSCacheTTL:           getDuration("JWKS_CACHE_TTL", 10*time.Minute),
+		WebSocketPingInterval:  getDuration("WS_PING_INTERVAL", 30*time.Second),
+		WebSocketPongTimeout:   getDuration("WS_PONG_TIMEOUT", 60*time.Second),
+		ShutdownTimeout:        getDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
+		TrustedProxies:         getPrefixes("TRUSTED_PROXIES"),
+		StorageBackend:         getString("STORAGE_BACKEND", "filesystem"),
+		StoragePath:            getString("STORAGE_PATH", "/var/lib/api-gateway/attachments"),
+		S3Endpoint:             os.Getenv("S3_ENDPOINT"),
+		S3Region:               getString("S3_REGION", "us-east-1"),
+		S3Bucket:               os.Getenv("S3_BUCKET"),
+		S3AccessKey:            os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:            os.Getenv("S3_SECRET_KEY"),
+		S3Timeout:              getDuration("S3_TIMEOUT", 2*time.Minute),
+		MaxAttachmentSize:      getInt64("MAX_ATTACHMENT_SIZE", 25<<20),
+		AttachmentTypes: getList("ATTACHMENT_TYPES", []string{
+			"image/jpeg", "image/png", "image/gif", "image/webp",
+			"video/mp4", "video/webm", "audio/mpeg", "audio/wave",
+			"application/pdf", "application/zip", "text/plain",
+		}),
+		DownloadURLSecret:       os.Getenv("DOWNLOAD_URL_SECRET"),
+		DownloadURLTTL:          getDuration("DOWNLOAD_URL_TTL", 15*time.Minute),
+		UnsentAttachmentTTL:     getDuration("UNSENT_ATTACHMENT_TTL", 24*time.Hour),
+		AttachmentPurgeInterval: getDuration("ATTACHMENT_PURGE_INTERVAL", time.Hour),
+		UserSearchLimit:         getInt64("USER_SEARCH_LIMIT", 30),
+		UserSearchWindow:        getDuration("USER_SEARCH_WINDOW", time.Minute),
+		UserLookupLimit:         getInt64("USER_LOOKUP_LIMIT", 120),
+		UserLookupWindow:        getDuration("USER_LOOKUP_WINDOW", time.Minute),
+	}
+}
+
+func getString(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getInt64(key string, fallback int64) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
+// getList reads a comma-separated list
+func getList(key string, fallback []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getPrefixes reads a comma-separated list of addresses and CIDR ranges,
+// skipping invalid entries
+func getPrefixes(key string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, item := range getList(key, nil) {
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(item)
+			if addrErr != nil {
+				log.Printf("Ignoring invalid %s entry %q: %v", key, item, err)
+				continue
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
 	}
+	return fallback
 }
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	"api-gateway/storage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sniffLength is how much of a file is read to detect its type
+const sniffLength = 512
+
+// thumbnailTypes are the image types thumbnails can be made of
+var thumbnailTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// UploadAttachment streams the request body to storage as a file the caller
+// may then send with a message. The file name is given as the name query
+// parameter, the type is detected from the content and must be allowed.
+// Images get a thumbnail.
+func (h *Handler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	fileName := strings.TrimSpace(r.URL.Query().Get("name"))
+	if fileName == "" {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid name",
+			middleware.ErrorDetail{Field: "name", Description: "must not be empty"})
+		return
+	}
+	switch {
+	case r.ContentLength < 0:
+		middleware.WriteError(w, r, http.StatusLengthRequired, middleware.CodeInvalidArgument, "content length required")
+		return
+	case r.ContentLength == 0:
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid file",
+			middleware.ErrorDetail{Field: "file", Description: "must not be empty"})
+		return
+	case r.ContentLength > h.Config.MaxAttachmentSize:
+		middleware.WriteError(w, r, http.StatusRequestEntityTooLarge, middleware.CodeInvalidArgument, "file too large",
+			middleware.ErrorDetail{Field: "file", Description: fmt.Sprintf("must be at most %d bytes", h.Config.MaxAttachmentSize)})
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, r.ContentLength)
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !slices.Contains(h.Config.AttachmentTypes, mediaType) {
+		middleware.WriteError(w, r, http.StatusUnsupportedMediaType, middleware.CodeInvalidArgument, "unsupported file type",
+			middleware.ErrorDetail{Field: "file", Description: "must be one of " + strings.Join(h.Config.AttachmentTypes, ", ")})
+		return
+	}
+
+	userID := middleware.UserIDFromContext(r.Context())
+	key, err := storage.NewKey(userID)
+	if err != nil {
+		log.Printf("Request %s failed to generate storage key: %v", middleware.RequestIDFromContext(r.Context()), err)
+		middleware.WriteError(w, r, http.StatusInternalServerError, middleware.CodeInternal, "internal error")
+		return
+	}
+	if err := h.Storage.Put(r.Context(), key, io.MultiReader(bytes.NewReader(head), body), r.ContentLength, contentType); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "incomplete upload")
+			return
+		}
+		log.Printf("Request %s failed to store file: %v", middleware.RequestIDFromContext(r.Context()), err)
+		middleware.WriteError(w, r, http.StatusServiceUnavailable, middleware.CodeUnavailable, "service temporarily unavailable")
+		return
+	}
+
+	grpcReq := &messageServiceProto.CreateAttachmentRequest{
+		UserId:      userID,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        r.ContentLength,
+		StorageKey:  key,
+	}
+	if slices.Contains(thumbnailTypes, mediaType) {
+		if thumbnail, thumbnailKey := h.storeThumbnail(r, key); thumbnail != nil {
+			grpcReq.ThumbnailKey = thumbnailKey
+			grpcReq.Width, grpcReq.Height = int32(thumbnail.Width), int32(thumbnail.Height)
+		}
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			resp, err := h.MessageClient.CreateAttachment(ctx, req.(*messageServiceProto.CreateAttachmentRequest))
+			if err != nil {
+				h.deleteFiles(ctx, grpcReq.StorageKey, grpcReq.ThumbnailKey)
+			}
+			return resp, err
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.CreateAttachmentResponse)
+			return map[string]interface{}{
+				"attachment": attachmentJSON(grpcResp.Attachment),
+			}, nil
+		},
+	)
+}
+
+// GetAttachment returns the attachment given in the path with download URLs
+// of the file and its thumbnail, which expire together
+func (h *Handler) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	attachmentID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.GetAttachmentRequest{
+		UserId:       middleware.UserIDFromContext(r.Context()),
+		AttachmentId: attachmentID,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.GetAttachment(ctx, req.(*messageServiceProto.GetAttachmentRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.GetAttachmentResponse)
+			now := time.Now()
+			url, expires := h.URLSigner.Sign(grpcResp.StorageKey, grpcResp.Attachment.ContentType, now)
+			var thumbnailURL interface{}
+			if grpcResp.ThumbnailKey != "" {
+				thumbnailURL, _ = h.URLSigner.Sign(grpcResp.ThumbnailKey, storage.ThumbnailContentType, now)
+			}
+			return map[string]interface{}{
+				"attachment":   attachmentJSON(grpcResp.Attachment),
+				"url":          url,
+				"thumbnailUrl": thumbnailURL,
+				"expiresAt":    expires.Unix(),
+			}, nil
+		},
+	)
+}
+
+// DownloadFile serves a stored file to whoever holds a valid download URL
+// for it. Files other than images are served as downloads, so that they
+// can't run scripts in the gateway's origin.
+func (h *Handler) DownloadFile(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	contentType, err := h.URLSigner.Verify(key, r.URL.Query(), time.Now())
+	if errors.Is(err, storage.ErrURLExpired) {
+		middleware.WriteError(w, r, http.StatusForbidden, middleware.CodePermissionDenied, "download URL expired")
+		return
+	}
+	if err != nil {
+		middleware.WriteError(w, r, http.StatusForbidden, middleware.CodePermissionDenied, "invalid download URL")
+		return
+	}
+
+	object, err := h.Storage.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		middleware.WriteError(w, r, http.StatusNotFound, middleware.CodeNotFound, "file not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Request %s failed to read file: %v", middleware.RequestIDFromContext(r.Context()), err)
+		middleware.WriteError(w, r, http.StatusServiceUnavailable, middleware.CodeUnavailable, "service temporarily unavailable")
+		return
+	}
+	defer object.Body.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(h.Config.DownloadURLTTL.Seconds())))
+	if !slices.Contains(thumbnailTypes, strings.SplitN(contentType, ";", 2)[0]) {
+		w.Header().Set("Content-Disposition", "attachment")
+	}
+	if object.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	}
+	if _, err := io.Copy(w, object.Body); err != nil {
+		log.Printf("Request %s failed to send file: %v", middleware.RequestIDFromContext(r.Context()), err)
+	}
+}
+
+// purgeBatchSize is how many unsent attachments are removed per request to
+// message-service
+const purgeBatchSize = 500
+
+// PurgeUnsentAttachments deletes the files of attachments that were never
+// sent within the configured TTL, until the context is cancelled. Every
+// replica runs it; message-service hands each attachment to only one.
+func (h *Handler) PurgeUnsentAttachments(ctx context.Context) {
+	ticker := time.NewTicker(h.Config.AttachmentPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := h.purgeUnsentAttachments(ctx, time.Now().Add(-h.Config.UnsentAttachmentTTL))
+			if err != nil {
+				log.Printf("Failed to purge unsent attachments: %v", err)
+			}
+			if purged > 0 {
+				log.Printf("Deleted %d files of unsent attachments", purged)
+			}
+		}
+	}
+}
+
+// purgeUnsentAttachments removes the attachments uploaded before the cutoff
+// and never sent, batch by batch, and deletes their files. It returns how
+// many files were handed to the storage for deletion.
+func (h *Handler) purgeUnsentAttachments(ctx context.Context, uploadedBefore time.Time) (int, error) {
+	purged := 0
+	for {
+		response, err := h.MessageClient.PurgeUnsentAttachments(ctx, &messageServiceProto.PurgeUnsentAttachmentsRequest{
+			UploadedBefore: uploadedBefore.Unix(),
+			Limit:          purgeBatchSize,
+		})
+		if err != nil {
+			return purged, err
+		}
+		h.deleteFiles(ctx, response.StorageKeys...)
+		purged += len(response.StorageKeys)
+		// Thumbnails add a key per image, so a full batch has at least as many
+		if len(response.StorageKeys) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// storeThumbnail makes a thumbnail of the uploaded image and stores it next
+// to the image. Images that can't be decoded are kept without one.
+func (h *Handler) storeThumbnail(r *http.Request, key string) (*storage.Thumbnail, string) {
+	requestID := middleware.RequestIDFromContext(r.Context())
+	object, err := h.Storage.Get(r.Context(), key)
+	if err != nil {
+		log.Printf("Request %s failed to read image: %v", requestID, err)
+		return nil, ""
+	}
+	defer object.Body.Close()
+
+	thumbnail, err := storage.MakeThumbnail(object.Body)
+	if err != nil {
+		log.Printf("Request %s failed to make thumbnail: %v", requestID, err)
+		return nil, ""
+	}
+	thumbnailKey := key + "-thumbnail"
+	err = h.Storage.Put(r.Context(), thumbnailKey, bytes.NewReader(thumbnail.Data), int64(len(thumbnail.Data)), storage.ThumbnailContentType)
+	if err != nil {
+		log.Printf("Request %s failed to store thumbnail: %v", requestID, err)
+		return nil, ""
+	}
+	return thumbnail, thumbnailKey
+}
+
+// deleteFiles removes stored files, logging failures since the files are
+// merely left behind. Empty keys are skipped.
+func (h *Handler) deleteFiles(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := h.Storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete file %s: %v", key, err)
+		}
+	}
+}
+
+// attachmentJSON maps an attachment to its JSON representation. Files are
+// fetched through GetAttachment, which checks access.
+func attachmentJSON(attachment *messageServiceProto.Attachment) map[string]interface{} {
+	return map[string]interface{}{
+		"attachmentId": attachment.AttachmentId,
+		"fileName":     attachment.FileName,
+		"contentType":  attachment.ContentType,
+		"size":         attachment.Size,
+		"hasThumbnail": attachment.HasThumbnail,
+		"width":        attachment.Width,
+		"height":       attachment.Height,
+	}
+}
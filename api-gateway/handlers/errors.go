@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"api-gateway/middleware"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// httpError is the response a gRPC status code is translated to
+type httpError struct {
+	status int
+	code   string
+}
+
+var grpcErrors = map[codes.Code]httpError{
+	codes.InvalidArgument:    {http.StatusBadRequest, middleware.CodeInvalidArgument},
+	codes.OutOfRange:         {http.StatusBadRequest, middleware.CodeInvalidArgument},
+	codes.Unauthenticated:    {http.StatusUnauthorized, middleware.CodeUnauthenticated},
+	codes.PermissionDenied:   {http.StatusForbidden, middleware.CodePermissionDenied},
+	codes.NotFound:           {http.StatusNotFound, middleware.CodeNotFound},
+	codes.AlreadyExists:      {http.StatusConflict, middleware.CodeAlreadyExists},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, middleware.CodeResourceExhausted},
+	codes.Unavailable:        {http.StatusServiceUnavailable, middleware.CodeUnavailable},
+	codes.DeadlineExceeded:   {http.StatusServiceUnavailable, middleware.CodeUnavailable},
+	codes.FailedPrecondition: {http.StatusConflict, middleware.CodeFailedPrecondition},
+}
+
+// writeGrpcError translates a failed gRPC call into an HTTP error response.
+// Messages of server-side failures are logged, not returned, since they may
+// describe the service's internals.
+func writeGrpcError(w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	requestID := middleware.RequestIDFromContext(r.Context())
+
+	mapped, ok := grpcErrors[st.Code()]
+	if !ok {
+		log.Printf("Request %s failed: %v", requestID, err)
+		middleware.WriteError(w, r, http.StatusInternalServerError, middleware.CodeInternal, "internal error")
+		return
+	}
+
+	message := st.Message()
+	if mapped.status == http.StatusServiceUnavailable {
+		log.Printf("Request %s failed: %v", requestID, err)
+		message = "service temporarily unavailable"
+	}
+
+	var details []middleware.ErrorDetail
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.BadRequest:
+			for _, violation := range detail.FieldViolations {
+				details = append(details, middleware.ErrorDetail{
+					Field:       violation.Field,
+					Description: violation.Description,
+				})
+			}
+		case *errdetails.RetryInfo:
+			if delay := detail.RetryDelay.AsDuration(); delay > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			}
+		}
+	}
+
+	middleware.WriteError(w, r, mapped.status, mapped.code, message, details...)
+}
@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var createGroupReq struct {
+		Title     string  `json:"title"`
+		MemberIDs []int32 `json:"memberIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&createGroupReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.CreateGroupRequest{
+		UserId:    middleware.UserIDFromContext(r.Context()),
+		Title:     createGroupReq.Title,
+		MemberIds: createGroupReq.MemberIDs,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.CreateGroup(ctx, req.(*messageServiceProto.CreateGroupRequest))
+		},
+		conversationResponseJSON,
+	)
+}
+
+func (h *Handler) AddMembers(w http.ResponseWriter, r *http.Request) {
+	conversationID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	var addMembersReq struct {
+		MemberIDs []int32 `json:"memberIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&addMembersReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.AddMembersRequest{
+		UserId:         middleware.UserIDFromContext(r.Context()),
+		ConversationId: conversationID,
+		MemberIds:      addMembersReq.MemberIDs,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.AddMembers(ctx, req.(*messageServiceProto.AddMembersRequest))
+		},
+		conversationResponseJSON,
+	)
+}
+
+func (h *Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	conversationID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	memberID, ok := idParam(w, r, "userId", 32)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.RemoveMemberRequest{
+		UserId:         middleware.UserIDFromContext(r.Context()),
+		ConversationId: conversationID,
+		MemberId:       int32(memberID),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.RemoveMember(ctx, req.(*messageServiceProto.RemoveMemberRequest))
+		},
+		conversationResponseJSON,
+	)
+}
+
+func (h *Handler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	conversationID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	memberID, ok := idParam(w, r, "userId", 32)
+	if !ok {
+		return
+	}
+	var updateRoleReq struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&updateRoleReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.UpdateMemberRoleRequest{
+		UserId:         middleware.UserIDFromContext(r.Context()),
+		ConversationId: conversationID,
+		MemberId:       int32(memberID),
+		Role:           updateRoleReq.Role,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.UpdateMemberRole(ctx, req.(*messageServiceProto.UpdateMemberRoleRequest))
+		},
+		conversationResponseJSON,
+	)
+}
+
+func (h *Handler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	conversationID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	var transferReq struct {
+		NewOwnerID int32 `json:"newOwnerId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&transferReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.TransferOwnershipRequest{
+		UserId:         middleware.UserIDFromContext(r.Context()),
+		ConversationId: conversationID,
+		NewOwnerId:     transferReq.NewOwnerID,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.TransferOwnership(ctx, req.(*messageServiceProto.TransferOwnershipRequest))
+		},
+		conversationResponseJSON,
+	)
+}
+
+func (h *Handler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
+	conversationID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.LeaveGroupRequest{
+		UserId:         middleware.UserIDFromContext(r.Context()),
+		ConversationId: conversationID,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.LeaveGroup(ctx, req.(*messageServiceProto.LeaveGroupRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.LeaveGroupResponse)
+			return map[string]interface{}{
+				"message": grpcResp.Message,
+			}, nil
+		},
+	)
+}
+
+func conversationResponseJSON(resp interface{}) (map[string]interface{}, error) {
+	grpcResp := resp.(*messageServiceProto.ConversationResponse)
+	return map[string]interface{}{
+		"conversation": conversationJSON(grpcResp.Conversation),
+	}, nil
+}
@@ -0,0 +1,619 @@
+package handlers
+
+import (
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+func (h *Handler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	var sendMessageReq struct {
+		ConversationID   int64   `json:"conversationId"`
+		RecipientID      int32   `json:"recipientId"`
+		Text             string  `json:"text"`
+		ReplyToMessageID int64   `json:"replyToMessageId"`
+		ThreadRootID     int64   `json:"threadRootId"`
+		AttachmentIDs    []int64 `json:"attachmentIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&sendMessageReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.SendMessageRequest{
+		UserId:           middleware.UserIDFromContext(r.Context()),
+		ConversationId:   sendMessageReq.ConversationID,
+		RecipientId:      sendMessageReq.RecipientID,
+		Text:             sendMessageReq.Text,
+		ReplyToMessageId: sendMessageReq.ReplyToMessageID,
+		ThreadRootId:     sendMessageReq.ThreadRootID,
+		AttachmentIds:    sendMessageReq.AttachmentIDs,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.SendMessage(ctx, req.(*messageServiceProto.SendMessageRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.SendMessageResponse)
+			return map[string]interface{}{
+				"message": messageJSON(grpcResp.Message),
+			}, nil
+		},
+	)
+}
+
+// EditMessage replaces the text of the caller's message given in the path
+func (h *Handler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	var editMessageReq struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&editMessageReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.EditMessageRequest{
+		UserId:    middleware.UserIDFromContext(r.Context()),
+		MessageId: messageID,
+		Text:      editMessageReq.Text,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.EditMessage(ctx, req.(*messageServiceProto.EditMessageRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.EditMessageResponse)
+			return map[string]interface{}{
+				"message": messageJSON(grpcResp.Message),
+			}, nil
+		},
+	)
+}
+
+// DeleteMessage hides the message given in the path from the caller, or
+// deletes it for everyone when forEveryone=true is given
+func (h *Handler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	forEveryone := false
+	if value := r.URL.Query().Get("forEveryone"); value != "" {
+		var err error
+		if forEveryone, err = strconv.ParseBool(value); err != nil {
+			middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid forEveryone",
+				middleware.ErrorDetail{Field: "forEveryone", Description: "must be true or false"})
+			return
+		}
+	}
+
+	grpcReq := &messageServiceProto.DeleteMessageRequest{
+		UserId:      middleware.UserIDFromContext(r.Context()),
+		MessageId:   messageID,
+		ForEveryone: forEveryone,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			resp, err := h.MessageClient.DeleteMessage(ctx, req.(*messageServiceProto.DeleteMessageRequest))
+			if err == nil {
+				h.deleteFiles(ctx, resp.StorageKeys...)
+			}
+			return resp, err
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.DeleteMessageResponse)
+			return map[string]interface{}{
+				"messageId":   grpcResp.MessageId,
+				"forEveryone": grpcResp.ForEveryone,
+			}, nil
+		},
+	)
+}
+
+// GetEditHistory returns the message given in the path with the previous
+// versions of its text, oldest first
+func (h *Handler) GetEditHistory(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.GetEditHistoryRequest{
+		UserId:    middleware.UserIDFromContext(r.Context()),
+		MessageId: messageID,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.GetEditHistory(ctx, req.(*messageServiceProto.GetEditHistoryRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.GetEditHistoryResponse)
+			edits := make([]map[string]interface{}, 0, len(grpcResp.Edits))
+			for _, edit := range grpcResp.Edits {
+				edits = append(edits, map[string]interface{}{
+					"text":     edit.Text,
+					"editedAt": edit.EditedAt,
+				})
+			}
+			return map[string]interface{}{
+				"message": messageJSON(grpcResp.Message),
+				"edits":   edits,
+			}, nil
+		},
+	)
+}
+
+// AddReaction reacts to the message given in the path with the emoji in the body
+func (h *Handler) AddReaction(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	var reactionReq struct {
+		Emoji string `json:"emoji"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reactionReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.ReactionRequest{
+		UserId:    middleware.UserIDFromContext(r.Context()),
+		MessageId: messageID,
+		Emoji:     reactionReq.Emoji,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.AddReaction(ctx, req.(*messageServiceProto.ReactionRequest))
+		},
+		reactionResponseJSON,
+	)
+}
+
+// RemoveReaction takes back the caller's reaction given in the path
+func (h *Handler) RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.ReactionRequest{
+		UserId:    middleware.UserIDFromContext(r.Context()),
+		MessageId: messageID,
+		Emoji:     mux.Vars(r)["emoji"],
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.RemoveReaction(ctx, req.(*messageServiceProto.ReactionRequest))
+		},
+		reactionResponseJSON,
+	)
+}
+
+// GetThread returns a page of the thread of the message given in the path,
+// newest replies first
+func (h *Handler) GetThread(w http.ResponseWriter, r *http.Request) {
+	rootMessageID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	pageSize, ok := pageSizeParam(w, r)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.GetThreadRequest{
+		UserId:        middleware.UserIDFromContext(r.Context()),
+		RootMessageId: rootMessageID,
+		PageSize:      pageSize,
+		Cursor:        r.URL.Query().Get("cursor"),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.GetThread(ctx, req.(*messageServiceProto.GetThreadRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.GetThreadResponse)
+			replies := make([]map[string]interface{}, 0, len(grpcResp.Replies))
+			for _, reply := range grpcResp.Replies {
+				replies = append(replies, messageJSON(reply))
+			}
+			return map[string]interface{}{
+				"root":       messageJSON(grpcResp.Root),
+				"replies":    replies,
+				"nextCursor": grpcResp.NextCursor,
+			}, nil
+		},
+	)
+}
+
+// MarkThreadRead marks the thread of the message given in the path as read
+// up to the reply in the body
+func (h *Handler) MarkThreadRead(w http.ResponseWriter, r *http.Request) {
+	rootMessageID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	var markThreadReadReq struct {
+		MessageID int64 `json:"messageId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&markThreadReadReq); err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	grpcReq := &messageServiceProto.MarkThreadReadRequest{
+		UserId:        middleware.UserIDFromContext(r.Context()),
+		RootMessageId: rootMessageID,
+		MessageId:     markThreadReadReq.MessageID,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.MarkThreadRead(ctx, req.(*messageServiceProto.MarkThreadReadRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.MarkThreadReadResponse)
+			return map[string]interface{}{
+				"rootMessageId": rootMessageID,
+				"thread":        threadJSON(grpcResp.Thread),
+			}, nil
+		},
+	)
+}
+
+func (h *Handler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	pageSize, ok := pageSizeParam(w, r)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.ListConversationsRequest{
+		UserId:   middleware.UserIDFromContext(r.Context()),
+		PageSize: pageSize,
+		Cursor:   r.URL.Query().Get("cursor"),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.ListConversations(ctx, req.(*messageServiceProto.ListConversationsRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.ListConversationsResponse)
+			conversations := make([]map[string]interface{}, 0, len(grpcResp.Conversations))
+			for _, conversation := range grpcResp.Conversations {
+				conversations = append(conversations, conversationJSON(conversation))
+			}
+			return map[string]interface{}{
+				"conversations": conversations,
+				"nextCursor":    grpcResp.NextCursor,
+			}, nil
+		},
+	)
+}
+
+// GetHistory returns a page of the conversation given in the path, newest messages first
+func (h *Handler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	conversationID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+	pageSize, ok := pageSizeParam(w, r)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.GetHistoryRequest{
+		UserId:         middleware.UserIDFromContext(r.Context()),
+		ConversationId: conversationID,
+		PageSize:       pageSize,
+		Cursor:         r.URL.Query().Get("cursor"),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.GetHistory(ctx, req.(*messageServiceProto.GetHistoryRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.GetHistoryResponse)
+			messages := make([]map[string]interface{}, 0, len(grpcResp.Messages))
+			for _, message := range grpcResp.Messages {
+				messages = append(messages, messageJSON(message))
+			}
+			return map[string]interface{}{
+				"messages":   messages,
+				"nextCursor": grpcResp.NextCursor,
+			}, nil
+		},
+	)
+}
+
+// GetReadState returns how far every participant got in the conversation
+// given in the path. A message was delivered to, or read by, a participant
+// when its ID is at most the participant's mark.
+func (h *Handler) GetReadState(w http.ResponseWriter, r *http.Request) {
+	conversationID, ok := idParam(w, r, "id", 64)
+	if !ok {
+		return
+	}
+
+	grpcReq := &messageServiceProto.GetReadStateRequest{
+		UserId:         middleware.UserIDFromContext(r.Context()),
+		ConversationId: conversationID,
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.GetReadState(ctx, req.(*messageServiceProto.GetReadStateRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.GetReadStateResponse)
+			receipts := make([]map[string]interface{}, 0, len(grpcResp.Receipts))
+			for _, receipt := range grpcResp.Receipts {
+				receipts = append(receipts, map[string]interface{}{
+					"userId":                 receipt.UserId,
+					"lastDeliveredMessageId": receipt.LastDeliveredMessageId,
+					"lastReadMessageId":      receipt.LastReadMessageId,
+				})
+			}
+			return map[string]interface{}{
+				"conversationId": conversationID,
+				"receipts":       receipts,
+			}, nil
+		},
+	)
+}
+
+// SearchMessages looks for the words given as q in the caller's
+// conversations, optionally narrowed to a conversation, a sender and a
+// period given as Unix times, newest messages first
+func (h *Handler) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	grpcReq := &messageServiceProto.SearchMessagesRequest{
+		UserId: middleware.UserIDFromContext(r.Context()),
+		Query:  r.URL.Query().Get("q"),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	var ok bool
+	if grpcReq.PageSize, ok = pageSizeParam(w, r); !ok {
+		return
+	}
+	if grpcReq.ConversationId, ok = queryIntParam(w, r, "conversationId", 64); !ok {
+		return
+	}
+	senderID, ok := queryIntParam(w, r, "senderId", 32)
+	if !ok {
+		return
+	}
+	grpcReq.SenderId = int32(senderID)
+	if grpcReq.After, ok = queryIntParam(w, r, "after", 64); !ok {
+		return
+	}
+	if grpcReq.Before, ok = queryIntParam(w, r, "before", 64); !ok {
+		return
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.MessageClient.SearchMessages(ctx, req.(*messageServiceProto.SearchMessagesRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*messageServiceProto.SearchMessagesResponse)
+			results := make([]map[string]interface{}, 0, len(grpcResp.Results))
+			for _, result := range grpcResp.Results {
+				highlights := make([]map[string]interface{}, 0, len(result.Highlights))
+				for _, highlight := range result.Highlights {
+					highlights = append(highlights, map[string]interface{}{
+						"start":  highlight.Start,
+						"length": highlight.Length,
+					})
+				}
+				results = append(results, map[string]interface{}{
+					"message":    messageJSON(result.Message),
+					"snippet":    result.Snippet,
+					"highlights": highlights,
+				})
+			}
+			return map[string]interface{}{
+				"results":    results,
+				"nextCursor": grpcResp.NextCursor,
+			}, nil
+		},
+	)
+}
+
+// conversationJSON maps a conversation to its JSON representation
+func conversationJSON(conversation *messageServiceProto.Conversation) map[string]interface{} {
+	participantIDs := conversation.ParticipantIds
+	if participantIDs == nil {
+		participantIDs = []int32{}
+	}
+	members := make([]map[string]interface{}, 0, len(conversation.Members))
+	for _, member := range conversation.Members {
+		members = append(members, map[string]interface{}{
+			"userId":   member.UserId,
+			"role":     member.Role,
+			"joinedAt": member.JoinedAt,
+		})
+	}
+	return map[string]interface{}{
+		"conversationId": conversation.ConversationId,
+		"kind":           conversation.Kind,
+		"title":          conversation.Title,
+		"participantIds": participantIDs,
+		"members":        members,
+		"lastMessage":    messageJSON(conversation.LastMessage),
+		"createdAt":      conversation.CreatedAt,
+	}
+}
+
+// messageJSON maps a message to its JSON representation, nil stays nil
+func messageJSON(message *messageServiceProto.Message) map[string]interface{} {
+	if message == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"messageId":      message.MessageId,
+		"conversationId": message.ConversationId,
+		"senderId":       message.SenderId,
+		"text":           message.Text,
+		"createdAt":      message.CreatedAt,
+		"editedAt":       message.EditedAt,
+		"deleted":        message.Deleted,
+		"replyTo":        quoteJSON(message.ReplyTo),
+		"threadRootId":   message.ThreadRootId,
+		"reactions":      reactionsJSON(message.Reactions),
+		"thread":         threadJSON(message.Thread),
+		"attachments":    attachmentsJSON(message.Attachments),
+	}
+}
+
+func attachmentsJSON(attachments []*messageServiceProto.Attachment) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(attachments))
+	for _, attachment := range attachments {
+		result = append(result, attachmentJSON(attachment))
+	}
+	return result
+}
+
+// quoteJSON maps the quote of a replied-to message, nil stays nil. Only the
+// ID is set outside of the response to sending the reply.
+func quoteJSON(quote *messageServiceProto.Quote) map[string]interface{} {
+	if quote == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"messageId": quote.MessageId,
+		"senderId":  quote.SenderId,
+		"text":      quote.Text,
+		"deleted":   quote.Deleted,
+	}
+}
+
+// threadJSON maps the summary of a thread, nil stays nil
+func threadJSON(thread *messageServiceProto.ThreadSummary) map[string]interface{} {
+	if thread == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"replyCount":  thread.ReplyCount,
+		"lastReplyAt": thread.LastReplyAt,
+		"unreadCount": thread.UnreadCount,
+	}
+}
+
+// reactionsJSON maps the reaction counts of a message, most used first
+func reactionsJSON(counts []*messageServiceProto.ReactionCount) []map[string]interface{} {
+	reactions := make([]map[string]interface{}, 0, len(counts))
+	for _, count := range counts {
+		reactions = append(reactions, map[string]interface{}{
+			"emoji":       count.Emoji,
+			"count":       count.Count,
+			"reactedByMe": count.ReactedByMe,
+		})
+	}
+	return reactions
+}
+
+// reactionResponseJSON maps the reactions to a message after one changed
+func reactionResponseJSON(resp interface{}) (map[string]interface{}, error) {
+	grpcResp := resp.(*messageServiceProto.ReactionResponse)
+	return map[string]interface{}{
+		"messageId": grpcResp.MessageId,
+		"reactions": reactionsJSON(grpcResp.Reactions),
+	}, nil
+}
+
+// pageSizeParam reads the optional pageSize query parameter, answering with
+// an error if it isn't a number
+func pageSizeParam(w http.ResponseWriter, r *http.Request) (int32, bool) {
+	value := r.URL.Query().Get("pageSize")
+	if value == "" {
+		return 0, true
+	}
+	pageSize, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || pageSize < 0 {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid page size",
+			middleware.ErrorDetail{Field: "pageSize", Description: "must be a non-negative integer"})
+		return 0, false
+	}
+	return int32(pageSize), true
+}
+
+// queryIntParam reads an optional non-negative integer query parameter,
+// answering with an error if it isn't one. Absent parameters read as 0.
+func queryIntParam(w http.ResponseWriter, r *http.Request, name string, bitSize int) (int64, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, true
+	}
+	number, err := strconv.ParseInt(value, 10, bitSize)
+	if err != nil || number < 0 {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid "+name,
+			middleware.ErrorDetail{Field: name, Description: "must be a non-negative integer"})
+		return 0, false
+	}
+	return number, true
+}
+
+// idParam reads a positive integer ID from the path, answering with an
+// error if it isn't one. bitSize is 32 for user IDs and 64 for the rest.
+func idParam(w http.ResponseWriter, r *http.Request, name string, bitSize int) (int64, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)[name], 10, bitSize)
+	if err != nil || id <= 0 {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid "+name,
+			middleware.ErrorDetail{Field: name, Description: "must be a positive integer"})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"api-gateway/middleware"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPresenceUsers is the largest number of users asked for at once
+const maxPresenceUsers = 100
+
+// presenceClient calls notification-service, which tracks presence
+var presenceClient = &http.Client{Timeout: 10 * time.Second}
+
+// presence is a user's presence as returned by notification-service
+type presence struct {
+	UserID   string     `json:"user_id"`
+	Status   string     `json:"status"`
+	LastSeen *time.Time `json:"last_seen"`
+}
+
+// GetPresence returns the online, away or offline status of the users given
+// as user_ids, with the last-seen time of offline users that don't hide it
+func (h *Handler) GetPresence(w http.ResponseWriter, r *http.Request) {
+	userIDs := strings.Split(r.URL.Query().Get("user_ids"), ",")
+	if len(userIDs) > maxPresenceUsers {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid user_ids",
+			middleware.ErrorDetail{Field: "user_ids", Description: "must list at most 100 users"})
+		return
+	}
+	for _, userID := range userIDs {
+		if id, err := strconv.ParseInt(userID, 10, 32); err != nil || id <= 0 {
+			middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid user_ids",
+				middleware.ErrorDetail{Field: "user_ids", Description: "must be positive integers separated by commas"})
+			return
+		}
+	}
+
+	query := url.Values{"user_ids": {strings.Join(userIDs, ",")}}
+	var body struct {
+		Presence []presence `json:"presence"`
+	}
+	if !h.callPresence(w, r, http.MethodGet, "/presence?"+query.Encode(), nil, &body) {
+		return
+	}
+
+	presences := make([]map[string]interface{}, 0, len(body.Presence))
+	for _, userPresence := range body.Presence {
+		userID, _ := strconv.Atoi(userPresence.UserID)
+		var lastSeen interface{}
+		if userPresence.LastSeen != nil {
+			lastSeen = userPresence.LastSeen.Unix()
+		}
+		presences = append(presences, map[string]interface{}{
+			"userId":   userID,
+			"status":   userPresence.Status,
+			"lastSeen": lastSeen,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"presence": presences})
+}
+
+// UpdatePresenceSettings lets the caller hide their last-seen time
+func (h *Handler) UpdatePresenceSettings(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		HideLastSeen *bool `json:"hideLastSeen"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.HideLastSeen == nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload",
+			middleware.ErrorDetail{Field: "hideLastSeen", Description: "must be a boolean"})
+		return
+	}
+
+	payload, _ := json.Marshal(map[string]bool{"hide_last_seen": *request.HideLastSeen})
+	var body struct {
+		HideLastSeen bool `json:"hide_last_seen"`
+	}
+	if !h.callPresence(w, r, http.MethodPut, "/presence/settings", payload, &body) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"hideLastSeen": body.HideLastSeen})
+}
+
+// callPresence forwards the request to notification-service on behalf of
+// the caller, whose access token it verifies, and decodes the response.
+// Failures are answered here, in which case it returns false.
+func (h *Handler) callPresence(w http.ResponseWriter, r *http.Request, method, path string, payload []byte, response interface{}) bool {
+	requestID := middleware.RequestIDFromContext(r.Context())
+	ctx, cancel := context.WithTimeout(r.Context(), presenceClient.Timeout)
+	defer cancel()
+
+	upstream, err := http.NewRequestWithContext(ctx, method, "http://"+h.Config.NotificationServiceURL+path, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("Request %s failed: %v", requestID, err)
+		middleware.WriteError(w, r, http.StatusInternalServerError, middleware.CodeInternal, "internal error")
+		return false
+	}
+	upstream.Header.Set("Authorization", r.Header.Get("Authorization"))
+	upstream.Header.Set(middleware.RequestIDHeader, requestID)
+	upstream.Header.Set("Content-Type", "application/json")
+
+	resp, err := presenceClient.Do(upstream)
+	if err != nil {
+		log.Printf("Request %s failed: %v", requestID, err)
+		middleware.WriteError(w, r, http.StatusServiceUnavailable, middleware.CodeUnavailable, "service temporarily unavailable")
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		json.Unmarshal(body, &failure)
+		switch resp.StatusCode {
+		case http.StatusBadRequest:
+			middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, failure.Error)
+		case http.StatusUnauthorized:
+			middleware.WriteError(w, r, http.StatusUnauthorized, middleware.CodeUnauthenticated, failure.Error)
+		case http.StatusNotFound:
+			middleware.WriteError(w, r, http.StatusNotFound, middleware.CodeNotFound, failure.Error)
+		default:
+			log.Printf("Request %s failed: notification service answered %d: %s", requestID, resp.StatusCode, body)
+			middleware.WriteError(w, r, http.StatusServiceUnavailable, middleware.CodeUnavailable, "service temporarily unavailable")
+		}
+		return false
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		log.Printf("Request %s failed: invalid notification service response: %v", requestID, err)
+		middleware.WriteError(w, r, http.StatusBadGateway, middleware.CodeBadGateway, "invalid upstream response")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	userServiceProto "api-gateway/proto/user_service"
+	"api-gateway/storage"
+	"context"
+	"encoding/json"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxProfileSize bounds the body of profile updates
+const maxProfileSize = 16 << 10
+
+// profileFields are the fields of a profile, which PATCH /me may change and
+// GET /users/{id} may be limited to
+var profileFields = []string{"displayName", "bio", "avatarAttachmentId", "locale", "timeZone"}
+
+// GetUser returns the user given in the path with their profile. The
+// fields query parameter limits the profile to the listed fields, separated
+// by commas.
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := idParam(w, r, "id", 32)
+	if !ok {
+		return
+	}
+	h.getUser(w, r, int32(userID))
+}
+
+// GetMe returns the caller with their profile
+func (h *Handler) GetMe(w http.ResponseWriter, r *http.Request) {
+	h.getUser(w, r, middleware.UserIDFromContext(r.Context()))
+}
+
+func (h *Handler) getUser(w http.ResponseWriter, r *http.Request, userID int32) {
+	grpcReq := &userServiceProto.GetUserRequest{
+		UserId:   userID,
+		ViewerId: middleware.UserIDFromContext(r.Context()),
+	}
+	var fields []string
+	if query := r.URL.Query().Get("fields"); query != "" {
+		fields = strings.Split(query, ",")
+		grpcReq.ReadMask = &fieldmaskpb.FieldMask{Paths: fields}
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.GetUser(ctx, req.(*userServiceProto.GetUserRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.GetUserResponse)
+			user := h.userJSON(grpcResp.User)
+			if len(fields) > 0 {
+				for _, field := range profileFields {
+					if !slices.Contains(fields, field) {
+						delete(user, field)
+					}
+				}
+				if !slices.Contains(fields, "avatarAttachmentId") {
+					delete(user, "avatarUrl")
+				}
+			}
+			return map[string]interface{}{
+				"user": user,
+			}, nil
+		},
+	)
+}
+
+// SearchUsers finds users by the start of their name or display name, or
+// by names resembling the query q, best matches first
+func (h *Handler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	grpcReq := &userServiceProto.SearchUsersRequest{
+		UserId: middleware.UserIDFromContext(r.Context()),
+		Query:  r.URL.Query().Get("q"),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	var ok bool
+	if grpcReq.PageSize, ok = pageSizeParam(w, r); !ok {
+		return
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.SearchUsers(ctx, req.(*userServiceProto.SearchUsersRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.SearchUsersResponse)
+			users := make([]map[string]interface{}, 0, len(grpcResp.Users))
+			for _, user := range grpcResp.Users {
+				users = append(users, h.userJSON(user))
+			}
+			return map[string]interface{}{
+				"users":      users,
+				"nextCursor": grpcResp.NextCursor,
+			}, nil
+		},
+	)
+}
+
+// BlockUser hides the user given in the path and the caller from each other
+func (h *Handler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	blockedUserID, ok := idParam(w, r, "id", 32)
+	if !ok {
+		return
+	}
+	grpcReq := &userServiceProto.BlockUserRequest{
+		UserId:        middleware.UserIDFromContext(r.Context()),
+		BlockedUserId: int32(blockedUserID),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.BlockUser(ctx, req.(*userServiceProto.BlockUserRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.BlockUserResponse)
+			return map[string]interface{}{
+				"message": grpcResp.Message,
+			}, nil
+		},
+	)
+}
+
+// UnblockUser lifts the caller's block of the user given in the path
+func (h *Handler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	blockedUserID, ok := idParam(w, r, "id", 32)
+	if !ok {
+		return
+	}
+	grpcReq := &userServiceProto.UnblockUserRequest{
+		UserId:        middleware.UserIDFromContext(r.Context()),
+		BlockedUserId: int32(blockedUserID),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.UnblockUser(ctx, req.(*userServiceProto.UnblockUserRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.UnblockUserResponse)
+			return map[string]interface{}{
+				"message": grpcResp.Message,
+			}, nil
+		},
+	)
+}
+
+// UpdateMe changes the fields of the caller's profile present in the body,
+// leaving the others as they are. Null or empty values clear a field. The
+// avatar is given as an image attachment the caller uploaded.
+func (h *Handler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProfileSize))
+	var present map[string]json.RawMessage
+	if err == nil {
+		err = json.Unmarshal(body, &present)
+	}
+	var profile struct {
+		DisplayName        string `json:"displayName"`
+		Bio                string `json:"bio"`
+		AvatarAttachmentID int64  `json:"avatarAttachmentId"`
+		Locale             string `json:"locale"`
+		TimeZone           string `json:"timeZone"`
+	}
+	if err == nil {
+		err = json.Unmarshal(body, &profile)
+	}
+	if err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
+		return
+	}
+
+	var details []middleware.ErrorDetail
+	for field := range present {
+		if !slices.Contains(profileFields, field) {
+			details = append(details, middleware.ErrorDetail{Field: field, Description: "is not a profile field"})
+		}
+	}
+	if len(details) > 0 {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload", details...)
+		return
+	}
+	if len(present) == 0 {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "no profile fields given")
+		return
+	}
+
+	grpcReq := &userServiceProto.UpdateProfileRequest{
+		UserId: middleware.UserIDFromContext(r.Context()),
+		Profile: &userServiceProto.Profile{
+			DisplayName:        profile.DisplayName,
+			Bio:                profile.Bio,
+			AvatarAttachmentId: profile.AvatarAttachmentID,
+			Locale:             profile.Locale,
+			TimeZone:           profile.TimeZone,
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{},
+	}
+	for _, field := range profileFields {
+		if _, ok := present[field]; ok {
+			grpcReq.UpdateMask.Paths = append(grpcReq.UpdateMask.Paths, field)
+		}
+	}
+	if _, ok := present["avatarAttachmentId"]; ok && profile.AvatarAttachmentID > 0 {
+		if grpcReq.AvatarKey, ok = h.resolveAvatar(w, r, profile.AvatarAttachmentID); !ok {
+			return
+		}
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.UpdateProfile(ctx, req.(*userServiceProto.UpdateProfileRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.UpdateProfileResponse)
+			return map[string]interface{}{
+				"user": h.userJSON(grpcResp.User),
+			}, nil
+		},
+	)
+}
+
+// resolveAvatar returns the storage key of the thumbnail of the attachment
+// chosen as the caller's avatar, which must be an image they uploaded, so
+// that files shared in conversations can't be made public. The attachment
+// is claimed, so it isn't purged for never being sent. Failures are
+// answered here, in which case it returns false.
+func (h *Handler) resolveAvatar(w http.ResponseWriter, r *http.Request, attachmentID int64) (string, bool) {
+	userID := middleware.UserIDFromContext(r.Context())
+	ctx := metadata.AppendToOutgoingContext(r.Context(), "x-request-id", middleware.RequestIDFromContext(r.Context()))
+	resp, err := h.MessageClient.GetAttachment(ctx, &messageServiceProto.GetAttachmentRequest{
+		UserId:       userID,
+		AttachmentId: attachmentID,
+	})
+	if err != nil {
+		writeGrpcError(w, r, err)
+		return "", false
+	}
+
+	if resp.Attachment.UploaderId != userID || resp.ThumbnailKey == "" {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid avatar",
+			middleware.ErrorDetail{Field: "avatarAttachmentId", Description: "must be an image uploaded by you"})
+		return "", false
+	}
+
+	_, err = h.MessageClient.ClaimAttachment(ctx, &messageServiceProto.ClaimAttachmentRequest{
+		UserId:       userID,
+		AttachmentId: attachmentID,
+	})
+	if err != nil {
+		writeGrpcError(w, r, err)
+		return "", false
+	}
+	return resp.ThumbnailKey, true
+}
+
+// userJSON maps a user to its JSON representation, with a download URL of
+// their avatar
+func (h *Handler) userJSON(user *userServiceProto.User) map[string]interface{} {
+	profile := user.GetProfile()
+	var avatarURL, avatarAttachmentID interface{}
+	if user.AvatarKey != "" {
+		avatarURL, _ = h.URLSigner.Sign(user.AvatarKey, storage.ThumbnailContentType, time.Now())
+		avatarAttachmentID = profile.GetAvatarAttachmentId()
+	}
+	return map[string]interface{}{
+		"userId":             user.UserId,
+		"name":               user.Name,
+		"displayName":        profile.GetDisplayName(),
+		"bio":                profile.GetBio(),
+		"avatarAttachmentId": avatarAttachmentID,
+		"avatarUrl":          avatarURL,
+		"locale":             profile.GetLocale(),
+		"timeZone":           profile.GetTimeZone(),
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"api-gateway/middleware"
+	userServiceProto "api-gateway/proto/user_service"
+	"context"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	grpcReq := &userServiceProto.LogoutRequest{
+		UserId:    middleware.UserIDFromContext(r.Context()),
+		SessionId: middleware.SessionIDFromContext(r.Context()),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.Logout(ctx, req.(*userServiceProto.LogoutRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.LogoutResponse)
+			return map[string]interface{}{
+				"message": grpcResp.Message,
+			}, nil
+		},
+	)
+}
+
+func (h *Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	grpcReq := &userServiceProto.ListSessionsRequest{
+		UserId:           middleware.UserIDFromContext(r.Context()),
+		CurrentSessionId: middleware.SessionIDFromContext(r.Context()),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.ListSessions(ctx, req.(*userServiceProto.ListSessionsRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.ListSessionsResponse)
+			sessions := make([]map[string]interface{}, 0, len(grpcResp.Sessions))
+			for _, session := range grpcResp.Sessions {
+				sessions = append(sessions, map[string]interface{}{
+					"sessionId":  session.SessionId,
+					"deviceName": session.DeviceName,
+					"ipAddress":  session.IpAddress,
+					"userAgent":  session.UserAgent,
+					"createdAt":  session.CreatedAt,
+					"lastUsedAt": session.LastUsedAt,
+					"current":    session.Current,
+				})
+			}
+			return map[string]interface{}{
+				"sessions": sessions,
+			}, nil
+		},
+	)
+}
+
+// RevokeSession signs out the session given in the path, or every other
+// session of the user when no session is given
+func (h *Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	sessionID := mux.Vars(r)["id"]
+	grpcReq := &userServiceProto.RevokeSessionRequest{
+		UserId:           middleware.UserIDFromContext(r.Context()),
+		CurrentSessionId: middleware.SessionIDFromContext(r.Context()),
+		SessionId:        sessionID,
+		AllOtherSessions: sessionID == "",
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.RevokeSession(ctx, req.(*userServiceProto.RevokeSessionRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.RevokeSessionResponse)
+			return map[string]interface{}{
+				"revokedSessions": grpcResp.RevokedSessions,
+				"message":         grpcResp.Message,
+			}, nil
+		},
+	)
+}
+
+// DeactivateMe deactivates the caller's account and signs out all its sessions
+func (h *Handler) DeactivateMe(w http.ResponseWriter, r *http.Request) {
+	grpcReq := &userServiceProto.DeactivateUserRequest{
+		UserId: middleware.UserIDFromContext(r.Context()),
+	}
+
+	forwardGrpcRequest(
+		w,
+		r,
+		grpcReq,
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return h.UserClient.DeactivateUser(ctx, req.(*userServiceProto.DeactivateUserRequest))
+		},
+		func(resp interface{}) (map[string]interface{}, error) {
+			grpcResp := resp.(*userServiceProto.DeactivateUserResponse)
+			return map[string]interface{}{
+				"revokedSessions": grpcResp.RevokedSessions,
+				"message":         grpcResp.Message,
+			}, nil
+		},
+	)
+}
+
+// clientIP returns the originating client address. X-Forwarded-For is only
+// honored when the peer is a trusted proxy, and is read from the right, so
+// that addresses made up by the client are skipped: the first address not
+// belonging to a trusted proxy is the client's.
+func (h *Handler) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !h.isTrustedProxy(host) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if _, err := netip.ParseAddr(hops[i]); err != nil {
+			// Everything left of a malformed entry is unreliable
+			return host
+		}
+		host = hops[i]
+		if !h.isTrustedProxy(host) {
+			return host
+		}
+	}
+	return host
+}
+
+// isTrustedProxy tells whether the address belongs to a configured proxy
+func (h *Handler) isTrustedProxy(address string) bool {
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range h.Config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
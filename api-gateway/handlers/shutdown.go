@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gorilla/websocket"
+	"log"
+	"time"
+)
+
+// trackProxy registers the client side of an open WebSocket proxy. The
+// returned function unregisters it once the proxy has finished.
+func (h *Handler) trackProxy(clientConn *websocket.Conn) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.proxies[clientConn] = struct{}{}
+	h.proxiesDone.Add(1)
+	return func() {
+		h.mu.Lock()
+		delete(h.proxies, clientConn)
+		h.mu.Unlock()
+		h.proxiesDone.Done()
+	}
+}
+
+// Shutdown sends a going away close frame to the clients of every open
+// WebSocket proxy and waits for the proxies to finish, then closes the
+// service connections and flushes the Kafka writer
+func (h *Handler) Shutdown(ctx context.Context) {
+	h.mu.Lock()
+	for clientConn := range h.proxies {
+		message := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+		clientConn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		clientConn.Close()
+	}
+	h.mu.Unlock()
+
+	proxiesDone := make(chan struct{})
+	go func() {
+		h.proxiesDone.Wait()
+		close(proxiesDone)
+	}()
+	select {
+	case <-proxiesDone:
+	case <-ctx.Done():
+		log.Println("WebSocket proxies did not finish in time")
+	}
+
+	if err := h.userConn.Close(); err != nil {
+		log.Printf("Failed to close user service connection: %v", err)
+	}
+	if err := h.messageConn.Close(); err != nil {
+		log.Printf("Failed to close message service connection: %v", err)
+	}
+	if err := h.KafkaWriter.Close(); err != nil {
+		log.Printf("Failed to flush Kafka writer: %v", err)
+	}
+}
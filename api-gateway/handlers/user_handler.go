@@ -2,24 +2,50 @@ package handlers
 
 import (
 	"api-gateway/config"
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	notificationProto "api-gateway/proto/notification"
 	userServiceProto "api-gateway/proto/user_service"
+	"api-gateway/storage"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"github.com/segmentio/kafka-go"
 	"google.golang.org/grpc"
 	_ "google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	_ "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type Handler struct {
-	Config      *config.Config
-	UserClient  userServiceProto.UserServiceClient
-	KafkaWriter *kafka.Writer
+	Config        *config.Config
+	UserClient    userServiceProto.UserServiceClient
+	MessageClient messageServiceProto.MessageServiceClient
+	KafkaWriter   *kafka.Writer
+	Storage       storage.Storage
+	URLSigner     *storage.URLSigner
+
+	userConn    *grpc.ClientConn
+	messageConn *grpc.ClientConn
+	mu          sync.Mutex                   // Protects `proxies`
+	proxies     map[*websocket.Conn]struct{} // Client connections of open WebSocket proxies
+	proxiesDone sync.WaitGroup
 }
 
 func (h *Handler) init() {
@@ -30,13 +56,44 @@ func (h *Handler) init() {
 	if connection, err = grpc.NewClient(h.Config.UserServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials())); err != nil {
 		log.Fatalf("Failed to connect to user service: %v", err)
 	}
+	h.userConn = connection
 	h.UserClient = userServiceProto.NewUserServiceClient(connection)
 
+	// init message service client
+	if connection, err = grpc.NewClient(h.Config.MessageServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials())); err != nil {
+		log.Fatalf("Failed to connect to message service: %v", err)
+	}
+	h.messageConn = connection
+	h.MessageClient = messageServiceProto.NewMessageServiceClient(connection)
+	h.proxies = make(map[*websocket.Conn]struct{})
+
 	// init kafka writer
 	h.KafkaWriter = &kafka.Writer{
 		Addr:     kafka.TCP(h.Config.KafkaServiceURL),
 		Balancer: &kafka.LeastBytes{},
 	}
+
+	// init attachment storage
+	if h.Config.StorageBackend == "s3" {
+		h.Storage = storage.NewS3Storage(storage.S3Config{
+			Endpoint:  h.Config.S3Endpoint,
+			Region:    h.Config.S3Region,
+			Bucket:    h.Config.S3Bucket,
+			AccessKey: h.Config.S3AccessKey,
+			SecretKey: h.Config.S3SecretKey,
+		}, &http.Client{Timeout: h.Config.S3Timeout})
+	} else if h.Storage, err = storage.NewFileStorage(h.Config.StoragePath); err != nil {
+		log.Fatalf("Failed to open attachment storage: %v", err)
+	}
+	secret := []byte(h.Config.DownloadURLSecret)
+	if len(secret) == 0 {
+		log.Println("DOWNLOAD_URL_SECRET is unset, download URLs will only work on this replica until it restarts")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate download URL secret: %v", err)
+		}
+	}
+	h.URLSigner = storage.NewURLSigner(secret, h.Config.DownloadURLTTL)
 }
 
 func NewHandler(cfg *config.Config) *Handler {
@@ -46,19 +103,27 @@ func NewHandler(cfg *config.Config) *Handler {
 }
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	var loginReq userServiceProto.LoginRequest
+	var loginReq struct {
+		Name       string `json:"name"`
+		Password   string `json:"password"`
+		DeviceName string `json:"deviceName"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
 		return
 	}
 
 	grpcReq := &userServiceProto.LoginRequest{
-		Name:     loginReq.Name,
-		Password: loginReq.Password,
+		Name:       loginReq.Name,
+		Password:   loginReq.Password,
+		DeviceName: loginReq.DeviceName,
+		IpAddress:  h.clientIP(r),
+		UserAgent:  r.UserAgent(),
 	}
 
 	forwardGrpcRequest(
 		w,
+		r,
 		grpcReq,
 		func(ctx context.Context, req interface{}) (interface{}, error) {
 			return h.UserClient.Login(ctx, req.(*userServiceProto.LoginRequest))
@@ -71,6 +136,7 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 				"accessTokenExpiresAt":  grpcResp.AccessTokenExpiresAt,
 				"refreshToken":          grpcResp.RefreshToken,
 				"refreshTokenExpiresAt": grpcResp.RefreshTokenExpiresAt,
+				"sessionId":             grpcResp.SessionId,
 				"message":               grpcResp.Message,
 			}, nil
 		},
@@ -78,9 +144,12 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
-	var registerReq userServiceProto.RegisterRequest
+	var registerReq struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&registerReq); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
 		return
 	}
 
@@ -91,6 +160,7 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 
 	forwardGrpcRequest(
 		w,
+		r,
 		grpcReq,
 		func(ctx context.Context, req interface{}) (interface{}, error) {
 			return h.UserClient.Register(ctx, req.(*userServiceProto.RegisterRequest))
@@ -106,21 +176,25 @@ func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
-	var refreshTokenReq userServiceProto.RefreshTokenRequest
+	var refreshTokenReq struct {
+		UserID       int32  `json:"userId"`
+		RefreshToken string `json:"refreshToken"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&refreshTokenReq); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid request payload")
 		return
 	}
 
 	// Prepare the gRPC request
 	grpcReq := &userServiceProto.RefreshTokenRequest{
-		UserId:       refreshTokenReq.UserId,
+		UserId:       refreshTokenReq.UserID,
 		RefreshToken: refreshTokenReq.RefreshToken,
 	}
 
 	// Forward the request to the user service
 	forwardGrpcRequest(
 		w,
+		r,
 		grpcReq,
 		func(ctx context.Context, req interface{}) (interface{}, error) {
 			return h.UserClient.RefreshToken(ctx, req.(*userServiceProto.RefreshTokenRequest))
@@ -138,6 +212,9 @@ func (h *Handler) RefreshToken(w http.ResponseWriter, r *http.Request) {
 	)
 }
 
+// envelopeVersion is the version of the notification envelopes written to Kafka
+const envelopeVersion = 1
+
 func (h *Handler) TestNotification(w http.ResponseWriter, r *http.Request) {
 	type request struct {
 		UserID  string `json:"user_id"`
@@ -146,23 +223,47 @@ func (h *Handler) TestNotification(w http.ResponseWriter, r *http.Request) {
 
 	var req request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid input", http.StatusBadRequest)
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid input")
 		return
 	}
 
-	msg, err := json.Marshal(req)
+	payload, err := structpb.NewStruct(map[string]interface{}{"text": req.Message})
+	if err != nil {
+		middleware.WriteError(w, r, http.StatusBadRequest, middleware.CodeInvalidArgument, "invalid input")
+		return
+	}
+	eventID, err := newEventID()
 	if err != nil {
-		http.Error(w, "Failed to serialize message", http.StatusInternalServerError)
+		log.Printf("Failed to generate event ID: %v", err)
+		middleware.WriteError(w, r, http.StatusInternalServerError, middleware.CodeInternal, "internal error")
+		return
+	}
+	envelope := &notificationProto.Envelope{
+		Id:         eventID,
+		Type:       notificationProto.EventType_EVENT_TYPE_CHAT_MESSAGE,
+		Version:    envelopeVersion,
+		Sender:     strconv.Itoa(int(middleware.UserIDFromContext(r.Context()))),
+		Recipients: []string{req.UserID},
+		CreatedAt:  timestamppb.Now(),
+		Payload:    payload,
+	}
+
+	msg, err := proto.Marshal(envelope)
+	if err != nil {
+		log.Printf("Failed to serialize notification: %v", err)
+		middleware.WriteError(w, r, http.StatusInternalServerError, middleware.CodeInternal, "internal error")
 		return
 	}
 
 	err = h.KafkaWriter.WriteMessages(r.Context(), kafka.Message{
-		Topic: "default",
-		Key:   []byte(req.UserID), // Use UserID as key for partitioning
-		Value: msg,
+		Topic:   "default",
+		Key:     []byte(req.UserID), // Use UserID as key for partitioning
+		Value:   msg,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/x-protobuf")}},
 	})
 	if err != nil {
-		http.Error(w, "Failed to send notification: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Failed to send notification: %v", err)
+		middleware.WriteError(w, r, http.StatusServiceUnavailable, middleware.CodeUnavailable, "service temporarily unavailable")
 		return
 	}
 
@@ -170,75 +271,161 @@ func (h *Handler) TestNotification(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Notification sent to Kafka"))
 }
 
+func newEventID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-// ProxyWebSocket redirects /ws requests to establish websocket connection
+// ProxyWebSocket redirects /ws requests to establish websocket connection.
+// Authentication is left to the notification service, so the client's
+// credentials are forwarded along with the negotiated subprotocol.
 func (h *Handler) ProxyWebSocket(w http.ResponseWriter, r *http.Request) {
-	// Upgrade the client connection
-	clientConn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Printf("Failed to upgrade client WebSocket: %v", err)
-		http.Error(w, "Failed to upgrade WebSocket", http.StatusInternalServerError)
-		return
+	backendHeader := http.Header{}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		backendHeader.Set("Authorization", authorization)
+	}
+	if protocols := websocket.Subprotocols(r); len(protocols) > 0 {
+		backendHeader.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
 	}
-	defer clientConn.Close()
 
 	// Dial the backend Notification Service
 	notificationURL := url.URL{Scheme: "ws", Host: h.Config.NotificationServiceURL, Path: "/ws", RawQuery: r.URL.RawQuery}
-	backendConn, _, err := websocket.DefaultDialer.Dial(notificationURL.String(), nil)
+	backendConn, backendResp, err := websocket.DefaultDialer.Dial(notificationURL.String(), backendHeader)
 	if err != nil {
 		log.Printf("Failed to connect to backend WebSocket: %v", err)
-		http.Error(w, "Failed to connect to backend WebSocket", http.StatusInternalServerError)
+		if backendResp != nil && backendResp.StatusCode == http.StatusUnauthorized {
+			middleware.WriteError(w, r, http.StatusUnauthorized, middleware.CodeUnauthenticated, "invalid token")
+			return
+		}
+		middleware.WriteError(w, r, http.StatusBadGateway, middleware.CodeBadGateway, "failed to connect to backend WebSocket")
 		return
 	}
 	defer backendConn.Close()
 
+	var responseHeader http.Header
+	if subprotocol := backendConn.Subprotocol(); subprotocol != "" {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
+	}
+
+	// Upgrade the client connection
+	clientConn, err := upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		log.Printf("Failed to upgrade client WebSocket: %v", err)
+		return
+	}
+	defer clientConn.Close()
+	defer h.trackProxy(clientConn)()
+
 	// Proxy messages between client and backend
-	errChan := make(chan error, 2)
+	errChan := make(chan proxyError, 4)
+	done := make(chan struct{})
+	defer close(done)
+
+	pingInterval, pongTimeout := h.Config.WebSocketPingInterval, h.Config.WebSocketPongTimeout
+	extendReadDeadlineOnPong(clientConn, pongTimeout)
+	extendReadDeadlineOnPong(backendConn, pongTimeout)
+	go keepAlive(clientConn, "client", pingInterval, done, errChan)
+	go keepAlive(backendConn, "backend", pingInterval, done, errChan)
 
-	go proxyMessages(clientConn, backendConn, errChan)
-	go proxyMessages(backendConn, clientConn, errChan)
+	go proxyMessages(clientConn, backendConn, "client", "backend", pongTimeout, errChan)
+	go proxyMessages(backendConn, clientConn, "backend", "client", pongTimeout, errChan)
 
-	<-errChan // Wait for any error
+	// Wait for any error
+	proxyErr := <-errChan
+	log.Printf("Closing WebSocket proxy, %s connection %s", proxyErr.side, proxyErr.reason())
+}
+
+// proxyError tells which side of the proxy failed
+type proxyError struct {
+	side string
+	err  error
+}
+
+func (e proxyError) reason() string {
+	var netErr net.Error
+	switch {
+	case errors.As(e.err, &netErr) && netErr.Timeout():
+		return "reaped after pong timeout"
+	case websocket.IsCloseError(e.err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+		return "closed normally"
+	default:
+		return fmt.Sprintf("failed: %v", e.err)
+	}
+}
+
+// extendReadDeadlineOnPong makes reads fail unless a pong or a message
+// arrives within the timeout, so half-open connections don't linger forever
+func extendReadDeadlineOnPong(conn *websocket.Conn, pongTimeout time.Duration) {
+	conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+}
+
+// keepAlive pings the connection until the proxy is done
+func keepAlive(conn *websocket.Conn, side string, pingInterval time.Duration, done chan struct{}, errChan chan proxyError) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingInterval)); err != nil {
+				errChan <- proxyError{side: side, err: err}
+				return
+			}
+		}
+	}
 }
 
-func proxyMessages(src, dest *websocket.Conn, errChan chan error) {
+func proxyMessages(src, dest *websocket.Conn, srcSide, destSide string, pongTimeout time.Duration, errChan chan proxyError) {
 	for {
 		messageType, message, err := src.ReadMessage()
 		if err != nil {
-			errChan <- err
+			errChan <- proxyError{side: srcSide, err: err}
 			return
 		}
+		src.SetReadDeadline(time.Now().Add(pongTimeout))
 		err = dest.WriteMessage(messageType, message)
 		if err != nil {
-			errChan <- err
+			errChan <- proxyError{side: destSide, err: err}
 			return
 		}
 	}
 }
 
-// Helper function to forward requests
+// Helper function to forward requests. The request ID is passed on as
+// metadata, so the services' logs can be matched with the gateway's.
 func forwardGrpcRequest(
 	w http.ResponseWriter,
+	r *http.Request,
 	grpcReq interface{},
 	grpcCall func(context.Context, interface{}) (interface{}, error),
 	responseMapper func(interface{}) (map[string]interface{}, error),
 ) {
-	ctx := context.Background()
+	requestID := middleware.RequestIDFromContext(r.Context())
+	ctx := metadata.AppendToOutgoingContext(r.Context(), "x-request-id", requestID)
 
 	// Call the specified gRPC function
 	grpcResp, err := grpcCall(ctx, grpcReq)
 	if err != nil {
-		http.Error(w, "Request failed: "+err.Error(), http.StatusInternalServerError)
+		writeGrpcError(w, r, err)
 		return
 	}
 
 	// Map the gRPC response to a JSON response
 	response, err := responseMapper(grpcResp)
 	if err != nil {
-		http.Error(w, "Failed to map response: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Request %s failed to map response: %v", requestID, err)
+		middleware.WriteError(w, r, http.StatusInternalServerError, middleware.CodeInternal, "internal error")
 		return
 	}
 
@@ -4,17 +4,22 @@ import (
 	"api-gateway/config"
 	"api-gateway/handlers"
 	"api-gateway/middleware"
+	"context"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
+	"jwks"
+	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
 	cfg := config.LoadConfig()
 	handler := handlers.NewHandler(cfg)
-	defer handler.KafkaWriter.Close()
 
 	router := mux.NewRouter()
 	// Unprotected routes
@@ -27,12 +32,73 @@ func main() {
 
 	// Routes
 	router.HandleFunc("/refresh", handler.RefreshToken).Methods("POST")
+	router.HandleFunc("/logout", handler.Logout).Methods("POST")
+	router.HandleFunc("/sessions", handler.ListSessions).Methods("GET")
+	router.HandleFunc("/sessions", handler.RevokeSession).Methods("DELETE")
+	router.HandleFunc("/sessions/{id}", handler.RevokeSession).Methods("DELETE")
+	router.HandleFunc("/me", handler.GetMe).Methods("GET")
+	router.HandleFunc("/me", handler.UpdateMe).Methods("PATCH")
+	router.HandleFunc("/me/deactivate", handler.DeactivateMe).Methods("POST")
+	userSearchLimiter := middleware.NewRateLimiter(int(cfg.UserSearchLimit), cfg.UserSearchWindow)
+	router.Handle("/users/search", middleware.RateLimit(userSearchLimiter)(http.HandlerFunc(handler.SearchUsers))).Methods("GET")
+	userLookupLimiter := middleware.NewRateLimiter(int(cfg.UserLookupLimit), cfg.UserLookupWindow)
+	router.Handle("/users/{id}", middleware.RateLimit(userLookupLimiter)(http.HandlerFunc(handler.GetUser))).Methods("GET")
+	router.HandleFunc("/users/{id}/block", handler.BlockUser).Methods("POST")
+	router.HandleFunc("/users/{id}/block", handler.UnblockUser).Methods("DELETE")
+	router.HandleFunc("/messages", handler.SendMessage).Methods("POST")
+	router.HandleFunc("/messages/{id}", handler.EditMessage).Methods("PUT")
+	router.HandleFunc("/messages/{id}", handler.DeleteMessage).Methods("DELETE")
+	router.HandleFunc("/messages/{id}/edits", handler.GetEditHistory).Methods("GET")
+	router.HandleFunc("/messages/{id}/reactions", handler.AddReaction).Methods("POST")
+	router.HandleFunc("/messages/{id}/reactions/{emoji}", handler.RemoveReaction).Methods("DELETE")
+	router.HandleFunc("/messages/{id}/thread", handler.GetThread).Methods("GET")
+	router.HandleFunc("/messages/{id}/thread/read", handler.MarkThreadRead).Methods("POST")
+	router.HandleFunc("/attachments", handler.UploadAttachment).Methods("POST")
+	router.HandleFunc("/attachments/{id}", handler.GetAttachment).Methods("GET")
+	router.HandleFunc("/files/{key:.+}", handler.DownloadFile).Methods("GET")
+	router.HandleFunc("/search", handler.SearchMessages).Methods("GET")
+	router.HandleFunc("/conversations", handler.ListConversations).Methods("GET")
+	router.HandleFunc("/conversations/{id}/messages", handler.GetHistory).Methods("GET")
+	router.HandleFunc("/conversations/{id}/read-state", handler.GetReadState).Methods("GET")
+	router.HandleFunc("/groups", handler.CreateGroup).Methods("POST")
+	router.HandleFunc("/groups/{id}/members", handler.AddMembers).Methods("POST")
+	router.HandleFunc("/groups/{id}/members/{userId}", handler.RemoveMember).Methods("DELETE")
+	router.HandleFunc("/groups/{id}/members/{userId}/role", handler.UpdateMemberRole).Methods("PUT")
+	router.HandleFunc("/groups/{id}/owner", handler.TransferOwnership).Methods("PUT")
+	router.HandleFunc("/groups/{id}/leave", handler.LeaveGroup).Methods("POST")
+	router.HandleFunc("/presence", handler.GetPresence).Methods("GET")
+	router.HandleFunc("/presence/settings", handler.UpdatePresenceSettings).Methods("PUT")
 	router.HandleFunc("/send-notification", handler.TestNotification).Methods("POST")
 	router.HandleFunc("/ws", handler.ProxyWebSocket)
 
 	// Apply middleware
-	router.Use(middleware.TokenAuthMiddleware)
+	router.Use(middleware.RequestID)
+	router.Use(middleware.TokenAuthMiddleware(jwks.NewCache(cfg.JWKSURL, cfg.JWKSCacheTTL)))
+
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	go handler.PurgeUnsentAttachments(purgeCtx)
 
 	// Start the API Gateway
-	http.ListenAndServe(":"+os.Getenv("PORT"), router)
+	server := &http.Server{Addr: ":" + os.Getenv("PORT"), Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start API Gateway: %v", err)
+		}
+	}()
+
+	interruption := make(chan os.Signal, 1)
+	signal.Notify(interruption, syscall.SIGINT, syscall.SIGTERM)
+	<-interruption
+
+	log.Println("Shutting down")
+	stopPurge()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Drain in-flight requests before the connections they use are closed
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Failed to shut down server: %v", err)
+	}
+	handler.Shutdown(ctx)
+	log.Println("Shutdown complete")
 }
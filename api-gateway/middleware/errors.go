@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes of the JSON error body. Clients branch on these, so they
+// must stay stable even if the HTTP status or the message changes.
+const (
+	CodeInvalidArgument    = "invalid_argument"
+	CodeUnauthenticated    = "unauthenticated"
+	CodePermissionDenied   = "permission_denied"
+	CodeNotFound           = "not_found"
+	CodeAlreadyExists      = "already_exists"
+	CodeFailedPrecondition = "failed_precondition"
+	CodeResourceExhausted  = "resource_exhausted"
+	CodeUnavailable        = "unavailable"
+	CodeBadGateway         = "bad_gateway"
+	CodeInternal           = "internal"
+)
+
+// ErrorDetail explains what was wrong with a single field of the request
+type ErrorDetail struct {
+	Field       string `json:"field,omitempty"`
+	Description string `json:"description"`
+}
+
+// ErrorResponse is the body of every error returned by the gateway
+type ErrorResponse struct {
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Details   []ErrorDetail `json:"details"`
+	RequestID string        `json:"request_id"`
+}
+
+// WriteError responds with the given status and a JSON error body
+func WriteError(w http.ResponseWriter, r *http.Request, httpStatus int, code, message string, details ...ErrorDetail) {
+	if details == nil {
+		details = []ErrorDetail{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: RequestIDFromContext(r.Context()),
+	})
+}
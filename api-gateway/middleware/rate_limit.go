@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter gives every user a bucket of requests, refilled steadily up
+// to its capacity. Buckets live in memory, so each replica of the gateway
+// limits on its own.
+type RateLimiter struct {
+	capacity float64
+	// Requests added to a bucket per second
+	rate float64
+
+	mu        sync.Mutex // Protects the fields below
+	buckets   map[int32]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter allows limit requests per window to each user, who may
+// spend them in a burst. Both must be positive.
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		capacity: float64(limit),
+		rate:     float64(limit) / window.Seconds(),
+		buckets:  make(map[int32]*bucket),
+	}
+}
+
+// Allow takes a request from the user's bucket. When it is empty, it
+// returns false along with how long until the next request is allowed.
+func (limiter *RateLimiter) Allow(userID int32, now time.Time) (bool, time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.sweep(now)
+	userBucket, ok := limiter.buckets[userID]
+	if !ok {
+		userBucket = &bucket{tokens: limiter.capacity, updated: now}
+		limiter.buckets[userID] = userBucket
+	}
+
+	elapsed := now.Sub(userBucket.updated).Seconds()
+	userBucket.tokens = math.Min(limiter.capacity, userBucket.tokens+max(elapsed, 0)*limiter.rate)
+	userBucket.updated = now
+	if userBucket.tokens < 1 {
+		wait := (1 - userBucket.tokens) / limiter.rate
+		return false, time.Duration(wait * float64(time.Second))
+	}
+	userBucket.tokens--
+	return true, 0
+}
+
+// sweep drops the buckets that have refilled since their last request, as
+// fresh ones are alike, so idle users don't pile up
+func (limiter *RateLimiter) sweep(now time.Time) {
+	refill := time.Duration(limiter.capacity / limiter.rate * float64(time.Second))
+	if now.Sub(limiter.lastSweep) < refill {
+		return
+	}
+	limiter.lastSweep = now
+	for userID, userBucket := range limiter.buckets {
+		if now.Sub(userBucket.updated) >= refill {
+			delete(limiter.buckets, userID)
+		}
+	}
+}
+
+// RateLimit answers requests of users who used up their bucket with 429,
+// telling them when to retry. It must run after the bearer check.
+func RateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := limiter.Allow(UserIDFromContext(r.Context()), time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				WriteError(w, r, http.StatusTooManyRequests, CodeResourceExhausted, "too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+)
+
+// RequestIDHeader carries the ID that ties a response to the gateway and service logs
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds IDs supplied by clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+const requestIDKey contextKey = "request_id"
+
+// RequestID keeps the caller's X-Request-ID or assigns a new one, and echoes
+// it in the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			var err error
+			if requestID, err = newRequestID(); err != nil {
+				log.Printf("Failed to generate request ID: %v", err)
+				WriteError(w, r, http.StatusInternalServerError, CodeInternal, "internal error")
+				return
+			}
+		}
+
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey, requestID)))
+	})
+}
+
+// RequestIDFromContext returns the ID assigned to the request
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// isValidRequestID accepts printable ASCII only, so IDs can be logged and
+// forwarded as headers safely
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, char := range requestID {
+		if char < '!' || char > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrNotFound is returned when no object is stored under the key
+var ErrNotFound = errors.New("object not found")
+
+// Object is the content of a stored file, which the caller must close
+type Object struct {
+	Body io.ReadCloser
+	Size int64
+}
+
+// Storage keeps the files of attachments. Keys are slash-separated paths
+// made of the characters returned by NewKey, content types are kept by the
+// caller.
+type Storage interface {
+	// Put stores size bytes read from body under the key, replacing any
+	// previous object. Nothing is stored if body ends early.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	// Delete removes the object, unknown keys are ignored
+	Delete(ctx context.Context, key string) error
+}
+
+// NewKey returns a fresh, unguessable key for a file uploaded by the user
+func NewKey(userID int32) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%d/%s", userID, hex.EncodeToString(random)), nil
+}
+
+// ValidKey tells whether the key could have been made by NewKey or derived
+// from one, so it can't escape the storage root
+func ValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || strings.Trim(segment, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+const (
+	// ThumbnailContentType is the format thumbnails are encoded in
+	ThumbnailContentType = "image/jpeg"
+	// maxThumbnailSide is the longest side of a thumbnail, in pixels
+	maxThumbnailSide = 320
+	// maxImagePixels bounds the images thumbnails are made of, since
+	// decoding needs memory in proportion to their size
+	maxImagePixels = 16_000_000
+)
+
+// ErrImageTooLarge is returned for images with too many pixels to decode
+var ErrImageTooLarge = errors.New("image too large")
+
+// Thumbnail is a downscaled JPEG of an image, with the image's dimensions
+type Thumbnail struct {
+	Data          []byte
+	Width, Height int
+}
+
+// MakeThumbnail decodes a JPEG, PNG or GIF image and scales it down to fit
+// a square of maxThumbnailSide pixels, averaging the pixels each thumbnail
+// pixel covers. Transparent areas turn white.
+func MakeThumbnail(r io.Reader) (*Thumbnail, error) {
+	var head bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+	source, _, err := image.Decode(io.MultiReader(&head, r))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, errors.New("empty image")
+	}
+	scaledWidth, scaledHeight := width, height
+	if width > maxThumbnailSide || height > maxThumbnailSide {
+		if width >= height {
+			scaledWidth, scaledHeight = maxThumbnailSide, max(1, height*maxThumbnailSide/width)
+		} else {
+			scaledWidth, scaledHeight = max(1, width*maxThumbnailSide/height), maxThumbnailSide
+		}
+	}
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, scaledWidth, scaledHeight))
+	for y := 0; y < scaledHeight; y++ {
+		top, bottom := y*height/scaledHeight, max((y+1)*height/scaledHeight, y*height/scaledHeight+1)
+		for x := 0; x < scaledWidth; x++ {
+			left, right := x*width/scaledWidth, max((x+1)*width/scaledWidth, x*width/scaledWidth+1)
+			var red, green, blue, count uint32
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					// Premultiplied, so drawing over white adds what alpha leaves out
+					r, g, b, a := source.At(bounds.Min.X+sx, bounds.Min.Y+sy).RGBA()
+					red, green, blue = red+r+0xffff-a, green+g+0xffff-a, blue+b+0xffff-a
+					count++
+				}
+			}
+			thumbnail.SetRGBA(x, y, color.RGBA{R: uint8(red / count >> 8), G: uint8(green / count >> 8), B: uint8(blue / count >> 8), A: 255})
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, thumbnail, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return &Thumbnail{Data: encoded.Bytes(), Width: width, Height: height}, nil
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"api-gateway/config"
+	"api-gateway/handlers"
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	userServiceProto "api-gateway/proto/user_service"
+	"api-gateway/storage"
+	"api-gateway/test"
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// attachmentServer routes the attachment endpoints of a gateway keeping
+// files in a temporary directory. Requests are made as user 1.
+type attachmentServer struct {
+	handler *handlers.Handler
+	storage storage.Storage
+	router  *mux.Router
+}
+
+func newAttachmentServer(t *testing.T, client *test.FakeMessageClient) *attachmentServer {
+	files, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	handler := &handlers.Handler{
+		Config: &config.Config{
+			MaxAttachmentSize:       1 << 20,
+			AttachmentTypes:         []string{"image/png", "application/pdf"},
+			DownloadURLTTL:          time.Minute,
+			UnsentAttachmentTTL:     time.Hour,
+			AttachmentPurgeInterval: 10 * time.Millisecond,
+		},
+		MessageClient: client,
+		Storage:       files,
+		URLSigner:     storage.NewURLSigner([]byte("secret"), time.Minute),
+	}
+	router := mux.NewRouter()
+	router.HandleFunc("/attachments", handler.UploadAttachment).Methods("POST")
+	router.HandleFunc("/attachments/{id}", handler.GetAttachment).Methods("GET")
+	router.HandleFunc("/files/{key:.+}", handler.DownloadFile).Methods("GET")
+	return &attachmentServer{handler: handler, storage: files, router: router}
+}
+
+func (s *attachmentServer) serve(method, target string, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, bytes.NewReader(body))
+	request = request.WithContext(middleware.WithUser(request.Context(), 1, "session-1"))
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func (s *attachmentServer) stored(key string) bool {
+	object, err := s.storage.Get(context.Background(), key)
+	if err != nil {
+		return false
+	}
+	object.Body.Close()
+	return true
+}
+
+// pngImage encodes a blank image of the given size
+func pngImage(t *testing.T, width, height int) []byte {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func decodeBody(t *testing.T, recorder *httptest.ResponseRecorder) map[string]interface{} {
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	return body
+}
+
+// TestUploadAttachment checks that an image is stored with a thumbnail and
+// recorded for the uploader under the detected type
+func TestUploadAttachment(t *testing.T) {
+	var recorded *messageServiceProto.CreateAttachmentRequest
+	server := newAttachmentServer(t, &test.FakeMessageClient{
+		CreateAttachmentFunc: func(request *messageServiceProto.CreateAttachmentRequest) (*messageServiceProto.CreateAttachmentResponse, error) {
+			recorded = request
+			return &messageServiceProto.CreateAttachmentResponse{Attachment: &messageServiceProto.Attachment{
+				AttachmentId: 7, FileName: request.FileName, ContentType: request.ContentType, Size: request.Size, HasThumbnail: true,
+			}}, nil
+		},
+	})
+
+	recorder := server.serve(http.MethodPost, "/attachments?name=photo.png", pngImage(t, 640, 480))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.EqualValues(t, 7, decodeBody(t, recorder)["attachment"].(map[string]interface{})["attachmentId"])
+
+	assert.EqualValues(t, 1, recorded.UserId)
+	assert.Equal(t, "photo.png", recorded.FileName)
+	assert.Equal(t, "image/png", recorded.ContentType)
+	assert.True(t, strings.HasPrefix(recorded.StorageKey, "attachments/1/"))
+	assert.Equal(t, recorded.StorageKey+"-thumbnail", recorded.ThumbnailKey)
+	assert.EqualValues(t, 640, recorded.Width)
+	assert.EqualValues(t, 480, recorded.Height)
+	assert.True(t, server.stored(recorded.StorageKey))
+	assert.True(t, server.stored(recorded.ThumbnailKey))
+}
+
+// TestUploadAttachmentRejected checks the uploads refused before anything is
+// stored, and that files are removed when message-service refuses them
+func TestUploadAttachmentRejected(t *testing.T) {
+	var recorded *messageServiceProto.CreateAttachmentRequest
+	server := newAttachmentServer(t, &test.FakeMessageClient{
+		CreateAttachmentFunc: func(request *messageServiceProto.CreateAttachmentRequest) (*messageServiceProto.CreateAttachmentResponse, error) {
+			recorded = request
+			return nil, status.Error(codes.InvalidArgument, "invalid attachment")
+		},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodPost, "/attachments", pngImage(t, 8, 8)).Code)
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodPost, "/attachments?name=empty.png", nil).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, server.serve(http.MethodPost, "/attachments?name=notes.txt", []byte("plain text")).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, server.serve(http.MethodPost, "/attachments?name=big.pdf", make([]byte, 2<<20)).Code)
+	assert.Nil(t, recorded)
+
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodPost, "/attachments?name=photo.png", pngImage(t, 8, 8)).Code)
+	assert.False(t, server.stored(recorded.StorageKey))
+	assert.False(t, server.stored(recorded.ThumbnailKey))
+}
+
+// TestGetAttachmentAndDownload checks that the URLs handed out by
+// GetAttachment serve the files, and that altered URLs don't
+func TestGetAttachmentAndDownload(t *testing.T) {
+	server := newAttachmentServer(t, &test.FakeMessageClient{
+		GetAttachmentFunc: func(request *messageServiceProto.GetAttachmentRequest) (*messageServiceProto.GetAttachmentResponse, error) {
+			switch request.AttachmentId {
+			case 7:
+				return &messageServiceProto.GetAttachmentResponse{
+					Attachment: &messageServiceProto.Attachment{AttachmentId: 7, FileName: "report.pdf", ContentType: "application/pdf"},
+					StorageKey: "attachments/1/report",
+				}, nil
+			case 8:
+				return &messageServiceProto.GetAttachmentResponse{
+					Attachment: &messageServiceProto.Attachment{AttachmentId: 8, FileName: "gone.pdf", ContentType: "application/pdf"},
+					StorageKey: "attachments/1/gone",
+				}, nil
+			}
+			return nil, status.Error(codes.NotFound, "attachment not found")
+		},
+	})
+	content := "%PDF-1.4 report"
+	assert.NoError(t, server.storage.Put(context.Background(), "attachments/1/report", strings.NewReader(content), int64(len(content)), "application/pdf"))
+
+	recorder := server.serve(http.MethodGet, "/attachments/7", nil)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := decodeBody(t, recorder)
+	assert.Nil(t, body["thumbnailUrl"])
+	downloadURL := body["url"].(string)
+
+	download := server.serve(http.MethodGet, downloadURL, nil)
+	assert.Equal(t, http.StatusOK, download.Code)
+	assert.Equal(t, content, download.Body.String())
+	assert.Equal(t, "application/pdf", download.Header().Get("Content-Type"))
+	assert.Equal(t, "attachment", download.Header().Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", download.Header().Get("X-Content-Type-Options"))
+
+	// The signature covers the key and the content type
+	parsed, err := url.Parse(downloadURL)
+	assert.NoError(t, err)
+	query := parsed.Query()
+	query.Set("type", "text/html")
+	assert.Equal(t, http.StatusForbidden, server.serve(http.MethodGet, parsed.Path+"?"+query.Encode(), nil).Code)
+	assert.Equal(t, http.StatusForbidden, server.serve(http.MethodGet, "/files/attachments/1/other?"+parsed.RawQuery, nil).Code)
+
+	expired, _ := server.handler.URLSigner.Sign("attachments/1/report", "application/pdf", time.Now().Add(-2*time.Minute))
+	assert.Equal(t, http.StatusForbidden, server.serve(http.MethodGet, expired, nil).Code)
+
+	gone := decodeBody(t, server.serve(http.MethodGet, "/attachments/8", nil))["url"].(string)
+	assert.Equal(t, http.StatusNotFound, server.serve(http.MethodGet, gone, nil).Code)
+
+	assert.Equal(t, http.StatusNotFound, server.serve(http.MethodGet, "/attachments/9", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodGet, "/attachments/x", nil).Code)
+}
+
+// TestPurgeUnsentAttachments checks that the files of the attachments
+// message-service purged are deleted, batch by batch
+func TestPurgeUnsentAttachments(t *testing.T) {
+	purged := make(chan *messageServiceProto.PurgeUnsentAttachmentsRequest, 10)
+	batches := [][]string{
+		make([]string, 0, 500),
+		{"attachments/1/last"},
+	}
+	for i := 0; i < 500; i++ {
+		batches[0] = append(batches[0], "attachments/1/unsent")
+	}
+	server := newAttachmentServer(t, &test.FakeMessageClient{
+		PurgeFunc: func(request *messageServiceProto.PurgeUnsentAttachmentsRequest) (*messageServiceProto.PurgeUnsentAttachmentsResponse, error) {
+			purged <- request
+			if len(batches) == 0 {
+				return &messageServiceProto.PurgeUnsentAttachmentsResponse{}, nil
+			}
+			keys := batches[0]
+			batches = batches[1:]
+			return &messageServiceProto.PurgeUnsentAttachmentsResponse{StorageKeys: keys}, nil
+		},
+	})
+	for _, key := range []string{"attachments/1/unsent", "attachments/1/last", "attachments/1/sent"} {
+		assert.NoError(t, server.storage.Put(context.Background(), key, strings.NewReader("file"), 4, "application/pdf"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.handler.PurgeUnsentAttachments(ctx)
+		close(done)
+	}()
+	first := <-purged
+	<-purged
+	cancel()
+	<-done
+
+	assert.EqualValues(t, 500, first.Limit)
+	assert.InDelta(t, time.Now().Add(-time.Hour).Unix(), first.UploadedBefore, 5)
+	assert.False(t, server.stored("attachments/1/unsent"))
+	assert.False(t, server.stored("attachments/1/last"))
+	assert.True(t, server.stored("attachments/1/sent"))
+}
+
+// TestAvatarSurvivesPurge checks that an uploaded image chosen as the avatar
+// is claimed, so that purging unsent attachments keeps its files
+func TestAvatarSurvivesPurge(t *testing.T) {
+	type attachment struct {
+		request *messageServiceProto.CreateAttachmentRequest
+		claimed bool
+	}
+	// Stands in for message-service, purging every unclaimed upload
+	var attachments []*attachment
+	purged := make(chan struct{}, 10)
+	server := newAttachmentServer(t, &test.FakeMessageClient{
+		CreateAttachmentFunc: func(request *messageServiceProto.CreateAttachmentRequest) (*messageServiceProto.CreateAttachmentResponse, error) {
+			attachments = append(attachments, &attachment{request: request})
+			return &messageServiceProto.CreateAttachmentResponse{Attachment: &messageServiceProto.Attachment{AttachmentId: int64(len(attachments))}}, nil
+		},
+		GetAttachmentFunc: func(request *messageServiceProto.GetAttachmentRequest) (*messageServiceProto.GetAttachmentResponse, error) {
+			stored := attachments[request.AttachmentId-1]
+			return &messageServiceProto.GetAttachmentResponse{
+				Attachment:   &messageServiceProto.Attachment{AttachmentId: request.AttachmentId, UploaderId: stored.request.UserId, HasThumbnail: true},
+				StorageKey:   stored.request.StorageKey,
+				ThumbnailKey: stored.request.ThumbnailKey,
+			}, nil
+		},
+		ClaimAttachmentFunc: func(request *messageServiceProto.ClaimAttachmentRequest) (*messageServiceProto.ClaimAttachmentResponse, error) {
+			attachments[request.AttachmentId-1].claimed = true
+			return &messageServiceProto.ClaimAttachmentResponse{}, nil
+		},
+		PurgeFunc: func(request *messageServiceProto.PurgeUnsentAttachmentsRequest) (*messageServiceProto.PurgeUnsentAttachmentsResponse, error) {
+			response := &messageServiceProto.PurgeUnsentAttachmentsResponse{}
+			for _, stored := range attachments {
+				if stored.request != nil && !stored.claimed {
+					response.StorageKeys = append(response.StorageKeys, stored.request.StorageKey, stored.request.ThumbnailKey)
+					stored.request = nil
+				}
+			}
+			purged <- struct{}{}
+			return response, nil
+		},
+	})
+	server.handler.UserClient = &test.FakeUserClient{
+		UpdateProfileFunc: func(request *userServiceProto.UpdateProfileRequest) (*userServiceProto.UpdateProfileResponse, error) {
+			return &userServiceProto.UpdateProfileResponse{User: &userServiceProto.User{
+				UserId: request.UserId, Profile: request.Profile, AvatarKey: request.AvatarKey,
+			}}, nil
+		},
+	}
+	server.router.HandleFunc("/me", server.handler.UpdateMe).Methods("PATCH")
+
+	assert.Equal(t, http.StatusOK, server.serve(http.MethodPost, "/attachments?name=avatar.png", pngImage(t, 640, 480)).Code)
+	assert.Equal(t, http.StatusOK, server.serve(http.MethodPost, "/attachments?name=other.png", pngImage(t, 640, 480)).Code)
+	recorder := server.serve(http.MethodPatch, "/me", []byte(`{"avatarAttachmentId":1}`))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	avatarURL := decodeBody(t, recorder)["user"].(map[string]interface{})["avatarUrl"].(string)
+	other := attachments[1].request
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.handler.PurgeUnsentAttachments(ctx)
+		close(done)
+	}()
+	<-purged
+	cancel()
+	<-done
+
+	assert.False(t, server.stored(other.StorageKey))
+	assert.False(t, server.stored(other.ThumbnailKey))
+	assert.Equal(t, http.StatusOK, server.serve(http.MethodGet, avatarURL, nil).Code)
+}
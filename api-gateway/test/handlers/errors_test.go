@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"api-gateway/config"
+	"api-gateway/handlers"
+	"api-gateway/middleware"
+	userServiceProto "api-gateway/proto/user_service"
+	"api-gateway/test"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingLogin serves the login route with a user-service answering the given error
+func failingLogin(t *testing.T, err error) (*httptest.ResponseRecorder, middleware.ErrorResponse) {
+	handler := &handlers.Handler{
+		Config: &config.Config{},
+		UserClient: &test.FakeUserClient{LoginFunc: func(*userServiceProto.LoginRequest) (*userServiceProto.LoginResponse, error) {
+			return nil, err
+		}},
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"name":"alice","password":"secret"}`))
+	request.Header.Set(middleware.RequestIDHeader, "request-1")
+	recorder := httptest.NewRecorder()
+	middleware.RequestID(http.HandlerFunc(handler.Login)).ServeHTTP(recorder, request)
+
+	var body middleware.ErrorResponse
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&body))
+	return recorder, body
+}
+
+// TestGrpcErrorMapping checks the HTTP status and error code each gRPC code is answered with
+func TestGrpcErrorMapping(t *testing.T) {
+	cases := []struct {
+		code         codes.Code
+		expectedHTTP int
+		expectedCode string
+	}{
+		{codes.InvalidArgument, http.StatusBadRequest, middleware.CodeInvalidArgument},
+		{codes.Unauthenticated, http.StatusUnauthorized, middleware.CodeUnauthenticated},
+		{codes.PermissionDenied, http.StatusForbidden, middleware.CodePermissionDenied},
+		{codes.NotFound, http.StatusNotFound, middleware.CodeNotFound},
+		{codes.AlreadyExists, http.StatusConflict, middleware.CodeAlreadyExists},
+		{codes.FailedPrecondition, http.StatusConflict, middleware.CodeFailedPrecondition},
+		{codes.ResourceExhausted, http.StatusTooManyRequests, middleware.CodeResourceExhausted},
+		{codes.Unavailable, http.StatusServiceUnavailable, middleware.CodeUnavailable},
+		{codes.Internal, http.StatusInternalServerError, middleware.CodeInternal},
+	}
+	for _, c := range cases {
+		recorder, body := failingLogin(t, status.Error(c.code, "failure"))
+		assert.Equal(t, c.expectedHTTP, recorder.Code, c.code.String())
+		assert.Equal(t, c.expectedCode, body.Code, c.code.String())
+		assert.Equal(t, "request-1", body.RequestID, c.code.String())
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"), c.code.String())
+	}
+}
+
+// TestGrpcErrorMessages checks that client errors keep their message while
+// server-side failures don't reveal theirs
+func TestGrpcErrorMessages(t *testing.T) {
+	_, body := failingLogin(t, status.Error(codes.AlreadyExists, "user already exists"))
+	assert.Equal(t, "user already exists", body.Message)
+
+	_, body = failingLogin(t, status.Error(codes.Unavailable, "dial tcp 10.0.0.5:5432: connection refused"))
+	assert.Equal(t, "service temporarily unavailable", body.Message)
+
+	_, body = failingLogin(t, status.Error(codes.Internal, "pq: relation users does not exist"))
+	assert.Equal(t, "internal error", body.Message)
+
+	// Errors that aren't gRPC statuses are unknown to the mapping
+	recorder, body := failingLogin(t, errors.New("connection reset"))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	assert.Equal(t, "internal error", body.Message)
+}
+
+// TestGrpcErrorDetails checks that field violations and retry delays are passed on
+func TestGrpcErrorDetails(t *testing.T) {
+	invalid, err := status.New(codes.InvalidArgument, "invalid input").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{
+			{Field: "name", Description: "must not be empty"},
+			{Field: "password", Description: "must not be empty"},
+		},
+	})
+	assert.NoError(t, err)
+	_, body := failingLogin(t, invalid.Err())
+	assert.Equal(t, []middleware.ErrorDetail{
+		{Field: "name", Description: "must not be empty"},
+		{Field: "password", Description: "must not be empty"},
+	}, body.Details)
+
+	exhausted, err := status.New(codes.ResourceExhausted, "too many attempts").WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(1500 * time.Millisecond),
+	})
+	assert.NoError(t, err)
+	recorder, body := failingLogin(t, exhausted.Err())
+	assert.Equal(t, "2", recorder.Header().Get("Retry-After"))
+	assert.Empty(t, body.Details)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"api-gateway/config"
+	"api-gateway/handlers"
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	"api-gateway/test"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestSendMessageFieldNames checks that the request body takes the same
+// camelCase field names as the response, and that the sender comes from the
+// access token rather than the body
+func TestSendMessageFieldNames(t *testing.T) {
+	var sent *messageServiceProto.SendMessageRequest
+	handler := &handlers.Handler{
+		Config: &config.Config{},
+		MessageClient: &test.FakeMessageClient{SendMessageFunc: func(request *messageServiceProto.SendMessageRequest) (*messageServiceProto.SendMessageResponse, error) {
+			sent = request
+			return &messageServiceProto.SendMessageResponse{Message: &messageServiceProto.Message{
+				MessageId:      10,
+				ConversationId: request.ConversationId,
+				SenderId:       request.UserId,
+				Text:           request.Text,
+				ThreadRootId:   request.ThreadRootId,
+			}}, nil
+		}},
+	}
+
+	body := `{"userId":2,"conversationId":3,"text":"hi","replyToMessageId":4,"threadRootId":5,"attachmentIds":[6,7]}`
+	request := httptest.NewRequest(http.MethodPost, "/messages", strings.NewReader(body))
+	request = request.WithContext(middleware.WithUser(request.Context(), 1, "session-1"))
+	recorder := httptest.NewRecorder()
+	handler.SendMessage(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.EqualValues(t, 1, sent.UserId)
+	assert.EqualValues(t, 3, sent.ConversationId)
+	assert.Equal(t, "hi", sent.Text)
+	assert.EqualValues(t, 4, sent.ReplyToMessageId)
+	assert.EqualValues(t, 5, sent.ThreadRootId)
+	assert.Equal(t, []int64{6, 7}, sent.AttachmentIds)
+
+	var response struct {
+		Message map[string]interface{} `json:"message"`
+	}
+	assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&response))
+	assert.EqualValues(t, 3, response.Message["conversationId"])
+	assert.EqualValues(t, 5, response.Message["threadRootId"])
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"api-gateway/config"
+	"api-gateway/handlers"
+	"api-gateway/middleware"
+	messageServiceProto "api-gateway/proto/message_service"
+	userServiceProto "api-gateway/proto/user_service"
+	"api-gateway/storage"
+	"api-gateway/test"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// profileServer routes the profile endpoints of a gateway whose
+// user-service records the last profile update. Requests are made as user 1.
+type profileServer struct {
+	router   *mux.Router
+	updates  []*userServiceProto.UpdateProfileRequest
+	reads    []*userServiceProto.GetUserRequest
+	blocks   []*userServiceProto.BlockUserRequest
+	unblocks []*userServiceProto.UnblockUserRequest
+}
+
+func newProfileServer(messageClient *test.FakeMessageClient) *profileServer {
+	server := &profileServer{}
+	handler := &handlers.Handler{
+		Config: &config.Config{},
+		UserClient: &test.FakeUserClient{
+			UpdateProfileFunc: func(request *userServiceProto.UpdateProfileRequest) (*userServiceProto.UpdateProfileResponse, error) {
+				server.updates = append(server.updates, request)
+				return &userServiceProto.UpdateProfileResponse{User: &userServiceProto.User{
+					UserId: request.UserId, Name: "alice", Profile: request.Profile, AvatarKey: request.AvatarKey,
+				}}, nil
+			},
+			GetUserFunc: func(request *userServiceProto.GetUserRequest) (*userServiceProto.GetUserResponse, error) {
+				server.reads = append(server.reads, request)
+				if request.UserId != 2 {
+					return nil, status.Error(codes.NotFound, "user not found")
+				}
+				return &userServiceProto.GetUserResponse{User: &userServiceProto.User{
+					UserId: 2, Name: "bob", Profile: &userServiceProto.Profile{DisplayName: "Bob", AvatarAttachmentId: 7}, AvatarKey: "attachments/2/avatar-thumbnail",
+				}}, nil
+			},
+			BlockUserFunc: func(request *userServiceProto.BlockUserRequest) (*userServiceProto.BlockUserResponse, error) {
+				server.blocks = append(server.blocks, request)
+				if request.BlockedUserId != 2 {
+					return nil, status.Error(codes.NotFound, "user not found")
+				}
+				return &userServiceProto.BlockUserResponse{Message: "user blocked"}, nil
+			},
+			UnblockUserFunc: func(request *userServiceProto.UnblockUserRequest) (*userServiceProto.UnblockUserResponse, error) {
+				server.unblocks = append(server.unblocks, request)
+				return &userServiceProto.UnblockUserResponse{Message: "user unblocked"}, nil
+			},
+		},
+		MessageClient: messageClient,
+		URLSigner:     storage.NewURLSigner([]byte("secret"), time.Minute),
+	}
+	server.router = mux.NewRouter()
+	server.router.HandleFunc("/me", handler.UpdateMe).Methods("PATCH")
+	server.router.HandleFunc("/users/{id}", handler.GetUser).Methods("GET")
+	server.router.HandleFunc("/users/{id}/block", handler.BlockUser).Methods("POST")
+	server.router.HandleFunc("/users/{id}/block", handler.UnblockUser).Methods("DELETE")
+	return server
+}
+
+func (s *profileServer) serve(method, target, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request = request.WithContext(middleware.WithUser(request.Context(), 1, "session-1"))
+	recorder := httptest.NewRecorder()
+	s.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+// TestUpdateMe checks that the fields present in the body, null ones
+// included, make up the update mask
+func TestUpdateMe(t *testing.T) {
+	server := newProfileServer(nil)
+
+	recorder := server.serve(http.MethodPatch, "/me", `{"bio":"hello","locale":null}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	if assert.Len(t, server.updates, 1) {
+		update := server.updates[0]
+		assert.EqualValues(t, 1, update.UserId)
+		assert.Equal(t, []string{"bio", "locale"}, update.UpdateMask.Paths)
+		assert.Equal(t, "hello", update.Profile.Bio)
+		assert.Empty(t, update.Profile.Locale)
+		assert.Empty(t, update.AvatarKey)
+	}
+	user := decodeBody(t, recorder)["user"].(map[string]interface{})
+	assert.Equal(t, "hello", user["bio"])
+	assert.Nil(t, user["avatarUrl"])
+}
+
+// TestUpdateMeRejected checks the bodies refused before user-service is asked
+func TestUpdateMeRejected(t *testing.T) {
+	server := newProfileServer(nil)
+
+	for name, body := range map[string]string{
+		"not JSON":      `bio=hello`,
+		"not an object": `["bio"]`,
+		"no fields":     `{}`,
+		"unknown field": `{"bio":"hello","name":"mallory"}`,
+		"wrong type":    `{"avatarAttachmentId":"seven"}`,
+	} {
+		recorder := server.serve(http.MethodPatch, "/me", body)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, name)
+	}
+	recorder := server.serve(http.MethodPatch, "/me", `{"bio":"`+strings.Repeat("a", 20<<10)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Empty(t, server.updates)
+}
+
+// TestUpdateMeAvatar checks that the avatar must be an image the caller
+// uploaded, whose thumbnail becomes the avatar and which is claimed
+func TestUpdateMeAvatar(t *testing.T) {
+	var claimed []int64
+	server := newProfileServer(&test.FakeMessageClient{
+		GetAttachmentFunc: func(request *messageServiceProto.GetAttachmentRequest) (*messageServiceProto.GetAttachmentResponse, error) {
+			switch request.AttachmentId {
+			case 7:
+				return &messageServiceProto.GetAttachmentResponse{
+					Attachment:   &messageServiceProto.Attachment{AttachmentId: 7, UploaderId: 1, ContentType: "image/png", HasThumbnail: true},
+					StorageKey:   "attachments/1/photo",
+					ThumbnailKey: "attachments/1/photo-thumbnail",
+				}, nil
+			case 8:
+				// Shared in a conversation by someone else
+				return &messageServiceProto.GetAttachmentResponse{
+					Attachment:   &messageServiceProto.Attachment{AttachmentId: 8, UploaderId: 2, ContentType: "image/png", HasThumbnail: true},
+					StorageKey:   "attachments/2/photo",
+					ThumbnailKey: "attachments/2/photo-thumbnail",
+				}, nil
+			case 9:
+				return &messageServiceProto.GetAttachmentResponse{
+					Attachment: &messageServiceProto.Attachment{AttachmentId: 9, UploaderId: 1, ContentType: "application/pdf"},
+					StorageKey: "attachments/1/report",
+				}, nil
+			}
+			return nil, status.Error(codes.NotFound, "attachment not found")
+		},
+		ClaimAttachmentFunc: func(request *messageServiceProto.ClaimAttachmentRequest) (*messageServiceProto.ClaimAttachmentResponse, error) {
+			claimed = append(claimed, request.AttachmentId)
+			return &messageServiceProto.ClaimAttachmentResponse{}, nil
+		},
+	})
+
+	recorder := server.serve(http.MethodPatch, "/me", `{"avatarAttachmentId":7}`)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	if assert.Len(t, server.updates, 1) {
+		assert.Equal(t, "attachments/1/photo-thumbnail", server.updates[0].AvatarKey)
+	}
+	user := decodeBody(t, recorder)["user"].(map[string]interface{})
+	assert.True(t, strings.HasPrefix(user["avatarUrl"].(string), storage.DownloadPath+"attachments/1/photo-thumbnail?"))
+
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodPatch, "/me", `{"avatarAttachmentId":8}`).Code)
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodPatch, "/me", `{"avatarAttachmentId":9}`).Code)
+	assert.Equal(t, http.StatusNotFound, server.serve(http.MethodPatch, "/me", `{"avatarAttachmentId":10}`).Code)
+	assert.Len(t, server.updates, 1)
+	assert.Equal(t, []int64{7}, claimed)
+
+	// Clearing the avatar doesn't look anything up
+	assert.Equal(t, http.StatusOK, server.serve(http.MethodPatch, "/me", `{"avatarAttachmentId":null}`).Code)
+	if assert.Len(t, server.updates, 2) {
+		assert.Equal(t, []string{"avatarAttachmentId"}, server.updates[1].UpdateMask.Paths)
+		assert.Empty(t, server.updates[1].AvatarKey)
+	}
+}
+
+// TestGetUserFields checks that the fields parameter becomes the read mask
+// and limits the returned profile
+func TestGetUserFields(t *testing.T) {
+	server := newProfileServer(nil)
+
+	recorder := server.serve(http.MethodGet, "/users/2", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	user := decodeBody(t, recorder)["user"].(map[string]interface{})
+	assert.Contains(t, user, "bio")
+	assert.NotNil(t, user["avatarUrl"])
+	assert.Nil(t, server.reads[0].ReadMask)
+	assert.EqualValues(t, 1, server.reads[0].ViewerId)
+
+	recorder = server.serve(http.MethodGet, "/users/2?fields=displayName", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	user = decodeBody(t, recorder)["user"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"userId": float64(2), "name": "bob", "displayName": "Bob"}, user)
+	assert.Equal(t, []string{"displayName"}, server.reads[1].ReadMask.Paths)
+
+	assert.Equal(t, http.StatusNotFound, server.serve(http.MethodGet, "/users/3", "").Code)
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodGet, "/users/0", "").Code)
+}
+
+// TestBlockUser checks that blocks are made and lifted by the caller
+func TestBlockUser(t *testing.T) {
+	server := newProfileServer(nil)
+
+	recorder := server.serve(http.MethodPost, "/users/2/block", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "user blocked", decodeBody(t, recorder)["message"])
+	if assert.Len(t, server.blocks, 1) {
+		assert.EqualValues(t, 1, server.blocks[0].UserId)
+		assert.EqualValues(t, 2, server.blocks[0].BlockedUserId)
+	}
+	assert.Equal(t, http.StatusNotFound, server.serve(http.MethodPost, "/users/3/block", "").Code)
+	assert.Equal(t, http.StatusBadRequest, server.serve(http.MethodPost, "/users/x/block", "").Code)
+
+	assert.Equal(t, http.StatusOK, server.serve(http.MethodDelete, "/users/2/block", "").Code)
+	if assert.Len(t, server.unblocks, 1) {
+		assert.EqualValues(t, 1, server.unblocks[0].UserId)
+		assert.EqualValues(t, 2, server.unblocks[0].BlockedUserId)
+	}
+}
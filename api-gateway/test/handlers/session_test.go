@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"api-gateway/config"
+	"api-gateway/handlers"
+	"api-gateway/middleware"
+	userServiceProto "api-gateway/proto/user_service"
+	"api-gateway/test"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+// TestLoginClientIP checks that X-Forwarded-For is only believed when sent by a trusted proxy
+func TestLoginClientIP(t *testing.T) {
+	var ipAddress string
+	handler := &handlers.Handler{
+		Config: &config.Config{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+		UserClient: &test.FakeUserClient{LoginFunc: func(request *userServiceProto.LoginRequest) (*userServiceProto.LoginResponse, error) {
+			ipAddress = request.IpAddress
+			return &userServiceProto.LoginResponse{}, nil
+		}},
+	}
+
+	cases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIP   string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"spoofed header from client", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entry behind proxy", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of proxies", "10.0.0.2:5000", []string{"198.51.100.1, 10.0.0.9", "10.0.0.3"}, "198.51.100.1"},
+		{"malformed entry", "10.0.0.2:5000", []string{"nonsense"}, "10.0.0.2"},
+	}
+	for _, c := range cases {
+		request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"name":"alice","password":"secret"}`))
+		request.RemoteAddr = c.remoteAddr
+		for _, header := range c.forwardedFor {
+			request.Header.Add("X-Forwarded-For", header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.Login(recorder, request)
+
+		assert.Equal(t, http.StatusOK, recorder.Code, c.name)
+		assert.Equal(t, c.expectedIP, ipAddress, c.name)
+	}
+}
+
+// TestDeactivateMe checks that the caller's account is the one deactivated
+func TestDeactivateMe(t *testing.T) {
+	var deactivated *userServiceProto.DeactivateUserRequest
+	handler := &handlers.Handler{
+		Config: &config.Config{},
+		UserClient: &test.FakeUserClient{DeactivateFunc: func(request *userServiceProto.DeactivateUserRequest) (*userServiceProto.DeactivateUserResponse, error) {
+			deactivated = request
+			return &userServiceProto.DeactivateUserResponse{RevokedSessions: 2, Message: "account deactivated"}, nil
+		}},
+	}
+
+	request := httptest.NewRequest(http.MethodPost, "/me/deactivate", nil)
+	request = request.WithContext(middleware.WithUser(request.Context(), 1, "session-1"))
+	recorder := httptest.NewRecorder()
+	handler.DeactivateMe(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.EqualValues(t, 1, deactivated.UserId)
+	assert.EqualValues(t, 2, decodeBody(t, recorder)["revokedSessions"])
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	messageServiceProto "api-gateway/proto/message_service"
+	userServiceProto "api-gateway/proto/user_service"
+	"context"
+	"google.golang.org/grpc"
+)
+
+// FakeUserClient answers the user-service calls a test sets a function
+// for. Other calls panic.
+type FakeUserClient struct {
+	userServiceProto.UserServiceClient
+	LoginFunc         func(*userServiceProto.LoginRequest) (*userServiceProto.LoginResponse, error)
+	GetUserFunc       func(*userServiceProto.GetUserRequest) (*userServiceProto.GetUserResponse, error)
+	UpdateProfileFunc func(*userServiceProto.UpdateProfileRequest) (*userServiceProto.UpdateProfileResponse, error)
+	BlockUserFunc     func(*userServiceProto.BlockUserRequest) (*userServiceProto.BlockUserResponse, error)
+	UnblockUserFunc   func(*userServiceProto.UnblockUserRequest) (*userServiceProto.UnblockUserResponse, error)
+	DeactivateFunc    func(*userServiceProto.DeactivateUserRequest) (*userServiceProto.DeactivateUserResponse, error)
+}
+
+func (c *FakeUserClient) Login(ctx context.Context, in *userServiceProto.LoginRequest, opts ...grpc.CallOption) (*userServiceProto.LoginResponse, error) {
+	return c.LoginFunc(in)
+}
+
+func (c *FakeUserClient) GetUser(ctx context.Context, in *userServiceProto.GetUserRequest, opts ...grpc.CallOption) (*userServiceProto.GetUserResponse, error) {
+	return c.GetUserFunc(in)
+}
+
+func (c *FakeUserClient) UpdateProfile(ctx context.Context, in *userServiceProto.UpdateProfileRequest, opts ...grpc.CallOption) (*userServiceProto.UpdateProfileResponse, error) {
+	return c.UpdateProfileFunc(in)
+}
+
+func (c *FakeUserClient) BlockUser(ctx context.Context, in *userServiceProto.BlockUserRequest, opts ...grpc.CallOption) (*userServiceProto.BlockUserResponse, error) {
+	return c.BlockUserFunc(in)
+}
+
+func (c *FakeUserClient) UnblockUser(ctx context.Context, in *userServiceProto.UnblockUserRequest, opts ...grpc.CallOption) (*userServiceProto.UnblockUserResponse, error) {
+	return c.UnblockUserFunc(in)
+}
+
+func (c *FakeUserClient) DeactivateUser(ctx context.Context, in *userServiceProto.DeactivateUserRequest, opts ...grpc.CallOption) (*userServiceProto.DeactivateUserResponse, error) {
+	return c.DeactivateFunc(in)
+}
+
+// FakeMessageClient answers the message-service calls a test sets a
+// function for. Other calls panic.
+type FakeMessageClient struct {
+	messageServiceProto.MessageServiceClient
+	CreateAttachmentFunc func(*messageServiceProto.CreateAttachmentRequest) (*messageServiceProto.CreateAttachmentResponse, error)
+	GetAttachmentFunc    func(*messageServiceProto.GetAttachmentRequest) (*messageServiceProto.GetAttachmentResponse, error)
+	ClaimAttachmentFunc  func(*messageServiceProto.ClaimAttachmentRequest) (*messageServiceProto.ClaimAttachmentResponse, error)
+	PurgeFunc            func(*messageServiceProto.PurgeUnsentAttachmentsRequest) (*messageServiceProto.PurgeUnsentAttachmentsResponse, error)
+	SendMessageFunc      func(*messageServiceProto.SendMessageRequest) (*messageServiceProto.SendMessageResponse, error)
+}
+
+func (c *FakeMessageClient) CreateAttachment(ctx context.Context, in *messageServiceProto.CreateAttachmentRequest, opts ...grpc.CallOption) (*messageServiceProto.CreateAttachmentResponse, error) {
+	return c.CreateAttachmentFunc(in)
+}
+
+func (c *FakeMessageClient) GetAttachment(ctx context.Context, in *messageServiceProto.GetAttachmentRequest, opts ...grpc.CallOption) (*messageServiceProto.GetAttachmentResponse, error) {
+	return c.GetAttachmentFunc(in)
+}
+
+func (c *FakeMessageClient) ClaimAttachment(ctx context.Context, in *messageServiceProto.ClaimAttachmentRequest, opts ...grpc.CallOption) (*messageServiceProto.ClaimAttachmentResponse, error) {
+	return c.ClaimAttachmentFunc(in)
+}
+
+func (c *FakeMessageClient) PurgeUnsentAttachments(ctx context.Context, in *messageServiceProto.PurgeUnsentAttachmentsRequest, opts ...grpc.CallOption) (*messageServiceProto.PurgeUnsentAttachmentsResponse, error) {
+	return c.PurgeFunc(in)
+}
+
+func (c *FakeMessageClient) SendMessage(ctx context.Context, in *messageServiceProto.SendMessageRequest, opts ...grpc.CallOption) (*messageServiceProto.SendMessageResponse, error) {
+	return c.SendMessageFunc(in)
+}
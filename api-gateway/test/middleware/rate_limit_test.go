@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"api-gateway/middleware"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRateLimiter checks that bursts are capped per user and refilled over time
+func TestRateLimiter(t *testing.T) {
+	limiter := middleware.NewRateLimiter(3, time.Minute)
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow(1, now)
+		assert.True(t, allowed)
+	}
+	allowed, wait := limiter.Allow(1, now)
+	assert.False(t, allowed)
+	assert.Equal(t, 20*time.Second, wait)
+
+	// Other users have buckets of their own
+	allowed, _ = limiter.Allow(2, now)
+	assert.True(t, allowed)
+
+	allowed, _ = limiter.Allow(1, now.Add(20*time.Second))
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow(1, now.Add(20*time.Second))
+	assert.False(t, allowed)
+
+	// Idle buckets refill to their capacity and no further
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow(1, now.Add(time.Hour))
+		assert.True(t, allowed)
+	}
+	allowed, _ = limiter.Allow(1, now.Add(time.Hour))
+	assert.False(t, allowed)
+}
+
+// TestRateLimit checks that rejected requests get 429 with Retry-After
+func TestRateLimit(t *testing.T) {
+	handler := middleware.RateLimit(middleware.NewRateLimiter(1, time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users/search?q=ann", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users/search?q=ann", nil))
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "60", recorder.Header().Get("Retry-After"))
+	assert.Contains(t, recorder.Body.String(), `"code":"resource_exhausted"`)
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"api-gateway/storage"
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeS3 is a local stand-in for an S3-compatible service, keeping objects
+// in memory and refusing unsigned requests
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+var authorization = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=access/\d{8}/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`)
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !authorization.MatchString(r.Header.Get("Authorization")) || r.Header.Get("X-Amz-Date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path], s.types[r.URL.Path] = body, r.Header.Get("Content-Type")
+	case http.MethodGet:
+		object, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(object)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func read(t *testing.T, store storage.Storage, key string) string {
+	object, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	defer object.Body.Close()
+	content, _ := io.ReadAll(object.Body)
+	assert.EqualValues(t, len(content), object.Size)
+	return string(content)
+}
+
+// testStorage runs the checks every Storage must pass
+func testStorage(t *testing.T, store storage.Storage) {
+	ctx := context.Background()
+	key, err := storage.NewKey(7)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"))
+	assert.Equal(t, "hello", read(t, store, key))
+	assert.NoError(t, store.Put(ctx, key, strings.NewReader("bye"), 3, "text/plain"))
+	assert.Equal(t, "bye", read(t, store, key))
+
+	assert.NoError(t, store.Delete(ctx, key))
+	assert.NoError(t, store.Delete(ctx, key))
+	_, err = store.Get(ctx, key)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	assert.Error(t, store.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"))
+}
+
+func TestFileStorage(t *testing.T) {
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStorage failed: %v", err)
+	}
+	testStorage(t, store)
+
+	// Short bodies store nothing
+	err = store.Put(context.Background(), "short", strings.NewReader("abc"), 10, "text/plain")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = store.Get(context.Background(), "short")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestS3Storage(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	config := storage.S3Config{Endpoint: server.URL + "/", Region: "eu-west-1", Bucket: "chat", AccessKey: "access", SecretKey: "secret"}
+	store := storage.NewS3Storage(config, server.Client())
+	testStorage(t, store)
+
+	assert.NoError(t, store.Put(context.Background(), "a/b", strings.NewReader("x"), 1, "image/png"))
+	assert.Equal(t, "image/png", fake.types["/chat/a/b"])
+}
+
+func TestURLSigner(t *testing.T) {
+	signer := storage.NewURLSigner([]byte("secret"), time.Minute)
+	now := time.Now()
+	signed, expires := signer.Sign("attachments/1/abc", "image/png", now)
+	assert.WithinDuration(t, now.Add(time.Minute), expires, time.Second)
+
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("invalid URL %q: %v", signed, err)
+	}
+	assert.Equal(t, storage.DownloadPath+"attachments/1/abc", parsed.Path)
+	contentType, err := signer.Verify("attachments/1/abc", parsed.Query(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+
+	_, err = signer.Verify("attachments/1/abd", parsed.Query(), now)
+	assert.ErrorIs(t, err, storage.ErrInvalidSignature)
+	tampered := parsed.Query()
+	tampered.Set("type", "text/html")
+	_, err = signer.Verify("attachments/1/abc", tampered, now)
+	assert.ErrorIs(t, err, storage.ErrInvalidSignature)
+	_, err = signer.Verify("attachments/1/abc", parsed.Query(), now.Add(2*time.Minute))
+	assert.ErrorIs(t, err, storage.ErrURLExpired)
+	_, err = storage.NewURLSigner([]byte("other"), time.Minute).Verify("attachments/1/abc", parsed.Query(), now)
+	assert.True(t, errors.Is(err, storage.ErrInvalidSignature))
+}
+
+func TestMakeThumbnail(t *testing.T) {
+	source := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	for x := 0; x < 1000; x++ {
+		for y := 0; y < 500; y++ {
+			source.Set(x, y, color.NRGBA{R: 200, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	assert.NoError(t, png.Encode(&encoded, source))
+
+	thumbnail, err := storage.MakeThumbnail(&encoded)
+	if err != nil {
+		t.Fatalf("MakeThumbnail failed: %v", err)
+	}
+	assert.Equal(t, 1000, thumbnail.Width)
+	assert.Equal(t, 500, thumbnail.Height)
+	decoded, err := jpeg.Decode(bytes.NewReader(thumbnail.Data))
+	if err != nil {
+		t.Fatalf("invalid thumbnail: %v", err)
+	}
+	assert.Equal(t, image.Pt(320, 160), decoded.Bounds().Size())
+	red, _, _, _ := decoded.At(160, 80).RGBA()
+	assert.InDelta(t, 200, red>>8, 5)
+
+	_, err = storage.MakeThumbnail(strings.NewReader("not an image"))
+	assert.Error(t, err)
+}
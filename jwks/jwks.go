@@ -0,0 +1,183 @@
+// Package jwks verifies access tokens against the key set that user-service
+// publishes at /.well-known/jwks.json. The gateway and notification-service
+// both use it through a replace directive in their go.mod.
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/sync/singleflight"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval limits how often an unknown `kid` or stale key set may
+// trigger a refetch, whether or not the previous one succeeded
+const minRefreshInterval = 30 * time.Second
+
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+type verificationKey struct {
+	algorithm string
+	publicKey interface{}
+}
+
+// Cache fetches and caches the user service's public signing keys
+type Cache struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	// Shares a fetch among the verifications waiting for it
+	group singleflight.Group
+
+	mu   sync.RWMutex // Protects the fields below
+	keys map[string]verificationKey
+	// Time of the last successful fetch, which the TTL counts from
+	fetchedAt time.Time
+	// Time of the last fetch, failed or not, which refetches are limited by
+	attemptedAt time.Time
+}
+
+func NewCache(url string, ttl time.Duration) *Cache {
+	return &Cache{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+		keys:   make(map[string]verificationKey),
+	}
+}
+
+// Keyfunc resolves the verification key of a token by its `kid` header,
+// refreshing the cache when it is stale or the key is unknown. Unknown keys
+// wait for a fetch in progress, while stale ones are used until it ends or
+// while the key set can't be fetched.
+func (j *Cache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("missing kid header")
+	}
+
+	key, found, stale, recentlyAttempted := j.lookup(kid)
+	if !found || stale && !recentlyAttempted {
+		if err := j.refresh(); err != nil {
+			log.Printf("Failed to refresh JWKS: %v", err)
+		}
+		key, found, _, _ = j.lookup(kid)
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.publicKey, nil
+}
+
+func (j *Cache) lookup(kid string) (verificationKey, bool, bool, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	key, found := j.keys[kid]
+	return key, found, time.Since(j.fetchedAt) > j.ttl, time.Since(j.attemptedAt) < minRefreshInterval
+}
+
+// refresh fetches the key set once for all concurrent callers, unless a
+// fetch was attempted recently. The lock is only held to swap the keys in,
+// so verifications with cached keys don't wait for the network.
+func (j *Cache) refresh() error {
+	_, err, _ := j.group.Do("refresh", func() (interface{}, error) {
+		j.mu.Lock()
+		// Another fetch may have ended since the caller looked, or failed
+		if time.Since(j.attemptedAt) < minRefreshInterval {
+			j.mu.Unlock()
+			return nil, nil
+		}
+		j.attemptedAt = time.Now()
+		j.mu.Unlock()
+
+		keys, err := j.fetch()
+		if err != nil {
+			return nil, err
+		}
+
+		j.mu.Lock()
+		j.keys, j.fetchedAt = keys, time.Now()
+		j.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+// fetch downloads the key set, skipping the keys it can't use
+func (j *Cache) fetch() (map[string]verificationKey, error) {
+	response, err := j.client.Get(j.url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	var body struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]verificationKey, len(body.Keys))
+	for _, key := range body.Keys {
+		publicKey, err := key.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWK %s: %v", key.KeyID, err)
+			continue
+		}
+		keys[key.KeyID] = verificationKey{algorithm: key.Algorithm, publicKey: publicKey}
+	}
+	return keys, nil
+}
+
+func (key jwk) publicKey() (interface{}, error) {
+	switch key.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if key.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", key.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", key.KeyType)
+	}
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"jwks"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// keyServer serves a key set of one Ed25519 key, counting the requests
+type keyServer struct {
+	*httptest.Server
+	privateKey ed25519.PrivateKey
+	requests   atomic.Int32
+	// Answered instead of the key set when set
+	status int
+	// Holds every request until closed, when set
+	release chan struct{}
+}
+
+func newKeyServer(t *testing.T) *keyServer {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	server := &keyServer{privateKey: privateKey}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.requests.Add(1)
+		if server.release != nil {
+			<-server.release
+		}
+		if server.status != 0 {
+			w.WriteHeader(server.status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": "key-1",
+			"alg": "EdDSA",
+			"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+		}}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *keyServer) sign(t *testing.T, kid string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"user_id": 1})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(s.privateKey)
+	if err != nil {
+		t.Fatalf("SignedString failed: %v", err)
+	}
+	return signed
+}
+
+func verify(cache *jwks.Cache, token string) error {
+	_, err := jwt.Parse(token, cache.Keyfunc)
+	return err
+}
+
+// TestKeyfunc checks that tokens are verified with the fetched keys, and
+// that unknown keys don't refetch right after a fetch
+func TestKeyfunc(t *testing.T) {
+	server := newKeyServer(t)
+	cache := jwks.NewCache(server.URL, time.Hour)
+
+	assert.NoError(t, verify(cache, server.sign(t, "key-1")))
+	assert.NoError(t, verify(cache, server.sign(t, "key-1")))
+	assert.Error(t, verify(cache, server.sign(t, "key-2")))
+	assert.EqualValues(t, 1, server.requests.Load())
+}
+
+// TestFailedRefreshIsThrottled checks that failing fetches are limited like
+// successful ones, rather than retried for every token
+func TestFailedRefreshIsThrottled(t *testing.T) {
+	server := newKeyServer(t)
+	server.status = http.StatusServiceUnavailable
+	cache := jwks.NewCache(server.URL, time.Hour)
+
+	for i := 0; i < 10; i++ {
+		assert.Error(t, verify(cache, server.sign(t, "key-1")))
+	}
+	assert.EqualValues(t, 1, server.requests.Load())
+}
+
+// TestConcurrentRefresh checks that verifications waiting for the key set
+// share a single fetch
+func TestConcurrentRefresh(t *testing.T) {
+	server := newKeyServer(t)
+	server.release = make(chan struct{})
+	cache := jwks.NewCache(server.URL, time.Hour)
+
+	token := server.sign(t, "key-1")
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- verify(cache, token)
+		}()
+	}
+	assert.Eventually(t, func() bool { return server.requests.Load() == 1 }, time.Second, time.Millisecond)
+	// Let the other verifications reach the fetch in progress
+	time.Sleep(10 * time.Millisecond)
+	close(server.release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.EqualValues(t, 1, server.requests.Load())
+}
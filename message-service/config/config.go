@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+type Config struct {
+	Port            string
+	UserServiceURL  string
+	KafkaServiceURL string
+	// Topic consumed by notification-service
+	NotificationTopic string
+	// How long after sending a message its sender may edit it
+	EditWindow time.Duration
+	// Deadline for finishing in-flight calls on shutdown
+	ShutdownTimeout time.Duration
+}
+
+func LoadConfig() *Config {
+	return &Config{
+		Port:              getString("PORT", "50052"),
+		UserServiceURL:    os.Getenv("USER_SERVICE_URL"),
+		KafkaServiceURL:   os.Getenv("KAFKA_BROKER"),
+		NotificationTopic: getString("NOTIFICATION_TOPIC", "default"),
+		EditWindow:        getDuration("EDIT_WINDOW", 15*time.Minute),
+		ShutdownTimeout:   getDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
+	}
+}
+
+func getString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
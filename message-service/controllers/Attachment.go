@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/repositories"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxFileNameLength is the longest attachment file name, in characters
+const maxFileNameLength = 255
+
+// CreateAttachment records a file the gateway stored for the caller, who
+// may then send it with a message
+func (c *MessageServiceServer) CreateAttachment(ctx context.Context, request *proto.CreateAttachmentRequest) (*proto.CreateAttachmentResponse, error) {
+	var violations []fieldViolation
+	fileName := strings.TrimSpace(request.FileName)
+	if fileName == "" || utf8.RuneCountInString(fileName) > maxFileNameLength {
+		violations = append(violations, fieldViolation{"fileName", "must be 1 to 255 characters long"})
+	}
+	if request.ContentType == "" {
+		violations = append(violations, fieldViolation{"contentType", "must not be empty"})
+	}
+	if request.Size <= 0 {
+		violations = append(violations, fieldViolation{"size", "must be a positive integer"})
+	}
+	if request.StorageKey == "" {
+		violations = append(violations, fieldViolation{"storageKey", "must not be empty"})
+	}
+	if request.Width < 0 || request.Height < 0 {
+		violations = append(violations, fieldViolation{"width", "dimensions must not be negative"})
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid attachment", violations...)
+	}
+
+	attachment := models.Attachment{
+		UploaderID:   uint(request.UserId),
+		FileName:     fileName,
+		ContentType:  request.ContentType,
+		Size:         request.Size,
+		StorageKey:   request.StorageKey,
+		ThumbnailKey: request.ThumbnailKey,
+		Width:        int(request.Width),
+		Height:       int(request.Height),
+		Created:      time.Now(),
+	}
+	if err := c.AttachmentRepo.CreateAttachment(&attachment); err != nil {
+		return nil, unavailable("store attachment", err)
+	}
+
+	return &proto.CreateAttachmentResponse{Attachment: toProtoAttachment(&attachment)}, nil
+}
+
+// GetAttachment tells the gateway where the files of an attachment are.
+// Unsent attachments are only shown to their uploader, sent ones to the
+// participants of the conversation.
+func (c *MessageServiceServer) GetAttachment(ctx context.Context, request *proto.GetAttachmentRequest) (*proto.GetAttachmentResponse, error) {
+	userID := uint(request.UserId)
+	attachment, err := c.AttachmentRepo.FindAttachment(uint(request.AttachmentId))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errAttachmentMissing
+	}
+	if err != nil {
+		return nil, unavailable("look up attachment", err)
+	}
+
+	if attachment.MessageID == nil && attachment.UploaderID != userID {
+		return nil, errAttachmentMissing
+	}
+	if attachment.MessageID != nil {
+		// Checked for the uploader as well, who may have left the conversation
+		_, _, err := c.findUserMessage(userID, *attachment.MessageID)
+		if errors.Is(err, errMessageNotFound) {
+			return nil, errAttachmentMissing
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &proto.GetAttachmentResponse{
+		Attachment:   toProtoAttachment(attachment),
+		StorageKey:   attachment.StorageKey,
+		ThumbnailKey: attachment.ThumbnailKey,
+	}, nil
+}
+
+// ClaimAttachment keeps an attachment the user uploaded from being purged
+// while unsent, as the gateway does for avatars
+func (c *MessageServiceServer) ClaimAttachment(ctx context.Context, request *proto.ClaimAttachmentRequest) (*proto.ClaimAttachmentResponse, error) {
+	attachment, err := c.findUserAttachment(uint(request.UserId), uint(request.AttachmentId))
+	if err != nil {
+		return nil, err
+	}
+	// Purged meanwhile
+	if err := c.AttachmentRepo.ClaimAttachment(attachment.ID); errors.Is(err, repositories.ErrNotFound) {
+		return nil, errAttachmentMissing
+	} else if err != nil {
+		return nil, unavailable("claim attachment", err)
+	}
+	attachment.Claimed = true
+
+	return &proto.ClaimAttachmentResponse{Attachment: toProtoAttachment(attachment)}, nil
+}
+
+// maxPurgeLimit bounds the attachments removed by one purge
+const maxPurgeLimit = 1000
+
+// PurgeUnsentAttachments removes attachments that were uploaded before the
+// cutoff and never sent nor claimed, returning their storage keys for the gateway to
+// delete the files
+func (c *MessageServiceServer) PurgeUnsentAttachments(ctx context.Context, request *proto.PurgeUnsentAttachmentsRequest) (*proto.PurgeUnsentAttachmentsResponse, error) {
+	var violations []fieldViolation
+	if request.UploadedBefore <= 0 {
+		violations = append(violations, fieldViolation{"uploadedBefore", "must be a positive Unix time"})
+	}
+	if request.Limit <= 0 || request.Limit > maxPurgeLimit {
+		violations = append(violations, fieldViolation{"limit", "must be between 1 and 1000"})
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid purge", violations...)
+	}
+
+	attachments, err := c.AttachmentRepo.DeleteUnsentAttachments(time.Unix(request.UploadedBefore, 0), int(request.Limit))
+	if err != nil {
+		return nil, unavailable("delete unsent attachments", err)
+	}
+	response := &proto.PurgeUnsentAttachmentsResponse{}
+	for _, attachment := range attachments {
+		response.StorageKeys = append(response.StorageKeys, attachment.StorageKey)
+		if attachment.ThumbnailKey != "" {
+			response.StorageKeys = append(response.StorageKeys, attachment.ThumbnailKey)
+		}
+	}
+	return response, nil
+}
+
+// findUserAttachment looks up an attachment, reporting it as missing unless
+// the user uploaded it
+func (c *MessageServiceServer) findUserAttachment(userID, attachmentID uint) (*models.Attachment, error) {
+	attachment, err := c.AttachmentRepo.FindAttachment(attachmentID)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && attachment.UploaderID != userID) {
+		return nil, errAttachmentMissing
+	}
+	if err != nil {
+		return nil, unavailable("look up attachment", err)
+	}
+	return attachment, nil
+}
+
+func toProtoAttachment(attachment *models.Attachment) *proto.Attachment {
+	return &proto.Attachment{
+		AttachmentId: int64(attachment.ID),
+		FileName:     attachment.FileName,
+		ContentType:  attachment.ContentType,
+		Size:         attachment.Size,
+		HasThumbnail: attachment.ThumbnailKey != "",
+		Width:        int32(attachment.Width),
+		Height:       int32(attachment.Height),
+		UploaderId:   int32(attachment.UploaderID),
+	}
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/repositories"
+	"time"
+)
+
+// ListConversations pages through the user's conversations, most recently
+// active first, each with its last message
+func (c *MessageServiceServer) ListConversations(ctx context.Context, request *proto.ListConversationsRequest) (*proto.ListConversationsResponse, error) {
+	var after *repositories.ConversationPosition
+	if request.Cursor != "" {
+		position, err := decodeCursor(request.Cursor, 2)
+		if err != nil {
+			return nil, invalidArgument("invalid cursor", fieldViolation{"cursor", "must be a cursor returned by a previous page"})
+		}
+		after = &repositories.ConversationPosition{LastMessageAt: time.UnixMicro(position[0]), ID: uint(position[1])}
+	}
+
+	limit := pageSize(request.PageSize)
+	// One extra conversation tells whether another page follows
+	conversations, err := c.ConversationRepo.ListConversations(uint(request.UserId), after, limit+1)
+	if err != nil {
+		return nil, unavailable("list conversations", err)
+	}
+
+	response := &proto.ListConversationsResponse{}
+	if len(conversations) > limit {
+		conversations = conversations[:limit]
+		last := conversations[limit-1]
+		response.NextCursor = encodeCursor(last.LastMessageAt.UnixMicro(), int64(last.ID))
+	}
+
+	conversationIDs := make([]uint, 0, len(conversations))
+	for _, conversation := range conversations {
+		conversationIDs = append(conversationIDs, conversation.ID)
+	}
+	lastMessages, err := c.MessageRepo.LastMessages(uint(request.UserId), conversationIDs)
+	if err != nil {
+		return nil, unavailable("load last messages", err)
+	}
+
+	for i := range conversations {
+		conversation := toProtoConversation(&conversations[i])
+		if message, ok := lastMessages[conversations[i].ID]; ok {
+			conversation.LastMessage = toProtoMessage(&message)
+		}
+		response.Conversations = append(response.Conversations, conversation)
+	}
+	return response, nil
+}
+
+func toProtoConversation(conversation *models.Conversation) *proto.Conversation {
+	result := &proto.Conversation{
+		ConversationId: int64(conversation.ID),
+		Kind:           conversation.Kind,
+		Title:          conversation.Title,
+		CreatedAt:      conversation.Created.Unix(),
+	}
+	for _, participant := range conversation.Participants {
+		result.ParticipantIds = append(result.ParticipantIds, int32(participant.UserID))
+		result.Members = append(result.Members, &proto.Member{
+			UserId:   int32(participant.UserID),
+			Role:     participant.Role,
+			JoinedAt: participant.JoinedAt.Unix(),
+		})
+	}
+	return result
+}
+
+// ListParticipants returns who takes part in the conversation, letting
+// notification-service relay ephemeral signals such as typing indicators
+func (c *MessageServiceServer) ListParticipants(ctx context.Context, request *proto.ListParticipantsRequest) (*proto.ListParticipantsResponse, error) {
+	conversation, err := c.findUserConversation(uint(request.UserId), uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &proto.ListParticipantsResponse{}
+	for _, userID := range participantIDs(conversation) {
+		response.UserIds = append(response.UserIds, int32(userID))
+	}
+	return response, nil
+}
+
+// ListContacts returns everyone sharing a conversation with the user, who
+// notification-service tells about the user's presence
+func (c *MessageServiceServer) ListContacts(ctx context.Context, request *proto.ListContactsRequest) (*proto.ListContactsResponse, error) {
+	contactIDs, err := c.ConversationRepo.ContactIDs(uint(request.UserId))
+	if err != nil {
+		return nil, unavailable("list contacts", err)
+	}
+
+	response := &proto.ListContactsResponse{}
+	for _, contactID := range contactIDs {
+		response.UserIds = append(response.UserIds, int32(contactID))
+	}
+	return response, nil
+}
+
+// findRecipient makes sure the user a direct conversation is started with exists
+func (c *MessageServiceServer) findRecipient(ctx context.Context, recipientID uint) error {
+	names, err := c.Users.FindUsers(ctx, []uint{recipientID})
+	if err != nil {
+		return unavailable("look up recipient", err)
+	}
+	if _, ok := names[recipientID]; !ok {
+		return errRecipientNotFound
+	}
+	return nil
+}
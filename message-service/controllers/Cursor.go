@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor packs the position a page ended at into an opaque string,
+// so clients don't come to depend on its layout
+func encodeCursor(position ...int64) string {
+	parts := make([]string, 0, len(position))
+	for _, value := range position {
+		parts = append(parts, strconv.FormatInt(value, 10))
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(parts, ".")))
+}
+
+// decodeCursor unpacks a cursor made of the given number of values
+func decodeCursor(cursor string, length int) ([]int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != length {
+		return nil, errInvalidCursor
+	}
+	position := make([]int64, 0, length)
+	for _, part := range parts {
+		value, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		position = append(position, value)
+	}
+	return position, nil
+}
+
+// pageSize applies the default to unset page sizes and caps large ones
+func pageSize(requested int32) int {
+	switch {
+	case requested <= 0:
+		return defaultPageSize
+	case requested > maxPageSize:
+		return maxPageSize
+	default:
+		return int(requested)
+	}
+}
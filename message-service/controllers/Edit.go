@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/repositories"
+	"time"
+)
+
+// EditMessage replaces the text of one of the caller's messages within the
+// edit window, keeping the previous text in its history, and announces the
+// new text to every participant
+func (c *MessageServiceServer) EditMessage(ctx context.Context, request *proto.EditMessageRequest) (*proto.EditMessageResponse, error) {
+	text, violations := validateText(request.Text)
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid message", violations...)
+	}
+
+	conversation, message, err := c.findUserMessage(uint(request.UserId), uint(request.MessageId))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case message.SenderID != uint(request.UserId):
+		return nil, errNotSender
+	case message.DeletedAt != nil:
+		return nil, errMessageDeleted
+	case c.EditWindow > 0 && time.Since(message.Created) > c.EditWindow:
+		return nil, errEditWindowPassed
+	case message.Text == text:
+		return &proto.EditMessageResponse{Message: toProtoMessage(message)}, nil
+	}
+
+	previousText := message.Text
+	editedAt := time.Now()
+	message.Text, message.EditedAt = text, &editedAt
+	err = c.MessageRepo.EditMessage(message, previousText)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errMessageDeleted
+	}
+	if err != nil {
+		return nil, unavailable("edit message", err)
+	}
+
+	// The edit is stored either way, devices that miss the event pick it
+	// up from the history
+	if err := c.Publisher.MessageEdited(ctx, message, participantIDs(conversation)); err != nil {
+		log.Printf("Failed to publish edit of message %d: %v", message.ID, err)
+	}
+
+	return &proto.EditMessageResponse{Message: toProtoMessage(message)}, nil
+}
+
+// DeleteMessage deletes a message for every participant, which only its
+// sender may do, or hides it from the caller. Either way the caller's other
+// devices, and for everyone the other participants, are told to remove it.
+func (c *MessageServiceServer) DeleteMessage(ctx context.Context, request *proto.DeleteMessageRequest) (*proto.DeleteMessageResponse, error) {
+	userID := uint(request.UserId)
+	conversation, message, err := c.findUserMessage(userID, uint(request.MessageId))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &proto.DeleteMessageResponse{MessageId: int64(message.ID), ForEveryone: request.ForEveryone}
+	deletion := &events.MessageDeletion{
+		MessageID:      message.ID,
+		ConversationID: conversation.ID,
+		UserID:         userID,
+		ForEveryone:    request.ForEveryone,
+		Created:        time.Now(),
+	}
+	recipients := []uint{userID}
+	switch {
+	case !request.ForEveryone:
+		if err := c.MessageRepo.HideMessage(message.ID, userID); err != nil {
+			return nil, unavailable("hide message", err)
+		}
+	case message.SenderID != userID:
+		return nil, errNotSender
+	case message.DeletedAt != nil:
+		// Deleted before, there is nothing new to announce
+		return response, nil
+	default:
+		attachments, err := c.MessageRepo.DeleteMessage(message.ID, deletion.Created)
+		if err != nil {
+			return nil, unavailable("delete message", err)
+		}
+		for _, attachment := range attachments {
+			response.StorageKeys = append(response.StorageKeys, attachment.StorageKey)
+			if attachment.ThumbnailKey != "" {
+				response.StorageKeys = append(response.StorageKeys, attachment.ThumbnailKey)
+			}
+		}
+		recipients = participantIDs(conversation)
+	}
+
+	if err := c.Publisher.MessageDeleted(ctx, deletion, recipients); err != nil {
+		log.Printf("Failed to publish deletion of message %d: %v", message.ID, err)
+	}
+
+	return response, nil
+}
+
+// GetEditHistory returns a message with the previous versions of its text
+func (c *MessageServiceServer) GetEditHistory(ctx context.Context, request *proto.GetEditHistoryRequest) (*proto.GetEditHistoryResponse, error) {
+	_, message, err := c.findUserMessage(uint(request.UserId), uint(request.MessageId))
+	if err != nil {
+		return nil, err
+	}
+
+	edits, err := c.MessageRepo.ListEdits(message.ID)
+	if err != nil {
+		return nil, unavailable("list edits", err)
+	}
+
+	response := &proto.GetEditHistoryResponse{Message: toProtoMessage(message)}
+	for _, edit := range edits {
+		response.Edits = append(response.Edits, &proto.MessageEdit{Text: edit.Text, EditedAt: edit.EditedAt.Unix()})
+	}
+	return response, nil
+}
+
+// findUserMessage makes sure the message exists and the user takes part in
+// its conversation. Messages of other conversations are reported as
+// missing, so their existence isn't revealed.
+func (c *MessageServiceServer) findUserMessage(userID, messageID uint) (*models.Conversation, *models.Message, error) {
+	message, err := c.MessageRepo.FindMessage(messageID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, nil, errMessageNotFound
+	}
+	if err != nil {
+		return nil, nil, unavailable("look up message", err)
+	}
+
+	conversation, err := c.findUserConversation(userID, message.ConversationID)
+	if errors.Is(err, errConversationNotFound) {
+		return nil, nil, errMessageNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return conversation, message, nil
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+)
+
+// Conversations the caller doesn't belong to are reported as missing, so
+// their existence isn't revealed
+var errConversationNotFound = status.Error(codes.NotFound, "conversation not found")
+
+var (
+	errMemberNotFound    = status.Error(codes.NotFound, "member not found")
+	errRecipientNotFound = status.Error(codes.NotFound, "recipient not found")
+	errMessageNotFound   = status.Error(codes.NotFound, "message not found")
+	errNotAGroup         = status.Error(codes.FailedPrecondition, "conversation is not a group")
+	errOwnerMustTransfer = status.Error(codes.FailedPrecondition, "transfer ownership before leaving the group")
+	errPermissionDenied  = status.Error(codes.PermissionDenied, "not allowed to change this group")
+	errNotSender         = status.Error(codes.PermissionDenied, "only the sender can change this message")
+	errMessageDeleted    = status.Error(codes.FailedPrecondition, "message was deleted")
+	errEditWindowPassed  = status.Error(codes.FailedPrecondition, "message can no longer be edited")
+	errAttachmentMissing = status.Error(codes.NotFound, "attachment not found")
+	errAttachmentSent    = status.Error(codes.FailedPrecondition, "attachment was already sent")
+)
+
+// fieldViolation describes why a single request field was rejected
+type fieldViolation struct {
+	field       string
+	description string
+}
+
+// invalidArgument rejects the request, listing every offending field
+func invalidArgument(message string, violations ...fieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.field,
+			Description: violation.description,
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, message).WithDetails(badRequest)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, message)
+	}
+	return st.Err()
+}
+
+// unavailable logs a storage failure and hides its details from the caller,
+// who may retry once the database is back
+func unavailable(operation string, err error) error {
+	log.Printf("Failed to %s: %v", operation, err)
+	return status.Error(codes.Unavailable, "service temporarily unavailable")
+}
@@ -0,0 +1,381 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxGroupSize is the largest number of participants of a group
+	maxGroupSize = 256
+	// maxTitleLength is the longest group title, in characters
+	maxTitleLength = 100
+)
+
+// rank orders roles by privilege, a participant can only manage those ranked below
+var rank = map[string]int{
+	models.RoleMember: 0,
+	models.RoleAdmin:  1,
+	models.RoleOwner:  2,
+}
+
+// CreateGroup starts a group owned by the caller
+func (c *MessageServiceServer) CreateGroup(ctx context.Context, request *proto.CreateGroupRequest) (*proto.ConversationResponse, error) {
+	userID := uint(request.UserId)
+	memberIDs := newMemberIDs(request.MemberIds, nil, userID)
+
+	var violations []fieldViolation
+	title := strings.TrimSpace(request.Title)
+	switch {
+	case title == "":
+		violations = append(violations, fieldViolation{"title", "must not be empty"})
+	case utf8.RuneCountInString(title) > maxTitleLength:
+		violations = append(violations, fieldViolation{"title", fmt.Sprintf("must be at most %d characters long", maxTitleLength)})
+	}
+	if len(memberIDs)+1 > maxGroupSize {
+		violations = append(violations, fieldViolation{"memberIds", fmt.Sprintf("a group has at most %d members", maxGroupSize)})
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid group", violations...)
+	}
+
+	names, err := c.findMembers(ctx, userID, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	conversation := models.Conversation{
+		Kind:          models.ConversationGroup,
+		Title:         title,
+		LastMessageAt: now,
+		Created:       now,
+		Participants:  []models.Participant{{UserID: userID, Role: models.RoleOwner, JoinedAt: now}},
+	}
+	for _, memberID := range memberIDs {
+		conversation.Participants = append(conversation.Participants, models.Participant{
+			UserID:   memberID,
+			Role:     models.RoleMember,
+			JoinedAt: now,
+		})
+	}
+	if err := c.ConversationRepo.CreateGroup(&conversation); err != nil {
+		return nil, unavailable("create group", err)
+	}
+
+	text := fmt.Sprintf("%s created the group %q", names[userID], title)
+	if len(memberIDs) > 0 {
+		text += " with " + joinNames(names, memberIDs)
+	}
+	c.publishMembershipChange(ctx, &conversation, &events.MembershipChange{
+		ActorID:   userID,
+		Action:    events.ActionCreated,
+		MemberIDs: memberIDs,
+		Text:      text,
+	})
+	return c.conversationResponse(conversation.ID)
+}
+
+// AddMembers invites users to a group, which owners and admins may do
+func (c *MessageServiceServer) AddMembers(ctx context.Context, request *proto.AddMembersRequest) (*proto.ConversationResponse, error) {
+	userID := uint(request.UserId)
+	conversation, actor, err := c.findGroupMembership(userID, uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+	if rank[actor.Role] < rank[models.RoleAdmin] {
+		return nil, errPermissionDenied
+	}
+
+	memberIDs := newMemberIDs(request.MemberIds, conversation, userID)
+	if len(memberIDs) == 0 {
+		return &proto.ConversationResponse{Conversation: toProtoConversation(conversation)}, nil
+	}
+	if len(conversation.Participants)+len(memberIDs) > maxGroupSize {
+		return nil, invalidArgument("group is full", fieldViolation{"memberIds", fmt.Sprintf("a group has at most %d members", maxGroupSize)})
+	}
+
+	names, err := c.findMembers(ctx, userID, memberIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	participants := make([]models.Participant, 0, len(memberIDs))
+	for _, memberID := range memberIDs {
+		participants = append(participants, models.Participant{
+			ConversationID: conversation.ID,
+			UserID:         memberID,
+			Role:           models.RoleMember,
+			JoinedAt:       now,
+		})
+	}
+	if err := c.ConversationRepo.AddParticipants(participants); err != nil {
+		return nil, unavailable("add members", err)
+	}
+	conversation.Participants = append(conversation.Participants, participants...)
+
+	c.publishMembershipChange(ctx, conversation, &events.MembershipChange{
+		ActorID:   userID,
+		Action:    events.ActionAdded,
+		MemberIDs: memberIDs,
+		Text:      fmt.Sprintf("%s added %s", names[userID], joinNames(names, memberIDs)),
+	})
+	return c.conversationResponse(conversation.ID)
+}
+
+// RemoveMember removes a participant ranked below the caller from a group
+func (c *MessageServiceServer) RemoveMember(ctx context.Context, request *proto.RemoveMemberRequest) (*proto.ConversationResponse, error) {
+	userID, memberID := uint(request.UserId), uint(request.MemberId)
+	if userID == memberID {
+		return nil, invalidArgument("invalid member", fieldViolation{"memberId", "use LeaveGroup to leave a group"})
+	}
+
+	conversation, actor, err := c.findGroupMembership(userID, uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+	member := findParticipant(conversation, memberID)
+	if member == nil {
+		return nil, errMemberNotFound
+	}
+	if rank[actor.Role] < rank[models.RoleAdmin] || rank[actor.Role] <= rank[member.Role] {
+		return nil, errPermissionDenied
+	}
+
+	if err := c.ConversationRepo.RemoveParticipant(conversation.ID, memberID); err != nil {
+		return nil, unavailable("remove member", err)
+	}
+
+	// The removed member is told as well, so their devices drop the group
+	names := c.userNames(ctx, userID, memberID)
+	c.publishMembershipChange(ctx, conversation, &events.MembershipChange{
+		ActorID:   userID,
+		Action:    events.ActionRemoved,
+		MemberIDs: []uint{memberID},
+		Text:      fmt.Sprintf("%s removed %s", names[userID], names[memberID]),
+	})
+	return c.conversationResponse(conversation.ID)
+}
+
+// UpdateMemberRole promotes a member to admin or demotes an admin, which
+// only the owner may do
+func (c *MessageServiceServer) UpdateMemberRole(ctx context.Context, request *proto.UpdateMemberRoleRequest) (*proto.ConversationResponse, error) {
+	userID, memberID := uint(request.UserId), uint(request.MemberId)
+	if request.Role != models.RoleAdmin && request.Role != models.RoleMember {
+		return nil, invalidArgument("invalid role", fieldViolation{"role", "must be admin or member"})
+	}
+
+	conversation, actor, err := c.findGroupMembership(userID, uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != models.RoleOwner {
+		return nil, errPermissionDenied
+	}
+	member := findParticipant(conversation, memberID)
+	if member == nil {
+		return nil, errMemberNotFound
+	}
+	if memberID == userID {
+		return nil, invalidArgument("invalid member", fieldViolation{"memberId", "use TransferOwnership to hand over the group"})
+	}
+	if member.Role == request.Role {
+		return &proto.ConversationResponse{Conversation: toProtoConversation(conversation)}, nil
+	}
+
+	if err := c.ConversationRepo.UpdateParticipantRole(conversation.ID, memberID, request.Role); err != nil {
+		return nil, unavailable("update member role", err)
+	}
+
+	names := c.userNames(ctx, userID, memberID)
+	c.publishMembershipChange(ctx, conversation, &events.MembershipChange{
+		ActorID:   userID,
+		Action:    events.ActionRoleChanged,
+		MemberIDs: []uint{memberID},
+		Role:      request.Role,
+		Text:      fmt.Sprintf("%s made %s %s", names[userID], names[memberID], roleArticle(request.Role)),
+	})
+	return c.conversationResponse(conversation.ID)
+}
+
+// TransferOwnership hands the group over to another member, the previous
+// owner stays on as admin
+func (c *MessageServiceServer) TransferOwnership(ctx context.Context, request *proto.TransferOwnershipRequest) (*proto.ConversationResponse, error) {
+	userID, newOwnerID := uint(request.UserId), uint(request.NewOwnerId)
+	conversation, actor, err := c.findGroupMembership(userID, uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != models.RoleOwner {
+		return nil, errPermissionDenied
+	}
+	if newOwnerID == userID {
+		return nil, invalidArgument("invalid owner", fieldViolation{"newOwnerId", "must be another member"})
+	}
+	if findParticipant(conversation, newOwnerID) == nil {
+		return nil, errMemberNotFound
+	}
+
+	if err := c.ConversationRepo.TransferOwnership(conversation.ID, userID, newOwnerID); err != nil {
+		return nil, unavailable("transfer ownership", err)
+	}
+
+	names := c.userNames(ctx, userID, newOwnerID)
+	c.publishMembershipChange(ctx, conversation, &events.MembershipChange{
+		ActorID:   userID,
+		Action:    events.ActionOwnershipTransferred,
+		MemberIDs: []uint{newOwnerID},
+		Role:      models.RoleOwner,
+		Text:      fmt.Sprintf("%s made %s the owner", names[userID], names[newOwnerID]),
+	})
+	return c.conversationResponse(conversation.ID)
+}
+
+// LeaveGroup removes the caller from a group. Owners have to hand the group
+// over first, unless they are its last member.
+func (c *MessageServiceServer) LeaveGroup(ctx context.Context, request *proto.LeaveGroupRequest) (*proto.LeaveGroupResponse, error) {
+	userID := uint(request.UserId)
+	conversation, actor, err := c.findGroupMembership(userID, uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role == models.RoleOwner && len(conversation.Participants) > 1 {
+		return nil, errOwnerMustTransfer
+	}
+
+	if err := c.ConversationRepo.RemoveParticipant(conversation.ID, userID); err != nil {
+		return nil, unavailable("leave group", err)
+	}
+
+	names := c.userNames(ctx, userID)
+	c.publishMembershipChange(ctx, conversation, &events.MembershipChange{
+		ActorID:   userID,
+		Action:    events.ActionLeft,
+		MemberIDs: []uint{userID},
+		Text:      fmt.Sprintf("%s left", names[userID]),
+	})
+	return &proto.LeaveGroupResponse{Message: "left group"}, nil
+}
+
+// findGroupMembership returns the group and the caller's participation in it
+func (c *MessageServiceServer) findGroupMembership(userID, conversationID uint) (*models.Conversation, *models.Participant, error) {
+	conversation, err := c.findUserConversation(userID, conversationID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if conversation.Kind != models.ConversationGroup {
+		return nil, nil, errNotAGroup
+	}
+	return conversation, findParticipant(conversation, userID), nil
+}
+
+// findMembers makes sure every member exists and returns their names
+// together with the caller's
+func (c *MessageServiceServer) findMembers(ctx context.Context, userID uint, memberIDs []uint) (map[uint]string, error) {
+	names, err := c.Users.FindUsers(ctx, append([]uint{userID}, memberIDs...))
+	if err != nil {
+		return nil, unavailable("look up users", err)
+	}
+
+	var violations []fieldViolation
+	for _, memberID := range memberIDs {
+		if _, ok := names[memberID]; !ok {
+			violations = append(violations, fieldViolation{"memberIds", fmt.Sprintf("user %d does not exist", memberID)})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("unknown members", violations...)
+	}
+	return names, nil
+}
+
+// userNames returns the names used in system messages. The change already
+// happened, so users that can't be looked up are named by their ID.
+func (c *MessageServiceServer) userNames(ctx context.Context, userIDs ...uint) map[uint]string {
+	names, err := c.Users.FindUsers(ctx, userIDs)
+	if err != nil {
+		log.Printf("Failed to look up users %v: %v", userIDs, err)
+		names = make(map[uint]string)
+	}
+	for _, userID := range userIDs {
+		if _, ok := names[userID]; !ok {
+			names[userID] = fmt.Sprintf("user %d", userID)
+		}
+	}
+	return names
+}
+
+// publishMembershipChange announces the change to everyone who took part
+// in the group before or after it
+func (c *MessageServiceServer) publishMembershipChange(ctx context.Context, conversation *models.Conversation, change *events.MembershipChange) {
+	change.ConversationID = conversation.ID
+	change.Created = time.Now()
+	if err := c.Publisher.MembershipChanged(ctx, change, participantIDs(conversation)); err != nil {
+		log.Printf("Failed to publish membership change of conversation %d: %v", conversation.ID, err)
+	}
+}
+
+func (c *MessageServiceServer) conversationResponse(conversationID uint) (*proto.ConversationResponse, error) {
+	conversation, err := c.ConversationRepo.FindConversation(conversationID)
+	if err != nil {
+		return nil, unavailable("look up conversation", err)
+	}
+	return &proto.ConversationResponse{Conversation: toProtoConversation(conversation)}, nil
+}
+
+// newMemberIDs drops duplicates, the caller and users already in the conversation
+func newMemberIDs(requested []int32, conversation *models.Conversation, userID uint) []uint {
+	seen := map[uint]bool{userID: true}
+	if conversation != nil {
+		for _, participant := range conversation.Participants {
+			seen[participant.UserID] = true
+		}
+	}
+
+	var memberIDs []uint
+	for _, id := range requested {
+		memberID := uint(id)
+		if id <= 0 || seen[memberID] {
+			continue
+		}
+		seen[memberID] = true
+		memberIDs = append(memberIDs, memberID)
+	}
+	return memberIDs
+}
+
+func findParticipant(conversation *models.Conversation, userID uint) *models.Participant {
+	for i := range conversation.Participants {
+		if conversation.Participants[i].UserID == userID {
+			return &conversation.Participants[i]
+		}
+	}
+	return nil
+}
+
+// joinNames lists the users' names as "a, b and c"
+func joinNames(names map[uint]string, userIDs []uint) string {
+	list := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		list = append(list, names[userID])
+	}
+	if len(list) == 1 {
+		return list[0]
+	}
+	return strings.Join(list[:len(list)-1], ", ") + " and " + list[len(list)-1]
+}
+
+func roleArticle(role string) string {
+	if role == models.RoleAdmin {
+		return "an admin"
+	}
+	return "a member"
+}
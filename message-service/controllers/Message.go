@@ -0,0 +1,342 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/repositories"
+	"message-service/users"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+	// maxMessageLength is the longest message text, in characters
+	maxMessageLength = 4096
+	// maxAttachments is how many files a single message may carry
+	maxAttachments = 10
+)
+
+type MessageServiceServer struct {
+	proto.UnimplementedMessageServiceServer
+	ConversationRepo repositories.ConversationRepository
+	MessageRepo      repositories.MessageRepository
+	ReactionRepo     repositories.ReactionRepository
+	AttachmentRepo   repositories.AttachmentRepository
+	Publisher        events.Publisher
+	Users            users.Directory
+	// EditWindow is how long after sending a message its sender may edit it
+	EditWindow time.Duration
+}
+
+// SendMessage stores a message and announces it to every participant,
+// including the sender's other devices. Messages may quote another message
+// of the conversation, and may be posted to the thread of one instead of
+// the conversation itself. Messages carrying attachments may have no text.
+func (c *MessageServiceServer) SendMessage(ctx context.Context, request *proto.SendMessageRequest) (*proto.SendMessageResponse, error) {
+	userID := uint(request.UserId)
+
+	text, violations := validateText(request.Text)
+	if text == "" && len(request.AttachmentIds) > 0 {
+		violations = nil
+	}
+	if request.ConversationId == 0 && (request.RecipientId <= 0 || request.RecipientId == request.UserId) {
+		violations = append(violations, fieldViolation{"recipientId", "must name another user when no conversation is given"})
+	}
+	if request.ReplyToMessageId < 0 {
+		violations = append(violations, fieldViolation{"replyToMessageId", "must be a positive integer when given"})
+	}
+	if request.ThreadRootId < 0 {
+		violations = append(violations, fieldViolation{"threadRootId", "must be a positive integer when given"})
+	}
+	violations = append(violations, validateAttachmentIDs(request.AttachmentIds)...)
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid message", violations...)
+	}
+
+	var conversation *models.Conversation
+	var err error
+	if request.ConversationId == 0 {
+		if err := c.findRecipient(ctx, uint(request.RecipientId)); err != nil {
+			return nil, err
+		}
+		conversation, err = c.ConversationRepo.FindOrCreateDirectConversation(userID, uint(request.RecipientId))
+		if err != nil {
+			return nil, unavailable("start conversation", err)
+		}
+	} else if conversation, err = c.findUserConversation(userID, uint(request.ConversationId)); err != nil {
+		return nil, err
+	}
+
+	message := models.Message{
+		ConversationID: conversation.ID,
+		SenderID:       userID,
+		Text:           text,
+		Created:        time.Now(),
+	}
+	var quoted *models.Message
+	if request.ReplyToMessageId > 0 {
+		if quoted, err = c.findConversationMessage(conversation.ID, uint(request.ReplyToMessageId)); err != nil {
+			return nil, err
+		}
+		message.ReplyToID = &quoted.ID
+	}
+	if request.ThreadRootId > 0 {
+		root, err := c.findConversationMessage(conversation.ID, uint(request.ThreadRootId))
+		if err != nil {
+			return nil, err
+		}
+		if root.ThreadRootID != nil {
+			return nil, invalidArgument("invalid message", fieldViolation{"threadRootId", "must not name a thread reply, threads don't nest"})
+		}
+		message.ThreadRootID = &root.ID
+	}
+	for _, attachmentID := range request.AttachmentIds {
+		attachment, err := c.findUserAttachment(userID, uint(attachmentID))
+		if err != nil {
+			return nil, err
+		}
+		if attachment.MessageID != nil {
+			return nil, errAttachmentSent
+		}
+		message.Attachments = append(message.Attachments, *attachment)
+	}
+	err = c.MessageRepo.CreateMessage(&message)
+	if errors.Is(err, repositories.ErrAttachmentUnavailable) {
+		// Sent with another message meanwhile
+		return nil, errAttachmentSent
+	}
+	if err != nil {
+		return nil, unavailable("store message", err)
+	}
+
+	// The message is stored either way, devices that miss the event pick it
+	// up from the history
+	recipients := participantIDs(conversation)
+	if message.ThreadRootID != nil {
+		err = c.Publisher.ThreadReplyCreated(ctx, &message, recipients)
+	} else {
+		err = c.Publisher.MessageCreated(ctx, &message, recipients)
+	}
+	if err != nil {
+		log.Printf("Failed to publish message %d: %v", message.ID, err)
+	}
+
+	response := &proto.SendMessageResponse{Message: toProtoMessage(&message)}
+	if quoted != nil {
+		response.Message.ReplyTo = toProtoQuote(quoted)
+	}
+	return response, nil
+}
+
+// GetHistory pages through a conversation, newest messages first
+func (c *MessageServiceServer) GetHistory(ctx context.Context, request *proto.GetHistoryRequest) (*proto.GetHistoryResponse, error) {
+	var beforeID uint
+	if request.Cursor != "" {
+		position, err := decodeCursor(request.Cursor, 1)
+		if err != nil {
+			return nil, invalidArgument("invalid cursor", fieldViolation{"cursor", "must be a cursor returned by a previous page"})
+		}
+		beforeID = uint(position[0])
+	}
+
+	conversation, err := c.findUserConversation(uint(request.UserId), uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+
+	limit := pageSize(request.PageSize)
+	// One extra message tells whether another page follows
+	messages, err := c.MessageRepo.ListMessages(conversation.ID, uint(request.UserId), beforeID, limit+1)
+	if err != nil {
+		return nil, unavailable("list messages", err)
+	}
+
+	response := &proto.GetHistoryResponse{}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		response.NextCursor = encodeCursor(int64(messages[limit-1].ID))
+	}
+	if response.Messages, err = c.toProtoMessages(uint(request.UserId), messages); err != nil {
+		return nil, unavailable("load message details", err)
+	}
+	return response, nil
+}
+
+// findUserConversation makes sure the conversation exists and the user takes part in it
+func (c *MessageServiceServer) findUserConversation(userID, conversationID uint) (*models.Conversation, error) {
+	conversation, err := c.ConversationRepo.FindConversation(conversationID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errConversationNotFound
+	}
+	if err != nil {
+		return nil, unavailable("look up conversation", err)
+	}
+
+	for _, participant := range conversation.Participants {
+		if participant.UserID == userID {
+			return conversation, nil
+		}
+	}
+	return nil, errConversationNotFound
+}
+
+// findConversationMessage looks up a message, reporting it as missing
+// unless it belongs to the conversation
+func (c *MessageServiceServer) findConversationMessage(conversationID, messageID uint) (*models.Message, error) {
+	message, err := c.MessageRepo.FindMessage(messageID)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && message.ConversationID != conversationID) {
+		return nil, errMessageNotFound
+	}
+	if err != nil {
+		return nil, unavailable("look up message", err)
+	}
+	return message, nil
+}
+
+// validateText trims the text of a message, which must be neither empty nor
+// too long
+func validateText(text string) (string, []fieldViolation) {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return text, []fieldViolation{{"text", "must not be empty"}}
+	case utf8.RuneCountInString(text) > maxMessageLength:
+		return text, []fieldViolation{{"text", "must be at most 4096 characters long"}}
+	}
+	return text, nil
+}
+
+// validateAttachmentIDs checks the attachments of a message are few and
+// given once each
+func validateAttachmentIDs(attachmentIDs []int64) []fieldViolation {
+	if len(attachmentIDs) > maxAttachments {
+		return []fieldViolation{{"attachmentIds", "must list at most 10 attachments"}}
+	}
+	seen := make(map[int64]bool, len(attachmentIDs))
+	for _, attachmentID := range attachmentIDs {
+		if attachmentID <= 0 || seen[attachmentID] {
+			return []fieldViolation{{"attachmentIds", "must list distinct positive integers"}}
+		}
+		seen[attachmentID] = true
+	}
+	return nil
+}
+
+func participantIDs(conversation *models.Conversation) []uint {
+	userIDs := make([]uint, 0, len(conversation.Participants))
+	for _, participant := range conversation.Participants {
+		userIDs = append(userIDs, participant.UserID)
+	}
+	return userIDs
+}
+
+// toProtoMessages maps messages shown to the user, along with their
+// attachments, the messages they quote, their reactions and the thread
+// replies the user hasn't read
+func (c *MessageServiceServer) toProtoMessages(userID uint, messages []models.Message) ([]*proto.Message, error) {
+	var messageIDs, quotedIDs, rootIDs []uint
+	for _, message := range messages {
+		messageIDs = append(messageIDs, message.ID)
+		if message.ReplyToID != nil {
+			quotedIDs = append(quotedIDs, *message.ReplyToID)
+		}
+		if message.ReplyCount > 0 {
+			rootIDs = append(rootIDs, message.ID)
+		}
+	}
+
+	quoted, err := c.MessageRepo.FindMessages(quotedIDs)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := c.ReactionRepo.ReactionCounts(userID, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	unread, err := c.MessageRepo.UnreadThreadCounts(userID, rootIDs)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := c.AttachmentRepo.ListAttachments(messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*proto.Message, 0, len(messages))
+	for i := range messages {
+		messages[i].Attachments = attachments[messages[i].ID]
+		message := toProtoMessage(&messages[i])
+		if replyToID := messages[i].ReplyToID; replyToID != nil {
+			if quote, ok := quoted[*replyToID]; ok {
+				message.ReplyTo = toProtoQuote(&quote)
+			}
+		}
+		message.Reactions = toProtoReactions(reactions[messages[i].ID])
+		if message.Thread != nil {
+			message.Thread.UnreadCount = int32(unread[messages[i].ID])
+		}
+		result = append(result, message)
+	}
+	return result, nil
+}
+
+// toProtoMessage maps the message alone, quoting only the ID of the message
+// it replies to and leaving out reactions and unread thread replies.
+// Attachments are mapped if loaded.
+func toProtoMessage(message *models.Message) *proto.Message {
+	result := &proto.Message{
+		MessageId:      int64(message.ID),
+		ConversationId: int64(message.ConversationID),
+		SenderId:       int32(message.SenderID),
+		Text:           message.Text,
+		CreatedAt:      message.Created.Unix(),
+		Deleted:        message.DeletedAt != nil,
+	}
+	if message.EditedAt != nil {
+		result.EditedAt = message.EditedAt.Unix()
+	}
+	if message.ReplyToID != nil {
+		result.ReplyTo = &proto.Quote{MessageId: int64(*message.ReplyToID)}
+	}
+	if message.ThreadRootID != nil {
+		result.ThreadRootId = int64(*message.ThreadRootID)
+	}
+	if message.ReplyCount > 0 {
+		result.Thread = &proto.ThreadSummary{ReplyCount: int32(message.ReplyCount)}
+		if message.LastReplyAt != nil {
+			result.Thread.LastReplyAt = message.LastReplyAt.Unix()
+		}
+	}
+	for i := range message.Attachments {
+		result.Attachments = append(result.Attachments, toProtoAttachment(&message.Attachments[i]))
+	}
+	return result
+}
+
+func toProtoQuote(message *models.Message) *proto.Quote {
+	return &proto.Quote{
+		MessageId: int64(message.ID),
+		SenderId:  int32(message.SenderID),
+		Text:      message.Text,
+		Deleted:   message.DeletedAt != nil,
+	}
+}
+
+func toProtoReactions(counts []repositories.ReactionCount) []*proto.ReactionCount {
+	var result []*proto.ReactionCount
+	for _, count := range counts {
+		result = append(result, &proto.ReactionCount{
+			Emoji:       count.Emoji,
+			Count:       int32(count.Count),
+			ReactedByMe: count.ReactedByMe,
+		})
+	}
+	return result
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxEmojiLength is the longest reaction, in characters. Emojis made of
+// several code points, such as flags and families, stay below it.
+const maxEmojiLength = 16
+
+// AddReaction reacts to a message with an emoji, announcing the new count to
+// every participant. Reacting twice with the same emoji changes nothing.
+func (c *MessageServiceServer) AddReaction(ctx context.Context, request *proto.ReactionRequest) (*proto.ReactionResponse, error) {
+	return c.updateReaction(ctx, request, events.ActionAdded)
+}
+
+// RemoveReaction takes back one of the caller's reactions to a message
+func (c *MessageServiceServer) RemoveReaction(ctx context.Context, request *proto.ReactionRequest) (*proto.ReactionResponse, error) {
+	return c.updateReaction(ctx, request, events.ActionRemoved)
+}
+
+func (c *MessageServiceServer) updateReaction(ctx context.Context, request *proto.ReactionRequest, action string) (*proto.ReactionResponse, error) {
+	userID := uint(request.UserId)
+	if !validEmoji(request.Emoji) {
+		return nil, invalidArgument("invalid reaction", fieldViolation{"emoji", "must be an emoji"})
+	}
+
+	conversation, message, err := c.findUserMessage(userID, uint(request.MessageId))
+	if err != nil {
+		return nil, err
+	}
+	if message.DeletedAt != nil && action == events.ActionAdded {
+		return nil, errMessageDeleted
+	}
+
+	var changed bool
+	if action == events.ActionAdded {
+		changed, err = c.ReactionRepo.AddReaction(&models.Reaction{
+			MessageID: message.ID,
+			UserID:    userID,
+			Emoji:     request.Emoji,
+			Created:   time.Now(),
+		})
+	} else {
+		changed, err = c.ReactionRepo.RemoveReaction(message.ID, userID, request.Emoji)
+	}
+	if err != nil {
+		return nil, unavailable("store reaction", err)
+	}
+
+	counts, err := c.ReactionRepo.ReactionCounts(userID, []uint{message.ID})
+	if err != nil {
+		return nil, unavailable("count reactions", err)
+	}
+
+	if changed {
+		update := &events.ReactionUpdate{
+			MessageID:      message.ID,
+			ConversationID: conversation.ID,
+			UserID:         userID,
+			Emoji:          request.Emoji,
+			Action:         action,
+			Created:        time.Now(),
+		}
+		for _, count := range counts[message.ID] {
+			if count.Emoji == request.Emoji {
+				update.Count = count.Count
+			}
+		}
+		// The reaction is stored either way, devices that miss the event see
+		// it in the history
+		if err := c.Publisher.ReactionUpdated(ctx, update, participantIDs(conversation)); err != nil {
+			log.Printf("Failed to publish reaction of user %d to message %d: %v", userID, message.ID, err)
+		}
+	}
+
+	return &proto.ReactionResponse{MessageId: int64(message.ID), Reactions: toProtoReactions(counts[message.ID])}, nil
+}
+
+// validEmoji loosely checks that the reaction is an emoji: short, and free
+// of letters, spaces and control characters
+func validEmoji(emoji string) bool {
+	if emoji == "" || !utf8.ValidString(emoji) || utf8.RuneCountInString(emoji) > maxEmojiLength {
+		return false
+	}
+	for _, r := range emoji {
+		if unicode.IsLetter(r) || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}
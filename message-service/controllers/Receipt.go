@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"time"
+)
+
+// MarkDelivered records that every message of the conversation up to the
+// given one reached one of the caller's devices
+func (c *MessageServiceServer) MarkDelivered(ctx context.Context, request *proto.ReceiptRequest) (*proto.ReceiptResponse, error) {
+	return c.markReceipt(ctx, request, events.ReceiptDelivered)
+}
+
+// MarkRead records that the caller read every message of the conversation up
+// to the given one
+func (c *MessageServiceServer) MarkRead(ctx context.Context, request *proto.ReceiptRequest) (*proto.ReceiptResponse, error) {
+	return c.markReceipt(ctx, request, events.ReceiptRead)
+}
+
+// markReceipt moves the caller's mark forward and tells the senders of the
+// messages it passed over. Receipts for messages behind the mark are
+// accepted but change nothing, since devices report them out of order.
+func (c *MessageServiceServer) markReceipt(ctx context.Context, request *proto.ReceiptRequest, receiptStatus string) (*proto.ReceiptResponse, error) {
+	userID := uint(request.UserId)
+	if request.MessageId <= 0 {
+		return nil, invalidArgument("invalid receipt", fieldViolation{"messageId", "must be a positive integer"})
+	}
+
+	conversation, err := c.findUserConversation(userID, uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+	message, err := c.findConversationMessage(conversation.ID, uint(request.MessageId))
+	if err != nil {
+		return nil, err
+	}
+
+	participant := findParticipant(conversation, userID)
+	previous := participant.LastDeliveredMessageID
+	var advanced bool
+	if receiptStatus == events.ReceiptRead {
+		previous = participant.LastReadMessageID
+		advanced, err = c.ConversationRepo.MarkRead(conversation.ID, userID, message.ID)
+		participant.LastReadMessageID = max(participant.LastReadMessageID, message.ID)
+	} else {
+		advanced, err = c.ConversationRepo.MarkDelivered(conversation.ID, userID, message.ID)
+	}
+	if err != nil {
+		return nil, unavailable("store receipt", err)
+	}
+	participant.LastDeliveredMessageID = max(participant.LastDeliveredMessageID, message.ID)
+
+	if advanced {
+		c.publishReceipt(ctx, &events.ReceiptUpdate{
+			ConversationID: conversation.ID,
+			UserID:         userID,
+			Status:         receiptStatus,
+			MessageID:      message.ID,
+			Created:        time.Now(),
+		}, previous)
+	}
+
+	return &proto.ReceiptResponse{Receipt: toProtoReceipt(participant)}, nil
+}
+
+// publishReceipt announces the update to the senders of the messages between
+// the previous mark and the new one. The receipt is stored either way,
+// senders that miss the event see it in the read state.
+func (c *MessageServiceServer) publishReceipt(ctx context.Context, update *events.ReceiptUpdate, previous uint) {
+	senderIDs, err := c.MessageRepo.SenderIDs(update.ConversationID, previous, update.MessageID)
+	if err != nil {
+		log.Printf("Failed to look up senders of conversation %d: %v", update.ConversationID, err)
+		return
+	}
+
+	recipients := make([]uint, 0, len(senderIDs))
+	for _, senderID := range senderIDs {
+		if senderID != update.UserID {
+			recipients = append(recipients, senderID)
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	if err := c.Publisher.ReceiptUpdated(ctx, update, recipients); err != nil {
+		log.Printf("Failed to publish %s receipt of user %d in conversation %d: %v",
+			update.Status, update.UserID, update.ConversationID, err)
+	}
+}
+
+// GetReadState returns how far every participant got in the conversation
+func (c *MessageServiceServer) GetReadState(ctx context.Context, request *proto.GetReadStateRequest) (*proto.GetReadStateResponse, error) {
+	conversation, err := c.findUserConversation(uint(request.UserId), uint(request.ConversationId))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &proto.GetReadStateResponse{}
+	for i := range conversation.Participants {
+		response.Receipts = append(response.Receipts, toProtoReceipt(&conversation.Participants[i]))
+	}
+	return response, nil
+}
+
+func toProtoReceipt(participant *models.Participant) *proto.Receipt {
+	return &proto.Receipt{
+		UserId:                 int32(participant.UserID),
+		LastDeliveredMessageId: int64(participant.LastDeliveredMessageID),
+		LastReadMessageId:      int64(participant.LastReadMessageID),
+	}
+}
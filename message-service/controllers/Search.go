@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/repositories"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxQueryLength is the longest search query, in characters
+const maxQueryLength = 256
+
+// SearchMessages finds the messages of the caller's conversations that
+// contain the words of the query, newest first, along with snippets
+// highlighting the matches
+func (c *MessageServiceServer) SearchMessages(ctx context.Context, request *proto.SearchMessagesRequest) (*proto.SearchMessagesResponse, error) {
+	userID := uint(request.UserId)
+
+	var violations []fieldViolation
+	query := strings.TrimSpace(request.Query)
+	if query == "" || utf8.RuneCountInString(query) > maxQueryLength {
+		violations = append(violations, fieldViolation{"query", "must be 1 to 256 characters long"})
+	}
+	if request.ConversationId < 0 {
+		violations = append(violations, fieldViolation{"conversationId", "must be a positive integer when given"})
+	}
+	if request.SenderId < 0 {
+		violations = append(violations, fieldViolation{"senderId", "must be a positive integer when given"})
+	}
+	if request.After < 0 || request.Before < 0 {
+		violations = append(violations, fieldViolation{"after", "times must be positive Unix times when given"})
+	} else if request.After > 0 && request.Before > 0 && request.After >= request.Before {
+		violations = append(violations, fieldViolation{"before", "must be later than after"})
+	}
+	var beforeID uint
+	if request.Cursor != "" {
+		position, err := decodeCursor(request.Cursor, 1)
+		if err != nil {
+			violations = append(violations, fieldViolation{"cursor", "must be a cursor returned by a previous page"})
+		} else {
+			beforeID = uint(position[0])
+		}
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid search", violations...)
+	}
+
+	search := repositories.MessageSearch{
+		Query:          query,
+		ConversationID: uint(request.ConversationId),
+		SenderID:       uint(request.SenderId),
+	}
+	if search.ConversationID > 0 {
+		if _, err := c.findUserConversation(userID, search.ConversationID); err != nil {
+			return nil, err
+		}
+	}
+	if request.After > 0 {
+		search.After = time.Unix(request.After, 0)
+	}
+	if request.Before > 0 {
+		search.Before = time.Unix(request.Before, 0)
+	}
+
+	limit := pageSize(request.PageSize)
+	// One extra hit tells whether another page follows
+	hits, err := c.MessageRepo.SearchMessages(userID, search, beforeID, limit+1)
+	if err != nil {
+		return nil, unavailable("search messages", err)
+	}
+
+	response := &proto.SearchMessagesResponse{}
+	if len(hits) > limit {
+		hits = hits[:limit]
+		response.NextCursor = encodeCursor(int64(hits[limit-1].ID))
+	}
+	messages := make([]models.Message, 0, len(hits))
+	for _, hit := range hits {
+		messages = append(messages, hit.Message)
+	}
+	mapped, err := c.toProtoMessages(userID, messages)
+	if err != nil {
+		return nil, unavailable("load message details", err)
+	}
+	for i, hit := range hits {
+		snippet, highlights := parseSnippet(hit.Snippet)
+		response.Results = append(response.Results, &proto.SearchResult{Message: mapped[i], Snippet: snippet, Highlights: highlights})
+	}
+	return response, nil
+}
+
+// parseSnippet strips the highlight delimiters from a snippet, returning
+// where they were instead
+func parseSnippet(marked string) (string, []*proto.Highlight) {
+	var snippet strings.Builder
+	var highlights []*proto.Highlight
+	var length int32
+	for _, r := range marked {
+		switch string(r) {
+		case repositories.HighlightStart:
+			highlights = append(highlights, &proto.Highlight{Start: length})
+		case repositories.HighlightStop:
+			if len(highlights) > 0 {
+				last := highlights[len(highlights)-1]
+				last.Length = length - last.Start
+			}
+		default:
+			snippet.WriteRune(r)
+			length++
+		}
+	}
+	return snippet.String(), highlights
+}
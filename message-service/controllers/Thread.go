@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"message-service/proto"
+)
+
+// GetThread pages through the replies in the thread of a message, newest
+// first, along with the message itself
+func (c *MessageServiceServer) GetThread(ctx context.Context, request *proto.GetThreadRequest) (*proto.GetThreadResponse, error) {
+	userID := uint(request.UserId)
+	var beforeID uint
+	if request.Cursor != "" {
+		position, err := decodeCursor(request.Cursor, 1)
+		if err != nil {
+			return nil, invalidArgument("invalid cursor", fieldViolation{"cursor", "must be a cursor returned by a previous page"})
+		}
+		beforeID = uint(position[0])
+	}
+
+	_, root, err := c.findUserMessage(userID, uint(request.RootMessageId))
+	if err != nil {
+		return nil, err
+	}
+	if root.ThreadRootID != nil {
+		return nil, invalidArgument("invalid thread", fieldViolation{"rootMessageId", "must not name a thread reply, threads don't nest"})
+	}
+
+	limit := pageSize(request.PageSize)
+	// One extra reply tells whether another page follows
+	replies, err := c.MessageRepo.ListThread(root.ID, userID, beforeID, limit+1)
+	if err != nil {
+		return nil, unavailable("list thread", err)
+	}
+
+	response := &proto.GetThreadResponse{}
+	if len(replies) > limit {
+		replies = replies[:limit]
+		response.NextCursor = encodeCursor(int64(replies[limit-1].ID))
+	}
+	messages, err := c.toProtoMessages(userID, append(replies, *root))
+	if err != nil {
+		return nil, unavailable("load message details", err)
+	}
+	response.Root, response.Replies = messages[len(messages)-1], messages[:len(messages)-1]
+	return response, nil
+}
+
+// MarkThreadRead records that the caller read every reply of the thread up
+// to the given one. Replies behind the mark are accepted but change nothing.
+func (c *MessageServiceServer) MarkThreadRead(ctx context.Context, request *proto.MarkThreadReadRequest) (*proto.MarkThreadReadResponse, error) {
+	userID := uint(request.UserId)
+	if request.MessageId <= 0 {
+		return nil, invalidArgument("invalid receipt", fieldViolation{"messageId", "must be a positive integer"})
+	}
+
+	_, reply, err := c.findUserMessage(userID, uint(request.MessageId))
+	if err != nil {
+		return nil, err
+	}
+	if reply.ThreadRootID == nil || int64(*reply.ThreadRootID) != request.RootMessageId {
+		return nil, errMessageNotFound
+	}
+
+	if err := c.MessageRepo.MarkThreadRead(*reply.ThreadRootID, userID, reply.ID); err != nil {
+		return nil, unavailable("store thread receipt", err)
+	}
+	// Looked up after the reply, so that its summary counts the reply
+	root, err := c.MessageRepo.FindMessage(*reply.ThreadRootID)
+	if err != nil {
+		return nil, unavailable("look up message", err)
+	}
+	unread, err := c.MessageRepo.UnreadThreadCounts(userID, []uint{root.ID})
+	if err != nil {
+		return nil, unavailable("count unread replies", err)
+	}
+
+	thread := toProtoMessage(root).Thread
+	thread.UnreadCount = int32(unread[root.ID])
+	return &proto.MarkThreadReadResponse{Thread: thread}, nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"fmt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"message-service/models"
+	"os"
+)
+
+var DB *gorm.DB
+
+func ConnectDatabase() {
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+		os.Getenv("DB_PORT"),
+	)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		panic("Failed to connect to database!")
+	}
+
+	Migrate(db)
+	DB = db
+}
+
+// Migrate creates or updates the tables of the models
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.Conversation{},
+		&models.Participant{},
+		&models.Message{},
+		&models.MessageEdit{},
+		&models.HiddenMessage{},
+		&models.Reaction{},
+		&models.ThreadRead{},
+		&models.Attachment{},
+	)
+}
+
+// Close closes the connection pool
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,374 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"message-service/models"
+	notification "message-service/proto/notification"
+	"strconv"
+	"time"
+)
+
+// envelopeVersion is the version of the payloads published here
+const envelopeVersion = 1
+
+// Actions of membership changes; reactions are added or removed
+const (
+	ActionCreated              = "created"
+	ActionAdded                = "added"
+	ActionRemoved              = "removed"
+	ActionLeft                 = "left"
+	ActionRoleChanged          = "role_changed"
+	ActionOwnershipTransferred = "ownership_transferred"
+)
+
+// MembershipChange describes who changed the membership of a group. Text is
+// the system message shown to the members, e.g. "alice added bob".
+type MembershipChange struct {
+	ConversationID uint
+	ActorID        uint
+	Action         string
+	MemberIDs      []uint
+	// Role is set when a role changed
+	Role    string
+	Text    string
+	Created time.Time
+}
+
+// Statuses of receipts
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+)
+
+// ReceiptUpdate tells that every message of the conversation up to
+// MessageID was delivered to or read by the user
+type ReceiptUpdate struct {
+	ConversationID uint
+	UserID         uint
+	Status         string
+	MessageID      uint
+	Created        time.Time
+}
+
+// MessageDeletion tells that the user deleted the message, for everyone or
+// for themselves only
+type MessageDeletion struct {
+	MessageID      uint
+	ConversationID uint
+	UserID         uint
+	ForEveryone    bool
+	Created        time.Time
+}
+
+// ReactionUpdate tells that the user added or removed a reaction. Count is
+// how many participants reacted with the emoji afterwards.
+type ReactionUpdate struct {
+	MessageID      uint
+	ConversationID uint
+	UserID         uint
+	Emoji          string
+	// ActionAdded or ActionRemoved
+	Action  string
+	Count   int
+	Created time.Time
+}
+
+// Publisher announces stored, edited and deleted messages, thread replies,
+// reactions, membership changes and receipts to the participants' devices
+type Publisher interface {
+	MessageCreated(ctx context.Context, message *models.Message, recipients []uint) error
+	ThreadReplyCreated(ctx context.Context, message *models.Message, recipients []uint) error
+	MessageEdited(ctx context.Context, message *models.Message, recipients []uint) error
+	MessageDeleted(ctx context.Context, deletion *MessageDeletion, recipients []uint) error
+	ReactionUpdated(ctx context.Context, update *ReactionUpdate, recipients []uint) error
+	MembershipChanged(ctx context.Context, change *MembershipChange, recipients []uint) error
+	ReceiptUpdated(ctx context.Context, update *ReceiptUpdate, recipients []uint) error
+}
+
+// KafkaPublisher writes envelopes to the topic consumed by
+// notification-service, keyed by conversation so they stay in order
+type KafkaPublisher struct {
+	Writer *kafka.Writer
+	Topic  string
+}
+
+func (publisher *KafkaPublisher) MessageCreated(ctx context.Context, message *models.Message, recipients []uint) error {
+	envelope, err := MessageCreatedEnvelope(message, recipients)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.write(ctx, message.ConversationID, value)
+}
+
+func (publisher *KafkaPublisher) ThreadReplyCreated(ctx context.Context, message *models.Message, recipients []uint) error {
+	envelope, err := ThreadReplyCreatedEnvelope(message, recipients)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.write(ctx, message.ConversationID, value)
+}
+
+func (publisher *KafkaPublisher) MessageEdited(ctx context.Context, message *models.Message, recipients []uint) error {
+	envelope, err := MessageEditedEnvelope(message, recipients)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.write(ctx, message.ConversationID, value)
+}
+
+func (publisher *KafkaPublisher) MessageDeleted(ctx context.Context, deletion *MessageDeletion, recipients []uint) error {
+	envelope, err := MessageDeletedEnvelope(deletion, recipients)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.write(ctx, deletion.ConversationID, value)
+}
+
+func (publisher *KafkaPublisher) ReactionUpdated(ctx context.Context, update *ReactionUpdate, recipients []uint) error {
+	envelope, err := ReactionUpdatedEnvelope(update, recipients)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.write(ctx, update.ConversationID, value)
+}
+
+func (publisher *KafkaPublisher) MembershipChanged(ctx context.Context, change *MembershipChange, recipients []uint) error {
+	envelope, err := MembershipChangedEnvelope(change, recipients)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.write(ctx, change.ConversationID, value)
+}
+
+func (publisher *KafkaPublisher) ReceiptUpdated(ctx context.Context, update *ReceiptUpdate, recipients []uint) error {
+	envelope, err := ReceiptUpdatedEnvelope(update, recipients)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.write(ctx, update.ConversationID, value)
+}
+
+func (publisher *KafkaPublisher) write(ctx context.Context, conversationID uint, value []byte) error {
+	return publisher.Writer.WriteMessages(ctx, kafka.Message{
+		Topic:   publisher.Topic,
+		Key:     []byte(strconv.FormatUint(uint64(conversationID), 10)),
+		Value:   value,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/x-protobuf")}},
+	})
+}
+
+// MessageCreatedEnvelope wraps the message in the envelope delivered to
+// every recipient
+func MessageCreatedEnvelope(message *models.Message, recipients []uint) (*notification.Envelope, error) {
+	payload, err := structpb.NewStruct(messageFields(message))
+	if err != nil {
+		return nil, err
+	}
+
+	return newEnvelope(notification.EventType_EVENT_TYPE_MESSAGE_CREATED, message.SenderID, recipients, message.Created, payload)
+}
+
+// ThreadReplyCreatedEnvelope wraps the thread reply in the envelope
+// delivered to every recipient, whose devices add it to the open thread or
+// bump the root's reply count
+func ThreadReplyCreatedEnvelope(message *models.Message, recipients []uint) (*notification.Envelope, error) {
+	fields := messageFields(message)
+	fields["thread_root_id"] = float64(*message.ThreadRootID)
+	payload, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEnvelope(notification.EventType_EVENT_TYPE_THREAD_REPLY_CREATED, message.SenderID, recipients, message.Created, payload)
+}
+
+// MessageEditedEnvelope wraps the edited message in the envelope delivered
+// to every recipient, whose devices replace the text in place
+func MessageEditedEnvelope(message *models.Message, recipients []uint) (*notification.Envelope, error) {
+	payload, err := structpb.NewStruct(messageFields(message))
+	if err != nil {
+		return nil, err
+	}
+
+	return newEnvelope(notification.EventType_EVENT_TYPE_MESSAGE_EDITED, message.SenderID, recipients, *message.EditedAt, payload)
+}
+
+// messageFields is the payload describing a message
+func messageFields(message *models.Message) map[string]interface{} {
+	fields := map[string]interface{}{
+		"message_id":      float64(message.ID),
+		"conversation_id": float64(message.ConversationID),
+		"sender_id":       float64(message.SenderID),
+		"text":            message.Text,
+	}
+	if message.ReplyToID != nil {
+		fields["reply_to_message_id"] = float64(*message.ReplyToID)
+	}
+	if len(message.Attachments) > 0 {
+		attachments := make([]interface{}, 0, len(message.Attachments))
+		for _, attachment := range message.Attachments {
+			// Storage keys stay private, clients ask the gateway for URLs
+			attachments = append(attachments, map[string]interface{}{
+				"attachment_id": float64(attachment.ID),
+				"file_name":     attachment.FileName,
+				"content_type":  attachment.ContentType,
+				"size":          float64(attachment.Size),
+				"has_thumbnail": attachment.ThumbnailKey != "",
+				"width":         float64(attachment.Width),
+				"height":        float64(attachment.Height),
+			})
+		}
+		fields["attachments"] = attachments
+	}
+	return fields
+}
+
+// MessageDeletedEnvelope wraps the deletion in the envelope delivered to
+// every recipient, whose devices remove the message in place
+func MessageDeletedEnvelope(deletion *MessageDeletion, recipients []uint) (*notification.Envelope, error) {
+	payload, err := structpb.NewStruct(map[string]interface{}{
+		"message_id":      float64(deletion.MessageID),
+		"conversation_id": float64(deletion.ConversationID),
+		"for_everyone":    deletion.ForEveryone,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newEnvelope(notification.EventType_EVENT_TYPE_MESSAGE_DELETED, deletion.UserID, recipients, deletion.Created, payload)
+}
+
+// ReactionUpdatedEnvelope wraps the update in the envelope delivered to
+// every recipient
+func ReactionUpdatedEnvelope(update *ReactionUpdate, recipients []uint) (*notification.Envelope, error) {
+	payload, err := structpb.NewStruct(map[string]interface{}{
+		"message_id":      float64(update.MessageID),
+		"conversation_id": float64(update.ConversationID),
+		"user_id":         float64(update.UserID),
+		"emoji":           update.Emoji,
+		"action":          update.Action,
+		"count":           float64(update.Count),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newEnvelope(notification.EventType_EVENT_TYPE_REACTION_UPDATED, update.UserID, recipients, update.Created, payload)
+}
+
+// MembershipChangedEnvelope wraps the change in the envelope delivered to
+// every recipient
+func MembershipChangedEnvelope(change *MembershipChange, recipients []uint) (*notification.Envelope, error) {
+	memberIDs := make([]interface{}, 0, len(change.MemberIDs))
+	for _, memberID := range change.MemberIDs {
+		memberIDs = append(memberIDs, float64(memberID))
+	}
+
+	fields := map[string]interface{}{
+		"conversation_id": float64(change.ConversationID),
+		"action":          change.Action,
+		"actor_id":        float64(change.ActorID),
+		"member_ids":      memberIDs,
+		"text":            change.Text,
+	}
+	if change.Role != "" {
+		fields["role"] = change.Role
+	}
+	payload, err := structpb.NewStruct(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEnvelope(notification.EventType_EVENT_TYPE_MEMBERSHIP_CHANGED, change.ActorID, recipients, change.Created, payload)
+}
+
+// ReceiptUpdatedEnvelope wraps the update in the envelope delivered to the
+// senders of the messages it covers
+func ReceiptUpdatedEnvelope(update *ReceiptUpdate, recipients []uint) (*notification.Envelope, error) {
+	payload, err := structpb.NewStruct(map[string]interface{}{
+		"conversation_id": float64(update.ConversationID),
+		"user_id":         float64(update.UserID),
+		"status":          update.Status,
+		"message_id":      float64(update.MessageID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newEnvelope(notification.EventType_EVENT_TYPE_RECEIPT_UPDATED, update.UserID, recipients, update.Created, payload)
+}
+
+func newEnvelope(eventType notification.EventType, senderID uint, recipients []uint, created time.Time, payload *structpb.Struct) (*notification.Envelope, error) {
+	id, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+	envelope := &notification.Envelope{
+		Id:        id,
+		Type:      eventType,
+		Version:   envelopeVersion,
+		Sender:    strconv.FormatUint(uint64(senderID), 10),
+		CreatedAt: timestamppb.New(created),
+		Payload:   payload,
+	}
+	for _, recipient := range recipients {
+		envelope.Recipients = append(envelope.Recipients, strconv.FormatUint(uint64(recipient), 10))
+	}
+	return envelope, nil
+}
+
+func newEventID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	"log"
+	"message-service/config"
+	"message-service/controllers"
+	"message-service/database"
+	"message-service/events"
+	"message-service/proto"
+	userServiceProto "message-service/proto/user_service"
+	"message-service/repositories"
+	"message-service/users"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	cfg := config.LoadConfig()
+	server := grpc.NewServer()
+	database.ConnectDatabase()
+
+	kafkaWriter := &kafka.Writer{
+		Addr:                   kafka.TCP(cfg.KafkaServiceURL),
+		Balancer:               &kafka.Hash{},
+		AllowAutoTopicCreation: true,
+	}
+
+	userConn, err := grpc.NewClient(cfg.UserServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("failed to connect to user service: %v", err)
+	}
+
+	messageServiceServer := &controllers.MessageServiceServer{
+		ConversationRepo: &repositories.GormConversationRepository{},
+		MessageRepo:      &repositories.GormMessageRepository{},
+		ReactionRepo:     &repositories.GormReactionRepository{},
+		AttachmentRepo:   &repositories.GormAttachmentRepository{},
+		Publisher:        &events.KafkaPublisher{Writer: kafkaWriter, Topic: cfg.NotificationTopic},
+		Users:            &users.GrpcDirectory{Client: userServiceProto.NewUserServiceClient(userConn)},
+		EditWindow:       cfg.EditWindow,
+	}
+	proto.RegisterMessageServiceServer(server, messageServiceServer)
+
+	// Enable gRPC reflection
+	reflection.Register(server)
+
+	listener, err := net.Listen("tcp", ":"+cfg.Port)
+	if err != nil {
+		log.Fatalf("failed to listen on port %s: %v", cfg.Port, err)
+	}
+
+	go func() {
+		log.Printf("gRPC server is running on port %s", cfg.Port)
+		if err := server.Serve(listener); err != nil {
+			log.Fatalf("failed to start gRPC server: %v", err)
+		}
+	}()
+
+	interruption := make(chan os.Signal, 1)
+	signal.Notify(interruption, syscall.SIGINT, syscall.SIGTERM)
+	<-interruption
+
+	log.Println("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	stopServer(ctx, server)
+
+	if err := userConn.Close(); err != nil {
+		log.Printf("failed to close user service connection: %v", err)
+	}
+	if err := kafkaWriter.Close(); err != nil {
+		log.Printf("failed to flush Kafka writer: %v", err)
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("failed to close database: %v", err)
+	}
+	log.Println("shutdown complete")
+}
+
+// stopServer lets in-flight calls finish, cancelling them once the deadline
+// passes
+func stopServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("gRPC calls did not finish in time, cancelling them")
+		server.Stop()
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// Attachment is a file uploaded through the gateway, which keeps the file
+// itself under StorageKey. It belongs to its uploader until sent with a
+// message, from then on every participant of the conversation may download
+// it. Attachments are sent once; deleting the message for everyone deletes
+// them too, unless claimed.
+type Attachment struct {
+	ID         uint  `gorm:"primaryKey;autoIncrement"`
+	UploaderID uint  `gorm:"index;not null"`
+	MessageID  *uint `gorm:"index"`
+	// Position among the attachments of the message
+	Position    int    `gorm:"not null;default:0"`
+	FileName    string `gorm:"not null"`
+	ContentType string `gorm:"not null"`
+	Size        int64  `gorm:"not null"`
+	StorageKey  string `gorm:"not null"`
+	// Empty unless the file is an image the gateway made a thumbnail of
+	ThumbnailKey string
+	Width        int
+	Height       int
+	Created      time.Time
+	// Claimed attachments are used outside of messages, as avatars are, and
+	// kept even if never sent
+	Claimed bool `gorm:"not null;default:false"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Kinds of conversations
+const (
+	ConversationDirect = "direct"
+	ConversationGroup  = "group"
+)
+
+// Conversation is a chat between its participants. LastMessageAt orders the
+// conversation list and is bumped by every message.
+type Conversation struct {
+	ID    uint   `gorm:"primaryKey;autoIncrement"`
+	Kind  string `gorm:"not null"`
+	Title string
+	// DirectKey is set for direct conversations only, so a pair of users
+	// can't end up with two of them
+	DirectKey     *string   `gorm:"uniqueIndex"`
+	LastMessageAt time.Time `gorm:"index"`
+	Created       time.Time
+	Participants  []Participant
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+)
+
+// Message is a single message posted to a conversation. IDs grow
+// monotonically, so they double as the history's sort order and cursor.
+//
+// EditedAt is set once the sender edited the text, DeletedAt once they
+// deleted the message for everyone, which clears the text but keeps the
+// message in the history as a placeholder.
+//
+// Messages with a ThreadRootID are replies in the thread of that message
+// and stay out of the conversation's own history. The root counts its
+// replies, so threads can be summarized without scanning them.
+//
+// SearchVector indexes the words of the text for full-text search. Postgres
+// derives it from the text, so edits and deletions reindex the message
+// without further ado. The simple configuration doesn't stem words, which
+// would only suit a single language.
+type Message struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement;index:idx_messages_conversation_id_id,priority:2;index:idx_messages_thread_root_id_id,priority:2"`
+	ConversationID uint   `gorm:"index:idx_messages_conversation_id_id,priority:1;not null"`
+	SenderID       uint   `gorm:"not null"`
+	Text           string `gorm:"not null"`
+	Created        time.Time
+	EditedAt       *time.Time
+	DeletedAt      *time.Time
+	ReplyToID      *uint
+	ThreadRootID   *uint `gorm:"index:idx_messages_thread_root_id_id,priority:1"`
+	ReplyCount     int   `gorm:"not null;default:0"`
+	LastReplyAt    *time.Time
+	// Loaded on demand, see AttachmentRepository
+	Attachments  []Attachment `gorm:"foreignKey:MessageID"`
+	SearchVector string       `gorm:"->:false;<-:false;type:tsvector GENERATED ALWAYS AS (to_tsvector('simple', text)) STORED;index:idx_messages_search_vector,type:gin"`
+}
+
+// MessageEdit is a previous version of an edited message, kept so that
+// edits can be audited. The versions of a message deleted for everyone are
+// deleted with its text.
+type MessageEdit struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement"`
+	MessageID uint   `gorm:"index;not null"`
+	Text      string `gorm:"not null"`
+	// EditedAt is when the text was replaced by the next version
+	EditedAt time.Time
+}
+
+// HiddenMessage is a message a participant deleted for themselves only
+type HiddenMessage struct {
+	MessageID uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"primaryKey"`
+	HiddenAt  time.Time
+}
+
+// Reaction is an emoji a participant reacted to a message with. A
+// participant may react with several emojis, each once.
+type Reaction struct {
+	MessageID uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"primaryKey"`
+	Emoji     string `gorm:"primaryKey"`
+	Created   time.Time
+}
+
+// ThreadRead is how far a participant read a thread: every reply up to
+// LastReadMessageID was read
+type ThreadRead struct {
+	RootMessageID     uint `gorm:"primaryKey"`
+	UserID            uint `gorm:"primaryKey"`
+	LastReadMessageID uint `gorm:"not null;default:0"`
+}
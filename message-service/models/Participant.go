@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// Roles of group participants, in decreasing order of privilege
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Participant is a member of a conversation. Every group has exactly one
+// owner; participants of direct conversations are plain members.
+//
+// Receipts are kept as high-water marks: every message up to
+// LastDeliveredMessageID reached one of the participant's devices, every
+// message up to LastReadMessageID was read. Reading implies delivery.
+type Participant struct {
+	ConversationID         uint   `gorm:"primaryKey"`
+	UserID                 uint   `gorm:"primaryKey;index"`
+	Role                   string `gorm:"not null;default:member"`
+	JoinedAt               time.Time
+	LastDeliveredMessageID uint `gorm:"not null;default:0"`
+	LastReadMessageID      uint `gorm:"not null;default:0"`
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"message-service/database"
+	"message-service/models"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// AttachmentRepository defines the interface for attachment data access.
+// Attachments are bound to messages by MessageRepository.CreateMessage.
+type AttachmentRepository interface {
+	CreateAttachment(attachment *models.Attachment) error
+	FindAttachment(id uint) (*models.Attachment, error)
+	// ListAttachments returns the attachments of each given message that
+	// has any, in the order they were sent
+	ListAttachments(messageIDs []uint) (map[uint][]models.Attachment, error)
+	// ClaimAttachment keeps the attachment from being deleted while unsent,
+	// or returns ErrNotFound if it no longer exists
+	ClaimAttachment(id uint) error
+	// DeleteUnsentAttachments removes up to limit attachments created before
+	// the cutoff that were never sent nor claimed, and returns them
+	DeleteUnsentAttachments(createdBefore time.Time, limit int) ([]models.Attachment, error)
+}
+
+type GormAttachmentRepository struct{}
+
+func (repo *GormAttachmentRepository) CreateAttachment(attachment *models.Attachment) error {
+	return database.DB.Create(attachment).Error
+}
+
+func (repo *GormAttachmentRepository) FindAttachment(id uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ?", id).First(&attachment).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &attachment, nil
+}
+
+func (repo *GormAttachmentRepository) ListAttachments(messageIDs []uint) (map[uint][]models.Attachment, error) {
+	result := make(map[uint][]models.Attachment, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var attachments []models.Attachment
+	if err := database.DB.Where("message_id IN ?", messageIDs).Order("message_id, position").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		result[*attachment.MessageID] = append(result[*attachment.MessageID], attachment)
+	}
+	return result, nil
+}
+
+func (repo *GormAttachmentRepository) ClaimAttachment(id uint) error {
+	result := database.DB.Model(&models.Attachment{}).Where("id = ?", id).Update("claimed", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (repo *GormAttachmentRepository) DeleteUnsentAttachments(createdBefore time.Time, limit int) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	unsent := database.DB.Model(&models.Attachment{}).
+		Select("id").
+		Where("message_id IS NULL AND NOT claimed AND created < ?", createdBefore).
+		Order("id").
+		Limit(limit)
+	// Checked again by the delete, so an attachment sent or claimed meanwhile
+	// is kept
+	err := database.DB.Clauses(clause.Returning{}).
+		Where("message_id IS NULL AND NOT claimed AND id IN (?)", unsent).
+		Delete(&attachments).Error
+	return attachments, err
+}
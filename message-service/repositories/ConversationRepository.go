@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"message-service/database"
+	"message-service/models"
+	"time"
+)
+
+// ConversationPosition is where a page of the conversation list ends
+type ConversationPosition struct {
+	LastMessageAt time.Time
+	ID            uint
+}
+
+// ConversationRepository defines the interface for conversation data access
+type ConversationRepository interface {
+	// FindOrCreateDirectConversation returns the direct conversation of the
+	// two users, starting it if they never talked before
+	FindOrCreateDirectConversation(userID, otherUserID uint) (*models.Conversation, error)
+	// FindConversation returns the conversation with its participants
+	FindConversation(id uint) (*models.Conversation, error)
+	// ListConversations returns the user's conversations with their
+	// participants, most recently active first, starting after the position
+	ListConversations(userID uint, after *ConversationPosition, limit int) ([]models.Conversation, error)
+	// CreateGroup stores the group together with its participants
+	CreateGroup(conversation *models.Conversation) error
+	// AddParticipants adds participants, skipping those already in the conversation
+	AddParticipants(participants []models.Participant) error
+	RemoveParticipant(conversationID, userID uint) error
+	UpdateParticipantRole(conversationID, userID uint, role string) error
+	// TransferOwnership makes the new owner the group's only owner and
+	// demotes the previous owner to admin
+	TransferOwnership(conversationID, ownerID, newOwnerID uint) error
+	// MarkDelivered moves the participant's delivered mark forward to the
+	// message. It reports false if the mark already was there or beyond.
+	MarkDelivered(conversationID, userID, messageID uint) (bool, error)
+	// MarkRead moves the participant's read mark, and the delivered mark
+	// with it, forward to the message. It reports false if the read mark
+	// already was there or beyond.
+	MarkRead(conversationID, userID, messageID uint) (bool, error)
+	// ContactIDs returns everyone sharing a conversation with the user
+	ContactIDs(userID uint) ([]uint, error)
+}
+
+type GormConversationRepository struct{}
+
+func (repo *GormConversationRepository) FindOrCreateDirectConversation(userID, otherUserID uint) (*models.Conversation, error) {
+	key := DirectKey(userID, otherUserID)
+	if conversation, err := repo.findDirectConversation(key); err != ErrNotFound {
+		return conversation, err
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		conversation := models.Conversation{Kind: models.ConversationDirect, DirectKey: &key, Created: now}
+		// Another request may have started the conversation in the meantime
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Participants").Create(&conversation)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		participants := []models.Participant{
+			{ConversationID: conversation.ID, UserID: userID, Role: models.RoleMember, JoinedAt: now},
+			{ConversationID: conversation.ID, UserID: otherUserID, Role: models.RoleMember, JoinedAt: now},
+		}
+		return tx.Create(&participants).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return repo.findDirectConversation(key)
+}
+
+func (repo *GormConversationRepository) findDirectConversation(key string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := database.DB.Preload("Participants").Where("direct_key = ?", key).First(&conversation).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &conversation, nil
+}
+
+func (repo *GormConversationRepository) FindConversation(id uint) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := database.DB.Preload("Participants").Where("id = ?", id).First(&conversation).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &conversation, nil
+}
+
+func (repo *GormConversationRepository) ListConversations(userID uint, after *ConversationPosition, limit int) ([]models.Conversation, error) {
+	query := database.DB.Preload("Participants").
+		Joins("JOIN participants ON participants.conversation_id = conversations.id AND participants.user_id = ?", userID)
+	if after != nil {
+		query = query.Where(
+			"(conversations.last_message_at, conversations.id) < (?, ?)",
+			after.LastMessageAt, after.ID,
+		)
+	}
+
+	var conversations []models.Conversation
+	err := query.Order("conversations.last_message_at DESC, conversations.id DESC").Limit(limit).Find(&conversations).Error
+	return conversations, err
+}
+
+func (repo *GormConversationRepository) CreateGroup(conversation *models.Conversation) error {
+	return database.DB.Create(conversation).Error
+}
+
+func (repo *GormConversationRepository) AddParticipants(participants []models.Participant) error {
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&participants).Error
+}
+
+func (repo *GormConversationRepository) RemoveParticipant(conversationID, userID uint) error {
+	return database.DB.
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Delete(&models.Participant{}).Error
+}
+
+func (repo *GormConversationRepository) UpdateParticipantRole(conversationID, userID uint, role string) error {
+	return repo.updateRole(database.DB, conversationID, userID, role)
+}
+
+func (repo *GormConversationRepository) TransferOwnership(conversationID, ownerID, newOwnerID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := repo.updateRole(tx, conversationID, ownerID, models.RoleAdmin); err != nil {
+			return err
+		}
+		return repo.updateRole(tx, conversationID, newOwnerID, models.RoleOwner)
+	})
+}
+
+func (repo *GormConversationRepository) updateRole(tx *gorm.DB, conversationID, userID uint, role string) error {
+	return tx.Model(&models.Participant{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Update("role", role).Error
+}
+
+func (repo *GormConversationRepository) MarkDelivered(conversationID, userID, messageID uint) (bool, error) {
+	// The condition keeps marks from moving backwards when receipts race
+	result := database.DB.Model(&models.Participant{}).
+		Where("conversation_id = ? AND user_id = ? AND last_delivered_message_id < ?", conversationID, userID, messageID).
+		Update("last_delivered_message_id", messageID)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo *GormConversationRepository) MarkRead(conversationID, userID, messageID uint) (bool, error) {
+	result := database.DB.Model(&models.Participant{}).
+		Where("conversation_id = ? AND user_id = ? AND last_read_message_id < ?", conversationID, userID, messageID).
+		Updates(map[string]interface{}{
+			"last_read_message_id":      messageID,
+			"last_delivered_message_id": gorm.Expr("GREATEST(last_delivered_message_id, ?)", messageID),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo *GormConversationRepository) ContactIDs(userID uint) ([]uint, error) {
+	var contactIDs []uint
+	err := database.DB.Table("participants AS own").
+		Joins("JOIN participants AS other ON other.conversation_id = own.conversation_id").
+		Where("own.user_id = ? AND other.user_id <> ?", userID, userID).
+		Distinct().Pluck("other.user_id", &contactIDs).Error
+	return contactIDs, err
+}
+
+// DirectKey identifies the direct conversation of two users, whichever of
+// them started it
+func DirectKey(userID, otherUserID uint) string {
+	if userID > otherUserID {
+		userID, otherUserID = otherUserID, userID
+	}
+	return fmt.Sprintf("%d:%d", userID, otherUserID)
+}
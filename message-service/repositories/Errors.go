@@ -0,0 +1,21 @@
+package repositories
+
+import (
+	"errors"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by lookups that match no record, so callers can
+// tell a missing record apart from a failing database
+var ErrNotFound = errors.New("record not found")
+
+// ErrAttachmentUnavailable is returned when a message is sent with an
+// attachment that another message took first
+var ErrAttachmentUnavailable = errors.New("attachment unavailable")
+
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
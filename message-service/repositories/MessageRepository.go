@@ -0,0 +1,311 @@
+package repositories
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"message-service/database"
+	"message-service/models"
+	"time"
+)
+
+// MessageRepository defines the interface for message data access
+type MessageRepository interface {
+	// CreateMessage stores the message and marks its conversation as
+	// active. Thread replies mark their root instead. The message's
+	// attachments, of which only the IDs are read, must be unsent uploads
+	// of its sender, otherwise nothing is stored and it fails with
+	// ErrAttachmentUnavailable.
+	CreateMessage(message *models.Message) error
+	// ListMessages returns the conversation's messages older than beforeID
+	// that the user didn't hide, newest first, leaving out thread replies. A
+	// beforeID of 0 starts at the newest message.
+	ListMessages(conversationID, userID, beforeID uint, limit int) ([]models.Message, error)
+	// ListThread is ListMessages for the replies in the thread of rootID
+	ListThread(rootID, userID, beforeID uint, limit int) ([]models.Message, error)
+	// LastMessages returns the newest message the user didn't hide of each
+	// given conversation that has any, leaving out thread replies
+	LastMessages(userID uint, conversationIDs []uint) (map[uint]models.Message, error)
+	FindMessage(id uint) (*models.Message, error)
+	// FindMessages returns those of the given messages that exist
+	FindMessages(ids []uint) (map[uint]models.Message, error)
+	// SenderIDs returns who sent the conversation's messages after afterID
+	// up to and including upToID, each sender once, leaving out thread
+	// replies
+	SenderIDs(conversationID, afterID, upToID uint) ([]uint, error)
+	// EditMessage stores the message's new text and edit time, keeping the
+	// previous text in its history. It fails with ErrNotFound if the message
+	// was deleted meanwhile.
+	EditMessage(message *models.Message, previousText string) error
+	// DeleteMessage clears the text, history and attachments of the message
+	// for everyone, returning the deleted attachments so their files can be
+	// removed. Claimed attachments are kept, unbound from the message.
+	DeleteMessage(id uint, deletedAt time.Time) ([]models.Attachment, error)
+	// HideMessage deletes the message for the user only
+	HideMessage(id, userID uint) error
+	// ListEdits returns the previous versions of the message, oldest first
+	ListEdits(messageID uint) ([]models.MessageEdit, error)
+	// MarkThreadRead moves the user's read mark of the thread forward to the
+	// reply, unless it already was there or beyond
+	MarkThreadRead(rootID, userID, messageID uint) error
+	// UnreadThreadCounts returns, for each given thread with any, how many
+	// replies by others the user hasn't read
+	UnreadThreadCounts(userID uint, rootIDs []uint) (map[uint]int, error)
+	// SearchMessages returns the messages older than beforeID matching the
+	// search, newest first, among those of the user's conversations that
+	// aren't deleted or hidden by the user. A beforeID of 0 starts at the
+	// newest message.
+	SearchMessages(userID uint, search MessageSearch, beforeID uint, limit int) ([]SearchHit, error)
+}
+
+// Delimiters enclosing the matching words in the snippets of search hits.
+// Control characters, since they won't clash with the text.
+const (
+	HighlightStart = "\x02"
+	HighlightStop  = "\x03"
+)
+
+// MessageSearch is a full-text query with optional filters, zero values
+// leave a filter out
+type MessageSearch struct {
+	// Query is parsed by websearch_to_tsquery
+	Query          string
+	ConversationID uint
+	SenderID       uint
+	// Sent at After or later, and before Before
+	After  time.Time
+	Before time.Time
+}
+
+// SearchHit is a message matching a search, with an excerpt of its text
+// in which the matching words are highlighted
+type SearchHit struct {
+	models.Message
+	Snippet string
+}
+
+type GormMessageRepository struct{}
+
+// notHidden filters out the messages hidden by the user given as argument
+const notHidden = "NOT EXISTS (SELECT 1 FROM hidden_messages WHERE hidden_messages.message_id = messages.id AND hidden_messages.user_id = ?)"
+
+func (repo *GormMessageRepository) CreateMessage(message *models.Message) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(message).Error; err != nil {
+			return err
+		}
+		for i := range message.Attachments {
+			result := tx.Model(&models.Attachment{}).
+				Where("id = ? AND uploader_id = ? AND message_id IS NULL", message.Attachments[i].ID, message.SenderID).
+				Updates(map[string]interface{}{"message_id": message.ID, "position": i})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrAttachmentUnavailable
+			}
+		}
+		if message.ThreadRootID != nil {
+			return tx.Model(&models.Message{}).
+				Where("id = ?", *message.ThreadRootID).
+				Updates(map[string]interface{}{
+					"reply_count":   gorm.Expr("reply_count + 1"),
+					"last_reply_at": message.Created,
+				}).Error
+		}
+		return tx.Model(&models.Conversation{}).
+			Where("id = ?", message.ConversationID).
+			Update("last_message_at", message.Created).Error
+	})
+}
+
+func (repo *GormMessageRepository) ListMessages(conversationID, userID, beforeID uint, limit int) ([]models.Message, error) {
+	query := database.DB.Where("conversation_id = ? AND thread_root_id IS NULL", conversationID)
+	return listMessages(query, userID, beforeID, limit)
+}
+
+func (repo *GormMessageRepository) ListThread(rootID, userID, beforeID uint, limit int) ([]models.Message, error) {
+	return listMessages(database.DB.Where("thread_root_id = ?", rootID), userID, beforeID, limit)
+}
+
+func listMessages(query *gorm.DB, userID, beforeID uint, limit int) ([]models.Message, error) {
+	query = query.Where(notHidden, userID)
+	if beforeID > 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var messages []models.Message
+	err := query.Order("id DESC").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+func (repo *GormMessageRepository) LastMessages(userID uint, conversationIDs []uint) (map[uint]models.Message, error) {
+	result := make(map[uint]models.Message, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return result, nil
+	}
+
+	var messages []models.Message
+	err := database.DB.Raw(
+		"SELECT DISTINCT ON (conversation_id) * FROM messages WHERE conversation_id IN ? AND thread_root_id IS NULL AND "+notHidden+
+			" ORDER BY conversation_id, id DESC",
+		conversationIDs, userID,
+	).Scan(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, message := range messages {
+		result[message.ConversationID] = message
+	}
+	return result, nil
+}
+
+func (repo *GormMessageRepository) FindMessage(id uint) (*models.Message, error) {
+	var message models.Message
+	if err := database.DB.Where("id = ?", id).First(&message).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &message, nil
+}
+
+func (repo *GormMessageRepository) FindMessages(ids []uint) (map[uint]models.Message, error) {
+	result := make(map[uint]models.Message, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var messages []models.Message
+	if err := database.DB.Where("id IN ?", ids).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		result[message.ID] = message
+	}
+	return result, nil
+}
+
+func (repo *GormMessageRepository) SenderIDs(conversationID, afterID, upToID uint) ([]uint, error) {
+	var senderIDs []uint
+	err := database.DB.Model(&models.Message{}).
+		Where("conversation_id = ? AND id > ? AND id <= ? AND thread_root_id IS NULL", conversationID, afterID, upToID).
+		Distinct().Pluck("sender_id", &senderIDs).Error
+	return senderIDs, err
+}
+
+func (repo *GormMessageRepository) EditMessage(message *models.Message, previousText string) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Message{}).
+			Where("id = ? AND deleted_at IS NULL", message.ID).
+			Updates(map[string]interface{}{"text": message.Text, "edited_at": message.EditedAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Create(&models.MessageEdit{MessageID: message.ID, Text: previousText, EditedAt: *message.EditedAt}).Error
+	})
+}
+
+func (repo *GormMessageRepository) DeleteMessage(id uint, deletedAt time.Time) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Message{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{"text": "", "deleted_at": deletedAt}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("message_id = ?", id).Delete(&models.MessageEdit{}).Error; err != nil {
+			return err
+		}
+		// Claimed attachments are still in use, so they are only unbound
+		err = tx.Model(&models.Attachment{}).
+			Where("message_id = ? AND claimed", id).
+			Updates(map[string]interface{}{"message_id": nil, "position": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Clauses(clause.Returning{}).Where("message_id = ?", id).Delete(&attachments).Error
+	})
+	return attachments, err
+}
+
+func (repo *GormMessageRepository) HideMessage(id, userID uint) error {
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.HiddenMessage{MessageID: id, UserID: userID, HiddenAt: time.Now()}).Error
+}
+
+func (repo *GormMessageRepository) ListEdits(messageID uint) ([]models.MessageEdit, error) {
+	var edits []models.MessageEdit
+	err := database.DB.Where("message_id = ?", messageID).Order("id").Find(&edits).Error
+	return edits, err
+}
+
+func (repo *GormMessageRepository) MarkThreadRead(rootID, userID, messageID uint) error {
+	return database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "root_message_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"last_read_message_id": gorm.Expr("GREATEST(thread_reads.last_read_message_id, excluded.last_read_message_id)"),
+		}),
+	}).Create(&models.ThreadRead{RootMessageID: rootID, UserID: userID, LastReadMessageID: messageID}).Error
+}
+
+func (repo *GormMessageRepository) UnreadThreadCounts(userID uint, rootIDs []uint) (map[uint]int, error) {
+	result := make(map[uint]int, len(rootIDs))
+	if len(rootIDs) == 0 {
+		return result, nil
+	}
+
+	var counts []struct {
+		ThreadRootID uint
+		Count        int
+	}
+	err := database.DB.Table("messages").
+		Select("messages.thread_root_id, COUNT(*) AS count").
+		Joins("LEFT JOIN thread_reads ON thread_reads.root_message_id = messages.thread_root_id AND thread_reads.user_id = ?", userID).
+		Where("messages.thread_root_id IN ? AND messages.sender_id <> ? AND messages.deleted_at IS NULL", rootIDs, userID).
+		Where("messages.id > COALESCE(thread_reads.last_read_message_id, 0)").
+		Group("messages.thread_root_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		result[count.ThreadRootID] = count.Count
+	}
+	return result, nil
+}
+
+// headlineOptions shape the snippets of search hits: a couple of fragments
+// of a few words around the matches
+var headlineOptions = `StartSel="` + HighlightStart + `", StopSel="` + HighlightStop + `"` +
+	`, MinWords=8, MaxWords=24, MaxFragments=2, FragmentDelimiter=" … "`
+
+func (repo *GormMessageRepository) SearchMessages(userID uint, search MessageSearch, beforeID uint, limit int) ([]SearchHit, error) {
+	query := database.DB.Table("messages").
+		Select("messages.*, ts_headline('simple', messages.text, search_query, ?) AS snippet", headlineOptions).
+		Joins("CROSS JOIN websearch_to_tsquery('simple', ?) AS search_query", search.Query).
+		Joins("JOIN participants ON participants.conversation_id = messages.conversation_id AND participants.user_id = ?", userID).
+		Where("messages.search_vector @@ search_query AND messages.deleted_at IS NULL").
+		Where(notHidden, userID)
+	if search.ConversationID > 0 {
+		query = query.Where("messages.conversation_id = ?", search.ConversationID)
+	}
+	if search.SenderID > 0 {
+		query = query.Where("messages.sender_id = ?", search.SenderID)
+	}
+	if !search.After.IsZero() {
+		query = query.Where("messages.created >= ?", search.After)
+	}
+	if !search.Before.IsZero() {
+		query = query.Where("messages.created < ?", search.Before)
+	}
+	if beforeID > 0 {
+		query = query.Where("messages.id < ?", beforeID)
+	}
+
+	var hits []SearchHit
+	err := query.Order("messages.id DESC").Limit(limit).Scan(&hits).Error
+	return hits, err
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"gorm.io/gorm/clause"
+	"message-service/database"
+	"message-service/models"
+)
+
+// ReactionCount is how many participants reacted to a message with an emoji
+type ReactionCount struct {
+	MessageID uint
+	Emoji     string
+	Count     int
+	// ReactedByMe tells whether the user the counts were asked for is one
+	// of those who reacted
+	ReactedByMe bool
+}
+
+// ReactionRepository defines the interface for reaction data access
+type ReactionRepository interface {
+	// AddReaction reports false if the user already reacted with the emoji
+	AddReaction(reaction *models.Reaction) (bool, error)
+	// RemoveReaction reports false if the user hadn't reacted with the emoji
+	RemoveReaction(messageID, userID uint, emoji string) (bool, error)
+	// ReactionCounts returns the reactions to each given message that has
+	// any, most frequent first
+	ReactionCounts(userID uint, messageIDs []uint) (map[uint][]ReactionCount, error)
+}
+
+type GormReactionRepository struct{}
+
+func (repo *GormReactionRepository) AddReaction(reaction *models.Reaction) (bool, error) {
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo *GormReactionRepository) RemoveReaction(messageID, userID uint, emoji string) (bool, error) {
+	result := database.DB.
+		Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+		Delete(&models.Reaction{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (repo *GormReactionRepository) ReactionCounts(userID uint, messageIDs []uint) (map[uint][]ReactionCount, error) {
+	result := make(map[uint][]ReactionCount, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	var counts []ReactionCount
+	err := database.DB.Model(&models.Reaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted_by_me", userID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		// Ties keep the order in which the emojis were first used
+		Order("message_id, count DESC, MIN(created)").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		result[count.MessageID] = append(result[count.MessageID], count)
+	}
+	return result, nil
+}
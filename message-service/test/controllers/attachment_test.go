@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+	"time"
+)
+
+func createAttachment(t *testing.T, client proto.MessageServiceClient, userID int32, key string) int64 {
+	response, err := client.CreateAttachment(context.Background(), &proto.CreateAttachmentRequest{
+		UserId:       userID,
+		FileName:     "photo.png",
+		ContentType:  "image/png",
+		Size:         2048,
+		StorageKey:   key,
+		ThumbnailKey: key + "-thumbnail",
+		Width:        640,
+		Height:       480,
+	})
+	if err != nil {
+		t.Fatalf("CreateAttachment failed: %v", err)
+	}
+	return response.Attachment.AttachmentId
+}
+
+// TestSendAttachments checks that attachments are sent once, in order, and
+// shown in the history and events
+func TestSendAttachments(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	first, second := createAttachment(t, client, 1, "a"), createAttachment(t, client, 1, "b")
+	sent, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+		UserId:         1,
+		ConversationId: int64(conversation.ID),
+		AttachmentIds:  []int64{second, first},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	assert.Empty(t, sent.Message.Text)
+	assert.Len(t, sent.Message.Attachments, 2)
+	assert.Len(t, publisher.Published[0].Message.Attachments, 2)
+
+	history, err := client.GetHistory(context.Background(), &proto.GetHistoryRequest{UserId: 2, ConversationId: int64(conversation.ID)})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	attachments := history.Messages[0].Attachments
+	assert.Equal(t, []int64{second, first}, []int64{attachments[0].AttachmentId, attachments[1].AttachmentId})
+	assert.True(t, attachments[0].HasThumbnail)
+	assert.EqualValues(t, 640, attachments[0].Width)
+	assert.EqualValues(t, 1, attachments[0].UploaderId)
+
+	send := func(userID int32, attachmentIDs ...int64) error {
+		_, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: userID, ConversationId: int64(conversation.ID), AttachmentIds: attachmentIDs})
+		return err
+	}
+	assert.Equal(t, codes.FailedPrecondition, status.Code(send(1, first)))
+	assert.Equal(t, codes.NotFound, status.Code(send(2, createAttachment(t, client, 1, "c"))))
+	assert.Equal(t, codes.InvalidArgument, status.Code(send(1, 3, 3)))
+	assert.Equal(t, codes.InvalidArgument, status.Code(send(1)))
+}
+
+// TestGetAttachment checks that unsent attachments are private to their
+// uploader and sent ones are shared with the participants until the
+// message is deleted for everyone
+func TestGetAttachment(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	attachmentID := createAttachment(t, client, 1, "a")
+	get := func(userID int32) (*proto.GetAttachmentResponse, error) {
+		return client.GetAttachment(context.Background(), &proto.GetAttachmentRequest{UserId: userID, AttachmentId: attachmentID})
+	}
+	response, err := get(1)
+	if err != nil {
+		t.Fatalf("GetAttachment failed: %v", err)
+	}
+	assert.Equal(t, "a", response.StorageKey)
+	_, err = get(2)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	sent, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+		UserId:         1,
+		ConversationId: int64(conversation.ID),
+		Text:           "look",
+		AttachmentIds:  []int64{attachmentID},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	response, err = get(2)
+	if err != nil {
+		t.Fatalf("GetAttachment failed: %v", err)
+	}
+	assert.Equal(t, "a-thumbnail", response.ThumbnailKey)
+	_, err = get(3)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	deleted, err := client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 1, MessageId: sent.Message.MessageId, ForEveryone: true})
+	if err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	assert.Equal(t, []string{"a", "a-thumbnail"}, deleted.StorageKeys)
+	_, err = get(1)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestPurgeUnsentAttachments checks that only attachments uploaded before
+// the cutoff and never sent nor claimed are removed, with the keys of their
+// files
+func TestPurgeUnsentAttachments(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	sentID, unsentID := createAttachment(t, client, 1, "a"), createAttachment(t, client, 1, "b")
+	claimedID := createAttachment(t, client, 1, "c")
+	if _, err := client.ClaimAttachment(context.Background(), &proto.ClaimAttachmentRequest{UserId: 1, AttachmentId: claimedID}); err != nil {
+		t.Fatalf("ClaimAttachment failed: %v", err)
+	}
+	_, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+		UserId:         1,
+		ConversationId: int64(conversation.ID),
+		AttachmentIds:  []int64{sentID},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	purge := func(uploadedBefore time.Time, limit int32) (*proto.PurgeUnsentAttachmentsResponse, error) {
+		return client.PurgeUnsentAttachments(context.Background(), &proto.PurgeUnsentAttachmentsRequest{UploadedBefore: uploadedBefore.Unix(), Limit: limit})
+	}
+	response, err := purge(time.Now().Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatalf("PurgeUnsentAttachments failed: %v", err)
+	}
+	assert.Empty(t, response.StorageKeys)
+
+	response, err = purge(time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Fatalf("PurgeUnsentAttachments failed: %v", err)
+	}
+	assert.Equal(t, []string{"b", "b-thumbnail"}, response.StorageKeys)
+	_, err = client.GetAttachment(context.Background(), &proto.GetAttachmentRequest{UserId: 1, AttachmentId: unsentID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetAttachment(context.Background(), &proto.GetAttachmentRequest{UserId: 2, AttachmentId: sentID})
+	assert.NoError(t, err)
+	_, err = client.GetAttachment(context.Background(), &proto.GetAttachmentRequest{UserId: 1, AttachmentId: claimedID})
+	assert.NoError(t, err)
+
+	_, err = purge(time.Now(), 0)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.PurgeUnsentAttachments(context.Background(), &proto.PurgeUnsentAttachmentsRequest{Limit: 10})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestClaimAttachment checks that only the uploader can claim an attachment,
+// and that a claimed one outlives the deletion of the message it was sent in
+func TestClaimAttachment(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	attachmentID := createAttachment(t, client, 1, "a")
+	claim := func(userID int32, attachmentID int64) error {
+		_, err := client.ClaimAttachment(context.Background(), &proto.ClaimAttachmentRequest{UserId: userID, AttachmentId: attachmentID})
+		return err
+	}
+	assert.Equal(t, codes.NotFound, status.Code(claim(2, attachmentID)))
+	assert.Equal(t, codes.NotFound, status.Code(claim(1, attachmentID+1)))
+	assert.NoError(t, claim(1, attachmentID))
+
+	sent, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+		UserId:         1,
+		ConversationId: int64(conversation.ID),
+		AttachmentIds:  []int64{attachmentID},
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	deleted, err := client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 1, MessageId: sent.Message.MessageId, ForEveryone: true})
+	if err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	assert.Empty(t, deleted.StorageKeys)
+
+	// Private to the uploader again
+	_, err = client.GetAttachment(context.Background(), &proto.GetAttachmentRequest{UserId: 1, AttachmentId: attachmentID})
+	assert.NoError(t, err)
+	_, err = client.GetAttachment(context.Background(), &proto.GetAttachmentRequest{UserId: 2, AttachmentId: attachmentID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+)
+
+// TestListConversations checks that conversations are listed by latest
+// activity with their last message, and paged through with the cursor
+func TestListConversations(t *testing.T) {
+	store := test.NewMockStore()
+	conn := test.InitGrpcServer(t, newServer(store, &test.MockPublisher{}))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	send := func(userID, recipientID int32, text string) {
+		if _, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+			UserId:      userID,
+			RecipientId: recipientID,
+			Text:        text,
+		}); err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+	}
+	send(1, 2, "to 2")
+	send(1, 3, "to 3")
+	send(4, 1, "from 4")
+	send(2, 1, "from 2")
+	send(3, 2, "not mine")
+
+	var lastMessages []string
+	cursor := ""
+	for page := 0; page < 2; page++ {
+		response, err := client.ListConversations(context.Background(), &proto.ListConversationsRequest{
+			UserId:   1,
+			PageSize: 2,
+			Cursor:   cursor,
+		})
+		if err != nil {
+			t.Fatalf("ListConversations failed: %v", err)
+		}
+		for _, conversation := range response.Conversations {
+			assert.Contains(t, conversation.ParticipantIds, int32(1))
+			lastMessages = append(lastMessages, conversation.LastMessage.Text)
+		}
+		cursor = response.NextCursor
+	}
+
+	assert.Equal(t, []string{"from 2", "from 4", "to 3"}, lastMessages)
+	assert.Empty(t, cursor)
+}
+
+// TestListParticipants checks that participants are listed to members only
+func TestListParticipants(t *testing.T) {
+	store := test.NewMockStore()
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2, 3)
+	conn := test.InitGrpcServer(t, newServer(store, &test.MockPublisher{}))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	response, err := client.ListParticipants(context.Background(), &proto.ListParticipantsRequest{UserId: 2, ConversationId: int64(conversation.ID)})
+	if err != nil {
+		t.Fatalf("ListParticipants failed: %v", err)
+	}
+	assert.ElementsMatch(t, []int32{1, 2, 3}, response.UserIds)
+
+	_, err = client.ListParticipants(context.Background(), &proto.ListParticipantsRequest{UserId: 4, ConversationId: int64(conversation.ID)})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestListContacts checks that contacts span all of the user's conversations, once each
+func TestListContacts(t *testing.T) {
+	store := test.NewMockStore()
+	store.CreateConversation(models.ConversationDirect, 1, 2)
+	store.CreateConversation(models.ConversationGroup, 3, 1, 2)
+	store.CreateConversation(models.ConversationDirect, 4, 5)
+	conn := test.InitGrpcServer(t, newServer(store, &test.MockPublisher{}))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	response, err := client.ListContacts(context.Background(), &proto.ListContactsRequest{UserId: 1})
+	if err != nil {
+		t.Fatalf("ListContacts failed: %v", err)
+	}
+	assert.ElementsMatch(t, []int32{2, 3}, response.UserIds)
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+	"time"
+)
+
+// TestEditMessageKeepsHistory checks that edits replace the text, announce it
+// to every participant and keep the previous versions
+func TestEditMessageKeepsHistory(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	sent, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, RecipientId: 2, Text: "helo"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	messageID := sent.Message.MessageId
+	for _, text := range []string{"hello", " hello "} {
+		edited, err := client.EditMessage(context.Background(), &proto.EditMessageRequest{UserId: 1, MessageId: messageID, Text: text})
+		if err != nil {
+			t.Fatalf("EditMessage failed: %v", err)
+		}
+		assert.Equal(t, "hello", edited.Message.Text)
+		assert.NotZero(t, edited.Message.EditedAt)
+	}
+
+	// Editing to the same text changes nothing
+	assert.Len(t, publisher.Edited, 1)
+	assert.ElementsMatch(t, []uint{1, 2}, publisher.Edited[0].Recipients)
+	assert.Equal(t, "hello", publisher.Edited[0].Message.Text)
+
+	history, err := client.GetEditHistory(context.Background(), &proto.GetEditHistoryRequest{UserId: 2, MessageId: messageID})
+	if err != nil {
+		t.Fatalf("GetEditHistory failed: %v", err)
+	}
+	assert.Equal(t, "hello", history.Message.Text)
+	assert.Len(t, history.Edits, 1)
+	assert.Equal(t, "helo", history.Edits[0].Text)
+
+	_, err = client.GetEditHistory(context.Background(), &proto.GetEditHistoryRequest{UserId: 3, MessageId: messageID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestEditMessageRules checks that only the sender can edit, within the edit
+// window and until the message is deleted
+func TestEditMessageRules(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	old := models.Message{ConversationID: conversation.ID, SenderID: 1, Text: "old", Created: time.Now().Add(-time.Hour)}
+	recent := models.Message{ConversationID: conversation.ID, SenderID: 1, Text: "recent", Created: time.Now()}
+	store.CreateMessage(&old)
+	store.CreateMessage(&recent)
+	server := newServer(store, publisher)
+	server.EditWindow = 15 * time.Minute
+	conn := test.InitGrpcServer(t, server)
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	edit := func(userID int32, messageID uint, text string) error {
+		_, err := client.EditMessage(context.Background(), &proto.EditMessageRequest{UserId: userID, MessageId: int64(messageID), Text: text})
+		return err
+	}
+	assert.Equal(t, codes.FailedPrecondition, status.Code(edit(1, old.ID, "edited")))
+	assert.Equal(t, codes.PermissionDenied, status.Code(edit(2, recent.ID, "edited")))
+	assert.Equal(t, codes.NotFound, status.Code(edit(3, recent.ID, "edited")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(edit(1, recent.ID, " ")))
+
+	_, err := client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 1, MessageId: int64(recent.ID), ForEveryone: true})
+	if err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	assert.Equal(t, codes.FailedPrecondition, status.Code(edit(1, recent.ID, "edited")))
+	assert.Empty(t, publisher.Edited)
+}
+
+// TestDeleteMessage checks that deleting for everyone leaves a placeholder for
+// all participants, while deleting for oneself hides the message from the
+// caller only
+func TestDeleteMessage(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2, 3)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	var messageIDs []int64
+	for _, text := range []string{"first", "second"} {
+		sent, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, ConversationId: int64(conversation.ID), Text: text})
+		if err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+		messageIDs = append(messageIDs, sent.Message.MessageId)
+	}
+
+	_, err := client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 2, MessageId: messageIDs[0], ForEveryone: true})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 2, MessageId: messageIDs[0]})
+	assert.NoError(t, err)
+	_, err = client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 1, MessageId: messageIDs[1], ForEveryone: true})
+	assert.NoError(t, err)
+	// Deleting again is accepted but not announced
+	_, err = client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 1, MessageId: messageIDs[1], ForEveryone: true})
+	assert.NoError(t, err)
+
+	assert.Len(t, publisher.Deletions, 2)
+	assert.Equal(t, []uint{2}, publisher.Deletions[0].Recipients)
+	assert.False(t, publisher.Deletions[0].Deletion.ForEveryone)
+	assert.ElementsMatch(t, []uint{1, 2, 3}, publisher.Deletions[1].Recipients)
+	assert.True(t, publisher.Deletions[1].Deletion.ForEveryone)
+
+	history := func(userID int32) []*proto.Message {
+		response, err := client.GetHistory(context.Background(), &proto.GetHistoryRequest{UserId: userID, ConversationId: int64(conversation.ID)})
+		if err != nil {
+			t.Fatalf("GetHistory failed: %v", err)
+		}
+		return response.Messages
+	}
+	hidden := history(2)
+	assert.Len(t, hidden, 1)
+	assert.True(t, hidden[0].Deleted)
+	assert.Empty(t, hidden[0].Text)
+	assert.Len(t, history(3), 2)
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/controllers"
+	"message-service/events"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+)
+
+var directory = test.MockDirectory{1: "alice", 2: "bob", 3: "carol", 4: "dave"}
+
+func newGroupClient(t *testing.T, publisher *test.MockPublisher) proto.MessageServiceClient {
+	store := test.NewMockStore()
+	server := &controllers.MessageServiceServer{
+		ConversationRepo: store,
+		MessageRepo:      store,
+		Publisher:        publisher,
+		Users:            directory,
+	}
+	conn := test.InitGrpcServer(t, server)
+	t.Cleanup(func() { conn.Close() })
+	return proto.NewMessageServiceClient(conn)
+}
+
+// createGroup starts a group owned by alice with bob and carol as members
+func createGroup(t *testing.T, client proto.MessageServiceClient) int64 {
+	response, err := client.CreateGroup(context.Background(), &proto.CreateGroupRequest{
+		UserId:    1,
+		Title:     "friends",
+		MemberIds: []int32{2, 3, 2},
+	})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	return response.Conversation.ConversationId
+}
+
+func roles(conversation *proto.Conversation) map[int32]string {
+	result := make(map[int32]string)
+	for _, member := range conversation.Members {
+		result[member.UserId] = member.Role
+	}
+	return result
+}
+
+// TestCreateGroup checks that the creator owns the group and every member hears about it
+func TestCreateGroup(t *testing.T) {
+	publisher := &test.MockPublisher{}
+	client := newGroupClient(t, publisher)
+
+	response, err := client.CreateGroup(context.Background(), &proto.CreateGroupRequest{
+		UserId:    1,
+		Title:     "friends",
+		MemberIds: []int32{2, 3},
+	})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+
+	assert.Equal(t, "group", response.Conversation.Kind)
+	assert.Equal(t, map[int32]string{1: "owner", 2: "member", 3: "member"}, roles(response.Conversation))
+	assert.Len(t, publisher.Changes, 1)
+	assert.Equal(t, events.ActionCreated, publisher.Changes[0].Change.Action)
+	assert.Equal(t, `alice created the group "friends" with bob and carol`, publisher.Changes[0].Change.Text)
+	assert.ElementsMatch(t, []uint{1, 2, 3}, publisher.Changes[0].Recipients)
+}
+
+// TestCreateGroupWithUnknownMember checks that members are validated against the user directory
+func TestCreateGroupWithUnknownMember(t *testing.T) {
+	client := newGroupClient(t, &test.MockPublisher{})
+
+	_, err := client.CreateGroup(context.Background(), &proto.CreateGroupRequest{UserId: 1, Title: "friends", MemberIds: []int32{2, 99}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.CreateGroup(context.Background(), &proto.CreateGroupRequest{UserId: 1, Title: " ", MemberIds: []int32{2}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestAddMembersPermissions checks that only owners and admins can invite
+func TestAddMembersPermissions(t *testing.T) {
+	publisher := &test.MockPublisher{}
+	client := newGroupClient(t, publisher)
+	groupID := createGroup(t, client)
+
+	_, err := client.AddMembers(context.Background(), &proto.AddMembersRequest{UserId: 2, ConversationId: groupID, MemberIds: []int32{4}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.UpdateMemberRole(context.Background(), &proto.UpdateMemberRoleRequest{UserId: 1, ConversationId: groupID, MemberId: 2, Role: "admin"})
+	assert.NoError(t, err)
+
+	response, err := client.AddMembers(context.Background(), &proto.AddMembersRequest{UserId: 2, ConversationId: groupID, MemberIds: []int32{4, 3}})
+	if err != nil {
+		t.Fatalf("AddMembers failed: %v", err)
+	}
+	assert.Equal(t, "member", roles(response.Conversation)[4])
+
+	last := publisher.Changes[len(publisher.Changes)-1]
+	assert.Equal(t, "bob added dave", last.Change.Text)
+	assert.Equal(t, []uint{4}, last.Change.MemberIDs)
+	assert.ElementsMatch(t, []uint{1, 2, 3, 4}, last.Recipients)
+}
+
+// TestRemoveMemberPermissions checks that members can only be removed by those ranked above them
+func TestRemoveMemberPermissions(t *testing.T) {
+	publisher := &test.MockPublisher{}
+	client := newGroupClient(t, publisher)
+	groupID := createGroup(t, client)
+	client.UpdateMemberRole(context.Background(), &proto.UpdateMemberRoleRequest{UserId: 1, ConversationId: groupID, MemberId: 2, Role: "admin"})
+
+	_, err := client.RemoveMember(context.Background(), &proto.RemoveMemberRequest{UserId: 3, ConversationId: groupID, MemberId: 2})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.RemoveMember(context.Background(), &proto.RemoveMemberRequest{UserId: 2, ConversationId: groupID, MemberId: 1})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.RemoveMember(context.Background(), &proto.RemoveMemberRequest{UserId: 2, ConversationId: groupID, MemberId: 4})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	response, err := client.RemoveMember(context.Background(), &proto.RemoveMemberRequest{UserId: 2, ConversationId: groupID, MemberId: 3})
+	if err != nil {
+		t.Fatalf("RemoveMember failed: %v", err)
+	}
+	assert.NotContains(t, roles(response.Conversation), int32(3))
+
+	last := publisher.Changes[len(publisher.Changes)-1]
+	assert.Equal(t, "bob removed carol", last.Change.Text)
+	assert.ElementsMatch(t, []uint{1, 2, 3}, last.Recipients)
+
+	_, err = client.GetHistory(context.Background(), &proto.GetHistoryRequest{UserId: 3, ConversationId: groupID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestTransferOwnershipAndLeave checks that owners must hand over the group before leaving
+func TestTransferOwnershipAndLeave(t *testing.T) {
+	client := newGroupClient(t, &test.MockPublisher{})
+	groupID := createGroup(t, client)
+
+	_, err := client.LeaveGroup(context.Background(), &proto.LeaveGroupRequest{UserId: 1, ConversationId: groupID})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = client.TransferOwnership(context.Background(), &proto.TransferOwnershipRequest{UserId: 2, ConversationId: groupID, NewOwnerId: 2})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	response, err := client.TransferOwnership(context.Background(), &proto.TransferOwnershipRequest{UserId: 1, ConversationId: groupID, NewOwnerId: 2})
+	if err != nil {
+		t.Fatalf("TransferOwnership failed: %v", err)
+	}
+	assert.Equal(t, map[int32]string{1: "admin", 2: "owner", 3: "member"}, roles(response.Conversation))
+
+	_, err = client.LeaveGroup(context.Background(), &proto.LeaveGroupRequest{UserId: 1, ConversationId: groupID})
+	assert.NoError(t, err)
+	_, err = client.UpdateMemberRole(context.Background(), &proto.UpdateMemberRoleRequest{UserId: 1, ConversationId: groupID, MemberId: 3, Role: "admin"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestGroupActionsOnDirectConversation checks that direct conversations can't be managed like groups
+func TestGroupActionsOnDirectConversation(t *testing.T) {
+	client := newGroupClient(t, &test.MockPublisher{})
+	sent, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, RecipientId: 2, Text: "hi"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+
+	_, err = client.AddMembers(context.Background(), &proto.AddMembersRequest{
+		UserId:         1,
+		ConversationId: sent.Message.ConversationId,
+		MemberIds:      []int32{3},
+	})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
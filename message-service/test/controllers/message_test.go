@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/controllers"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"strings"
+	"testing"
+)
+
+func newServer(store *test.MockStore, publisher *test.MockPublisher) *controllers.MessageServiceServer {
+	return &controllers.MessageServiceServer{
+		ConversationRepo: store,
+		MessageRepo:      store,
+		ReactionRepo:     store,
+		AttachmentRepo:   store,
+		Publisher:        publisher,
+		Users:            directory,
+	}
+}
+
+// TestSendMessageStartsDirectConversation checks that the first message to a
+// TestSendMessageToUnknownRecipient checks that no conversation is started
+// with a user who doesn't exist
+func TestSendMessageToUnknownRecipient(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	_, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, RecipientId: 99, Text: "hi"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	conversations, err := client.ListConversations(context.Background(), &proto.ListConversationsRequest{UserId: 1})
+	assert.NoError(t, err)
+	assert.Empty(t, conversations.Conversations)
+	assert.Empty(t, publisher.Published)
+}
+
+// user starts a conversation, which later messages in both directions reuse
+func TestSendMessageStartsDirectConversation(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	first, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, RecipientId: 2, Text: " hi "})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	assert.Equal(t, "hi", first.Message.Text)
+	assert.Equal(t, int32(1), first.Message.SenderId)
+
+	reply, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 2, RecipientId: 1, Text: "hello"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	assert.Equal(t, first.Message.ConversationId, reply.Message.ConversationId)
+
+	assert.Len(t, publisher.Published, 2)
+	assert.ElementsMatch(t, []uint{1, 2}, publisher.Published[0].Recipients)
+	assert.Equal(t, uint(first.Message.MessageId), publisher.Published[0].Message.ID)
+}
+
+// TestSendMessageToForeignConversation checks that only participants can post
+func TestSendMessageToForeignConversation(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	_, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+		UserId:         3,
+		ConversationId: int64(conversation.ID),
+		Text:           "hi",
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Empty(t, publisher.Published)
+}
+
+// TestSendMessageInvalidInput checks that empty, oversized and unaddressed messages are rejected
+func TestSendMessageInvalidInput(t *testing.T) {
+	conn := test.InitGrpcServer(t, newServer(test.NewMockStore(), &test.MockPublisher{}))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	requests := []*proto.SendMessageRequest{
+		{UserId: 1, RecipientId: 2, Text: "   "},
+		{UserId: 1, RecipientId: 2, Text: strings.Repeat("x", 4097)},
+		{UserId: 1, Text: "hi"},
+		{UserId: 1, RecipientId: 1, Text: "hi"},
+	}
+	for _, request := range requests {
+		_, err := client.SendMessage(context.Background(), request)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+}
+
+// TestGetHistoryPages checks that history is paged newest first until the cursor runs out
+func TestGetHistoryPages(t *testing.T) {
+	store := test.NewMockStore()
+	conn := test.InitGrpcServer(t, newServer(store, &test.MockPublisher{}))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	var conversationID int64
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		response, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, RecipientId: 2, Text: text})
+		if err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+		conversationID = response.Message.ConversationId
+	}
+
+	var texts []string
+	cursor := ""
+	for page := 0; page < 3; page++ {
+		response, err := client.GetHistory(context.Background(), &proto.GetHistoryRequest{
+			UserId:         2,
+			ConversationId: conversationID,
+			PageSize:       2,
+			Cursor:         cursor,
+		})
+		if err != nil {
+			t.Fatalf("GetHistory failed: %v", err)
+		}
+		for _, message := range response.Messages {
+			texts = append(texts, message.Text)
+		}
+		cursor = response.NextCursor
+	}
+
+	assert.Equal(t, []string{"e", "d", "c", "b", "a"}, texts)
+	assert.Empty(t, cursor)
+}
+
+// TestGetHistoryOfForeignConversation checks that outsiders can't read a conversation
+func TestGetHistoryOfForeignConversation(t *testing.T) {
+	store := test.NewMockStore()
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	conn := test.InitGrpcServer(t, newServer(store, &test.MockPublisher{}))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	_, err := client.GetHistory(context.Background(), &proto.GetHistoryRequest{UserId: 3, ConversationId: int64(conversation.ID)})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetHistory(context.Background(), &proto.GetHistoryRequest{
+		UserId:         1,
+		ConversationId: int64(conversation.ID),
+		Cursor:         "not a cursor",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
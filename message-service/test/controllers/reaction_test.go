@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+	"time"
+)
+
+// TestReactions checks that reactions are counted per emoji, announced only
+// when they change and shown in the history
+func TestReactions(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2, 3)
+	message := models.Message{ConversationID: conversation.ID, SenderID: 1, Text: "hello", Created: time.Now()}
+	store.CreateMessage(&message)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	react := func(userID int32, emoji string) *proto.ReactionResponse {
+		response, err := client.AddReaction(context.Background(), &proto.ReactionRequest{UserId: userID, MessageId: int64(message.ID), Emoji: emoji})
+		if err != nil {
+			t.Fatalf("AddReaction failed: %v", err)
+		}
+		return response
+	}
+	react(2, "👍")
+	react(3, "❤️")
+	react(3, "👍")
+	// Reacting twice changes nothing
+	response := react(3, "👍")
+	assert.Len(t, response.Reactions, 2)
+	assert.Equal(t, "👍", response.Reactions[0].Emoji)
+	assert.EqualValues(t, 2, response.Reactions[0].Count)
+	assert.True(t, response.Reactions[0].ReactedByMe)
+
+	removed, err := client.RemoveReaction(context.Background(), &proto.ReactionRequest{UserId: 2, MessageId: int64(message.ID), Emoji: "👍"})
+	if err != nil {
+		t.Fatalf("RemoveReaction failed: %v", err)
+	}
+	assert.Len(t, removed.Reactions, 2)
+	assert.False(t, removed.Reactions[0].ReactedByMe)
+
+	assert.Len(t, publisher.Reactions, 4)
+	last := publisher.Reactions[3]
+	assert.Equal(t, events.ActionRemoved, last.Update.Action)
+	assert.EqualValues(t, 1, last.Update.Count)
+	assert.ElementsMatch(t, []uint{1, 2, 3}, last.Recipients)
+
+	history, err := client.GetHistory(context.Background(), &proto.GetHistoryRequest{UserId: 1, ConversationId: int64(conversation.ID)})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	assert.Len(t, history.Messages[0].Reactions, 2)
+}
+
+// TestReactionRules checks that reactions must be emojis, on visible messages
+// that are not deleted
+func TestReactionRules(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2)
+	message := models.Message{ConversationID: conversation.ID, SenderID: 1, Text: "hello", Created: time.Now()}
+	store.CreateMessage(&message)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	react := func(userID int32, emoji string) error {
+		_, err := client.AddReaction(context.Background(), &proto.ReactionRequest{UserId: userID, MessageId: int64(message.ID), Emoji: emoji})
+		return err
+	}
+	for _, emoji := range []string{"", "ok", "👍 👍", "👍👍👍👍👍👍👍👍👍👍👍👍👍👍👍👍👍"} {
+		assert.Equal(t, codes.InvalidArgument, status.Code(react(2, emoji)), emoji)
+	}
+	assert.Equal(t, codes.NotFound, status.Code(react(3, "👍")))
+
+	_, err := client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 1, MessageId: int64(message.ID), ForEveryone: true})
+	if err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	assert.Equal(t, codes.FailedPrecondition, status.Code(react(2, "👍")))
+	assert.Empty(t, publisher.Reactions)
+}
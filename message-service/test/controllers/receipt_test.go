@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+)
+
+// sendMessages posts one message per sender to the conversation and returns their IDs
+func sendMessages(t *testing.T, client proto.MessageServiceClient, conversationID uint, senderIDs ...int32) []int64 {
+	var messageIDs []int64
+	for _, senderID := range senderIDs {
+		response, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+			UserId:         senderID,
+			ConversationId: int64(conversationID),
+			Text:           "hi",
+		})
+		if err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+		messageIDs = append(messageIDs, response.Message.MessageId)
+	}
+	return messageIDs
+}
+
+// TestMarkReadNotifiesSenders checks that reading up to a message tells the
+// senders of every message passed over, but not the reader
+func TestMarkReadNotifiesSenders(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2, 3)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+	messageIDs := sendMessages(t, client, conversation.ID, 1, 2, 3)
+
+	response, err := client.MarkRead(context.Background(), &proto.ReceiptRequest{
+		UserId:         3,
+		ConversationId: int64(conversation.ID),
+		MessageId:      messageIDs[2],
+	})
+	if err != nil {
+		t.Fatalf("MarkRead failed: %v", err)
+	}
+	assert.Equal(t, messageIDs[2], response.Receipt.LastReadMessageId)
+	assert.Equal(t, messageIDs[2], response.Receipt.LastDeliveredMessageId)
+
+	if assert.Len(t, publisher.Receipts, 1) {
+		assert.Equal(t, events.ReceiptRead, publisher.Receipts[0].Update.Status)
+		assert.Equal(t, uint(3), publisher.Receipts[0].Update.UserID)
+		assert.ElementsMatch(t, []uint{1, 2}, publisher.Receipts[0].Recipients)
+	}
+}
+
+// TestMarkDeliveredOnlyMovesForward checks that stale receipts are accepted
+// without moving the mark back or notifying anyone again
+func TestMarkDeliveredOnlyMovesForward(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationDirect, 1, 2)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+	messageIDs := sendMessages(t, client, conversation.ID, 1, 1)
+
+	for _, messageID := range []int64{messageIDs[1], messageIDs[0], messageIDs[1]} {
+		_, err := client.MarkDelivered(context.Background(), &proto.ReceiptRequest{
+			UserId:         2,
+			ConversationId: int64(conversation.ID),
+			MessageId:      messageID,
+		})
+		if err != nil {
+			t.Fatalf("MarkDelivered failed: %v", err)
+		}
+	}
+
+	assert.Len(t, publisher.Receipts, 1)
+	state, err := client.GetReadState(context.Background(), &proto.GetReadStateRequest{UserId: 1, ConversationId: int64(conversation.ID)})
+	if err != nil {
+		t.Fatalf("GetReadState failed: %v", err)
+	}
+	for _, receipt := range state.Receipts {
+		if receipt.UserId == 2 {
+			assert.Equal(t, messageIDs[1], receipt.LastDeliveredMessageId)
+			assert.Zero(t, receipt.LastReadMessageId)
+		}
+	}
+}
+
+// TestMarkReadInvalidMessage checks that receipts must name a message of the
+// caller's conversation
+func TestMarkReadInvalidMessage(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationDirect, 1, 2)
+	other := store.CreateConversation(models.ConversationDirect, 1, 3)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+	foreignIDs := sendMessages(t, client, other.ID, 3)
+
+	_, err := client.MarkRead(context.Background(), &proto.ReceiptRequest{UserId: 2, ConversationId: int64(conversation.ID)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.MarkRead(context.Background(), &proto.ReceiptRequest{
+		UserId:         2,
+		ConversationId: int64(conversation.ID),
+		MessageId:      foreignIDs[0],
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.GetReadState(context.Background(), &proto.GetReadStateRequest{UserId: 2, ConversationId: int64(other.ID)})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Empty(t, publisher.Receipts)
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+	"time"
+)
+
+// TestSearchMessages checks that searches only find messages of the
+// caller's conversations, highlight the matches and page through the rest
+func TestSearchMessages(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	ours := store.CreateConversation(models.ConversationGroup, 1, 2)
+	theirs := store.CreateConversation(models.ConversationGroup, 2, 3)
+	start := time.Now().Add(-time.Hour)
+	for i, message := range []models.Message{
+		{ConversationID: ours.ID, SenderID: 1, Text: "Pizza tonight?"},
+		{ConversationID: ours.ID, SenderID: 2, Text: "no pizza for me"},
+		{ConversationID: theirs.ID, SenderID: 3, Text: "pizza is great"},
+		{ConversationID: ours.ID, SenderID: 2, Text: "what about pizza tomorrow"},
+	} {
+		message.Created = start.Add(time.Duration(i) * time.Minute)
+		store.CreateMessage(&message)
+	}
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	search := func(request *proto.SearchMessagesRequest) *proto.SearchMessagesResponse {
+		request.UserId = 1
+		response, err := client.SearchMessages(context.Background(), request)
+		if err != nil {
+			t.Fatalf("SearchMessages failed: %v", err)
+		}
+		return response
+	}
+	ids := func(response *proto.SearchMessagesResponse) []int64 {
+		var result []int64
+		for _, hit := range response.Results {
+			result = append(result, hit.Message.MessageId)
+		}
+		return result
+	}
+
+	page := search(&proto.SearchMessagesRequest{Query: "pizza", PageSize: 2})
+	assert.Equal(t, []int64{4, 2}, ids(page))
+	assert.Equal(t, "what about pizza tomorrow", page.Results[0].Snippet)
+	highlight := page.Results[0].Highlights[0]
+	assert.EqualValues(t, 11, highlight.Start)
+	assert.EqualValues(t, 5, highlight.Length)
+	page = search(&proto.SearchMessagesRequest{Query: "pizza", PageSize: 2, Cursor: page.NextCursor})
+	assert.Equal(t, []int64{1}, ids(page))
+	assert.Empty(t, page.NextCursor)
+
+	assert.Equal(t, []int64{2}, ids(search(&proto.SearchMessagesRequest{Query: "pizza me"})))
+	assert.Equal(t, []int64{4, 2}, ids(search(&proto.SearchMessagesRequest{Query: "pizza", SenderId: 2})))
+	assert.Equal(t, []int64{2}, ids(search(&proto.SearchMessagesRequest{
+		Query:  "pizza",
+		After:  start.Add(time.Minute).Unix(),
+		Before: start.Add(3 * time.Minute).Unix(),
+	})))
+
+	// Edits and deletions are searched as they are now
+	_, err := client.EditMessage(context.Background(), &proto.EditMessageRequest{UserId: 1, MessageId: 1, Text: "Burgers tonight?"})
+	assert.NoError(t, err)
+	_, err = client.DeleteMessage(context.Background(), &proto.DeleteMessageRequest{UserId: 2, MessageId: 4, ForEveryone: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{2}, ids(search(&proto.SearchMessagesRequest{Query: "pizza"})))
+	assert.Equal(t, []int64{1}, ids(search(&proto.SearchMessagesRequest{Query: "burgers"})))
+}
+
+// TestSearchMessagesInvalid checks the query and filters are validated
+func TestSearchMessagesInvalid(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	theirs := store.CreateConversation(models.ConversationGroup, 2, 3)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	for _, request := range []*proto.SearchMessagesRequest{
+		{UserId: 1, Query: " "},
+		{UserId: 1, Query: "pizza", After: 200, Before: 100},
+		{UserId: 1, Query: "pizza", Cursor: "bogus"},
+	} {
+		_, err := client.SearchMessages(context.Background(), request)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+	_, err := client.SearchMessages(context.Background(), &proto.SearchMessagesRequest{UserId: 1, Query: "pizza", ConversationId: int64(theirs.ID)})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
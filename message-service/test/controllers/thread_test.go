@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/test"
+	"testing"
+)
+
+// TestQuotedReply checks that replies carry a quote of the message they
+// answer and stay in the main timeline
+func TestQuotedReply(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	original, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, RecipientId: 2, Text: "lunch?"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	reply, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+		UserId:           2,
+		ConversationId:   original.Message.ConversationId,
+		Text:             "sure",
+		ReplyToMessageId: original.Message.MessageId,
+	})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	assert.Equal(t, original.Message.MessageId, reply.Message.ReplyTo.MessageId)
+	assert.Equal(t, "lunch?", reply.Message.ReplyTo.Text)
+
+	history, err := client.GetHistory(context.Background(), &proto.GetHistoryRequest{UserId: 1, ConversationId: original.Message.ConversationId})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	assert.Len(t, history.Messages, 2)
+	assert.Equal(t, "lunch?", history.Messages[0].ReplyTo.Text)
+	assert.Len(t, publisher.Published, 2)
+
+	// Quoting a message of another conversation is refused
+	_, err = client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, RecipientId: 3, Text: "hi", ReplyToMessageId: original.Message.MessageId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestThread checks that thread replies stay out of the main timeline, update
+// the summary of their root and are counted as unread until marked read
+func TestThread(t *testing.T) {
+	store, publisher := test.NewMockStore(), &test.MockPublisher{}
+	conversation := store.CreateConversation(models.ConversationGroup, 1, 2, 3)
+	conn := test.InitGrpcServer(t, newServer(store, publisher))
+	defer conn.Close()
+	client := proto.NewMessageServiceClient(conn)
+
+	root, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, ConversationId: int64(conversation.ID), Text: "plans?"})
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	rootID := root.Message.MessageId
+	var replyIDs []int64
+	for _, userID := range []int32{2, 3, 2} {
+		reply, err := client.SendMessage(context.Background(), &proto.SendMessageRequest{
+			UserId:         userID,
+			ConversationId: int64(conversation.ID),
+			Text:           "reply",
+			ThreadRootId:   rootID,
+		})
+		if err != nil {
+			t.Fatalf("SendMessage failed: %v", err)
+		}
+		assert.Equal(t, rootID, reply.Message.ThreadRootId)
+		replyIDs = append(replyIDs, reply.Message.MessageId)
+	}
+	assert.Len(t, publisher.Published, 1)
+	assert.Len(t, publisher.Replies, 3)
+	assert.ElementsMatch(t, []uint{1, 2, 3}, publisher.Replies[0].Recipients)
+
+	// Threads don't nest
+	_, err = client.SendMessage(context.Background(), &proto.SendMessageRequest{UserId: 1, ConversationId: int64(conversation.ID), Text: "reply", ThreadRootId: replyIDs[0]})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	history, err := client.GetHistory(context.Background(), &proto.GetHistoryRequest{UserId: 1, ConversationId: int64(conversation.ID)})
+	if err != nil {
+		t.Fatalf("GetHistory failed: %v", err)
+	}
+	assert.Len(t, history.Messages, 1)
+	assert.EqualValues(t, 3, history.Messages[0].Thread.ReplyCount)
+	assert.EqualValues(t, 3, history.Messages[0].Thread.UnreadCount)
+
+	page, err := client.GetThread(context.Background(), &proto.GetThreadRequest{UserId: 3, RootMessageId: rootID, PageSize: 2})
+	if err != nil {
+		t.Fatalf("GetThread failed: %v", err)
+	}
+	assert.Equal(t, rootID, page.Root.MessageId)
+	assert.Equal(t, []int64{replyIDs[2], replyIDs[1]}, []int64{page.Replies[0].MessageId, page.Replies[1].MessageId})
+	// Unread replies are those of the others
+	assert.EqualValues(t, 2, page.Root.Thread.UnreadCount)
+	page, err = client.GetThread(context.Background(), &proto.GetThreadRequest{UserId: 3, RootMessageId: rootID, PageSize: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("GetThread failed: %v", err)
+	}
+	assert.Len(t, page.Replies, 1)
+	assert.Empty(t, page.NextCursor)
+
+	read, err := client.MarkThreadRead(context.Background(), &proto.MarkThreadReadRequest{UserId: 1, RootMessageId: rootID, MessageId: replyIDs[1]})
+	if err != nil {
+		t.Fatalf("MarkThreadRead failed: %v", err)
+	}
+	assert.EqualValues(t, 3, read.Thread.ReplyCount)
+	assert.EqualValues(t, 1, read.Thread.UnreadCount)
+
+	_, err = client.MarkThreadRead(context.Background(), &proto.MarkThreadReadRequest{UserId: 1, RootMessageId: replyIDs[0], MessageId: replyIDs[1]})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetThread(context.Background(), &proto.GetThreadRequest{UserId: 4, RootMessageId: rootID})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
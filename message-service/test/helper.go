@@ -0,0 +1,743 @@
+package test
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"message-service/database"
+	"message-service/events"
+	"message-service/models"
+	"message-service/proto"
+	"message-service/repositories"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MockStore keeps conversations, messages and reactions in memory and
+// implements every repository, since messages bump their conversation
+type MockStore struct {
+	mu            sync.Mutex
+	conversations map[uint]*models.Conversation
+	messages      []models.Message
+	edits         []models.MessageEdit
+	hidden        map[models.HiddenMessage]bool // Keyed without HiddenAt
+	reactions     []models.Reaction
+	threadReads   map[models.ThreadRead]uint // Keyed without LastReadMessageID
+	attachments   []models.Attachment        // Indexed by ID - 1, deleted ones are zeroed
+}
+
+func NewMockStore() *MockStore {
+	return &MockStore{
+		conversations: make(map[uint]*models.Conversation),
+		hidden:        make(map[models.HiddenMessage]bool),
+		threadReads:   make(map[models.ThreadRead]uint),
+	}
+}
+
+// CreateConversation adds a conversation of the given users. Groups are
+// owned by the first user.
+func (m *MockStore) CreateConversation(kind string, userIDs ...uint) *models.Conversation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation := &models.Conversation{ID: uint(len(m.conversations) + 1), Kind: kind, Created: time.Now()}
+	for i, userID := range userIDs {
+		role := models.RoleMember
+		if kind == models.ConversationGroup && i == 0 {
+			role = models.RoleOwner
+		}
+		conversation.Participants = append(conversation.Participants, models.Participant{
+			ConversationID: conversation.ID,
+			UserID:         userID,
+			Role:           role,
+			JoinedAt:       conversation.Created,
+		})
+	}
+	m.conversations[conversation.ID] = conversation
+	return conversation
+}
+
+func (m *MockStore) FindOrCreateDirectConversation(userID, otherUserID uint) (*models.Conversation, error) {
+	key := repositories.DirectKey(userID, otherUserID)
+	m.mu.Lock()
+	for _, conversation := range m.conversations {
+		if conversation.DirectKey != nil && *conversation.DirectKey == key {
+			m.mu.Unlock()
+			return m.FindConversation(conversation.ID)
+		}
+	}
+	m.mu.Unlock()
+
+	conversation := m.CreateConversation(models.ConversationDirect, userID, otherUserID)
+	conversation.DirectKey = &key
+	return m.FindConversation(conversation.ID)
+}
+
+func (m *MockStore) FindConversation(id uint) (*models.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation, exists := m.conversations[id]
+	if !exists {
+		return nil, repositories.ErrNotFound
+	}
+	stored := *conversation
+	stored.Participants = append([]models.Participant(nil), conversation.Participants...)
+	return &stored, nil
+}
+
+func (m *MockStore) CreateGroup(conversation *models.Conversation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation.ID = uint(len(m.conversations) + 1)
+	for i := range conversation.Participants {
+		conversation.Participants[i].ConversationID = conversation.ID
+	}
+	stored := *conversation
+	stored.Participants = append([]models.Participant(nil), conversation.Participants...)
+	m.conversations[conversation.ID] = &stored
+	return nil
+}
+
+func (m *MockStore) AddParticipants(participants []models.Participant) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, participant := range participants {
+		conversation := m.conversations[participant.ConversationID]
+		if m.participant(participant.ConversationID, participant.UserID) == nil {
+			conversation.Participants = append(conversation.Participants, participant)
+		}
+	}
+	return nil
+}
+
+func (m *MockStore) RemoveParticipant(conversationID, userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conversation := m.conversations[conversationID]
+	for i, participant := range conversation.Participants {
+		if participant.UserID == userID {
+			conversation.Participants = append(conversation.Participants[:i:i], conversation.Participants[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MockStore) UpdateParticipantRole(conversationID, userID uint, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if participant := m.participant(conversationID, userID); participant != nil {
+		participant.Role = role
+	}
+	return nil
+}
+
+func (m *MockStore) TransferOwnership(conversationID, ownerID, newOwnerID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.participant(conversationID, ownerID).Role = models.RoleAdmin
+	m.participant(conversationID, newOwnerID).Role = models.RoleOwner
+	return nil
+}
+
+func (m *MockStore) MarkDelivered(conversationID, userID, messageID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	participant := m.participant(conversationID, userID)
+	if participant == nil || participant.LastDeliveredMessageID >= messageID {
+		return false, nil
+	}
+	participant.LastDeliveredMessageID = messageID
+	return true, nil
+}
+
+func (m *MockStore) MarkRead(conversationID, userID, messageID uint) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	participant := m.participant(conversationID, userID)
+	if participant == nil || participant.LastReadMessageID >= messageID {
+		return false, nil
+	}
+	participant.LastReadMessageID = messageID
+	participant.LastDeliveredMessageID = max(participant.LastDeliveredMessageID, messageID)
+	return true, nil
+}
+
+func (m *MockStore) ContactIDs(userID uint) ([]uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[uint]bool)
+	var contactIDs []uint
+	for _, conversation := range m.conversations {
+		if m.participant(conversation.ID, userID) == nil {
+			continue
+		}
+		for _, participant := range conversation.Participants {
+			if participant.UserID != userID && !seen[participant.UserID] {
+				seen[participant.UserID] = true
+				contactIDs = append(contactIDs, participant.UserID)
+			}
+		}
+	}
+	return contactIDs, nil
+}
+
+func (m *MockStore) participant(conversationID, userID uint) *models.Participant {
+	conversation := m.conversations[conversationID]
+	for i := range conversation.Participants {
+		if conversation.Participants[i].UserID == userID {
+			return &conversation.Participants[i]
+		}
+	}
+	return nil
+}
+
+func (m *MockStore) ListConversations(userID uint, after *repositories.ConversationPosition, limit int) ([]models.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []models.Conversation
+	for _, conversation := range m.conversations {
+		for _, participant := range conversation.Participants {
+			if participant.UserID == userID {
+				result = append(result, *conversation)
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].LastMessageAt.Equal(result[j].LastMessageAt) {
+			return result[i].LastMessageAt.After(result[j].LastMessageAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	if after != nil {
+		for len(result) > 0 && !isBefore(result[0], after) {
+			result = result[1:]
+		}
+	}
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func isBefore(conversation models.Conversation, position *repositories.ConversationPosition) bool {
+	if !conversation.LastMessageAt.Equal(position.LastMessageAt) {
+		return conversation.LastMessageAt.Before(position.LastMessageAt)
+	}
+	return conversation.ID < position.ID
+}
+
+func (m *MockStore) CreateMessage(message *models.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, attachment := range message.Attachments {
+		if attachment.ID == 0 || int(attachment.ID) > len(m.attachments) {
+			return repositories.ErrAttachmentUnavailable
+		}
+		stored := m.attachments[attachment.ID-1]
+		if stored.ID == 0 || stored.UploaderID != message.SenderID || stored.MessageID != nil {
+			return repositories.ErrAttachmentUnavailable
+		}
+	}
+	message.ID = uint(len(m.messages) + 1)
+	for i, attachment := range message.Attachments {
+		stored := &m.attachments[attachment.ID-1]
+		stored.MessageID, stored.Position = &message.ID, i
+	}
+	stored := *message
+	stored.Attachments = nil
+	m.messages = append(m.messages, stored)
+	if message.ThreadRootID != nil {
+		root := &m.messages[*message.ThreadRootID-1]
+		root.ReplyCount++
+		root.LastReplyAt = &message.Created
+		return nil
+	}
+	// Truncated like Postgres timestamps, so cursors round-trip
+	m.conversations[message.ConversationID].LastMessageAt = message.Created.Truncate(time.Microsecond)
+	return nil
+}
+
+func (m *MockStore) ListMessages(conversationID, userID, beforeID uint, limit int) ([]models.Message, error) {
+	return m.listMessages(func(message models.Message) bool {
+		return message.ConversationID == conversationID && message.ThreadRootID == nil
+	}, userID, beforeID, limit)
+}
+
+func (m *MockStore) ListThread(rootID, userID, beforeID uint, limit int) ([]models.Message, error) {
+	return m.listMessages(func(message models.Message) bool {
+		return message.ThreadRootID != nil && *message.ThreadRootID == rootID
+	}, userID, beforeID, limit)
+}
+
+func (m *MockStore) listMessages(matches func(models.Message) bool, userID, beforeID uint, limit int) ([]models.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []models.Message
+	for i := len(m.messages) - 1; i >= 0 && len(result) < limit; i-- {
+		message := m.messages[i]
+		if matches(message) && (beforeID == 0 || message.ID < beforeID) && !m.isHidden(message.ID, userID) {
+			result = append(result, message)
+		}
+	}
+	return result, nil
+}
+
+func (m *MockStore) LastMessages(userID uint, conversationIDs []uint) (map[uint]models.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[uint]models.Message)
+	for _, message := range m.messages {
+		for _, conversationID := range conversationIDs {
+			if message.ConversationID == conversationID && message.ThreadRootID == nil && !m.isHidden(message.ID, userID) {
+				result[conversationID] = message
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MockStore) FindMessage(id uint) (*models.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == 0 || int(id) > len(m.messages) {
+		return nil, repositories.ErrNotFound
+	}
+	message := m.messages[id-1]
+	return &message, nil
+}
+
+func (m *MockStore) FindMessages(ids []uint) (map[uint]models.Message, error) {
+	result := make(map[uint]models.Message)
+	for _, id := range ids {
+		if message, err := m.FindMessage(id); err == nil {
+			result[id] = *message
+		}
+	}
+	return result, nil
+}
+
+func (m *MockStore) SenderIDs(conversationID, afterID, upToID uint) ([]uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[uint]bool)
+	var senderIDs []uint
+	for _, message := range m.messages {
+		if message.ConversationID == conversationID && message.ID > afterID && message.ID <= upToID &&
+			message.ThreadRootID == nil && !seen[message.SenderID] {
+			seen[message.SenderID] = true
+			senderIDs = append(senderIDs, message.SenderID)
+		}
+	}
+	return senderIDs, nil
+}
+
+func (m *MockStore) EditMessage(message *models.Message, previousText string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := &m.messages[message.ID-1]
+	if stored.DeletedAt != nil {
+		return repositories.ErrNotFound
+	}
+	stored.Text, stored.EditedAt = message.Text, message.EditedAt
+	m.edits = append(m.edits, models.MessageEdit{ID: uint(len(m.edits) + 1), MessageID: message.ID, Text: previousText, EditedAt: *message.EditedAt})
+	return nil
+}
+
+func (m *MockStore) DeleteMessage(id uint, deletedAt time.Time) ([]models.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := &m.messages[id-1]
+	stored.Text, stored.DeletedAt = "", &deletedAt
+	var edits []models.MessageEdit
+	for _, edit := range m.edits {
+		if edit.MessageID != id {
+			edits = append(edits, edit)
+		}
+	}
+	m.edits = edits
+	var deleted []models.Attachment
+	for i, attachment := range m.attachments {
+		if attachment.MessageID == nil || *attachment.MessageID != id {
+			continue
+		}
+		if attachment.Claimed {
+			m.attachments[i].MessageID, m.attachments[i].Position = nil, 0
+			continue
+		}
+		deleted = append(deleted, attachment)
+		m.attachments[i] = models.Attachment{}
+	}
+	return deleted, nil
+}
+
+func (m *MockStore) HideMessage(id, userID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hidden[models.HiddenMessage{MessageID: id, UserID: userID}] = true
+	return nil
+}
+
+func (m *MockStore) ListEdits(messageID uint) ([]models.MessageEdit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var edits []models.MessageEdit
+	for _, edit := range m.edits {
+		if edit.MessageID == messageID {
+			edits = append(edits, edit)
+		}
+	}
+	return edits, nil
+}
+
+func (m *MockStore) MarkThreadRead(rootID, userID, messageID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := models.ThreadRead{RootMessageID: rootID, UserID: userID}
+	m.threadReads[key] = max(m.threadReads[key], messageID)
+	return nil
+}
+
+func (m *MockStore) UnreadThreadCounts(userID uint, rootIDs []uint) (map[uint]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[uint]int)
+	for _, rootID := range rootIDs {
+		lastRead := m.threadReads[models.ThreadRead{RootMessageID: rootID, UserID: userID}]
+		for _, message := range m.messages {
+			if message.ThreadRootID != nil && *message.ThreadRootID == rootID && message.SenderID != userID &&
+				message.DeletedAt == nil && message.ID > lastRead {
+				result[rootID]++
+			}
+		}
+	}
+	return result, nil
+}
+
+func (m *MockStore) AddReaction(reaction *models.Reaction) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.reactions {
+		if existing.MessageID == reaction.MessageID && existing.UserID == reaction.UserID && existing.Emoji == reaction.Emoji {
+			return false, nil
+		}
+	}
+	m.reactions = append(m.reactions, *reaction)
+	return true, nil
+}
+
+func (m *MockStore) RemoveReaction(messageID, userID uint, emoji string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, existing := range m.reactions {
+		if existing.MessageID == messageID && existing.UserID == userID && existing.Emoji == emoji {
+			m.reactions = append(m.reactions[:i:i], m.reactions[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *MockStore) ReactionCounts(userID uint, messageIDs []uint) (map[uint][]repositories.ReactionCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[uint][]repositories.ReactionCount)
+	for _, messageID := range messageIDs {
+		var counts []repositories.ReactionCount
+		for _, reaction := range m.reactions {
+			if reaction.MessageID != messageID {
+				continue
+			}
+			i := 0
+			for i < len(counts) && counts[i].Emoji != reaction.Emoji {
+				i++
+			}
+			if i == len(counts) {
+				counts = append(counts, repositories.ReactionCount{MessageID: messageID, Emoji: reaction.Emoji})
+			}
+			counts[i].Count++
+			counts[i].ReactedByMe = counts[i].ReactedByMe || reaction.UserID == userID
+		}
+		// Stable, so ties keep the order in which the emojis were first used
+		sort.SliceStable(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+		if len(counts) > 0 {
+			result[messageID] = counts
+		}
+	}
+	return result, nil
+}
+
+func (m *MockStore) CreateAttachment(attachment *models.Attachment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	attachment.ID = uint(len(m.attachments) + 1)
+	m.attachments = append(m.attachments, *attachment)
+	return nil
+}
+
+func (m *MockStore) FindAttachment(id uint) (*models.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == 0 || int(id) > len(m.attachments) || m.attachments[id-1].ID == 0 {
+		return nil, repositories.ErrNotFound
+	}
+	attachment := m.attachments[id-1]
+	return &attachment, nil
+}
+
+func (m *MockStore) ListAttachments(messageIDs []uint) (map[uint][]models.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[uint][]models.Attachment)
+	for _, messageID := range messageIDs {
+		for _, attachment := range m.attachments {
+			if attachment.MessageID != nil && *attachment.MessageID == messageID {
+				result[messageID] = append(result[messageID], attachment)
+			}
+		}
+		sort.Slice(result[messageID], func(i, j int) bool {
+			return result[messageID][i].Position < result[messageID][j].Position
+		})
+	}
+	return result, nil
+}
+
+func (m *MockStore) ClaimAttachment(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id == 0 || int(id) > len(m.attachments) || m.attachments[id-1].ID == 0 {
+		return repositories.ErrNotFound
+	}
+	m.attachments[id-1].Claimed = true
+	return nil
+}
+
+func (m *MockStore) DeleteUnsentAttachments(createdBefore time.Time, limit int) ([]models.Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deleted []models.Attachment
+	for i, attachment := range m.attachments {
+		if len(deleted) == limit {
+			break
+		}
+		if attachment.ID != 0 && attachment.MessageID == nil && !attachment.Claimed && attachment.Created.Before(createdBefore) {
+			deleted = append(deleted, attachment)
+			m.attachments[i] = models.Attachment{}
+		}
+	}
+	return deleted, nil
+}
+
+// SearchMessages matches messages containing every word of the query,
+// ignoring case. Unlike Postgres it doesn't understand search operators, and
+// snippets are the whole text.
+func (m *MockStore) SearchMessages(userID uint, search repositories.MessageSearch, beforeID uint, limit int) ([]repositories.SearchHit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	terms := strings.Fields(strings.ToLower(search.Query))
+	slices.Sort(terms)
+	terms = slices.Compact(terms)
+	var hits []repositories.SearchHit
+	for i := len(m.messages) - 1; i >= 0 && len(hits) < limit; i-- {
+		message := m.messages[i]
+		switch {
+		case !m.isParticipant(message.ConversationID, userID), message.DeletedAt != nil, m.isHidden(message.ID, userID),
+			search.ConversationID > 0 && message.ConversationID != search.ConversationID,
+			search.SenderID > 0 && message.SenderID != search.SenderID,
+			!search.After.IsZero() && message.Created.Before(search.After),
+			!search.Before.IsZero() && !message.Created.Before(search.Before),
+			beforeID > 0 && message.ID >= beforeID:
+			continue
+		}
+		words := strings.Fields(message.Text)
+		matched := make(map[string]bool)
+		for j, word := range words {
+			if slices.Contains(terms, strings.ToLower(word)) {
+				matched[strings.ToLower(word)] = true
+				words[j] = repositories.HighlightStart + word + repositories.HighlightStop
+			}
+		}
+		if len(matched) == len(terms) {
+			hits = append(hits, repositories.SearchHit{Message: message, Snippet: strings.Join(words, " ")})
+		}
+	}
+	return hits, nil
+}
+
+func (m *MockStore) isParticipant(conversationID, userID uint) bool {
+	for _, participant := range m.conversations[conversationID].Participants {
+		if participant.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MockStore) isHidden(messageID, userID uint) bool {
+	return m.hidden[models.HiddenMessage{MessageID: messageID, UserID: userID}]
+}
+
+// PublishedMessage is a message.created event captured by MockPublisher
+type PublishedMessage struct {
+	Message    models.Message
+	Recipients []uint
+}
+
+// PublishedChange is a membership change captured by MockPublisher
+type PublishedChange struct {
+	Change     events.MembershipChange
+	Recipients []uint
+}
+
+// PublishedReceipt is a receipt update captured by MockPublisher
+type PublishedReceipt struct {
+	Update     events.ReceiptUpdate
+	Recipients []uint
+}
+
+// PublishedReaction is a reaction update captured by MockPublisher
+type PublishedReaction struct {
+	Update     events.ReactionUpdate
+	Recipients []uint
+}
+
+// PublishedDeletion is a message deletion captured by MockPublisher
+type PublishedDeletion struct {
+	Deletion   events.MessageDeletion
+	Recipients []uint
+}
+
+type MockPublisher struct {
+	mu        sync.Mutex
+	Published []PublishedMessage
+	Replies   []PublishedMessage // Thread replies
+	Edited    []PublishedMessage
+	Deletions []PublishedDeletion
+	Reactions []PublishedReaction
+	Changes   []PublishedChange
+	Receipts  []PublishedReceipt
+}
+
+func (m *MockPublisher) ThreadReplyCreated(ctx context.Context, message *models.Message, recipients []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Replies = append(m.Replies, PublishedMessage{Message: *message, Recipients: recipients})
+	return nil
+}
+
+func (m *MockPublisher) ReactionUpdated(ctx context.Context, update *events.ReactionUpdate, recipients []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Reactions = append(m.Reactions, PublishedReaction{Update: *update, Recipients: recipients})
+	return nil
+}
+
+func (m *MockPublisher) MessageEdited(ctx context.Context, message *models.Message, recipients []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Edited = append(m.Edited, PublishedMessage{Message: *message, Recipients: recipients})
+	return nil
+}
+
+func (m *MockPublisher) MessageDeleted(ctx context.Context, deletion *events.MessageDeletion, recipients []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Deletions = append(m.Deletions, PublishedDeletion{Deletion: *deletion, Recipients: recipients})
+	return nil
+}
+
+func (m *MockPublisher) MembershipChanged(ctx context.Context, change *events.MembershipChange, recipients []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Changes = append(m.Changes, PublishedChange{Change: *change, Recipients: recipients})
+	return nil
+}
+
+func (m *MockPublisher) ReceiptUpdated(ctx context.Context, update *events.ReceiptUpdate, recipients []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Receipts = append(m.Receipts, PublishedReceipt{Update: *update, Recipients: recipients})
+	return nil
+}
+
+// MockDirectory knows the users it was created with
+type MockDirectory map[uint]string
+
+func (m MockDirectory) FindUsers(ctx context.Context, userIDs []uint) (map[uint]string, error) {
+	names := make(map[uint]string)
+	for _, userID := range userIDs {
+		if name, ok := m[userID]; ok {
+			names[userID] = name
+		}
+	}
+	return names, nil
+}
+
+func (m *MockPublisher) MessageCreated(ctx context.Context, message *models.Message, recipients []uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Published = append(m.Published, PublishedMessage{Message: *message, Recipients: recipients})
+	return nil
+}
+
+func InitGrpcServer(t *testing.T, server proto.MessageServiceServer) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	proto.RegisterMessageServiceServer(s, server)
+
+	go func() {
+		if err := s.Serve(listener); err != nil {
+			t.Errorf("Server failed to start: %v", err)
+		}
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(
+		"passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial bufnet: %v", err)
+	}
+
+	return conn
+}
+
+// UseTestDatabase points the repositories at the Postgres database of
+// TEST_DATABASE_URL, skipping the test if it is unset. Everything runs in a
+// transaction rolled back when the test ends, so tests leave no rows behind.
+func UseTestDatabase(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	tx := db.Begin()
+	if err := database.Migrate(tx); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = tx
+	t.Cleanup(func() {
+		database.DB = previous
+		tx.Rollback()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package repositories
+
+import (
+	"github.com/stretchr/testify/assert"
+	"message-service/models"
+	"message-service/repositories"
+	"message-service/test"
+	"testing"
+	"time"
+)
+
+func storeAttachment(t *testing.T, repo repositories.AttachmentRepository, key string, messageID *uint, created time.Time) *models.Attachment {
+	attachment := &models.Attachment{UploaderID: 1, MessageID: messageID, FileName: key, ContentType: "image/png", Size: 1, StorageKey: key, Created: created}
+	if err := repo.CreateAttachment(attachment); err != nil {
+		t.Fatalf("CreateAttachment failed: %v", err)
+	}
+	return attachment
+}
+
+// TestDeleteUnsentAttachments checks the purge against Postgres: only
+// attachments created before the cutoff that were never sent nor claimed
+// are deleted, at most limit at a time
+func TestDeleteUnsentAttachments(t *testing.T) {
+	test.UseTestDatabase(t)
+	repo := &repositories.GormAttachmentRepository{}
+	message := createMessage(t, &repositories.GormMessageRepository{}, createConversation(t, 1, 2).ID, 1, "look")
+	old, recent := time.Now().Add(-48*time.Hour), time.Now()
+
+	first := storeAttachment(t, repo, "first", nil, old)
+	second := storeAttachment(t, repo, "second", nil, old)
+	storeAttachment(t, repo, "sent", &message.ID, old)
+	storeAttachment(t, repo, "recent", nil, recent)
+	claimed := storeAttachment(t, repo, "claimed", nil, old)
+	assert.NoError(t, repo.ClaimAttachment(claimed.ID))
+	assert.ErrorIs(t, repo.ClaimAttachment(claimed.ID+1000), repositories.ErrNotFound)
+
+	cutoff := time.Now().Add(-24 * time.Hour)
+	deleted, err := repo.DeleteUnsentAttachments(cutoff, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, first.StorageKey, deleted[0].StorageKey)
+	}
+	deleted, err = repo.DeleteUnsentAttachments(cutoff, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, deleted, 1) {
+		assert.Equal(t, second.StorageKey, deleted[0].StorageKey)
+	}
+	deleted, err = repo.DeleteUnsentAttachments(cutoff, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	_, err = repo.FindAttachment(claimed.ID)
+	assert.NoError(t, err)
+}
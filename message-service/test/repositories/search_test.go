@@ -0,0 +1,84 @@
+package repositories
+
+import (
+	"github.com/stretchr/testify/assert"
+	"message-service/models"
+	"message-service/repositories"
+	"message-service/test"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createConversation stores a group of the given users
+func createConversation(t *testing.T, userIDs ...uint) *models.Conversation {
+	conversation := &models.Conversation{Kind: models.ConversationGroup, Created: time.Now()}
+	for _, userID := range userIDs {
+		conversation.Participants = append(conversation.Participants, models.Participant{UserID: userID, JoinedAt: time.Now()})
+	}
+	if err := (&repositories.GormConversationRepository{}).CreateGroup(conversation); err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	return conversation
+}
+
+func createMessage(t *testing.T, repo repositories.MessageRepository, conversationID, senderID uint, text string) *models.Message {
+	message := &models.Message{ConversationID: conversationID, SenderID: senderID, Text: text, Created: time.Now()}
+	if err := repo.CreateMessage(message); err != nil {
+		t.Fatalf("CreateMessage failed: %v", err)
+	}
+	return message
+}
+
+func searchIDs(t *testing.T, repo repositories.MessageRepository, userID uint, search repositories.MessageSearch) []uint {
+	hits, err := repo.SearchMessages(userID, search, 0, 10)
+	if err != nil {
+		t.Fatalf("SearchMessages failed: %v", err)
+	}
+	ids := []uint{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+// TestSearchMessages checks the full-text search against Postgres: messages
+// are found in their current state, only in the user's conversations and
+// unless deleted or hidden, and the query syntax of web search engines is
+// understood
+func TestSearchMessages(t *testing.T) {
+	test.UseTestDatabase(t)
+	repo := &repositories.GormMessageRepository{}
+	ours := createConversation(t, 1, 2)
+	theirs := createConversation(t, 2, 3)
+
+	plain := createMessage(t, repo, ours.ID, 1, "Pizza tonight?")
+	edited := createMessage(t, repo, ours.ID, 2, "pasta for me")
+	deleted := createMessage(t, repo, ours.ID, 2, "secret pizza recipe")
+	hidden := createMessage(t, repo, ours.ID, 2, "pizza with pineapple")
+	createMessage(t, repo, theirs.ID, 3, "pizza is great")
+
+	editedAt := time.Now()
+	edited.Text, edited.EditedAt = "pizza for me", &editedAt
+	assert.NoError(t, repo.EditMessage(edited, "pasta for me"))
+	_, err := repo.DeleteMessage(deleted.ID, time.Now())
+	assert.NoError(t, err)
+	assert.NoError(t, repo.HideMessage(hidden.ID, 1))
+
+	assert.Equal(t, []uint{edited.ID, plain.ID}, searchIDs(t, repo, 1, repositories.MessageSearch{Query: "pizza"}))
+	assert.Empty(t, searchIDs(t, repo, 1, repositories.MessageSearch{Query: "pasta"}))
+	assert.Empty(t, searchIDs(t, repo, 1, repositories.MessageSearch{Query: "secret"}))
+	// Hidden for user 1 only
+	assert.Equal(t, []uint{hidden.ID, edited.ID, plain.ID}, searchIDs(t, repo, 2, repositories.MessageSearch{Query: "pizza", ConversationID: ours.ID}))
+
+	assert.Equal(t, []uint{plain.ID}, searchIDs(t, repo, 1, repositories.MessageSearch{Query: "pizza -me"}))
+	assert.Equal(t, []uint{edited.ID}, searchIDs(t, repo, 1, repositories.MessageSearch{Query: `"for me"`}))
+	assert.Equal(t, []uint{edited.ID, plain.ID}, searchIDs(t, repo, 1, repositories.MessageSearch{Query: "tonight or me"}))
+	assert.Equal(t, []uint{edited.ID}, searchIDs(t, repo, 1, repositories.MessageSearch{Query: "pizza", SenderID: 2}))
+
+	hits, err := repo.SearchMessages(1, repositories.MessageSearch{Query: "tonight"}, 0, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, hits, 1) {
+		assert.True(t, strings.Contains(hits[0].Snippet, repositories.HighlightStart+"tonight"+repositories.HighlightStop))
+	}
+}
@@ -0,0 +1,34 @@
+package users
+
+import (
+	"context"
+	userServiceProto "message-service/proto/user_service"
+)
+
+// Directory looks up users in the user service
+type Directory interface {
+	// FindUsers returns the names of the given users, leaving out unknown ones
+	FindUsers(ctx context.Context, userIDs []uint) (map[uint]string, error)
+}
+
+type GrpcDirectory struct {
+	Client userServiceProto.UserServiceClient
+}
+
+func (directory *GrpcDirectory) FindUsers(ctx context.Context, userIDs []uint) (map[uint]string, error) {
+	request := &userServiceProto.GetUsersBatchRequest{UserIds: make([]int32, 0, len(userIDs))}
+	for _, userID := range userIDs {
+		request.UserIds = append(request.UserIds, int32(userID))
+	}
+
+	response, err := directory.Client.GetUsersBatch(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint]string, len(response.Users))
+	for _, user := range response.Users {
+		names[uint(user.UserId)] = user.Name
+	}
+	return names, nil
+}
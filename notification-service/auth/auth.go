@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"jwks"
+	"strconv"
+	"time"
+)
+
+// Claims mirrors the access token claims issued by the user service
+type Claims struct {
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Subject returns the user ID in the form used to address hub clients
+func (c *Claims) Subject() string {
+	return strconv.FormatUint(uint64(c.UserID), 10)
+}
+
+// Expiry returns the moment the token stops being valid
+func (c *Claims) Expiry() time.Time {
+	if c.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return c.ExpiresAt.Time
+}
+
+type Verifier struct {
+	keys *jwks.Cache
+}
+
+func NewVerifier(keys *jwks.Cache) *Verifier {
+	return &Verifier{keys: keys}
+}
+
+// Verify checks the token signature and expiration and returns its claims
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, v.keys.Keyfunc, jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == 0 {
+		return nil, errors.New("token has no user_id claim")
+	}
+	return claims, nil
+}
@@ -0,0 +1,210 @@
+// Command dlq inspects the notification dead-letter topic and re-drives its
+// entries back to their source topic.
+//
+//	dlq list [-limit n]
+//	dlq redrive [-partition p -offset o]
+//
+// Without an entry selected, redrive moves every entry the previous runs
+// haven't, tracked by the consumer group of the dead-letter topic.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"notification-service/consumer"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// idleTimeout ends a read once the topic had no new entries for this long
+const idleTimeout = 5 * time.Second
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	brokers := flags.String("brokers", getEnv("KAFKA_BROKER", "localhost:9092"), "Kafka broker address")
+	topic := flags.String("topic", getEnv("DLQ_TOPIC", "default.dlq"), "dead-letter topic")
+	limit := flags.Int("limit", 100, "maximum number of entries to list")
+	partition := flags.Int("partition", -1, "partition of the entry to re-drive")
+	offset := flags.Int64("offset", -1, "offset of the entry to re-drive")
+	flags.Parse(os.Args[2:])
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(*brokers, *topic, *limit)
+	case "redrive":
+		writer := &kafka.Writer{Addr: kafka.TCP(*brokers)}
+		if *partition >= 0 && *offset >= 0 {
+			err = redriveEntry(writer, *brokers, *topic, *partition, *offset)
+		} else {
+			err = redriveAll(writer, *brokers, *topic)
+		}
+		if closeErr := writer.Close(); err == nil {
+			err = closeErr
+		}
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dlq list [-limit n] | dlq redrive [-partition p -offset o]")
+	os.Exit(2)
+}
+
+// list prints the entries of every partition, oldest first
+func list(brokers, topic string, limit int) error {
+	partitions, err := partitions(brokers, topic)
+	if err != nil {
+		return err
+	}
+
+	listed := 0
+	for _, partition := range partitions {
+		reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{brokers}, Topic: topic, Partition: partition})
+		for listed < limit {
+			entry, err := readNext(reader)
+			if err != nil {
+				break
+			}
+			printEntry(entry)
+			listed++
+		}
+		reader.Close()
+	}
+	return nil
+}
+
+func printEntry(entry kafka.Message) {
+	fmt.Printf("%d/%d  source=%s/%s/%s  failed_at=%s  attempts=%s  reason=%q\n",
+		entry.Partition, entry.Offset,
+		header(entry, consumer.HeaderSourceTopic),
+		header(entry, consumer.HeaderSourcePartition),
+		header(entry, consumer.HeaderSourceOffset),
+		header(entry, consumer.HeaderFailedAt),
+		header(entry, consumer.HeaderAttempts),
+		header(entry, consumer.HeaderReason),
+	)
+
+	original, err := consumer.Redrive(entry)
+	if err == nil {
+		if envelope, err := consumer.DecodeEnvelope(original); err == nil {
+			fmt.Printf("    %s\n", protojson.Format(envelope))
+			return
+		}
+	}
+	fmt.Printf("    %q\n", entry.Value)
+}
+
+// redriveEntry re-drives the single entry at the given position
+func redriveEntry(writer *kafka.Writer, brokers, topic string, partition int, offset int64) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{brokers}, Topic: topic, Partition: partition})
+	defer reader.Close()
+	if err := reader.SetOffset(offset); err != nil {
+		return err
+	}
+
+	entry, err := readNext(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read entry %d/%d: %v", partition, offset, err)
+	}
+	return redrive(writer, entry)
+}
+
+// redriveAll re-drives the entries added since the last run
+func redriveAll(writer *kafka.Writer, brokers, topic string) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     []string{brokers},
+		Topic:       topic,
+		GroupID:     topic + "-redrive",
+		StartOffset: kafka.FirstOffset,
+	})
+	defer reader.Close()
+
+	redriven := 0
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), idleTimeout)
+		entry, err := reader.FetchMessage(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("Re-drove %d entries", redriven)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := redrive(writer, entry); err != nil {
+			return err
+		}
+		if err := reader.CommitMessages(context.Background(), entry); err != nil {
+			return err
+		}
+		redriven++
+	}
+}
+
+func redrive(writer *kafka.Writer, entry kafka.Message) error {
+	original, err := consumer.Redrive(entry)
+	if err != nil {
+		return fmt.Errorf("entry %d/%d: %v", entry.Partition, entry.Offset, err)
+	}
+	if err := writer.WriteMessages(context.Background(), original); err != nil {
+		return err
+	}
+	log.Printf("Re-drove entry %d/%d to %s", entry.Partition, entry.Offset, original.Topic)
+	return nil
+}
+
+func readNext(reader *kafka.Reader) (kafka.Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), idleTimeout)
+	defer cancel()
+	return reader.ReadMessage(ctx)
+}
+
+func partitions(brokers, topic string) ([]int, error) {
+	conn, err := kafka.Dial("tcp", brokers)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	found, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	partitions := make([]int, 0, len(found))
+	for _, partition := range found {
+		partitions = append(partitions, partition.ID)
+	}
+	return partitions, nil
+}
+
+func header(entry kafka.Message, key string) string {
+	for _, header := range entry.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -1,13 +1,171 @@
 package config
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
 
 type Config struct {
 	KafkaServiceURL string
+	// Attempts at persisting a consumed message before it is dead-lettered
+	ConsumerMaxAttempts    int
+	ConsumerInitialBackoff time.Duration
+	ConsumerMaxBackoff     time.Duration
+	// Topic receiving messages the consumer failed to process
+	DeadLetterTopic string
+	JWKSURL         string
+	JWKSCacheTTL    time.Duration
+	// Time a WebSocket client has to authenticate after the handshake
+	AuthTimeout time.Duration
+	// Outgoing messages buffered per WebSocket connection
+	SendBufferSize int
+	WriteTimeout   time.Duration
+	// One of drop_oldest, disconnect or spill
+	OverflowPolicy string
+	PingInterval   time.Duration
+	PongTimeout    time.Duration
+	// Time a client has to acknowledge a message before it is redelivered
+	AckTimeout time.Duration
+	// Upper bound of the backoff between redeliveries
+	MaxRetryInterval time.Duration
+	// Unacknowledged messages per WebSocket connection before the overflow policy applies
+	MaxInflight int
+	// Where unacknowledged messages are kept, memory or postgres
+	OfflineStore string
+	// How long unacknowledged messages are kept for redelivery
+	OfflineMessageTTL time.Duration
+	// Unacknowledged messages kept per user, oldest are evicted first
+	OfflineMaxBacklog int
+	// Identifies this instance, defaults to the host name
+	InstanceID string
+	// Where user connections are registered, memory for a single instance or postgres
+	Registry string
+	// How long registry entries of an instance live without a refresh
+	RegistryTTL time.Duration
+	// How events reach other instances, memory for a single instance or kafka
+	Relay            string
+	RelayTopicPrefix string
+	// Where presence statuses and last-seen times are kept, memory for a
+	// single instance or postgres
+	PresenceStore string
+	// How ephemeral signals reach other instances, memory for a single
+	// instance or postgres; never Kafka, which would persist them
+	SignalRelay         string
+	SignalChannelPrefix string
+	// Address of message-service, which records delivered and read
+	// receipts and knows who to relay typing frames to. Receipt and typing
+	// frames are ignored when unset.
+	MessageServiceURL string
+	// How long conversation participants are cached for typing frames
+	ParticipantCacheTTL time.Duration
+	// Typing frames relayed per connection and conversation, at most one per interval
+	TypingInterval time.Duration
+	// How long receivers show a typing indicator
+	TypingTTL time.Duration
+	// Deadline for draining connections and committing offsets on shutdown
+	ShutdownTimeout time.Duration
 }
 
-func LoadConfig() *Config {
-	return &Config{
+// LoadConfig reads the configuration from the environment, rejecting
+// durations that must be positive, such as ticker intervals
+func LoadConfig() (*Config, error) {
+	config := &Config{
 		KafkaServiceURL: os.Getenv("KAFKA_BROKER"),
+
+		ConsumerMaxAttempts:    getInt("CONSUMER_MAX_ATTEMPTS", 5),
+		ConsumerInitialBackoff: getDuration("CONSUMER_INITIAL_BACKOFF", 200*time.Millisecond),
+		ConsumerMaxBackoff:     getDuration("CONSUMER_MAX_BACKOFF", 30*time.Second),
+		DeadLetterTopic:        getString("DLQ_TOPIC", "default.dlq"),
+
+		JWKSURL:        os.Getenv("JWKS_URL"),
+		JWKSCacheTTL:   getDuration("JWKS_CACHE_TTL", 10*time.Minute),
+		AuthTimeout:    getDuration("WS_AUTH_TIMEOUT", 10*time.Second),
+		SendBufferSize: getInt("WS_SEND_BUFFER_SIZE", 256),
+		WriteTimeout:   getDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		OverflowPolicy: getString("WS_OVERFLOW_POLICY", "drop_oldest"),
+		PingInterval:   getDuration("WS_PING_INTERVAL", 30*time.Second),
+		PongTimeout:    getDuration("WS_PONG_TIMEOUT", 60*time.Second),
+
+		AckTimeout:       getDuration("WS_ACK_TIMEOUT", 5*time.Second),
+		MaxRetryInterval: getDuration("WS_MAX_RETRY_INTERVAL", time.Minute),
+		MaxInflight:      getInt("WS_MAX_INFLIGHT", 1000),
+
+		OfflineStore:      getString("OFFLINE_STORE", "memory"),
+		OfflineMessageTTL: getDuration("OFFLINE_MESSAGE_TTL", 72*time.Hour),
+		OfflineMaxBacklog: getInt("OFFLINE_MAX_BACKLOG", 1000),
+
+		InstanceID:       getString("INSTANCE_ID", hostname()),
+		Registry:         getString("REGISTRY", "memory"),
+		RegistryTTL:      getDuration("REGISTRY_TTL", 90*time.Second),
+		Relay:            getString("RELAY", "memory"),
+		RelayTopicPrefix: getString("RELAY_TOPIC_PREFIX", "notification-relay-"),
+
+		PresenceStore:       getString("PRESENCE_STORE", "memory"),
+		SignalRelay:         getString("SIGNAL_RELAY", "memory"),
+		SignalChannelPrefix: getString("SIGNAL_CHANNEL_PREFIX", "signal_"),
+
+		MessageServiceURL:   os.Getenv("MESSAGE_SERVICE_URL"),
+		ParticipantCacheTTL: getDuration("PARTICIPANT_CACHE_TTL", 30*time.Second),
+		TypingInterval:      getDuration("WS_TYPING_INTERVAL", 2*time.Second),
+		TypingTTL:           getDuration("WS_TYPING_TTL", 6*time.Second),
+
+		ShutdownTimeout: getDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
+	}
+
+	positive := []struct {
+		key   string
+		value time.Duration
+	}{
+		{"CONSUMER_INITIAL_BACKOFF", config.ConsumerInitialBackoff},
+		{"CONSUMER_MAX_BACKOFF", config.ConsumerMaxBackoff},
+		{"JWKS_CACHE_TTL", config.JWKSCacheTTL},
+		{"WS_AUTH_TIMEOUT", config.AuthTimeout},
+		{"WS_WRITE_TIMEOUT", config.WriteTimeout},
+		{"WS_PING_INTERVAL", config.PingInterval},
+		{"WS_PONG_TIMEOUT", config.PongTimeout},
+		// Halved for the redelivery ticker
+		{"WS_ACK_TIMEOUT", config.AckTimeout / 2},
+		{"WS_MAX_RETRY_INTERVAL", config.MaxRetryInterval},
+		{"OFFLINE_MESSAGE_TTL", config.OfflineMessageTTL},
+		// Divided by three for the refresh ticker
+		{"REGISTRY_TTL", config.RegistryTTL / 3},
+		{"PARTICIPANT_CACHE_TTL", config.ParticipantCacheTTL},
+		{"WS_TYPING_INTERVAL", config.TypingInterval},
+		{"WS_TYPING_TTL", config.TypingTTL},
+		{"SHUTDOWN_TIMEOUT", config.ShutdownTimeout},
+	}
+	for _, duration := range positive {
+		if duration.value <= 0 {
+			return nil, fmt.Errorf("%s must be a positive duration, got %q", duration.key, os.Getenv(duration.key))
+		}
+	}
+	return config, nil
+}
+
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
+
+func getString(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
 	}
+	return fallback
 }
@@ -2,48 +2,153 @@ package consumer
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"log"
+	notification "notification-service/proto"
 	"notification-service/websocket"
+	"strings"
 	"time"
 )
 
-type Message struct {
-	Receiver string `json:"user_id"`
-	Content  string `json:"message"`
+// MessageAdder persists messages for delivery, implemented by websocket.Hub
+type MessageAdder interface {
+	AddMessage(message websocket.KafkaMessage) error
 }
 
-func StartWebsocketConsumer(brokers []string, topic, groupID string, hub *websocket.Hub) {
+// MessageWriter publishes Kafka messages, implemented by kafka.Writer
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+}
+
+// Processor hands Kafka messages to the hub. Messages that can't be decoded
+// are moved to the dead-letter topic, and so are those that keep failing
+// after the retries, addressed to the recipients they failed for.
+type Processor struct {
+	Hub             MessageAdder
+	DeadLetter      MessageWriter
+	DeadLetterTopic string
+	Retry           RetryPolicy
+}
+
+// Process returns an error only if the message could neither be delivered
+// nor dead-lettered, in which case its offset must not be committed
+func (p *Processor) Process(ctx context.Context, msg kafka.Message) error {
+	envelope, err := DecodeEnvelope(msg)
+	if err != nil {
+		return p.deadLetter(ctx, msg, fmt.Errorf("failed to deserialize message: %v", err), 1)
+	}
+	content, err := protojson.Marshal(envelope)
+	if err != nil {
+		return p.deadLetter(ctx, msg, fmt.Errorf("failed to encode envelope %s: %v", envelope.Id, err), 1)
+	}
+
+	// A recipient that keeps failing doesn't hold up the others, only it
+	// is dead-lettered
+	messageID, retracts := chatMessage(envelope)
+	var failed []string
+	var lastErr error
+	maxAttempts := 0
+	for _, recipient := range envelope.Recipients {
+		message := websocket.KafkaMessage{Receiver: recipient, Content: string(content), MessageID: messageID, Retracts: retracts}
+		attempts, err := p.Retry.Do(ctx, func() error {
+			err := p.Hub.AddMessage(message)
+			if err != nil {
+				log.Printf("Failed to add message %s for user %s: %v", envelope.Id, recipient, err)
+			}
+			return err
+		})
+		if err != nil {
+			failed = append(failed, recipient)
+			lastErr = err
+			maxAttempts = max(maxAttempts, attempts)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	reason := fmt.Errorf("failed to add message for users %s: %v", strings.Join(failed, ", "), lastErr)
+	return p.deadLetter(ctx, withRecipients(msg, envelope, failed), reason, maxAttempts)
+}
+
+// withRecipients returns the message with its envelope addressed to the
+// given recipients only, so that re-driving it doesn't deliver it twice to
+// the others
+func withRecipients(msg kafka.Message, envelope *notification.Envelope, recipients []string) kafka.Message {
+	if len(recipients) == len(envelope.Recipients) {
+		return msg
+	}
+	narrowed := proto.Clone(envelope).(*notification.Envelope)
+	narrowed.Recipients = recipients
+	value, err := proto.Marshal(narrowed)
+	if err != nil {
+		log.Printf("Failed to encode envelope %s, dead-lettering it for all recipients: %v", envelope.Id, err)
+		return msg
+	}
+	msg.Value = value
+	return msg
+}
+
+// deadLetter writes the message to the dead-letter topic, retrying until it
+// succeeds or the context is cancelled
+func (p *Processor) deadLetter(ctx context.Context, msg kafka.Message, reason error, attempts int) error {
+	log.Printf("Dead-lettering message %d of partition %d: %v", msg.Offset, msg.Partition, reason)
+	entry := DeadLetter(msg, p.DeadLetterTopic, reason, attempts)
+
+	for failures := 1; ; failures++ {
+		err := p.DeadLetter.WriteMessages(ctx, entry)
+		if err == nil {
+			return nil
+		}
+		delay := p.Retry.Backoff(failures)
+		log.Printf("Failed to write to dead-letter topic %s, retrying in %s: %v", p.DeadLetterTopic, delay, err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// StartWebsocketConsumer consumes the topic until the context is cancelled.
+// Closing the reader on return commits the offsets of processed messages.
+func StartWebsocketConsumer(ctx context.Context, brokers []string, topic, groupID string, processor *Processor) {
 	readerConfig := kafka.ReaderConfig{
 		Brokers:        brokers,
 		GroupID:        groupID,
 		Topic:          topic,
 		MinBytes:       10e3,        // 10KB
 		MaxBytes:       10e6,        // 10MB
-		CommitInterval: time.Second, // Commit offsets every second
+		CommitInterval: time.Second, // Flush committed offsets every second
 	}
 
 	reader := kafka.NewReader(readerConfig)
 	defer reader.Close()
 
+	failures := 0
 	// Continuously read messages from Kafka
 	for {
-		msg, err := reader.ReadMessage(context.Background())
-		if err != nil {
-			log.Printf("Error reading message: %v", err)
-			continue
+		msg, err := reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return
 		}
-
-		// Deserialize the Kafka message
-		var kafkaMessage Message
-		err = json.Unmarshal(msg.Value, &kafkaMessage)
 		if err != nil {
-			log.Printf("Failed to deserialize Kafka message: %v", err)
+			failures++
+			delay := processor.Retry.Backoff(failures)
+			log.Printf("Error reading message, retrying in %s: %v", delay, err)
+			sleep(ctx, delay)
 			continue
 		}
+		failures = 0
 
-		// Send message to WebSocket hub
-		hub.AddMessage(websocket.KafkaMessage{Receiver: kafkaMessage.Receiver, Content: kafkaMessage.Content})
+		// The offset is only committed once the message is persisted or dead-lettered
+		if err := processor.Process(ctx, msg); err != nil {
+			log.Printf("Failed to process message %d of partition %d: %v", msg.Offset, msg.Partition, err)
+			return
+		}
+		// Not tied to the context, so the last processed message is committed during shutdown
+		if err := reader.CommitMessages(context.Background(), msg); err != nil {
+			log.Printf("Failed to commit offset %d: %v", msg.Offset, err)
+		}
 	}
 }
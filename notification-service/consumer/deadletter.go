@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to dead-lettered messages, next to the original ones
+const (
+	HeaderSourceTopic     = "dlq-source-topic"
+	HeaderSourcePartition = "dlq-source-partition"
+	HeaderSourceOffset    = "dlq-source-offset"
+	HeaderReason          = "dlq-reason"
+	HeaderAttempts        = "dlq-attempts"
+	HeaderFailedAt        = "dlq-failed-at"
+)
+
+const deadLetterHeaderPrefix = "dlq-"
+
+// DeadLetter wraps a message that couldn't be processed for the dead-letter topic
+func DeadLetter(msg kafka.Message, topic string, reason error, attempts int) kafka.Message {
+	headers := append([]kafka.Header(nil), msg.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderSourceTopic, Value: []byte(msg.Topic)},
+		kafka.Header{Key: HeaderSourcePartition, Value: []byte(strconv.Itoa(msg.Partition))},
+		kafka.Header{Key: HeaderSourceOffset, Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+		kafka.Header{Key: HeaderReason, Value: []byte(reason.Error())},
+		kafka.Header{Key: HeaderAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+	)
+	return kafka.Message{Topic: topic, Key: msg.Key, Value: msg.Value, Headers: headers}
+}
+
+// Redrive restores the original message of a dead-letter entry, addressed to
+// its source topic
+func Redrive(entry kafka.Message) (kafka.Message, error) {
+	topic := header(entry, HeaderSourceTopic)
+	if topic == "" {
+		return kafka.Message{}, errors.New("entry has no source topic")
+	}
+
+	var headers []kafka.Header
+	for _, header := range entry.Headers {
+		if !strings.HasPrefix(header.Key, deadLetterHeaderPrefix) {
+			headers = append(headers, header)
+		}
+	}
+	return kafka.Message{Topic: topic, Key: entry.Key, Value: entry.Value, Headers: headers}, nil
+}
@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"log"
+	notification "notification-service/proto"
+)
+
+// SupportedVersion is the newest envelope version this service was built for
+const SupportedVersion = 1
+
+// Kafka messages carrying a binary Envelope are marked with this content type
+const (
+	contentTypeHeader   = "content-type"
+	contentTypeProtobuf = "application/x-protobuf"
+)
+
+// legacyMessage is the format published before envelopes were introduced
+type legacyMessage struct {
+	Receiver string `json:"user_id"`
+	Content  string `json:"message"`
+}
+
+// DecodeEnvelope reads the envelope of a Kafka message. Envelopes of newer
+// versions are still delivered, since clients may understand them: their
+// payload is a Struct, which carries new payload fields through. Fields
+// added to the Envelope message itself are unknown to this build, though,
+// and are dropped when the envelope is encoded as JSON for the clients.
+// Messages without the protobuf content type are read in the legacy format.
+func DecodeEnvelope(msg kafka.Message) (*notification.Envelope, error) {
+	if header(msg, contentTypeHeader) != contentTypeProtobuf {
+		return decodeLegacy(msg)
+	}
+
+	var envelope notification.Envelope
+	if err := proto.Unmarshal(msg.Value, &envelope); err != nil {
+		return nil, err
+	}
+	switch {
+	case envelope.Version == 0:
+		return nil, errors.New("envelope has no version")
+	case len(envelope.Recipients) == 0:
+		return nil, errors.New("envelope has no recipients")
+	case envelope.Version > SupportedVersion:
+		log.Printf("Envelope %s has version %d, newer than %d, delivering it anyway", envelope.Id, envelope.Version, SupportedVersion)
+	}
+	return &envelope, nil
+}
+
+// chatMessage returns the chat message whose text the envelope carries, and
+// the one it deletes for everyone, each 0 if none. Notifications carrying
+// the text of a deleted message are removed before they are delivered.
+func chatMessage(envelope *notification.Envelope) (messageID, retracts int64) {
+	id := int64(envelope.GetPayload().GetFields()["message_id"].GetNumberValue())
+	switch envelope.Type {
+	case notification.EventType_EVENT_TYPE_MESSAGE_CREATED,
+		notification.EventType_EVENT_TYPE_MESSAGE_EDITED,
+		notification.EventType_EVENT_TYPE_THREAD_REPLY_CREATED:
+		return id, 0
+	case notification.EventType_EVENT_TYPE_MESSAGE_DELETED:
+		if envelope.GetPayload().GetFields()["for_everyone"].GetBoolValue() {
+			return 0, id
+		}
+	}
+	return 0, 0
+}
+
+// decodeLegacy wraps a message of the legacy format in a chat message envelope
+func decodeLegacy(msg kafka.Message) (*notification.Envelope, error) {
+	var legacy legacyMessage
+	if err := json.Unmarshal(msg.Value, &legacy); err != nil {
+		return nil, err
+	}
+	if legacy.Receiver == "" {
+		return nil, errors.New("legacy message has no receiver")
+	}
+
+	payload, err := structpb.NewStruct(map[string]interface{}{"text": legacy.Content})
+	if err != nil {
+		return nil, err
+	}
+	return &notification.Envelope{
+		Id:         fmt.Sprintf("%s-%d-%d", msg.Topic, msg.Partition, msg.Offset),
+		Type:       notification.EventType_EVENT_TYPE_CHAT_MESSAGE,
+		Version:    1,
+		Recipients: []string{legacy.Receiver},
+		CreatedAt:  timestamppb.New(msg.Time),
+		Payload:    payload,
+	}, nil
+}
+
+func header(msg kafka.Message, key string) string {
+	for _, header := range msg.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package consumer
+
+import (
+	"context"
+	"time"
+)
+
+// RetryPolicy retries failed operations with exponential backoff
+type RetryPolicy struct {
+	MaxAttempts    int           // Attempts before an operation is given up, at least one
+	InitialBackoff time.Duration // Delay after the first failure, doubled after each further one
+	MaxBackoff     time.Duration
+}
+
+// Backoff returns the delay after the given number of consecutive failures
+func (p RetryPolicy) Backoff(failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+	if failures > 32 {
+		return p.MaxBackoff
+	}
+	delay := p.InitialBackoff << (failures - 1)
+	if delay <= 0 || delay > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return delay
+}
+
+// Do runs the operation until it succeeds, the attempts are used up or the
+// context is cancelled. It returns the number of attempts made and the last error.
+func (p RetryPolicy) Do(ctx context.Context, operation func() error) (int, error) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = operation(); err == nil || attempt >= p.MaxAttempts {
+			return attempt, err
+		}
+		if sleepErr := sleep(ctx, p.Backoff(attempt)); sleepErr != nil {
+			return attempt, err
+		}
+	}
+}
+
+// sleep waits for the duration unless the context is cancelled first
+func sleep(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
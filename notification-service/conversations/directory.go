@@ -0,0 +1,160 @@
+package conversations
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	messageServiceProto "notification-service/proto/message_service"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds the cache. Once it is reached expired entries are
+// pruned, and if none expired the one expiring soonest is evicted.
+const maxCacheEntries = 10000
+
+var errNotParticipant = errors.New("user is not a participant of the conversation")
+
+type cachedUsers struct {
+	userIDs   []string
+	err       error // Set for lookups message-service refused
+	expiresAt time.Time
+}
+
+// Directory looks up participants of conversations and contacts of users in
+// message-service. Typing frames and presence changes arrive in bursts, so
+// both are cached for the TTL; membership changes take up to that long to
+// apply. Refused lookups are cached as well, so a client signalling to a
+// conversation it isn't part of doesn't reach message-service every time.
+type Directory struct {
+	client messageServiceProto.MessageServiceClient
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedUsers // Keyed by conversation or contacts key
+}
+
+func NewDirectory(client messageServiceProto.MessageServiceClient, ttl time.Duration) *Directory {
+	return &Directory{client: client, ttl: ttl, entries: make(map[string]cachedUsers)}
+}
+
+func (d *Directory) Participants(ctx context.Context, userID string, conversationID int64) ([]string, error) {
+	key := "conversation:" + strconv.FormatInt(conversationID, 10)
+	if userIDs, ok := d.cached(key); ok {
+		for _, participant := range userIDs {
+			if participant == userID {
+				return userIDs, nil
+			}
+		}
+		return nil, errNotParticipant
+	}
+
+	refusedKey := key + ":user:" + userID
+	if entry, ok := d.lookup(refusedKey); ok {
+		return nil, entry.err
+	}
+
+	id, err := strconv.ParseInt(userID, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	response, err := d.client.ListParticipants(ctx, &messageServiceProto.ListParticipantsRequest{
+		UserId:         int32(id),
+		ConversationId: conversationID,
+	})
+	if isRefusal(err) {
+		d.store(refusedKey, nil, err)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := formatIDs(response.UserIds)
+	d.store(key, userIDs, nil)
+	return userIDs, nil
+}
+
+func (d *Directory) Contacts(ctx context.Context, userID string) ([]string, error) {
+	key := "contacts:" + userID
+	if userIDs, ok := d.cached(key); ok {
+		return userIDs, nil
+	}
+
+	id, err := strconv.ParseInt(userID, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	response, err := d.client.ListContacts(ctx, &messageServiceProto.ListContactsRequest{UserId: int32(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := formatIDs(response.UserIds)
+	d.store(key, userIDs, nil)
+	return userIDs, nil
+}
+
+// isRefusal tells errors that repeating the lookup won't change apart from
+// failures of message-service
+func isRefusal(err error) bool {
+	switch status.Code(err) {
+	case codes.NotFound, codes.PermissionDenied, codes.InvalidArgument:
+		return true
+	}
+	return false
+}
+
+func formatIDs(ids []int32) []string {
+	userIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		userIDs = append(userIDs, strconv.FormatInt(int64(id), 10))
+	}
+	return userIDs
+}
+
+func (d *Directory) cached(key string) ([]string, bool) {
+	entry, ok := d.lookup(key)
+	return entry.userIDs, ok && entry.err == nil
+}
+
+func (d *Directory) lookup(key string) (cachedUsers, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return cachedUsers{}, false
+	}
+	return entry, true
+}
+
+func (d *Directory) store(key string, userIDs []string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	if _, ok := d.entries[key]; !ok && len(d.entries) >= maxCacheEntries {
+		d.evict(now)
+	}
+	d.entries[key] = cachedUsers{userIDs: userIDs, err: err, expiresAt: now.Add(d.ttl)}
+}
+
+// evict prunes expired entries, or the one expiring soonest if none did.
+// The caller holds `mu`.
+func (d *Directory) evict(now time.Time) {
+	soonest := ""
+	var soonestAt time.Time
+	for key, entry := range d.entries {
+		if now.After(entry.expiresAt) {
+			delete(d.entries, key)
+			continue
+		}
+		if soonest == "" || entry.expiresAt.Before(soonestAt) {
+			soonest, soonestAt = key, entry.expiresAt
+		}
+	}
+	if len(d.entries) >= maxCacheEntries {
+		delete(d.entries, soonest)
+	}
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"fmt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"os"
+)
+
+var DB *gorm.DB
+
+func ConnectDatabase() {
+	db, err := gorm.Open(postgres.Open(DSN()), &gorm.Config{})
+	if err != nil {
+		panic("Failed to connect to database!")
+	}
+
+	DB = db
+}
+
+// DSN describes the database given by the environment, for components that
+// need a connection of their own
+func DSN() string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		os.Getenv("DB_HOST"),
+		os.Getenv("DB_USER"),
+		os.Getenv("DB_PASSWORD"),
+		os.Getenv("DB_NAME"),
+		os.Getenv("DB_PORT"),
+	)
+}
+
+// Close closes the connection pool, if a connection was made
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -1,34 +1,268 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"io"
+	"jwks"
+	"log"
 	"net/http"
+	"notification-service/auth"
 	"notification-service/config"
 	"notification-service/consumer"
+	"notification-service/conversations"
+	"notification-service/database"
+	"notification-service/presence"
+	messageServiceProto "notification-service/proto/message_service"
+	"notification-service/receipts"
+	"notification-service/routing"
+	"notification-service/store"
 	"notification-service/websocket"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
+// purgeInterval is how often expired pending messages are deleted
+const purgeInterval = 10 * time.Minute
+
 func main() {
-	config := config.LoadConfig()
-	hub := websocket.NewHub()
+	config, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	// Cancelled on shutdown, stops the consumer and the background loops
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	verifier := auth.NewVerifier(jwks.NewCache(config.JWKSURL, config.JWKSCacheTTL))
+	overflowPolicy, err := websocket.ParseOverflowPolicy(config.OverflowPolicy)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	pendingStore, err := newPendingStore(config)
+	if err != nil {
+		log.Fatalf("Failed to set up pending message store: %v", err)
+	}
+	go store.PurgePeriodically(ctx, pendingStore, purgeInterval)
+	registry, err := newRegistry(config)
+	if err != nil {
+		log.Fatalf("Failed to set up connection registry: %v", err)
+	}
+	relay, err := newRelay(config)
+	if err != nil {
+		log.Fatalf("Failed to set up relay: %v", err)
+	}
+
+	presenceStore, err := newPresenceStore(config)
+	if err != nil {
+		log.Fatalf("Failed to set up presence store: %v", err)
+	}
+	signalRelay, err := newSignalRelay(config)
+	if err != nil {
+		log.Fatalf("Failed to set up signal relay: %v", err)
+	}
+
+	var receiptRecorder websocket.ReceiptRecorder
+	var conversationDirectory websocket.ConversationDirectory
+	var messageConn *grpc.ClientConn
+	if config.MessageServiceURL != "" {
+		messageConn, err = grpc.NewClient(config.MessageServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("Failed to connect to message service: %v", err)
+		}
+		messageClient := messageServiceProto.NewMessageServiceClient(messageConn)
+		receiptRecorder = &receipts.GrpcRecorder{Client: messageClient}
+		conversationDirectory = conversations.NewDirectory(messageClient, config.ParticipantCacheTTL)
+	}
+
+	hub := websocket.NewHub(verifier, websocket.Options{
+		AuthTimeout:      config.AuthTimeout,
+		SendBufferSize:   config.SendBufferSize,
+		WriteTimeout:     config.WriteTimeout,
+		OverflowPolicy:   overflowPolicy,
+		PingInterval:     config.PingInterval,
+		PongTimeout:      config.PongTimeout,
+		AckTimeout:       config.AckTimeout,
+		MaxRetryInterval: config.MaxRetryInterval,
+		MaxInflight:      config.MaxInflight,
+		Store:            pendingStore,
+		InstanceID:       config.InstanceID,
+		Registry:         registry,
+		Relay:            relay,
+		Receipts:         receiptRecorder,
+		Conversations:    conversationDirectory,
+		TypingInterval:   config.TypingInterval,
+		TypingTTL:        config.TypingTTL,
+		SignalRelay:      signalRelay,
+		Presence:         presenceStore,
+	})
 
 	go hub.Broadcast()
+	go hub.RefreshRegistry(ctx, config.RegistryTTL/3)
+	go func() {
+		if err := relay.Subscribe(ctx, config.InstanceID, hub.HandleEvent); err != nil && ctx.Err() == nil {
+			log.Printf("Relay subscription of instance %s ended: %v", config.InstanceID, err)
+		}
+	}()
+	go func() {
+		if err := signalRelay.Subscribe(ctx, config.InstanceID, hub.HandleEvent); err != nil && ctx.Err() == nil {
+			log.Printf("Signal relay subscription of instance %s ended: %v", config.InstanceID, err)
+		}
+	}()
+
+	deadLetterWriter := &kafka.Writer{
+		Addr:                   kafka.TCP(config.KafkaServiceURL),
+		AllowAutoTopicCreation: true,
+	}
 
-	go consumer.StartWebsocketConsumer(
-		[]string{config.KafkaServiceURL},
-		"default",
-		"notification-service-group",
-		hub,
-	)
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		consumer.StartWebsocketConsumer(
+			ctx,
+			[]string{config.KafkaServiceURL},
+			"default",
+			"notification-service-group",
+			&consumer.Processor{
+				Hub:             hub,
+				DeadLetter:      deadLetterWriter,
+				DeadLetterTopic: config.DeadLetterTopic,
+				Retry: consumer.RetryPolicy{
+					MaxAttempts:    config.ConsumerMaxAttempts,
+					InitialBackoff: config.ConsumerInitialBackoff,
+					MaxBackoff:     config.ConsumerMaxBackoff,
+				},
+			},
+		)
+	}()
 
 	// register websocket registration function
 	http.HandleFunc("/ws", hub.WebSocketHandler)
+	http.HandleFunc("GET /presence", hub.PresenceHandler)
+	http.HandleFunc("PUT /presence/settings", hub.PresenceSettingsHandler)
 
-	go http.ListenAndServe(":"+os.Getenv("PORT"), nil)
+	server := &http.Server{Addr: ":" + os.Getenv("PORT")}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
 
 	interruption := make(chan os.Signal, 1)
 	signal.Notify(interruption, syscall.SIGINT, syscall.SIGTERM)
 	<-interruption
+
+	log.Println("Shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancelShutdown()
+
+	// Stop accepting connections, then stop consuming so the reader commits
+	// its offsets while the hub can still persist in-flight messages
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down server: %v", err)
+	}
+	cancel()
+	select {
+	case <-consumerDone:
+	case <-shutdownCtx.Done():
+		log.Println("Kafka consumer did not stop in time")
+	}
+
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to close WebSocket connections: %v", err)
+	}
+	if err := deadLetterWriter.Close(); err != nil {
+		log.Printf("Failed to flush dead-letter writer: %v", err)
+	}
+	if closer, ok := relay.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Failed to flush relay: %v", err)
+		}
+	}
+	if kafkaRelay, ok := relay.(*routing.KafkaRelay); ok {
+		if err := kafkaRelay.DeleteTopic(shutdownCtx, config.InstanceID); err != nil {
+			log.Printf("Failed to delete relay topic: %v", err)
+		}
+	}
+	if messageConn != nil {
+		if err := messageConn.Close(); err != nil {
+			log.Printf("Failed to close message service connection: %v", err)
+		}
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("Failed to close database: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
+
+func newPendingStore(config *config.Config) (store.PendingStore, error) {
+	switch config.OfflineStore {
+	case "memory":
+		return store.NewMemoryStore(config.OfflineMessageTTL, config.OfflineMaxBacklog), nil
+	case "postgres":
+		connectDatabase()
+		return store.NewPostgresStore(database.DB, config.OfflineMessageTTL, config.OfflineMaxBacklog)
+	default:
+		return nil, fmt.Errorf("unknown offline store %q", config.OfflineStore)
+	}
+}
+
+func newRegistry(config *config.Config) (routing.Registry, error) {
+	switch config.Registry {
+	case "memory":
+		return routing.NewMemoryRegistry(config.RegistryTTL), nil
+	case "postgres":
+		connectDatabase()
+		return routing.NewPostgresRegistry(database.DB, config.RegistryTTL)
+	default:
+		return nil, fmt.Errorf("unknown registry %q", config.Registry)
+	}
+}
+
+func newRelay(config *config.Config) (routing.Relay, error) {
+	switch config.Relay {
+	case "memory":
+		return routing.NewMemoryRelay(), nil
+	case "kafka":
+		return routing.NewKafkaRelay([]string{config.KafkaServiceURL}, config.RelayTopicPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown relay %q", config.Relay)
+	}
+}
+
+func newPresenceStore(config *config.Config) (presence.Store, error) {
+	switch config.PresenceStore {
+	case "memory":
+		return presence.NewMemoryStore(), nil
+	case "postgres":
+		connectDatabase()
+		return presence.NewPostgresStore(database.DB)
+	default:
+		return nil, fmt.Errorf("unknown presence store %q", config.PresenceStore)
+	}
+}
+
+func newSignalRelay(config *config.Config) (routing.Relay, error) {
+	switch config.SignalRelay {
+	case "memory":
+		return routing.NewMemoryRelay(), nil
+	case "postgres":
+		connectDatabase()
+		return routing.NewPostgresRelay(database.DB, database.DSN(), config.SignalChannelPrefix), nil
+	default:
+		return nil, fmt.Errorf("unknown signal relay %q", config.SignalRelay)
+	}
+}
+
+// connectDatabase connects once, however many components are backed by Postgres
+func connectDatabase() {
+	if database.DB == nil {
+		database.ConnectDatabase()
+	}
 }
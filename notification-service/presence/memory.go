@@ -0,0 +1,57 @@
+package presence
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store living in the process memory, for a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+func (s *MemoryStore) Seen(_ context.Context, at time.Time, userIDs ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, userID := range userIDs {
+		record := s.record(userID)
+		record.LastSeen = at
+		s.records[userID] = record
+	}
+	return nil
+}
+
+func (s *MemoryStore) SetHideLastSeen(_ context.Context, userID string, hide bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.record(userID)
+	record.HideLastSeen = hide
+	s.records[userID] = record
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, userIDs ...string) (map[string]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make(map[string]Record, len(userIDs))
+	for _, userID := range userIDs {
+		if record, ok := s.records[userID]; ok {
+			records[userID] = record
+		}
+	}
+	return records, nil
+}
+
+// record returns the user's record, or a fresh one. Callers hold the lock.
+func (s *MemoryStore) record(userID string) Record {
+	if record, ok := s.records[userID]; ok {
+		return record
+	}
+	return Record{UserID: userID}
+}
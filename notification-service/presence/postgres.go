@@ -0,0 +1,66 @@
+package presence
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type userPresence struct {
+	UserID       string `gorm:"primaryKey"`
+	LastSeen     time.Time
+	HideLastSeen bool `gorm:"not null;default:false"`
+}
+
+// PostgresStore is a Store backed by the user_presences table
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	if err := db.AutoMigrate(&userPresence{}); err != nil {
+		return nil, err
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) Seen(ctx context.Context, at time.Time, userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	rows := make([]userPresence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		rows = append(rows, userPresence{UserID: userID, LastSeen: at})
+	}
+	return s.upsert(ctx, rows, "last_seen")
+}
+
+func (s *PostgresStore) SetHideLastSeen(ctx context.Context, userID string, hide bool) error {
+	return s.upsert(ctx, []userPresence{{UserID: userID, HideLastSeen: hide}}, "hide_last_seen")
+}
+
+// upsert inserts the rows, only updating the given column of existing ones
+func (s *PostgresStore) upsert(ctx context.Context, rows []userPresence, column string) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{column}),
+	}).Create(&rows).Error
+}
+
+func (s *PostgresStore) Get(ctx context.Context, userIDs ...string) (map[string]Record, error) {
+	records := make(map[string]Record, len(userIDs))
+	if len(userIDs) == 0 {
+		return records, nil
+	}
+
+	var rows []userPresence
+	if err := s.db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		records[row.UserID] = Record(row)
+	}
+	return records, nil
+}
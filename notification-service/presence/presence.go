@@ -0,0 +1,34 @@
+package presence
+
+import (
+	"context"
+	"time"
+)
+
+// Statuses of users. Online and away are chosen by the user's devices and
+// kept per instance in the routing registry, offline is derived from the
+// user having no connections left.
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusOffline = "offline"
+)
+
+// Record is what is stored about a user's presence
+type Record struct {
+	UserID string
+	// LastSeen is when the user was last known to be connected, zero if never
+	LastSeen time.Time
+	// HideLastSeen keeps LastSeen from being shown to other users
+	HideLastSeen bool
+}
+
+// Store keeps presence records shared by all instances. Users without a
+// record have never been seen.
+type Store interface {
+	// Seen records that the users were connected at the given time
+	Seen(ctx context.Context, at time.Time, userIDs ...string) error
+	SetHideLastSeen(ctx context.Context, userID string, hide bool) error
+	// Get returns the records of the users that have one
+	Get(ctx context.Context, userIDs ...string) (map[string]Record, error)
+}
@@ -0,0 +1,44 @@
+package receipts
+
+import (
+	"context"
+	messageServiceProto "notification-service/proto/message_service"
+	"strconv"
+)
+
+// GrpcRecorder records receipts through message-service
+type GrpcRecorder struct {
+	Client messageServiceProto.MessageServiceClient
+}
+
+func (r *GrpcRecorder) MarkDelivered(ctx context.Context, userID string, conversationID, messageID int64) error {
+	request, err := receiptRequest(userID, conversationID, messageID)
+	if err != nil {
+		return err
+	}
+	_, err = r.Client.MarkDelivered(ctx, request)
+	return err
+}
+
+func (r *GrpcRecorder) MarkRead(ctx context.Context, userID string, conversationID, messageID int64) error {
+	request, err := receiptRequest(userID, conversationID, messageID)
+	if err != nil {
+		return err
+	}
+	_, err = r.Client.MarkRead(ctx, request)
+	return err
+}
+
+// receiptRequest converts the user ID taken from the token claims to the
+// numeric ID message-service works with
+func receiptRequest(userID string, conversationID, messageID int64) (*messageServiceProto.ReceiptRequest, error) {
+	id, err := strconv.ParseInt(userID, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	return &messageServiceProto.ReceiptRequest{
+		UserId:         int32(id),
+		ConversationId: conversationID,
+		MessageId:      messageID,
+	}, nil
+}
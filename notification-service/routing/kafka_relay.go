@@ -0,0 +1,135 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaRelay is a Relay with a Kafka topic per instance. Subscribers start
+// at the end of their topic: connections don't survive a restart, and
+// clients reconnecting elsewhere are served by the replay.
+//
+// The topic is created by the instance's subscription and should be deleted
+// with DeleteTopic when the instance shuts down. Publishing never creates
+// it, so events sent to an instance that is gone fail instead of bringing
+// its topic back; they stay pending and are replayed to the reconnecting
+// client. Topics of instances that crashed are left behind.
+type KafkaRelay struct {
+	brokers     []string
+	topicPrefix string
+	client      *kafka.Client
+	writer      *kafka.Writer
+}
+
+func NewKafkaRelay(brokers []string, topicPrefix string) *KafkaRelay {
+	return &KafkaRelay{
+		brokers:     brokers,
+		topicPrefix: topicPrefix,
+		client:      &kafka.Client{Addr: kafka.TCP(brokers...)},
+		writer:      &kafka.Writer{Addr: kafka.TCP(brokers...)},
+	}
+}
+
+func (r *KafkaRelay) topic(instanceID string) string {
+	return r.topicPrefix + instanceID
+}
+
+func (r *KafkaRelay) Publish(ctx context.Context, instanceID string, event Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.writer.WriteMessages(ctx, kafka.Message{
+		Topic: r.topic(instanceID),
+		Key:   []byte(event.Message.UserID),
+		Value: value,
+	})
+}
+
+func (r *KafkaRelay) Subscribe(ctx context.Context, instanceID string, handler func(Event)) error {
+	for failures := 1; ; failures++ {
+		err := r.createTopic(ctx, instanceID)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		delay := backoff(failures)
+		log.Printf("Failed to create relay topic of instance %s, retrying in %v: %v", instanceID, delay, err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: r.brokers,
+		Topic:   r.topic(instanceID),
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(kafka.LastOffset); err != nil {
+		return err
+	}
+
+	failures := 0
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			failures++
+			delay := backoff(failures)
+			log.Printf("Error reading relayed event, retrying in %v: %v", delay, err)
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+			continue
+		}
+		failures = 0
+
+		var event Event
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			log.Printf("Failed to deserialize relayed event: %v", err)
+			continue
+		}
+		handler(event)
+	}
+}
+
+func (r *KafkaRelay) createTopic(ctx context.Context, instanceID string) error {
+	topic := r.topic(instanceID)
+	response, err := r.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{
+		Topics: []kafka.TopicConfig{{Topic: topic, NumPartitions: 1, ReplicationFactor: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	if err := response.Errors[topic]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+		return err
+	}
+	return nil
+}
+
+// DeleteTopic removes the topic of the instance, once it no longer subscribes
+func (r *KafkaRelay) DeleteTopic(ctx context.Context, instanceID string) error {
+	topic := r.topic(instanceID)
+	response, err := r.client.DeleteTopics(ctx, &kafka.DeleteTopicsRequest{Topics: []string{topic}})
+	if err != nil {
+		return err
+	}
+	if err := response.Errors[topic]; err != nil && !errors.Is(err, kafka.UnknownTopicOrPartition) {
+		return fmt.Errorf("delete topic %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Close flushes pending events
+func (r *KafkaRelay) Close() error {
+	return r.writer.Close()
+}
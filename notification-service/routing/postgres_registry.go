@@ -0,0 +1,85 @@
+package routing
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type userInstance struct {
+	UserID      string    `gorm:"primaryKey"`
+	InstanceID  string    `gorm:"primaryKey"`
+	RefreshedAt time.Time `gorm:"index;not null"`
+	Status      string    `gorm:"not null;default:online"`
+}
+
+// PostgresRegistry is a Registry backed by the user_instances table
+type PostgresRegistry struct {
+	db  *gorm.DB
+	ttl time.Duration
+}
+
+func NewPostgresRegistry(db *gorm.DB, ttl time.Duration) (*PostgresRegistry, error) {
+	if err := db.AutoMigrate(&userInstance{}); err != nil {
+		return nil, err
+	}
+	return &PostgresRegistry{db: db, ttl: ttl}, nil
+}
+
+func (r *PostgresRegistry) Register(ctx context.Context, instanceID string, userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	rows := make([]userInstance, 0, len(userIDs))
+	for _, userID := range userIDs {
+		rows = append(rows, userInstance{UserID: userID, InstanceID: instanceID, RefreshedAt: now, Status: StatusOnline})
+	}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"refreshed_at"}),
+	}).Create(&rows).Error
+}
+
+func (r *PostgresRegistry) Unregister(ctx context.Context, instanceID, userID string) error {
+	return r.db.WithContext(ctx).
+		Where("user_id = ? AND instance_id = ?", userID, instanceID).
+		Delete(&userInstance{}).Error
+}
+
+func (r *PostgresRegistry) Instances(ctx context.Context, userID string) ([]string, error) {
+	var instances []string
+	err := r.db.WithContext(ctx).Model(&userInstance{}).
+		Where("user_id = ? AND refreshed_at > ?", userID, time.Now().Add(-r.ttl)).
+		Pluck("instance_id", &instances).Error
+	return instances, err
+}
+
+func (r *PostgresRegistry) SetStatus(ctx context.Context, instanceID, userID, status string) error {
+	row := userInstance{UserID: userID, InstanceID: instanceID, RefreshedAt: time.Now(), Status: status}
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "instance_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"refreshed_at", "status"}),
+	}).Create(&row).Error
+}
+
+func (r *PostgresRegistry) Statuses(ctx context.Context, userIDs ...string) (map[string]string, error) {
+	statuses := make(map[string]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return statuses, nil
+	}
+
+	var rows []userInstance
+	err := r.db.WithContext(ctx).
+		Where("user_id IN ? AND refreshed_at > ?", userIDs, time.Now().Add(-r.ttl)).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		statuses[row.UserID] = combineStatus(statuses[row.UserID], row.Status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// maxChannelLength is the longest identifier Postgres keeps without truncating
+const maxChannelLength = 63
+
+// PostgresRelay is a Relay on top of LISTEN/NOTIFY, with a channel per
+// instance. Notifications are never stored, so events published while an
+// instance isn't listening are lost; this suits ephemeral signals, which
+// must not end up in Kafka. Events are limited to about 8000 bytes.
+type PostgresRelay struct {
+	db            *gorm.DB
+	dsn           string // Listening takes a connection of its own, outside the pool
+	channelPrefix string
+}
+
+func NewPostgresRelay(db *gorm.DB, dsn, channelPrefix string) *PostgresRelay {
+	return &PostgresRelay{db: db, dsn: dsn, channelPrefix: channelPrefix}
+}
+
+// channel names the instance's channel. Names too long for an identifier,
+// such as those of pods with long names, are replaced by their hash.
+func (r *PostgresRelay) channel(instanceID string) string {
+	channel := r.channelPrefix + instanceID
+	if len(channel) > maxChannelLength {
+		sum := sha256.Sum256([]byte(channel))
+		channel = r.channelPrefix + hex.EncodeToString(sum[:])[:maxChannelLength-len(r.channelPrefix)]
+	}
+	return channel
+}
+
+func (r *PostgresRelay) Publish(ctx context.Context, instanceID string, event Event) error {
+	value, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", r.channel(instanceID), string(value)).Error
+}
+
+// Subscribe listens until the context is cancelled. A lost connection is
+// re-established with backoff; signals sent meanwhile are lost.
+func (r *PostgresRelay) Subscribe(ctx context.Context, instanceID string, handler func(Event)) error {
+	for failures := 1; ; failures++ {
+		listening, err := r.listen(ctx, instanceID, handler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if listening {
+			failures = 1
+		}
+		delay := backoff(failures)
+		log.Printf("Lost relay channel of instance %s, reconnecting in %v: %v", instanceID, delay, err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// listen hands notifications to the handler until the connection fails. It
+// reports whether it got as far as listening.
+func (r *PostgresRelay) listen(ctx context.Context, instanceID string, handler func(Event)) (bool, error) {
+	conn, err := pgx.Connect(ctx, r.dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{r.channel(instanceID)}.Sanitize()); err != nil {
+		return false, err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("Failed to deserialize relayed event: %v", err)
+			continue
+		}
+		handler(event)
+	}
+}
@@ -0,0 +1,125 @@
+package routing
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Registry maps users to the instances holding their connections. Entries
+// expire unless refreshed, so users of crashed instances are forgotten.
+// Each entry carries the status the user's connections on the instance
+// combine to, so that one device going away doesn't hide another that is
+// still in use.
+type Registry interface {
+	// Register records or refreshes connections of the users on the instance.
+	// New entries start out online.
+	Register(ctx context.Context, instanceID string, userIDs ...string) error
+	// Unregister removes the user's entry of the instance
+	Unregister(ctx context.Context, instanceID, userID string) error
+	// Instances returns the instances with live connections of the user
+	Instances(ctx context.Context, userID string) ([]string, error)
+	// SetStatus records the status of the user's connections on the instance
+	SetStatus(ctx context.Context, instanceID, userID, status string) error
+	// Statuses returns the status of the users with live connections:
+	// online if any instance reports them online, away otherwise. Users
+	// without connections are left out.
+	Statuses(ctx context.Context, userIDs ...string) (map[string]string, error)
+}
+
+// Statuses of the connections of a user on an instance, matching those of
+// the presence package
+const (
+	StatusOnline = "online"
+	StatusAway   = "away"
+)
+
+// combineStatus adds an instance's status to the one combined so far
+func combineStatus(combined, status string) string {
+	if combined == StatusOnline || status == StatusOnline {
+		return StatusOnline
+	}
+	return StatusAway
+}
+
+type instanceEntry struct {
+	refreshedAt time.Time
+	status      string
+}
+
+// MemoryRegistry is a Registry living in the process memory, shared by the
+// hubs of a single process
+type MemoryRegistry struct {
+	mu        sync.Mutex
+	instances map[string]map[string]instanceEntry // Maps user IDs to their entries by instance
+	ttl       time.Duration
+}
+
+func NewMemoryRegistry(ttl time.Duration) *MemoryRegistry {
+	return &MemoryRegistry{instances: make(map[string]map[string]instanceEntry), ttl: ttl}
+}
+
+func (r *MemoryRegistry) Register(_ context.Context, instanceID string, userIDs ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, userID := range userIDs {
+		if r.instances[userID] == nil {
+			r.instances[userID] = make(map[string]instanceEntry)
+		}
+		entry, ok := r.instances[userID][instanceID]
+		if !ok {
+			entry.status = StatusOnline
+		}
+		entry.refreshedAt = time.Now()
+		r.instances[userID][instanceID] = entry
+	}
+	return nil
+}
+
+func (r *MemoryRegistry) Unregister(_ context.Context, instanceID, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.instances[userID], instanceID)
+	if len(r.instances[userID]) == 0 {
+		delete(r.instances, userID)
+	}
+	return nil
+}
+
+func (r *MemoryRegistry) Instances(_ context.Context, userID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cutoff := time.Now().Add(-r.ttl)
+	var instances []string
+	for instanceID, entry := range r.instances[userID] {
+		if entry.refreshedAt.After(cutoff) {
+			instances = append(instances, instanceID)
+		}
+	}
+	return instances, nil
+}
+
+func (r *MemoryRegistry) SetStatus(_ context.Context, instanceID, userID, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.instances[userID] == nil {
+		r.instances[userID] = make(map[string]instanceEntry)
+	}
+	r.instances[userID][instanceID] = instanceEntry{refreshedAt: time.Now(), status: status}
+	return nil
+}
+
+func (r *MemoryRegistry) Statuses(_ context.Context, userIDs ...string) (map[string]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cutoff := time.Now().Add(-r.ttl)
+	statuses := make(map[string]string, len(userIDs))
+	for _, userID := range userIDs {
+		for _, entry := range r.instances[userID] {
+			if entry.refreshedAt.After(cutoff) {
+				statuses[userID] = combineStatus(statuses[userID], entry.status)
+			}
+		}
+	}
+	return statuses, nil
+}
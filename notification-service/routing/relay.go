@@ -0,0 +1,110 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"notification-service/store"
+	"sync"
+	"time"
+)
+
+// Types of events relayed between instances
+const (
+	// EventMessage delivers a persisted message to the instance's connections
+	EventMessage = "message"
+	// EventAck stops the redelivery of a message acknowledged on another instance
+	EventAck = "ack"
+	// EventSignal delivers an ephemeral signal to the instance's connections
+	EventSignal = "signal"
+)
+
+// Event is sent from one instance to another
+type Event struct {
+	Type    string        `json:"type"`
+	Message store.Message `json:"message"` // Only UserID and ID are set for acks
+	Signal  *Signal       `json:"signal,omitempty"`
+}
+
+// Signal is an ephemeral event, such as a typing indicator. Signals are
+// never stored or acknowledged; those that expire before reaching a
+// connection are dropped.
+type Signal struct {
+	UserID string `json:"user_id"` // Receiver
+	// About names the user a presence signal is about, only connections
+	// subscribed to them receive it
+	About     string          `json:"about,omitempty"`
+	Type      string          `json:"type"`
+	Event     json.RawMessage `json:"event"`
+	ExpiresAt time.Time       `json:"expires_at"`
+}
+
+// Relay carries events to a specific instance
+type Relay interface {
+	// Publish sends the event to the instance
+	Publish(ctx context.Context, instanceID string, event Event) error
+	// Subscribe hands the instance's events to the handler until the context is cancelled
+	Subscribe(ctx context.Context, instanceID string, handler func(Event)) error
+}
+
+// MemoryRelay is an in-process Relay, connecting hubs running in the same
+// process. Events for instances without a subscriber are dropped.
+type MemoryRelay struct {
+	mu       sync.RWMutex
+	handlers map[string]func(Event)
+}
+
+func NewMemoryRelay() *MemoryRelay {
+	return &MemoryRelay{handlers: make(map[string]func(Event))}
+}
+
+func (r *MemoryRelay) Publish(_ context.Context, instanceID string, event Event) error {
+	r.mu.RLock()
+	handler := r.handlers[instanceID]
+	r.mu.RUnlock()
+	if handler != nil {
+		go handler(event)
+	}
+	return nil
+}
+
+func (r *MemoryRelay) Subscribe(ctx context.Context, instanceID string, handler func(Event)) error {
+	r.mu.Lock()
+	r.handlers[instanceID] = handler
+	r.mu.Unlock()
+
+	<-ctx.Done()
+	r.mu.Lock()
+	delete(r.handlers, instanceID)
+	r.mu.Unlock()
+	return ctx.Err()
+}
+
+// Delays between attempts to reach a relay's backend
+const (
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+)
+
+// backoff doubles the delay after each of the consecutive failures, up to maxBackoff
+func backoff(failures int) time.Duration {
+	if failures > 16 {
+		return maxBackoff
+	}
+	delay := initialBackoff << (failures - 1)
+	if delay <= 0 || delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+// sleep waits for the delay unless the context is cancelled first
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
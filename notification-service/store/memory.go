@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a PendingStore living in the process memory
+type MemoryStore struct {
+	mu         sync.Mutex
+	messages   map[string][]Message // Per-user backlog, oldest first
+	sequences  map[string]int64     // Last sequence number handed out per user
+	nextID     int64
+	ttl        time.Duration
+	maxBacklog int
+}
+
+func NewMemoryStore(ttl time.Duration, maxBacklog int) *MemoryStore {
+	return &MemoryStore{
+		messages:   make(map[string][]Message),
+		sequences:  make(map[string]int64),
+		ttl:        ttl,
+		maxBacklog: maxBacklog,
+	}
+}
+
+func (s *MemoryStore) Save(_ context.Context, userID, content string, messageID int64) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.sequences[userID]++
+	message := Message{ID: s.nextID, UserID: userID, Seq: s.sequences[userID], Content: content, MessageID: messageID, CreatedAt: time.Now()}
+	backlog := append(s.messages[userID], message)
+	if len(backlog) > s.maxBacklog {
+		backlog = backlog[len(backlog)-s.maxBacklog:]
+	}
+	s.messages[userID] = backlog
+	return message, nil
+}
+
+func (s *MemoryStore) Pending(_ context.Context, userID string, afterID int64, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []Message
+	for _, message := range s.unexpired(s.messages[userID]) {
+		if len(pending) == limit {
+			break
+		}
+		if message.ID > afterID {
+			pending = append(pending, message)
+		}
+	}
+	return pending, nil
+}
+
+func (s *MemoryStore) Ack(_ context.Context, userID string, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backlog := s.messages[userID]
+	for i, message := range backlog {
+		if message.ID == id {
+			s.set(userID, append(backlog[:i:i], backlog[i+1:]...))
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Retract(_ context.Context, userID string, messageID int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backlog := s.messages[userID]
+	kept := make([]Message, 0, len(backlog))
+	for _, message := range backlog {
+		if message.MessageID != messageID {
+			kept = append(kept, message)
+		}
+	}
+	s.set(userID, kept)
+	return int64(len(backlog) - len(kept)), nil
+}
+
+func (s *MemoryStore) PurgeExpired(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for userID, backlog := range s.messages {
+		kept := s.unexpired(backlog)
+		purged += int64(len(backlog) - len(kept))
+		s.set(userID, kept)
+	}
+	return purged, nil
+}
+
+// unexpired drops the messages older than the TTL; the backlog is ordered
+// by age so they are all at its head
+func (s *MemoryStore) unexpired(backlog []Message) []Message {
+	cutoff := time.Now().Add(-s.ttl)
+	for len(backlog) > 0 && backlog[0].CreatedAt.Before(cutoff) {
+		backlog = backlog[1:]
+	}
+	return backlog
+}
+
+func (s *MemoryStore) set(userID string, backlog []Message) {
+	if len(backlog) == 0 {
+		delete(s.messages, userID)
+		return
+	}
+	s.messages[userID] = backlog
+}
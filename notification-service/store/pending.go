@@ -0,0 +1,57 @@
+package store
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Message is a notification waiting to be acknowledged by its receiver
+type Message struct {
+	ID        int64
+	UserID    string
+	Seq       int64 // Increases by one with every message of the user
+	Content   string
+	MessageID int64 // Chat message whose text the content carries, 0 if none
+	CreatedAt time.Time
+}
+
+// PendingStore keeps notifications per user until a client acknowledges
+// them, so that unacknowledged messages are redelivered after reconnects.
+// Messages older than the store's TTL are never returned, and each user's
+// backlog is capped, evicting the oldest messages first.
+type PendingStore interface {
+	// Save appends a message to the user's backlog, assigning its ID and
+	// sequence number. messageID is the chat message whose text the content
+	// carries, 0 if none.
+	Save(ctx context.Context, userID, content string, messageID int64) (Message, error)
+	// Pending returns up to limit of the user's oldest messages with an ID above afterID
+	Pending(ctx context.Context, userID string, afterID int64, limit int) ([]Message, error)
+	// Ack removes the message from the user's backlog, unknown IDs are ignored
+	Ack(ctx context.Context, userID string, id int64) error
+	// Retract removes the user's messages carrying the text of the chat
+	// message, once it was deleted for everyone
+	Retract(ctx context.Context, userID string, messageID int64) (int64, error)
+	// PurgeExpired deletes every message older than the TTL
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+// PurgePeriodically removes expired messages until the context is cancelled
+func PurgePeriodically(ctx context.Context, pending PendingStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := pending.PurgeExpired(ctx)
+			if err != nil {
+				log.Printf("Failed to purge expired pending messages: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d expired pending messages", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type pendingMessage struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement"`
+	UserID    string    `gorm:"index;not null"`
+	Seq       int64     `gorm:"not null"`
+	Content   string    `gorm:"not null"`
+	MessageID int64     `gorm:"index;not null;default:0"`
+	CreatedAt time.Time `gorm:"index;not null"`
+}
+
+// deliverySequence holds the last sequence number handed out to a user
+type deliverySequence struct {
+	UserID string `gorm:"primaryKey"`
+	Seq    int64  `gorm:"not null"`
+}
+
+// PostgresStore is a PendingStore backed by the pending_messages table
+type PostgresStore struct {
+	db         *gorm.DB
+	ttl        time.Duration
+	maxBacklog int
+}
+
+func NewPostgresStore(db *gorm.DB, ttl time.Duration, maxBacklog int) (*PostgresStore, error) {
+	if err := db.AutoMigrate(&pendingMessage{}, &deliverySequence{}); err != nil {
+		return nil, err
+	}
+	return &PostgresStore{db: db, ttl: ttl, maxBacklog: maxBacklog}, nil
+}
+
+func (s *PostgresStore) Save(ctx context.Context, userID, content string, messageID int64) (Message, error) {
+	var row pendingMessage
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The upsert locks the user's sequence row, so concurrent saves get distinct numbers
+		var seq int64
+		err := tx.Raw(`INSERT INTO delivery_sequences (user_id, seq) VALUES (?, 1)
+			ON CONFLICT (user_id) DO UPDATE SET seq = delivery_sequences.seq + 1
+			RETURNING seq`, userID).Scan(&seq).Error
+		if err != nil {
+			return err
+		}
+
+		row = pendingMessage{UserID: userID, Seq: seq, Content: content, MessageID: messageID, CreatedAt: time.Now()}
+		if err := tx.Create(&row).Error; err != nil {
+			return err
+		}
+
+		// Evict the oldest messages beyond the backlog limit
+		return tx.Exec(`DELETE FROM pending_messages WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM pending_messages WHERE user_id = ? ORDER BY id DESC LIMIT ?
+		)`, userID, userID, s.maxBacklog).Error
+	})
+	return Message(row), err
+}
+
+func (s *PostgresStore) Pending(ctx context.Context, userID string, afterID int64, limit int) ([]Message, error) {
+	var rows []pendingMessage
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND id > ? AND created_at > ?", userID, afterID, time.Now().Add(-s.ttl)).
+		Order("id").
+		Limit(limit).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(rows))
+	for _, row := range rows {
+		messages = append(messages, Message(row))
+	}
+	return messages, nil
+}
+
+func (s *PostgresStore) Ack(ctx context.Context, userID string, id int64) error {
+	return s.db.WithContext(ctx).Where("user_id = ? AND id = ?", userID, id).Delete(&pendingMessage{}).Error
+}
+
+func (s *PostgresStore) Retract(ctx context.Context, userID string, messageID int64) (int64, error) {
+	result := s.db.WithContext(ctx).Where("user_id = ? AND message_id = ?", userID, messageID).Delete(&pendingMessage{})
+	return result.RowsAffected, result.Error
+}
+
+func (s *PostgresStore) PurgeExpired(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at <= ?", time.Now().Add(-s.ttl)).Delete(&pendingMessage{})
+	return result.RowsAffected, result.Error
+}
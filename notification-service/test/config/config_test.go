@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"notification-service/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadConfigDefaults checks that the defaults are accepted
+func TestLoadConfigDefaults(t *testing.T) {
+	loaded, err := config.LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, loaded.PingInterval)
+	assert.Equal(t, 5*time.Second, loaded.AckTimeout)
+}
+
+// TestLoadConfigRejectsNonPositiveDurations checks that durations used as
+// ticker intervals fail at startup instead of panicking per connection
+func TestLoadConfigRejectsNonPositiveDurations(t *testing.T) {
+	for key, value := range map[string]string{
+		"WS_PING_INTERVAL": "0s",
+		"WS_PONG_TIMEOUT":  "-1s",
+		"WS_ACK_TIMEOUT":   "1ns",
+		"REGISTRY_TTL":     "0s",
+	} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := config.LoadConfig()
+			assert.EqualError(t, err, key+` must be a positive duration, got "`+value+`"`)
+		})
+	}
+}
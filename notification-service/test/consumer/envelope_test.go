@@ -0,0 +1,72 @@
+package consumer
+
+import (
+	"testing"
+	"time"
+
+	"notification-service/consumer"
+	notification "notification-service/proto"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+func kafkaMessage(t *testing.T, envelope *notification.Envelope) kafka.Message {
+	value, err := proto.Marshal(envelope)
+	assert.NoError(t, err)
+	return kafka.Message{
+		Value:   value,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/x-protobuf")}},
+	}
+}
+
+// TestDecodeEnvelope checks that a binary envelope is read as is
+func TestDecodeEnvelope(t *testing.T) {
+	envelope, err := consumer.DecodeEnvelope(kafkaMessage(t, &notification.Envelope{
+		Id:         "event-1",
+		Type:       notification.EventType_EVENT_TYPE_SYSTEM_ALERT,
+		Version:    1,
+		Recipients: []string{"1", "2"},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "event-1", envelope.Id)
+	assert.Equal(t, notification.EventType_EVENT_TYPE_SYSTEM_ALERT, envelope.Type)
+	assert.Equal(t, []string{"1", "2"}, envelope.Recipients)
+}
+
+// TestDecodeNewerVersion checks that envelopes of unknown versions are still delivered
+func TestDecodeNewerVersion(t *testing.T) {
+	envelope, err := consumer.DecodeEnvelope(kafkaMessage(t, &notification.Envelope{
+		Id:         "event-1",
+		Version:    consumer.SupportedVersion + 1,
+		Recipients: []string{"1"},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(consumer.SupportedVersion+1), envelope.Version)
+}
+
+// TestDecodeInvalidEnvelope checks that envelopes which can't be routed are rejected
+func TestDecodeInvalidEnvelope(t *testing.T) {
+	_, err := consumer.DecodeEnvelope(kafkaMessage(t, &notification.Envelope{Recipients: []string{"1"}}))
+	assert.Error(t, err)
+
+	_, err = consumer.DecodeEnvelope(kafkaMessage(t, &notification.Envelope{Version: 1}))
+	assert.Error(t, err)
+}
+
+// TestDecodeLegacyMessage checks that messages published before envelopes are wrapped
+func TestDecodeLegacyMessage(t *testing.T) {
+	envelope, err := consumer.DecodeEnvelope(kafka.Message{
+		Topic:     "default",
+		Partition: 2,
+		Offset:    7,
+		Time:      time.Now(),
+		Value:     []byte(`{"user_id":"1","message":"hello"}`),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "default-2-7", envelope.Id)
+	assert.Equal(t, notification.EventType_EVENT_TYPE_CHAT_MESSAGE, envelope.Type)
+	assert.Equal(t, []string{"1"}, envelope.Recipients)
+	assert.Equal(t, "hello", envelope.Payload.GetFields()["text"].GetStringValue())
+}
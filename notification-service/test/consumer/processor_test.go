@@ -0,0 +1,204 @@
+package consumer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"notification-service/consumer"
+	notification "notification-service/proto"
+	"notification-service/websocket"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// failingHub fails the first `failures` messages it is given
+type failingHub struct {
+	mu       sync.Mutex
+	failures int
+	added    []websocket.KafkaMessage
+}
+
+func (h *failingHub) AddMessage(message websocket.KafkaMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures > 0 {
+		h.failures--
+		return errors.New("store unavailable")
+	}
+	h.added = append(h.added, message)
+	return nil
+}
+
+// userFailingHub fails every message for the given user
+type userFailingHub struct {
+	failing string
+	added   []websocket.KafkaMessage
+}
+
+func (h *userFailingHub) AddMessage(message websocket.KafkaMessage) error {
+	if message.Receiver == h.failing {
+		return errors.New("store unavailable")
+	}
+	h.added = append(h.added, message)
+	return nil
+}
+
+type recordingWriter struct {
+	messages []kafka.Message
+}
+
+func (w *recordingWriter) WriteMessages(_ context.Context, messages ...kafka.Message) error {
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func newProcessor(hub consumer.MessageAdder, writer consumer.MessageWriter) *consumer.Processor {
+	return &consumer.Processor{
+		Hub:             hub,
+		DeadLetter:      writer,
+		DeadLetterTopic: "default.dlq",
+		Retry:           consumer.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond},
+	}
+}
+
+func headerValue(msg kafka.Message, key string) string {
+	for _, header := range msg.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// TestPoisonMessageIsDeadLettered checks that undecodable messages are moved
+// to the dead-letter topic with their origin and the failure reason
+func TestPoisonMessageIsDeadLettered(t *testing.T) {
+	writer := &recordingWriter{}
+	msg := kafka.Message{
+		Topic:     "default",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("1"),
+		Value:     []byte("not json"),
+		Headers:   []kafka.Header{{Key: "trace-id", Value: []byte("abc")}},
+	}
+
+	assert.NoError(t, newProcessor(&failingHub{}, writer).Process(context.Background(), msg))
+
+	assert.Len(t, writer.messages, 1)
+	entry := writer.messages[0]
+	assert.Equal(t, "default.dlq", entry.Topic)
+	assert.Equal(t, msg.Value, entry.Value)
+	assert.Equal(t, "abc", headerValue(entry, "trace-id"))
+	assert.Equal(t, "default", headerValue(entry, consumer.HeaderSourceTopic))
+	assert.Equal(t, "3", headerValue(entry, consumer.HeaderSourcePartition))
+	assert.Equal(t, "42", headerValue(entry, consumer.HeaderSourceOffset))
+	assert.Equal(t, "1", headerValue(entry, consumer.HeaderAttempts))
+	assert.Contains(t, headerValue(entry, consumer.HeaderReason), "deserialize")
+}
+
+// TestTransientFailureIsRetried checks that a message is delivered once the hub recovers
+func TestTransientFailureIsRetried(t *testing.T) {
+	hub := &failingHub{failures: 2}
+	writer := &recordingWriter{}
+	msg := kafkaMessage(t, &notification.Envelope{Id: "event-1", Version: 1, Recipients: []string{"1"}})
+
+	assert.NoError(t, newProcessor(hub, writer).Process(context.Background(), msg))
+	assert.Len(t, hub.added, 1)
+	assert.Empty(t, writer.messages)
+}
+
+// TestPersistentFailureIsDeadLettered checks that a message is dead-lettered
+// once the retries are used up
+func TestPersistentFailureIsDeadLettered(t *testing.T) {
+	hub := &failingHub{failures: 10}
+	writer := &recordingWriter{}
+	msg := kafkaMessage(t, &notification.Envelope{Id: "event-1", Version: 1, Recipients: []string{"1"}})
+
+	assert.NoError(t, newProcessor(hub, writer).Process(context.Background(), msg))
+	assert.Empty(t, hub.added)
+	assert.Len(t, writer.messages, 1)
+	assert.Equal(t, "3", headerValue(writer.messages[0], consumer.HeaderAttempts))
+}
+
+// TestFailedRecipientIsDeadLettered checks that only the recipient the
+// message failed for is dead-lettered, while the others still receive it
+func TestFailedRecipientIsDeadLettered(t *testing.T) {
+	hub := &userFailingHub{failing: "2"}
+	writer := &recordingWriter{}
+	msg := kafkaMessage(t, &notification.Envelope{Id: "event-1", Version: 1, Recipients: []string{"1", "2", "3"}})
+	msg.Topic = "default"
+
+	assert.NoError(t, newProcessor(hub, writer).Process(context.Background(), msg))
+	assert.Len(t, hub.added, 2)
+	assert.Equal(t, "1", hub.added[0].Receiver)
+	assert.Equal(t, "3", hub.added[1].Receiver)
+
+	assert.Len(t, writer.messages, 1)
+	original, err := consumer.Redrive(writer.messages[0])
+	assert.NoError(t, err)
+	envelope, err := consumer.DecodeEnvelope(original)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "event-1", envelope.Id)
+	assert.Equal(t, []string{"2"}, envelope.Recipients)
+	assert.Contains(t, headerValue(writer.messages[0], consumer.HeaderReason), "users 2")
+}
+
+// TestRedrive checks that a dead-letter entry is restored to its original form
+func TestRedrive(t *testing.T) {
+	msg := kafka.Message{
+		Topic:   "default",
+		Key:     []byte("1"),
+		Value:   []byte("payload"),
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/x-protobuf")}},
+	}
+	entry := consumer.DeadLetter(msg, "default.dlq", errors.New("boom"), 1)
+
+	original, err := consumer.Redrive(entry)
+	assert.NoError(t, err)
+	assert.Equal(t, "default", original.Topic)
+	assert.Equal(t, msg.Key, original.Key)
+	assert.Equal(t, msg.Value, original.Value)
+	assert.Equal(t, msg.Headers, original.Headers)
+}
+
+// TestBackoff checks that delays double up to the maximum
+func TestBackoff(t *testing.T) {
+	policy := consumer.RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+	assert.Equal(t, 800*time.Millisecond, policy.Backoff(4))
+	assert.Equal(t, time.Second, policy.Backoff(5))
+	assert.Equal(t, time.Second, policy.Backoff(100))
+}
+
+// TestDeletionRetractsMessage checks that messages are tagged with the chat
+// message they carry, and that deleting it for everyone retracts them
+func TestDeletionRetractsMessage(t *testing.T) {
+	hub := &failingHub{}
+	writer := &recordingWriter{}
+	processor := newProcessor(hub, writer)
+	event := func(eventType notification.EventType, fields map[string]interface{}) kafka.Message {
+		payload, err := structpb.NewStruct(fields)
+		assert.NoError(t, err)
+		return kafkaMessage(t, &notification.Envelope{Id: "event-1", Type: eventType, Version: 1, Recipients: []string{"1"}, Payload: payload})
+	}
+
+	ctx := context.Background()
+	assert.NoError(t, processor.Process(ctx, event(notification.EventType_EVENT_TYPE_MESSAGE_CREATED, map[string]interface{}{"message_id": 5, "text": "secret"})))
+	assert.NoError(t, processor.Process(ctx, event(notification.EventType_EVENT_TYPE_MESSAGE_DELETED, map[string]interface{}{"message_id": 5, "for_everyone": false})))
+	assert.NoError(t, processor.Process(ctx, event(notification.EventType_EVENT_TYPE_MESSAGE_DELETED, map[string]interface{}{"message_id": 5, "for_everyone": true})))
+
+	assert.Len(t, hub.added, 3)
+	assert.Equal(t, [2]int64{5, 0}, [2]int64{hub.added[0].MessageID, hub.added[0].Retracts})
+	assert.Equal(t, [2]int64{0, 0}, [2]int64{hub.added[1].MessageID, hub.added[1].Retracts})
+	assert.Equal(t, [2]int64{0, 5}, [2]int64{hub.added[2].MessageID, hub.added[2].Retracts})
+	assert.Empty(t, writer.messages)
+}
@@ -0,0 +1,80 @@
+package conversations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"notification-service/conversations"
+	messageServiceProto "notification-service/proto/message_service"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// countingClient answers participant lookups of conversation 7 and counts them
+type countingClient struct {
+	messageServiceProto.MessageServiceClient
+	calls int
+	err   error // Answered instead when set
+}
+
+func (c *countingClient) ListParticipants(ctx context.Context, in *messageServiceProto.ListParticipantsRequest, opts ...grpc.CallOption) (*messageServiceProto.ListParticipantsResponse, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	if in.ConversationId != 7 || (in.UserId != 1 && in.UserId != 2) {
+		return nil, status.Error(codes.NotFound, "conversation not found")
+	}
+	return &messageServiceProto.ListParticipantsResponse{UserIds: []int32{1, 2}}, nil
+}
+
+// TestParticipantsAreCached checks that participants are looked up once per TTL
+func TestParticipantsAreCached(t *testing.T) {
+	client := &countingClient{}
+	directory := conversations.NewDirectory(client, time.Minute)
+
+	for _, userID := range []string{"1", "2", "1"} {
+		participants, err := directory.Participants(context.Background(), userID, 7)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"1", "2"}, participants)
+	}
+	assert.Equal(t, 1, client.calls)
+
+	// Outsiders are refused from the cache
+	_, err := directory.Participants(context.Background(), "3", 7)
+	assert.Error(t, err)
+	assert.Equal(t, 1, client.calls)
+}
+
+// TestRefusedLookupsAreCached checks that a user asking about a conversation
+// they aren't part of reaches message-service once per TTL
+func TestRefusedLookupsAreCached(t *testing.T) {
+	client := &countingClient{}
+	directory := conversations.NewDirectory(client, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		_, err := directory.Participants(context.Background(), "3", 8)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	}
+	assert.Equal(t, 1, client.calls)
+}
+
+// TestFailedLookupsAreNotCached checks that lookups failing because
+// message-service is unavailable are tried again
+func TestFailedLookupsAreNotCached(t *testing.T) {
+	client := &countingClient{err: status.Error(codes.Unavailable, "connection refused")}
+	directory := conversations.NewDirectory(client, time.Minute)
+
+	_, err := directory.Participants(context.Background(), "1", 7)
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	client.err = nil
+	participants, err := directory.Participants(context.Background(), "1", 7)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, participants)
+	assert.Equal(t, 2, client.calls)
+}
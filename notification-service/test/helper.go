@@ -0,0 +1,165 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"notification-service/auth"
+	notification "notification-service/proto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// MockVerifier accepts tokens of the form "<user id>:<ttl>", e.g. "42:1m"
+type MockVerifier struct {
+	mu      sync.Mutex
+	revoked map[string]bool
+}
+
+func NewMockVerifier() *MockVerifier {
+	return &MockVerifier{revoked: make(map[string]bool)}
+}
+
+func (m *MockVerifier) Verify(token string) (*auth.Claims, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 || m.revoked[token] {
+		return nil, errors.New("invalid token")
+	}
+	userID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := time.ParseDuration(parts[1])
+	if err != nil || ttl <= 0 {
+		return nil, errors.New("token expired")
+	}
+
+	return &auth.Claims{
+		UserID: uint(userID),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: &jwt.NumericDate{Time: time.Now().Add(ttl)},
+		},
+	}, nil
+}
+
+// Receipt is a delivered or read receipt captured by MockReceipts
+type Receipt struct {
+	Status         string
+	UserID         string
+	ConversationID int64
+	MessageID      int64
+}
+
+// MockReceipts records the receipts forwarded by the hub
+type MockReceipts struct {
+	mu       sync.Mutex
+	receipts []Receipt
+}
+
+func (m *MockReceipts) MarkDelivered(ctx context.Context, userID string, conversationID, messageID int64) error {
+	m.record(Receipt{"delivered", userID, conversationID, messageID})
+	return nil
+}
+
+func (m *MockReceipts) MarkRead(ctx context.Context, userID string, conversationID, messageID int64) error {
+	m.record(Receipt{"read", userID, conversationID, messageID})
+	return nil
+}
+
+func (m *MockReceipts) record(receipt Receipt) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.receipts = append(m.receipts, receipt)
+}
+
+// Receipts returns the receipts recorded so far
+func (m *MockReceipts) Receipts() []Receipt {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Receipt(nil), m.receipts...)
+}
+
+// MockConversations maps conversation IDs to their participants
+type MockConversations map[int64][]string
+
+func (m MockConversations) Participants(ctx context.Context, userID string, conversationID int64) ([]string, error) {
+	for _, participant := range m[conversationID] {
+		if participant == userID {
+			return m[conversationID], nil
+		}
+	}
+	return nil, errors.New("not a participant")
+}
+
+func (m MockConversations) Contacts(ctx context.Context, userID string) ([]string, error) {
+	seen := make(map[string]bool)
+	var contacts []string
+	for conversationID := range m {
+		participants, err := m.Participants(ctx, userID, conversationID)
+		if err != nil {
+			continue
+		}
+		for _, participant := range participants {
+			if participant != userID && !seen[participant] {
+				seen[participant] = true
+				contacts = append(contacts, participant)
+			}
+		}
+	}
+	return contacts, nil
+}
+
+// StartServer serves the handler on a test server and returns its ws:// URL
+func StartServer(handler http.HandlerFunc) (*httptest.Server, string) {
+	server := httptest.NewServer(handler)
+	return server, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// Dial opens a WebSocket connection with optional headers
+func Dial(url string, header http.Header) (*websocket.Conn, *http.Response, error) {
+	return websocket.DefaultDialer.Dial(url, header)
+}
+
+// Eventually polls the condition until it holds or a second has passed
+func Eventually(condition func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+// ChatEvent returns the JSON mapping of a chat message envelope
+func ChatEvent(text string) string {
+	payload, _ := structpb.NewStruct(map[string]interface{}{"text": text})
+	event, _ := protojson.Marshal(&notification.Envelope{
+		Type:    notification.EventType_EVENT_TYPE_CHAT_MESSAGE,
+		Version: 1,
+		Payload: payload,
+	})
+	return string(event)
+}
+
+// ChatText returns the text of a chat message envelope
+func ChatText(event json.RawMessage) string {
+	var envelope notification.Envelope
+	if err := protojson.Unmarshal(event, &envelope); err != nil {
+		return ""
+	}
+	return envelope.Payload.GetFields()["text"].GetStringValue()
+}
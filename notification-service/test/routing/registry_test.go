@@ -0,0 +1,69 @@
+package routing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"notification-service/routing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRegistry checks that users are mapped to every instance holding their connections
+func TestRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := routing.NewMemoryRegistry(time.Minute)
+	assert.NoError(t, registry.Register(ctx, "a", "1", "2"))
+	assert.NoError(t, registry.Register(ctx, "b", "1"))
+
+	instances, err := registry.Instances(ctx, "1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, instances)
+
+	assert.NoError(t, registry.Unregister(ctx, "a", "1"))
+	instances, err = registry.Instances(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, instances)
+}
+
+// TestRegistryExpiry checks that entries which aren't refreshed expire
+func TestRegistryExpiry(t *testing.T) {
+	ctx := context.Background()
+	registry := routing.NewMemoryRegistry(50 * time.Millisecond)
+	assert.NoError(t, registry.Register(ctx, "a", "1"))
+	assert.NoError(t, registry.Register(ctx, "b", "1"))
+
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, registry.Register(ctx, "b", "1"))
+
+	instances, err := registry.Instances(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, instances)
+}
+
+// TestRegistryStatuses checks that a user is online while any instance
+// reports them online, and away once all of them report away
+func TestRegistryStatuses(t *testing.T) {
+	ctx := context.Background()
+	registry := routing.NewMemoryRegistry(time.Minute)
+	assert.NoError(t, registry.Register(ctx, "a", "1", "2"))
+	assert.NoError(t, registry.Register(ctx, "b", "1"))
+	assert.NoError(t, registry.SetStatus(ctx, "a", "1", routing.StatusAway))
+	assert.NoError(t, registry.SetStatus(ctx, "a", "2", routing.StatusAway))
+
+	statuses, err := registry.Statuses(ctx, "1", "2", "3")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"1": routing.StatusOnline, "2": routing.StatusAway}, statuses)
+
+	assert.NoError(t, registry.SetStatus(ctx, "b", "1", routing.StatusAway))
+	statuses, err = registry.Statuses(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"1": routing.StatusAway}, statuses)
+
+	// Registering again refreshes the entry without resetting the status
+	assert.NoError(t, registry.Register(ctx, "b", "1"))
+	statuses, err = registry.Statuses(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, routing.StatusAway, statuses["1"])
+}
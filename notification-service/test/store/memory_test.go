@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"notification-service/store"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func contents(messages []store.Message) []string {
+	result := make([]string, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, message.Content)
+	}
+	return result
+}
+
+func save(t *testing.T, pending store.PendingStore, userID string, contents ...string) []store.Message {
+	var saved []store.Message
+	for _, content := range contents {
+		message, err := pending.Save(context.Background(), userID, content, 0)
+		assert.NoError(t, err)
+		saved = append(saved, message)
+	}
+	return saved
+}
+
+// TestPendingInOrder checks that messages are returned oldest first and paged by ID
+func TestPendingInOrder(t *testing.T) {
+	ctx := context.Background()
+	pending := store.NewMemoryStore(time.Hour, 10)
+	save(t, pending, "1", "a", "b", "c")
+	save(t, pending, "2", "other user")
+
+	messages, err := pending.Pending(ctx, "1", 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, contents(messages))
+
+	messages, err = pending.Pending(ctx, "1", messages[1].ID, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c"}, contents(messages))
+}
+
+// TestSequenceNumbers checks that sequence numbers count per user and are
+// not reused after acknowledgements
+func TestSequenceNumbers(t *testing.T) {
+	ctx := context.Background()
+	pending := store.NewMemoryStore(time.Hour, 10)
+	first := save(t, pending, "1", "a", "b")
+	other := save(t, pending, "2", "c")
+	assert.Equal(t, int64(1), first[0].Seq)
+	assert.Equal(t, int64(2), first[1].Seq)
+	assert.Equal(t, int64(1), other[0].Seq)
+
+	assert.NoError(t, pending.Ack(ctx, "1", first[0].ID))
+	assert.NoError(t, pending.Ack(ctx, "1", first[1].ID))
+	assert.Equal(t, int64(3), save(t, pending, "1", "d")[0].Seq)
+}
+
+// TestAck checks that only the acknowledged message of the right user is removed
+func TestAck(t *testing.T) {
+	ctx := context.Background()
+	pending := store.NewMemoryStore(time.Hour, 10)
+	saved := save(t, pending, "1", "a", "b")
+
+	assert.NoError(t, pending.Ack(ctx, "2", saved[0].ID))
+	assert.NoError(t, pending.Ack(ctx, "1", saved[1].ID))
+
+	messages, err := pending.Pending(ctx, "1", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, contents(messages))
+}
+
+// TestBacklogLimit checks that the oldest messages are evicted beyond the limit
+func TestBacklogLimit(t *testing.T) {
+	pending := store.NewMemoryStore(time.Hour, 2)
+	save(t, pending, "1", "a", "b", "c")
+
+	messages, err := pending.Pending(context.Background(), "1", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, contents(messages))
+}
+
+// TestExpiredMessages checks that messages older than the TTL are neither returned nor kept
+func TestExpiredMessages(t *testing.T) {
+	ctx := context.Background()
+	pending := store.NewMemoryStore(50*time.Millisecond, 10)
+	save(t, pending, "1", "old")
+	save(t, pending, "2", "old")
+	time.Sleep(100 * time.Millisecond)
+	save(t, pending, "1", "new")
+
+	messages, err := pending.Pending(ctx, "1", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new"}, contents(messages))
+
+	purged, err := pending.PurgeExpired(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+}
+
+// TestRetract checks that only the user's messages carrying the chat message are removed
+func TestRetract(t *testing.T) {
+	ctx := context.Background()
+	pending := store.NewMemoryStore(time.Hour, 10)
+	for _, userID := range []string{"1", "2"} {
+		_, err := pending.Save(ctx, userID, "created", 5)
+		assert.NoError(t, err)
+	}
+	_, err := pending.Save(ctx, "1", "edited", 5)
+	assert.NoError(t, err)
+	_, err = pending.Save(ctx, "1", "other", 6)
+	assert.NoError(t, err)
+
+	retracted, err := pending.Retract(ctx, "1", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), retracted)
+
+	messages, err := pending.Pending(ctx, "1", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"other"}, contents(messages))
+	messages, err = pending.Pending(ctx, "2", 0, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"created"}, contents(messages))
+}
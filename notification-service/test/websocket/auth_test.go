@@ -0,0 +1,159 @@
+package websocket
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"notification-service/store"
+	"notification-service/test"
+	ws "notification-service/websocket"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHub() *ws.Hub {
+	return startHub(ws.Options{})
+}
+
+func startHub(options ws.Options) *ws.Hub {
+	if options.AuthTimeout == 0 {
+		options.AuthTimeout = time.Second
+	}
+	if options.SendBufferSize == 0 {
+		options.SendBufferSize = 16
+	}
+	if options.WriteTimeout == 0 {
+		options.WriteTimeout = time.Second
+	}
+	if options.OverflowPolicy == "" {
+		options.OverflowPolicy = ws.OverflowDropOldest
+	}
+	if options.PingInterval == 0 {
+		options.PingInterval = time.Minute
+	}
+	if options.PongTimeout == 0 {
+		options.PongTimeout = time.Minute
+	}
+	if options.AckTimeout == 0 {
+		options.AckTimeout = time.Minute
+	}
+	if options.MaxRetryInterval == 0 {
+		options.MaxRetryInterval = time.Minute
+	}
+	if options.MaxInflight == 0 {
+		options.MaxInflight = 1000
+	}
+	if options.Store == nil {
+		options.Store = store.NewMemoryStore(time.Hour, 1000)
+	}
+	hub := ws.NewHub(test.NewMockVerifier(), options)
+	go hub.Broadcast()
+	return hub
+}
+
+// TestBearerHandshake checks that the user ID is taken from the bearer token
+func TestBearerHandshake(t *testing.T) {
+	hub := newHub()
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn, _, err := test.Dial(url+"?user_id=2", http.Header{"Authorization": {"Bearer 1:1m"}})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	// The query parameter must not override the token's subject
+	time.Sleep(50 * time.Millisecond)
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("hello")})
+	assert.Equal(t, "hello", readText(t, conn))
+}
+
+// TestSubprotocolHandshake checks token transport via Sec-WebSocket-Protocol
+func TestSubprotocolHandshake(t *testing.T) {
+	server, url := test.StartServer(newHub().WebSocketHandler)
+	defer server.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"access_token", "1:1m"}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	assert.Equal(t, "access_token", conn.Subprotocol())
+}
+
+// TestInvalidTokenRejected checks that the handshake fails with a bad token
+func TestInvalidTokenRejected(t *testing.T) {
+	server, url := test.StartServer(newHub().WebSocketHandler)
+	defer server.Close()
+
+	_, response, err := test.Dial(url, http.Header{"Authorization": {"Bearer garbage"}})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+// TestFirstFrameAuth checks the in-band authentication right after the handshake
+func TestFirstFrameAuth(t *testing.T) {
+	hub := newHub()
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn, _, err := test.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	assert.NoError(t, conn.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeAuth, Token: "7:1m"}))
+	time.Sleep(50 * time.Millisecond)
+	hub.AddMessage(ws.KafkaMessage{Receiver: "7", Content: test.ChatEvent("hi")})
+	assert.Equal(t, "hi", readText(t, conn))
+}
+
+// TestFirstFrameAuthTimeout checks that silent clients are disconnected
+func TestFirstFrameAuthTimeout(t *testing.T) {
+	server, url := test.StartServer(newHub().WebSocketHandler)
+	defer server.Close()
+
+	conn, _, err := test.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+}
+
+// TestTokenExpiry checks that the connection is closed once the token expires
+// and that in-band re-authentication keeps it open
+func TestTokenExpiry(t *testing.T) {
+	server, url := test.StartServer(newHub().WebSocketHandler)
+	defer server.Close()
+
+	expiring, _, err := test.Dial(url, http.Header{"Authorization": {"Bearer 3:200ms"}})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer expiring.Close()
+
+	renewed, _, err := test.Dial(url, http.Header{"Authorization": {"Bearer 4:200ms"}})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer renewed.Close()
+	assert.NoError(t, renewed.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeAuth, Token: "4:1m"}))
+
+	expiring.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = expiring.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, ws.CloseTokenExpired))
+
+	renewed.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	_, _, err = renewed.ReadMessage()
+	assert.False(t, websocket.IsCloseError(err, ws.CloseTokenExpired))
+}
@@ -0,0 +1,331 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"notification-service/store"
+	"notification-service/test"
+	ws "notification-service/websocket"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func dialUser(t *testing.T, url, token string) *websocket.Conn {
+	conn, _, err := test.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	return conn
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) ws.ServerFrame {
+	var frame ws.ServerFrame
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	assert.NoError(t, conn.ReadJSON(&frame))
+	return frame
+}
+
+func readText(t *testing.T, conn *websocket.Conn) string {
+	return test.ChatText(readFrame(t, conn).Event)
+}
+
+// TestFanOutToAllDevices checks that every connection of a user gets the message
+func TestFanOutToAllDevices(t *testing.T) {
+	hub := newHub()
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	phone := dialUser(t, url, "1:1m")
+	defer phone.Close()
+	laptop := dialUser(t, url, "1:1m")
+	defer laptop.Close()
+
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 2 }))
+
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("hello")})
+
+	assert.Equal(t, "hello", readText(t, phone))
+	assert.Equal(t, "hello", readText(t, laptop))
+}
+
+// TestDisconnectKeepsOtherDevices checks that closing one connection leaves the others registered
+func TestDisconnectKeepsOtherDevices(t *testing.T) {
+	hub := newHub()
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	phone := dialUser(t, url, "1:1m")
+	laptop := dialUser(t, url, "1:1m")
+	defer laptop.Close()
+
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 2 }))
+
+	phone.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("still here")})
+	assert.Equal(t, "still here", readText(t, laptop))
+}
+
+// TestSlowConsumerDoesNotStallHub checks that a client which stopped reading
+// neither delays other users nor grows its queue without bounds
+func TestSlowConsumerDoesNotStallHub(t *testing.T) {
+	pending := store.NewMemoryStore(time.Hour, 1000)
+	hub := startHub(ws.Options{
+		SendBufferSize: 1,
+		WriteTimeout:   10 * time.Second,
+		OverflowPolicy: ws.OverflowSpill,
+		Store:          pending,
+	})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	stalled := dialUser(t, url, "1:1m")
+	defer stalled.Close()
+	healthy := dialUser(t, url, "2:1m")
+	defer healthy.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 && hub.ConnectionCount("2") == 1 }))
+
+	// Enough data to fill the socket buffers of the client that never reads
+	payload := strings.Repeat("x", 256*1024)
+	for i := 0; i < 64; i++ {
+		hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent(payload)})
+	}
+
+	hub.AddMessage(ws.KafkaMessage{Receiver: "2", Content: test.ChatEvent("hello")})
+	assert.Equal(t, "hello", readText(t, healthy))
+
+	// Nothing was acknowledged, so all of it is kept for redelivery
+	backlog, err := pending.Pending(context.Background(), "1", 0, 1000)
+	assert.NoError(t, err)
+	assert.Len(t, backlog, 64)
+}
+
+// TestDisconnectPolicy checks that a slow client is disconnected when configured
+func TestDisconnectPolicy(t *testing.T) {
+	hub := startHub(ws.Options{
+		SendBufferSize: 1,
+		WriteTimeout:   10 * time.Second,
+		OverflowPolicy: ws.OverflowDisconnect,
+	})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	stalled := dialUser(t, url, "1:1m")
+	defer stalled.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	payload := strings.Repeat("x", 256*1024)
+	for i := 0; i < 64; i++ {
+		hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent(payload)})
+	}
+
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 0 }))
+}
+
+// TestInflightLimitDisconnects checks that a client which reads but never
+// acknowledges is disconnected once it reaches the limit of unacknowledged messages
+func TestInflightLimitDisconnects(t *testing.T) {
+	hub := startHub(ws.Options{
+		MaxInflight:    2,
+		OverflowPolicy: ws.OverflowDisconnect,
+	})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	for _, content := range []string{"first", "second", "third"} {
+		hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent(content)})
+	}
+
+	// Messages still queued may or may not be sent before the close frame
+	var err error
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseTryAgainLater), "unexpected error: %v", err)
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 0 }))
+}
+
+// TestInflightLimitDropsOldest checks that the oldest unacknowledged message
+// stops being redelivered to make room for a new one
+func TestInflightLimitDropsOldest(t *testing.T) {
+	hub := startHub(ws.Options{
+		MaxInflight: 2,
+		AckTimeout:  100 * time.Millisecond,
+	})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	for _, content := range []string{"first", "second", "third"} {
+		hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent(content)})
+	}
+	assert.Equal(t, "first", readText(t, conn))
+	assert.Equal(t, "second", readText(t, conn))
+	assert.Equal(t, "third", readText(t, conn))
+
+	// Only the two newest are redelivered
+	assert.Equal(t, "second", readText(t, conn))
+	assert.Equal(t, "third", readText(t, conn))
+}
+
+// TestUnresponsiveClientIsReaped checks that a client not answering pings is removed,
+// while one that keeps reading stays connected
+func TestUnresponsiveClientIsReaped(t *testing.T) {
+	hub := startHub(ws.Options{
+		PingInterval: 50 * time.Millisecond,
+		PongTimeout:  200 * time.Millisecond,
+	})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	// Pongs are only sent while the client reads
+	silent := dialUser(t, url, "1:1m")
+	defer silent.Close()
+	alive := dialUser(t, url, "2:1m")
+	defer alive.Close()
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 0 }))
+	time.Sleep(300 * time.Millisecond)
+	assert.Equal(t, 1, hub.ConnectionCount("2"))
+}
+
+// TestOfflineReplay checks that messages sent while a user is offline are
+// delivered in order once the user connects
+func TestOfflineReplay(t *testing.T) {
+	hub := newHub()
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	for _, content := range []string{"first", "second", "third"} {
+		hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent(content)})
+	}
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.Equal(t, "first", readText(t, conn))
+	assert.Equal(t, "second", readText(t, conn))
+	assert.Equal(t, "third", readText(t, conn))
+
+	// Live messages follow the replayed ones
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("live")})
+	assert.Equal(t, "live", readText(t, conn))
+}
+
+// TestUnackedMessageIsRedelivered checks that a message is sent again with
+// the same ID and sequence number until the client acknowledges it
+func TestUnackedMessageIsRedelivered(t *testing.T) {
+	hub := startHub(ws.Options{AckTimeout: 100 * time.Millisecond})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("first")})
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("second")})
+	first := readFrame(t, conn)
+	second := readFrame(t, conn)
+	assert.Equal(t, first.Seq+1, second.Seq)
+	assert.NoError(t, conn.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeAck, ID: second.ID}))
+
+	redelivered := readFrame(t, conn)
+	assert.Equal(t, first, redelivered)
+	assert.NoError(t, conn.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeAck, ID: first.ID}))
+
+	// Both are acknowledged, nothing else may arrive
+	var frame ws.ServerFrame
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	assert.Error(t, conn.ReadJSON(&frame))
+}
+
+// TestUnackedMessageSurvivesReconnect checks that a message received but not
+// acknowledged is replayed on the next connection
+func TestUnackedMessageSurvivesReconnect(t *testing.T) {
+	pending := store.NewMemoryStore(time.Hour, 100)
+	hub := startHub(ws.Options{Store: pending})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("hello")})
+	delivered := readFrame(t, conn)
+	conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 0 }))
+
+	conn = dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.Equal(t, delivered, readFrame(t, conn))
+	assert.NoError(t, conn.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeAck, ID: delivered.ID}))
+
+	assert.True(t, test.Eventually(func() bool {
+		backlog, _ := pending.Pending(context.Background(), "1", 0, 10)
+		return len(backlog) == 0
+	}))
+}
+
+// TestShutdownClosesConnections checks that clients get a going away close
+// frame and that connections arriving afterwards are turned away
+func TestShutdownClosesConnections(t *testing.T) {
+	hub := newHub()
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, hub.Shutdown(ctx))
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+
+	late := dialUser(t, url, "2:1m")
+	defer late.Close()
+	late.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = late.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
+
+// TestRetractedMessageIsNotReplayed checks that a message deleted for
+// everyone before its receiver connected is never delivered
+func TestRetractedMessageIsNotReplayed(t *testing.T) {
+	hub := newHub()
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("secret"), MessageID: 5})
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("edited secret"), MessageID: 5})
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("kept"), MessageID: 6})
+	hub.AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("deleted"), Retracts: 5})
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.Equal(t, "kept", readText(t, conn))
+	assert.Equal(t, "deleted", readText(t, conn))
+}
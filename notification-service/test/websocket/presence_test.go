@@ -0,0 +1,175 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"notification-service/presence"
+	"notification-service/test"
+	ws "notification-service/websocket"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func presenceOptions() ws.Options {
+	return ws.Options{
+		Conversations: test.MockConversations{7: {"1", "2"}, 8: {"3"}},
+		Presence:      presence.NewMemoryStore(),
+	}
+}
+
+// readPresence reads a presence frame
+func readPresence(t *testing.T, conn *websocket.Conn) ws.Presence {
+	frame := readFrame(t, conn)
+	assert.Equal(t, ws.FrameTypePresence, frame.Type)
+	var change ws.Presence
+	assert.NoError(t, json.Unmarshal(frame.Event, &change))
+	return change
+}
+
+// TestPresenceChangesReachSubscribers checks that contacts subscribed to a
+// user see them come online, go away and leave
+func TestPresenceChangesReachSubscribers(t *testing.T) {
+	hub := startHub(presenceOptions())
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	subscriber := dialUser(t, url, "2:1m")
+	defer subscriber.Close()
+	unsubscribed := dialUser(t, url, "2:1m")
+	defer unsubscribed.Close()
+	assert.NoError(t, subscriber.WriteJSON(ws.ClientFrame{Type: ws.FrameTypePresenceSubscribe, UserIDs: []string{"1"}}))
+	assert.True(t, test.Eventually(func() bool { return hub.SubscriberCount("1") == 1 }))
+
+	user := dialUser(t, url, "1:1m")
+	online := readPresence(t, subscriber)
+	assert.Equal(t, ws.Presence{UserID: "1", Status: presence.StatusOnline}, online)
+
+	assert.NoError(t, user.WriteJSON(ws.ClientFrame{Type: ws.FrameTypePresence, Status: presence.StatusAway}))
+	assert.Equal(t, presence.StatusAway, readPresence(t, subscriber).Status)
+
+	user.Close()
+	offline := readPresence(t, subscriber)
+	assert.Equal(t, presence.StatusOffline, offline.Status)
+	assert.NotNil(t, offline.LastSeen)
+
+	assertSilent(t, unsubscribed)
+}
+
+// TestPresenceHandler checks the presence served over HTTP, including
+// hidden last-seen times
+func TestPresenceHandler(t *testing.T) {
+	hub := startHub(presenceOptions())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", hub.WebSocketHandler)
+	mux.HandleFunc("GET /presence", hub.PresenceHandler)
+	mux.HandleFunc("PUT /presence/settings", hub.PresenceSettingsHandler)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	request := func(method, path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	presences := func(token string) []ws.Presence {
+		w := request(http.MethodGet, "/presence?user_ids=1,2", token, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var body struct {
+			Presence []ws.Presence `json:"presence"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Presence
+	}
+
+	conn := dialUser(t, url, "1:1m")
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+	assert.Equal(t, presence.StatusOnline, presences("2:1m")[0].Status)
+	assert.Equal(t, presence.StatusOffline, presences("2:1m")[1].Status)
+
+	assert.Equal(t, http.StatusOK, request(http.MethodPut, "/presence/settings", "1:1m", `{"hide_last_seen":true}`).Code)
+	conn.Close()
+	assert.True(t, test.Eventually(func() bool { return presences("2:1m")[0].Status == presence.StatusOffline }))
+	assert.Nil(t, presences("2:1m")[0].LastSeen)
+	assert.NotNil(t, presences("1:1m")[0].LastSeen)
+
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodGet, "/presence?user_ids=1", "", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodGet, "/presence?user_ids=1,x", "2:1m", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, "/presence/settings", "1:1m", `{}`).Code)
+}
+
+// TestPresenceAcrossDevices checks that a user stays online while any of
+// their devices is, and goes away once all of them are
+func TestPresenceAcrossDevices(t *testing.T) {
+	hub := startHub(presenceOptions())
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	subscriber := dialUser(t, url, "2:1m")
+	defer subscriber.Close()
+	assert.NoError(t, subscriber.WriteJSON(ws.ClientFrame{Type: ws.FrameTypePresenceSubscribe, UserIDs: []string{"1"}}))
+	assert.True(t, test.Eventually(func() bool { return hub.SubscriberCount("1") == 1 }))
+
+	phone := dialUser(t, url, "1:1m")
+	defer phone.Close()
+	assert.Equal(t, presence.StatusOnline, readPresence(t, subscriber).Status)
+	laptop := dialUser(t, url, "1:1m")
+	defer laptop.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 2 }))
+
+	status := func() string {
+		presences, err := hub.Presences(context.Background(), "2", []string{"1"})
+		assert.NoError(t, err)
+		return presences[0].Status
+	}
+
+	// The laptop is still in use, so the phone going idle announces
+	// nothing: the next change the subscriber sees is the laptop's
+	assert.NoError(t, phone.WriteJSON(ws.ClientFrame{Type: ws.FrameTypePresence, Status: presence.StatusAway}))
+	assert.Equal(t, presence.StatusOnline, status())
+	assert.NoError(t, laptop.WriteJSON(ws.ClientFrame{Type: ws.FrameTypePresence, Status: presence.StatusAway}))
+	assert.Equal(t, presence.StatusAway, readPresence(t, subscriber).Status)
+
+	// Closing the away laptop leaves the away phone
+	laptop.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+	assert.Equal(t, presence.StatusAway, status())
+
+	assert.NoError(t, phone.WriteJSON(ws.ClientFrame{Type: ws.FrameTypePresence, Status: presence.StatusOnline}))
+	assert.Equal(t, presence.StatusOnline, readPresence(t, subscriber).Status)
+}
+
+// TestPresenceHiddenFromStrangers checks that users who share no
+// conversation see each other offline and never seen
+func TestPresenceHiddenFromStrangers(t *testing.T) {
+	hub := startHub(presenceOptions())
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	presences, err := hub.Presences(context.Background(), "3", []string{"1", "3"})
+	assert.NoError(t, err)
+	assert.Equal(t, ws.Presence{UserID: "1", Status: presence.StatusOffline}, presences[0])
+
+	conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 0 }))
+	assert.True(t, test.Eventually(func() bool {
+		presences, err := hub.Presences(context.Background(), "2", []string{"1"})
+		return err == nil && presences[0].LastSeen != nil
+	}))
+	presences, err = hub.Presences(context.Background(), "3", []string{"1"})
+	assert.NoError(t, err)
+	assert.Equal(t, ws.Presence{UserID: "1", Status: presence.StatusOffline}, presences[0])
+}
@@ -0,0 +1,39 @@
+package websocket
+
+import (
+	"testing"
+
+	"notification-service/test"
+	ws "notification-service/websocket"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReceiptFramesAreRecorded checks that delivered and read frames are
+// forwarded on behalf of the connected user, and incomplete ones dropped
+func TestReceiptFramesAreRecorded(t *testing.T) {
+	receipts := &test.MockReceipts{}
+	hub := startHub(ws.Options{Receipts: receipts})
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 1 }))
+
+	frames := []ws.ClientFrame{
+		{Type: ws.FrameTypeDelivered, ConversationID: 7, MessageID: 40},
+		{Type: ws.FrameTypeRead, ConversationID: 7},
+		{Type: ws.FrameTypeRead, ConversationID: 7, MessageID: 42},
+	}
+	for _, frame := range frames {
+		assert.NoError(t, conn.WriteJSON(frame))
+	}
+
+	expected := []test.Receipt{
+		{Status: "delivered", UserID: "1", ConversationID: 7, MessageID: 40},
+		{Status: "read", UserID: "1", ConversationID: 7, MessageID: 42},
+	}
+	assert.True(t, test.Eventually(func() bool { return len(receipts.Receipts()) == len(expected) }))
+	assert.Equal(t, expected, receipts.Receipts())
+}
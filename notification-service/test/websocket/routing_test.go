@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"notification-service/routing"
+	"notification-service/store"
+	"notification-service/test"
+	ws "notification-service/websocket"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// startInstances starts hubs sharing a store, registry and relay, as
+// separate replicas would
+func startInstances(t *testing.T, options ws.Options, instanceIDs ...string) []*ws.Hub {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	options.Store = store.NewMemoryStore(time.Hour, 1000)
+	options.Registry = routing.NewMemoryRegistry(time.Minute)
+	relay := routing.NewMemoryRelay()
+	options.Relay = relay
+	signalRelay := routing.NewMemoryRelay()
+	options.SignalRelay = signalRelay
+
+	var hubs []*ws.Hub
+	for _, instanceID := range instanceIDs {
+		options.InstanceID = instanceID
+		hub := startHub(options)
+		go relay.Subscribe(ctx, instanceID, hub.HandleEvent)
+		go signalRelay.Subscribe(ctx, instanceID, hub.HandleEvent)
+		hubs = append(hubs, hub)
+	}
+	return hubs
+}
+
+// TestCrossInstanceDelivery checks that a message consumed by one instance
+// reaches the user connected to another
+func TestCrossInstanceDelivery(t *testing.T) {
+	hubs := startInstances(t, ws.Options{}, "a", "b")
+	server, url := test.StartServer(hubs[1].WebSocketHandler)
+	defer server.Close()
+
+	conn := dialUser(t, url, "1:1m")
+	defer conn.Close()
+	assert.True(t, test.Eventually(func() bool { return hubs[1].ConnectionCount("1") == 1 }))
+
+	assert.NoError(t, hubs[0].AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("hello")}))
+	assert.Equal(t, "hello", readText(t, conn))
+}
+
+// TestCrossInstanceAck checks that an acknowledgement on one instance stops
+// the redelivery to the user's devices on another
+func TestCrossInstanceAck(t *testing.T) {
+	hubs := startInstances(t, ws.Options{AckTimeout: 100 * time.Millisecond}, "a", "b")
+	serverA, urlA := test.StartServer(hubs[0].WebSocketHandler)
+	defer serverA.Close()
+	serverB, urlB := test.StartServer(hubs[1].WebSocketHandler)
+	defer serverB.Close()
+
+	phone := dialUser(t, urlA, "1:1m")
+	defer phone.Close()
+	laptop := dialUser(t, urlB, "1:1m")
+	defer laptop.Close()
+	assert.True(t, test.Eventually(func() bool {
+		return hubs[0].ConnectionCount("1") == 1 && hubs[1].ConnectionCount("1") == 1
+	}))
+
+	assert.NoError(t, hubs[0].AddMessage(ws.KafkaMessage{Receiver: "1", Content: test.ChatEvent("hello")}))
+	frame := readFrame(t, laptop)
+	assert.Equal(t, frame, readFrame(t, phone))
+	assert.NoError(t, laptop.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeAck, ID: frame.ID}))
+
+	// The phone may see one redelivery that raced the ack, but no more
+	var redelivered int
+	phone.SetReadDeadline(time.Now().Add(600 * time.Millisecond))
+	for {
+		var next ws.ServerFrame
+		if err := phone.ReadJSON(&next); err != nil {
+			break
+		}
+		redelivered++
+	}
+	assert.LessOrEqual(t, redelivered, 1)
+}
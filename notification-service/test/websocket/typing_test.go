@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"notification-service/store"
+	"notification-service/test"
+	ws "notification-service/websocket"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+var typingOptions = ws.Options{
+	Conversations:  test.MockConversations{7: {"1", "2", "3"}},
+	TypingInterval: time.Minute,
+	TypingTTL:      time.Minute,
+}
+
+// readTyping reads a typing frame and returns who is typing
+func readTyping(t *testing.T, conn *websocket.Conn) string {
+	frame := readFrame(t, conn)
+	assert.Equal(t, ws.FrameTypeTyping, frame.Type)
+	var event struct {
+		ConversationID int64  `json:"conversation_id"`
+		UserID         string `json:"user_id"`
+	}
+	assert.NoError(t, json.Unmarshal(frame.Event, &event))
+	assert.Equal(t, int64(7), event.ConversationID)
+	return event.UserID
+}
+
+// assertSilent checks that nothing arrives on the connection for a while
+func assertSilent(t *testing.T, conn *websocket.Conn) {
+	var frame ws.ServerFrame
+	conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+	assert.Error(t, conn.ReadJSON(&frame))
+}
+
+// TestTypingRelayedToParticipants checks that typing frames reach the other
+// participants once per interval, without being stored or echoed
+func TestTypingRelayedToParticipants(t *testing.T) {
+	options := typingOptions
+	options.Store = store.NewMemoryStore(time.Hour, 100)
+	hub := startHub(options)
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	typist := dialUser(t, url, "1:1m")
+	defer typist.Close()
+	otherDevice := dialUser(t, url, "1:1m")
+	defer otherDevice.Close()
+	reader := dialUser(t, url, "2:1m")
+	defer reader.Close()
+	outsider := dialUser(t, url, "4:1m")
+	defer outsider.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("1") == 2 && hub.ConnectionCount("4") == 1 }))
+
+	assert.NoError(t, typist.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeTyping, ConversationID: 7}))
+	assert.NoError(t, typist.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeTyping, ConversationID: 7}))
+	assert.Equal(t, "1", readTyping(t, reader))
+	assertSilent(t, reader)
+	assertSilent(t, otherDevice)
+	assertSilent(t, outsider)
+
+	// Outsiders can't signal to the conversation
+	assert.NoError(t, outsider.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeTyping, ConversationID: 7}))
+	assertSilent(t, reader)
+
+	pending, err := options.Store.Pending(context.Background(), "2", 0, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+// TestExpiredTypingIsDropped checks that signals expiring before they are
+// written never reach the client
+func TestExpiredTypingIsDropped(t *testing.T) {
+	options := typingOptions
+	options.TypingTTL = -time.Second
+	hub := startHub(options)
+	server, url := test.StartServer(hub.WebSocketHandler)
+	defer server.Close()
+
+	typist := dialUser(t, url, "1:1m")
+	defer typist.Close()
+	reader := dialUser(t, url, "2:1m")
+	defer reader.Close()
+	assert.True(t, test.Eventually(func() bool { return hub.ConnectionCount("2") == 1 }))
+
+	assert.NoError(t, typist.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeTyping, ConversationID: 7}))
+	assertSilent(t, reader)
+}
+
+// TestCrossInstanceTyping checks that typing frames reach participants
+// connected to another instance
+func TestCrossInstanceTyping(t *testing.T) {
+	hubs := startInstances(t, typingOptions, "a", "b")
+	serverA, urlA := test.StartServer(hubs[0].WebSocketHandler)
+	defer serverA.Close()
+	serverB, urlB := test.StartServer(hubs[1].WebSocketHandler)
+	defer serverB.Close()
+
+	typist := dialUser(t, urlA, "1:1m")
+	defer typist.Close()
+	reader := dialUser(t, urlB, "3:1m")
+	defer reader.Close()
+	assert.True(t, test.Eventually(func() bool {
+		return hubs[0].ConnectionCount("1") == 1 && hubs[1].ConnectionCount("3") == 1
+	}))
+
+	assert.NoError(t, typist.WriteJSON(ws.ClientFrame{Type: ws.FrameTypeTyping, ConversationID: 7}))
+	assert.Equal(t, "1", readTyping(t, reader))
+}
@@ -0,0 +1,66 @@
+package websocket
+
+import (
+	"errors"
+	"net/http"
+	"notification-service/auth"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tokenSubprotocol is the Sec-WebSocket-Protocol value announcing that the
+// next offered protocol is an access token, as browsers can't set headers
+const tokenSubprotocol = "access_token"
+
+// CloseTokenExpired is sent when the access token expires without the
+// client re-authenticating in-band
+const CloseTokenExpired = 4001
+
+var errUnauthorized = errors.New("unauthorized")
+
+// TokenVerifier validates access tokens presented by WebSocket clients
+type TokenVerifier interface {
+	Verify(token string) (*auth.Claims, error)
+}
+
+// handshakeToken extracts an access token from the Authorization header or
+// the Sec-WebSocket-Protocol header. The returned subprotocol must be echoed
+// back to the client when the token came from the latter.
+func handshakeToken(r *http.Request) (token string, subprotocol string) {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer "), ""
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == tokenSubprotocol {
+			return protocols[i+1], tokenSubprotocol
+		}
+	}
+	return "", ""
+}
+
+// authenticateFirstFrame waits for an auth frame as the first client message
+func (h *Hub) authenticateFirstFrame(conn *websocket.Conn) (*auth.Claims, error) {
+	conn.SetReadDeadline(time.Now().Add(h.options.AuthTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	frame, err := parseClientFrame(data)
+	if err != nil || frame.Type != FrameTypeAuth {
+		return nil, errUnauthorized
+	}
+	return h.verifier.Verify(frame.Token)
+}
+
+// closeWithCode sends a close frame and closes the connection
+func closeWithCode(conn *websocket.Conn, code int, reason string) {
+	message := websocket.FormatCloseMessage(code, reason)
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	conn.Close()
+}
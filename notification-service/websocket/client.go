@@ -0,0 +1,456 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"notification-service/presence"
+	"notification-service/routing"
+	"notification-service/store"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// OverflowPolicy decides what happens when a client's send queue is full
+type OverflowPolicy string
+
+const (
+	// OverflowDropOldest discards the oldest queued message to make room
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDisconnect closes the connection of the slow client
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowSpill leaves the message in the pending store for redelivery
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+func ParseOverflowPolicy(value string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(value); policy {
+	case OverflowDropOldest, OverflowDisconnect, OverflowSpill:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q", value)
+	}
+}
+
+type Client struct {
+	ID     string // Identifies one of possibly several connections of a user
+	UserID string
+	Conn   *websocket.Conn
+	expiry *time.Timer // Closes the connection once the access token expires
+
+	send        chan store.Message // Bounded queue drained by the write pump
+	mu          sync.Mutex         // Serializes enqueueing and closing of `send`, protects `inflight`
+	closed      bool
+	closeReason string              // Why the hub closed the connection, if it did
+	inflight    map[int64]*delivery // Unacknowledged messages by ID
+	evict       chan struct{}       // Asks the write pump to close the connection of a slow consumer
+
+	signals      chan routing.Signal // Ephemeral signals, dropped when the queue is full
+	typingSentAt map[int64]time.Time // Last typing signal by conversation, used by the read loop only
+	subscribed   map[string]bool     // Users whose presence changes are sent, protected by `mu`
+	status       string              // Reported by the device, online or away; protected by `mu`
+}
+
+func newClient(id, userID string, conn *websocket.Conn, bufferSize int) *Client {
+	return &Client{
+		ID:       id,
+		UserID:   userID,
+		Conn:     conn,
+		send:     make(chan store.Message, bufferSize),
+		inflight: make(map[int64]*delivery),
+		evict:    make(chan struct{}, 1),
+
+		signals:      make(chan routing.Signal, signalBufferSize),
+		typingSentAt: make(map[int64]time.Time),
+		status:       presence.StatusOnline,
+	}
+}
+
+// replayBatchSize is the number of pending messages read from the store at once
+const replayBatchSize = 100
+
+// signalBufferSize is the number of ephemeral signals queued per connection
+const signalBufferSize = 16
+
+// delivery tracks a message queued or sent to the connection until it is acknowledged
+type delivery struct {
+	message  store.Message
+	attempts int       // Redeliveries so far
+	due      time.Time // When the message is sent again unless acknowledged
+}
+
+// writePump is the only goroutine writing data frames to the connection. It
+// first replays the messages the user hasn't acknowledged yet, then sends
+// queued messages, redeliveries and heartbeat pings.
+func (c *Client) writePump(options Options) {
+	ticker := time.NewTicker(options.PingInterval)
+	retries := time.NewTicker(options.AckTimeout / 2)
+	defer func() {
+		ticker.Stop()
+		retries.Stop()
+		c.Conn.Close()
+	}()
+
+	if err := c.replay(options); err != nil {
+		c.setCloseReason(fmt.Sprintf("replay failed: %v", err))
+		return
+	}
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			if !ok {
+				return
+			}
+			if err := c.write(message, options.WriteTimeout); err != nil {
+				c.setCloseReason(fmt.Sprintf("write failed: %v", err))
+				return
+			}
+			log.Printf("Sent message %d to user %s (connection %s)", message.ID, c.UserID, c.ID)
+		case signal := <-c.signals:
+			if time.Now().After(signal.ExpiresAt) {
+				continue
+			}
+			if err := c.writeSignal(signal, options.WriteTimeout); err != nil {
+				c.setCloseReason(fmt.Sprintf("write failed: %v", err))
+				return
+			}
+		case <-retries.C:
+			for _, message := range c.due(options.AckTimeout, options.MaxRetryInterval) {
+				if err := c.write(message, options.WriteTimeout); err != nil {
+					c.setCloseReason(fmt.Sprintf("write failed: %v", err))
+					return
+				}
+				log.Printf("Redelivered message %d to user %s (connection %s)", message.ID, c.UserID, c.ID)
+			}
+		case <-c.evict:
+			closeWithCode(c.Conn, websocket.CloseTryAgainLater, "slow consumer")
+			return
+		case <-ticker.C:
+			if err := c.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(options.WriteTimeout)); err != nil {
+				c.setCloseReason(fmt.Sprintf("ping failed: %v", err))
+				return
+			}
+		}
+	}
+}
+
+func (c *Client) write(message store.Message, writeTimeout time.Duration) error {
+	c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.Conn.WriteJSON(ServerFrame{
+		Type:  FrameTypeMessage,
+		ID:    message.ID,
+		Seq:   message.Seq,
+		Event: json.RawMessage(message.Content),
+	})
+}
+
+func (c *Client) writeSignal(signal routing.Signal, writeTimeout time.Duration) error {
+	c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.Conn.WriteJSON(ServerFrame{Type: signal.Type, Event: signal.Event})
+}
+
+// replay writes the user's unacknowledged messages oldest first, skipping
+// those that already reached the send queue
+func (c *Client) replay(options Options) error {
+	replayed := 0
+	defer func() {
+		if replayed > 0 {
+			log.Printf("Replayed %d pending messages to user %s (connection %s)", replayed, c.UserID, c.ID)
+		}
+	}()
+
+	var afterID int64
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), options.WriteTimeout)
+		messages, err := options.Store.Pending(ctx, c.UserID, afterID, replayBatchSize)
+		cancel()
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		for _, message := range messages {
+			afterID = message.ID
+			tracked, full := c.track(message, options)
+			if full {
+				// The rest is replayed by the next connection
+				log.Printf("Stopped replay to user %s (connection %s) at %d unacknowledged messages", c.UserID, c.ID, options.MaxInflight)
+				return nil
+			}
+			if !tracked {
+				continue
+			}
+			if err := c.write(message, options.WriteTimeout); err != nil {
+				return err
+			}
+			replayed++
+		}
+	}
+}
+
+// track starts waiting for the acknowledgement of the message. It reports
+// false if the message is already being tracked, and whether the limit of
+// unacknowledged messages left no room for it.
+func (c *Client) track(message store.Message, options Options) (tracked, full bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, tracked := c.inflight[message.ID]; tracked {
+		return false, false
+	}
+	if options.MaxInflight > 0 && len(c.inflight) >= options.MaxInflight {
+		return false, true
+	}
+	c.inflight[message.ID] = &delivery{message: message, due: time.Now().Add(options.AckTimeout)}
+	return true, false
+}
+
+// due returns the unacknowledged messages whose redelivery is due, oldest
+// first, and backs off their next attempt exponentially
+func (c *Client) due(ackTimeout, maxRetryInterval time.Duration) []store.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var messages []store.Message
+	for _, delivery := range c.inflight {
+		if now.Before(delivery.due) {
+			continue
+		}
+		delivery.attempts++
+		delivery.due = now.Add(retryDelay(delivery.attempts, ackTimeout, maxRetryInterval))
+		messages = append(messages, delivery.message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Seq < messages[j].Seq })
+	return messages
+}
+
+// acked stops the redelivery of the message
+func (c *Client) acked(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inflight, id)
+}
+
+// retryDelay doubles the ack timeout with every attempt, up to the maximum
+func retryDelay(attempts int, ackTimeout, maxRetryInterval time.Duration) time.Duration {
+	if attempts > 32 {
+		return maxRetryInterval
+	}
+	delay := ackTimeout << attempts
+	if delay <= 0 || delay > maxRetryInterval {
+		return maxRetryInterval
+	}
+	return delay
+}
+
+// extendReadDeadline keeps the connection alive for another pong timeout
+func (c *Client) extendReadDeadline(pongTimeout time.Duration) {
+	c.Conn.SetReadDeadline(time.Now().Add(pongTimeout))
+}
+
+// setCloseReason records the first reason the connection is being closed for
+func (c *Client) setCloseReason(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeReason == "" {
+		c.closeReason = reason
+	}
+}
+
+// disconnectReason explains why the read loop ended with the given error
+func (c *Client) disconnectReason(err error) string {
+	c.mu.Lock()
+	reason := c.closeReason
+	c.mu.Unlock()
+	if reason != "" {
+		return reason
+	}
+
+	var netErr net.Error
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "pong timeout"
+	case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+		return "closed by client"
+	default:
+		return fmt.Sprintf("read failed: %v", err)
+	}
+}
+
+// enqueue queues the message without blocking and tracks it until it is
+// acknowledged. When the queue is full, or the connection already has the
+// maximum of unacknowledged messages, the overflow policy applies. Messages
+// left out of the queue are redelivered once their ack timeout passes, those
+// left untracked by the replay of the user's next connection. The returned
+// value reports whether the message was queued.
+func (c *Client) enqueue(message store.Message, options Options) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	if _, tracked := c.inflight[message.ID]; tracked {
+		// Already sent by the replay
+		return true
+	}
+
+	if options.MaxInflight > 0 && len(c.inflight) >= options.MaxInflight {
+		switch options.OverflowPolicy {
+		case OverflowDropOldest:
+			oldest := c.oldestInflight()
+			delete(c.inflight, oldest)
+			log.Printf("User %s (connection %s) has too many unacknowledged messages, forgetting oldest message %d", c.UserID, c.ID, oldest)
+		case OverflowSpill:
+			log.Printf("User %s (connection %s) has too many unacknowledged messages, postponing message %d", c.UserID, c.ID, message.ID)
+			return false
+		default:
+			c.evictSlow("too many unacknowledged messages")
+			return false
+		}
+	}
+	c.inflight[message.ID] = &delivery{message: message, due: time.Now().Add(options.AckTimeout)}
+
+	select {
+	case c.send <- message:
+		return true
+	default:
+	}
+
+	switch options.OverflowPolicy {
+	case OverflowDropOldest:
+		select {
+		case dropped := <-c.send:
+			log.Printf("Send queue of user %s (connection %s) is full, postponing oldest message %d", c.UserID, c.ID, dropped.ID)
+		default:
+		}
+		c.send <- message
+		return true
+	case OverflowSpill:
+		log.Printf("Send queue of user %s (connection %s) is full, postponing message %d", c.UserID, c.ID, message.ID)
+		return false
+	default:
+		c.evictSlow("send queue overflow")
+		return false
+	}
+}
+
+// oldestInflight returns the ID of the earliest unacknowledged message. The
+// caller holds `mu`.
+func (c *Client) oldestInflight() int64 {
+	var oldest *delivery
+	for _, delivery := range c.inflight {
+		if oldest == nil || delivery.message.Seq < oldest.message.Seq {
+			oldest = delivery
+		}
+	}
+	return oldest.message.ID
+}
+
+// evictSlow asks the write pump to close the connection of a slow consumer. The
+// close frame is sent by the write pump, which may block on a slow socket;
+// the hub must not. The caller holds `mu`.
+func (c *Client) evictSlow(reason string) {
+	if c.closeReason == "" {
+		c.closeReason = reason
+	}
+	select {
+	case c.evict <- struct{}{}:
+	default:
+	}
+}
+
+// signal queues the ephemeral signal without blocking. Signals are lossy, so
+// one that doesn't fit in the queue is dropped.
+func (c *Client) signal(signal routing.Signal) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	select {
+	case c.signals <- signal:
+	default:
+		log.Printf("Signal queue of user %s (connection %s) is full, dropping %s signal", c.UserID, c.ID, signal.Type)
+	}
+}
+
+// reportedStatus returns the status the device last reported
+func (c *Client) reportedStatus() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+func (c *Client) setReportedStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status = status
+}
+
+// maxPresenceSubscriptions bounds the users a connection follows the
+// presence of, further ones are ignored
+const maxPresenceSubscriptions = 500
+
+// subscribePresence replaces the users whose presence changes are sent
+func (c *Client) subscribePresence(userIDs []string) {
+	if len(userIDs) > maxPresenceSubscriptions {
+		log.Printf("User %s subscribed to %d users, keeping the first %d", c.UserID, len(userIDs), maxPresenceSubscriptions)
+		userIDs = userIDs[:maxPresenceSubscriptions]
+	}
+	subscribed := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		subscribed[userID] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscribed = subscribed
+}
+
+func (c *Client) subscribedTo(userID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscribed[userID]
+}
+
+// maxTypingConversations bounds the conversations whose last typing signal
+// a connection remembers. Once reached stale entries are pruned, and typing
+// in further conversations is refused until some become stale.
+const maxTypingConversations = 64
+
+// allowTyping reports whether a typing signal for the conversation may be
+// relayed, allowing one per interval. Only called by the read loop.
+func (c *Client) allowTyping(conversationID int64, interval time.Duration) bool {
+	now := time.Now()
+	if sentAt, ok := c.typingSentAt[conversationID]; ok && now.Sub(sentAt) < interval {
+		return false
+	}
+	if len(c.typingSentAt) >= maxTypingConversations {
+		for id, sentAt := range c.typingSentAt {
+			if now.Sub(sentAt) >= interval {
+				delete(c.typingSentAt, id)
+			}
+		}
+		if len(c.typingSentAt) >= maxTypingConversations {
+			return false
+		}
+	}
+	c.typingSentAt[conversationID] = now
+	return true
+}
+
+// close stops the write pump once the queued messages are flushed
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
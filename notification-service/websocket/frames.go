@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"encoding/json"
+)
+
+// Types of frames a client can send over an established connection
+const (
+	FrameTypeAuth = "auth"
+	// FrameTypeAck confirms that the message with the given ID was received
+	FrameTypeAck = "ack"
+	// FrameTypeDelivered reports that every message of the conversation up
+	// to the given one reached this device
+	FrameTypeDelivered = "delivered"
+	// FrameTypeRead reports that the user read every message of the
+	// conversation up to the given one
+	FrameTypeRead = "read"
+	// FrameTypeTyping reports that the user is typing in the conversation.
+	// Other participants receive it as an ephemeral frame whose event holds
+	// conversation_id, user_id and expires_at, after which the indicator
+	// should be hidden unless another one arrived.
+	FrameTypeTyping = "typing"
+	// FrameTypePresence reports the status of the user, online or away,
+	// e.g. when the app goes idle. Subscribers receive it as an ephemeral
+	// frame whose event holds user_id, status and last_seen.
+	FrameTypePresence = "presence"
+	// FrameTypePresenceSubscribe replaces the users whose presence changes
+	// the connection receives. Only changes of users sharing a conversation
+	// with the subscriber are sent; the current presence is fetched from
+	// GET /presence.
+	FrameTypePresenceSubscribe = "presence_subscribe"
+)
+
+// Types of frames the server sends
+const (
+	FrameTypeMessage = "message"
+)
+
+// ClientFrame is a JSON message sent by a client
+type ClientFrame struct {
+	Type  string `json:"type"`
+	Token string `json:"token,omitempty"`
+	ID    int64  `json:"id,omitempty"`
+	// Set on receipts, naming a message stored by message-service, and on
+	// typing frames
+	ConversationID int64 `json:"conversation_id,omitempty"`
+	MessageID      int64 `json:"message_id,omitempty"`
+	// Set on presence frames
+	Status string `json:"status,omitempty"`
+	// Set on presence subscriptions
+	UserIDs []string `json:"user_ids,omitempty"`
+}
+
+// ServerFrame is a JSON message sent to a client, carrying the JSON mapping
+// of the event envelope. Messages are redelivered until acknowledged, so
+// clients should drop those whose sequence number they have already seen.
+// Ephemeral frames, such as typing indicators, have neither ID nor sequence
+// number and are never acknowledged.
+type ServerFrame struct {
+	Type  string          `json:"type"`
+	ID    int64           `json:"id"`
+	Seq   int64           `json:"seq"`
+	Event json.RawMessage `json:"event"`
+}
+
+func parseClientFrame(data []byte) (*ClientFrame, error) {
+	var frame ClientFrame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return nil, err
+	}
+	return &frame, nil
+}
@@ -0,0 +1,304 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"notification-service/presence"
+	"notification-service/routing"
+	"time"
+)
+
+// presenceSignalTTL is how long a presence change may take to reach the
+// subscribers before it is dropped
+const presenceSignalTTL = 30 * time.Second
+
+// Presence is a user's presence as shown to other users
+type Presence struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+	// LastSeen is set for offline users that were seen before, unless they
+	// hide it
+	LastSeen *time.Time `json:"last_seen,omitempty"`
+}
+
+// Presences returns the presence of the users as the viewer may see it.
+// Only the viewer's contacts and the viewer themself are shown; everyone
+// else appears offline and never seen. An empty viewer ID sees everyone.
+func (h *Hub) Presences(ctx context.Context, viewerID string, userIDs []string) ([]Presence, error) {
+	visible, err := h.visibleUsers(ctx, viewerID, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	records, err := h.options.Presence.Get(ctx, visible...)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := h.statuses(ctx, visible)
+	if err != nil {
+		return nil, err
+	}
+
+	shown := make(map[string]bool, len(visible))
+	for _, userID := range visible {
+		shown[userID] = true
+	}
+	presences := make([]Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if !shown[userID] {
+			presences = append(presences, Presence{UserID: userID, Status: presence.StatusOffline})
+			continue
+		}
+		record, ok := records[userID]
+		if !ok {
+			record = presence.Record{UserID: userID}
+		}
+		presences = append(presences, toPresence(record, statuses[userID], viewerID == userID))
+	}
+	return presences, nil
+}
+
+// visibleUsers returns the users whose presence the viewer may see
+func (h *Hub) visibleUsers(ctx context.Context, viewerID string, userIDs []string) ([]string, error) {
+	if viewerID == "" {
+		return userIDs, nil
+	}
+	allowed := map[string]bool{viewerID: true}
+	if h.options.Conversations != nil {
+		contacts, err := h.options.Conversations.Contacts(ctx, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		for _, contact := range contacts {
+			allowed[contact] = true
+		}
+	}
+
+	visible := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if allowed[userID] {
+			visible = append(visible, userID)
+		}
+	}
+	return visible, nil
+}
+
+// toPresence derives the presence shown to a viewer from the stored record
+// and the status of the user's connections, empty if there are none
+func toPresence(record presence.Record, status string, own bool) Presence {
+	if status != "" {
+		return Presence{UserID: record.UserID, Status: status}
+	}
+	result := Presence{UserID: record.UserID, Status: presence.StatusOffline}
+	if !record.LastSeen.IsZero() && (own || !record.HideLastSeen) {
+		lastSeen := record.LastSeen
+		result.LastSeen = &lastSeen
+	}
+	return result
+}
+
+// statuses returns the status of the users connected to any instance,
+// leaving out those without connections
+func (h *Hub) statuses(ctx context.Context, userIDs []string) (map[string]string, error) {
+	if h.routed() {
+		return h.options.Registry.Statuses(ctx, userIDs...)
+	}
+	statuses := make(map[string]string, len(userIDs))
+	for _, userID := range userIDs {
+		if status := h.localStatus(userID, nil); status != presence.StatusOffline {
+			statuses[userID] = status
+		}
+	}
+	return statuses, nil
+}
+
+// localStatus combines the statuses of the user's connections to this
+// instance, including the given client even if it isn't registered yet:
+// online if any of them is, away if all are, offline if there are none
+func (h *Hub) localStatus(userID string, client *Client) string {
+	clients := h.connections(userID)
+	if client != nil {
+		clients = append(clients, client)
+	}
+	if len(clients) == 0 {
+		return presence.StatusOffline
+	}
+	for _, connection := range clients {
+		if connection.reportedStatus() == presence.StatusOnline {
+			return presence.StatusOnline
+		}
+	}
+	return presence.StatusAway
+}
+
+// storeStatus records the combined status of the user's connections to this
+// instance, so that other instances see it
+func (h *Hub) storeStatus(ctx context.Context, userID string, client *Client) error {
+	if !h.routed() {
+		return nil
+	}
+	status := h.localStatus(userID, client)
+	if status == presence.StatusOffline {
+		return nil
+	}
+	return h.options.Registry.SetStatus(ctx, h.options.InstanceID, userID, status)
+}
+
+// connectedAnywhere reports whether the user has connections on any instance
+func (h *Hub) connectedAnywhere(ctx context.Context, userID string) (bool, error) {
+	statuses, err := h.statuses(ctx, []string{userID})
+	return statuses[userID] != "", err
+}
+
+// currentStatus returns the status other users currently see, offline if
+// it can't be told
+func (h *Hub) currentStatus(userID string) string {
+	if h.options.Presence == nil {
+		return presence.StatusOffline
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	statuses, err := h.statuses(ctx, []string{userID})
+	if err != nil {
+		log.Printf("Failed to look up presence of user %s: %v", userID, err)
+		return presence.StatusOffline
+	}
+	if status, ok := statuses[userID]; ok {
+		return status
+	}
+	return presence.StatusOffline
+}
+
+// userConnected marks the user online, announcing it unless the user
+// already was online. A new connection is online, so the user is as well.
+func (h *Hub) userConnected(client *Client, previous string) {
+	if h.options.Presence == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	if err := h.storeStatus(ctx, client.UserID, client); err != nil {
+		log.Printf("Failed to store presence of user %s: %v", client.UserID, err)
+		return
+	}
+	h.seen(ctx, []string{client.UserID})
+	if previous != presence.StatusOnline {
+		go h.publishPresence(Presence{UserID: client.UserID, Status: presence.StatusOnline})
+	}
+}
+
+// connectionClosed updates the user's status after one of several
+// connections closed, announcing it if it changed
+func (h *Hub) connectionClosed(userID, previous string) {
+	if h.options.Presence == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	if err := h.storeStatus(ctx, userID, nil); err != nil {
+		log.Printf("Failed to store presence of user %s: %v", userID, err)
+		return
+	}
+	if current := h.currentStatus(userID); current != previous && current != presence.StatusOffline {
+		go h.publishPresence(Presence{UserID: userID, Status: current})
+	}
+}
+
+// userDisconnected marks the user offline once no instance holds any of
+// their connections
+func (h *Hub) userDisconnected(userID string) {
+	if h.options.Presence == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	connected, err := h.connectedAnywhere(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to look up connections of user %s: %v", userID, err)
+		return
+	}
+	if connected {
+		return
+	}
+
+	now := time.Now()
+	if err := h.options.Presence.Seen(ctx, now, userID); err != nil {
+		log.Printf("Failed to store last-seen time of user %s: %v", userID, err)
+	}
+	records, err := h.options.Presence.Get(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to look up presence of user %s: %v", userID, err)
+		return
+	}
+	record, ok := records[userID]
+	if !ok {
+		record = presence.Record{UserID: userID, LastSeen: now}
+	}
+	go h.publishPresence(toPresence(record, "", false))
+}
+
+// reportStatus records the status reported by one of the client's devices.
+// The user is shown online as long as any of their devices is.
+func (h *Hub) reportStatus(client *Client, status string) {
+	if h.options.Presence == nil {
+		return
+	}
+	if status != presence.StatusOnline && status != presence.StatusAway {
+		log.Printf("Ignoring presence frame with status %q from user %s", status, client.UserID)
+		return
+	}
+
+	previous := h.currentStatus(client.UserID)
+	client.setReportedStatus(status)
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	if err := h.storeStatus(ctx, client.UserID, client); err != nil {
+		log.Printf("Failed to store presence of user %s: %v", client.UserID, err)
+		return
+	}
+	if current := h.currentStatus(client.UserID); current != previous {
+		go h.publishPresence(Presence{UserID: client.UserID, Status: current})
+	}
+}
+
+// seen records that the users are connected right now
+func (h *Hub) seen(ctx context.Context, userIDs []string) {
+	if h.options.Presence == nil {
+		return
+	}
+	if err := h.options.Presence.Seen(ctx, time.Now(), userIDs...); err != nil {
+		log.Printf("Failed to store last-seen times of %d users: %v", len(userIDs), err)
+	}
+}
+
+// publishPresence sends the presence change to the user's contacts, whose
+// connections pass it on if subscribed to the user. Like typing frames,
+// presence changes are never stored.
+func (h *Hub) publishPresence(change Presence) {
+	if h.options.Conversations == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	contacts, err := h.options.Conversations.Contacts(ctx, change.UserID)
+	if err != nil {
+		log.Printf("Failed to look up contacts of user %s: %v", change.UserID, err)
+		return
+	}
+
+	event, err := json.Marshal(change)
+	if err != nil {
+		log.Printf("Failed to serialize presence event: %v", err)
+		return
+	}
+	expiresAt := time.Now().Add(presenceSignalTTL)
+	for _, contact := range contacts {
+		h.sendSignal(routing.Signal{
+			UserID:    contact,
+			About:     change.UserID,
+			Type:      FrameTypePresence,
+			Event:     event,
+			ExpiresAt: expiresAt,
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxPresenceQuery is the largest number of users asked for at once
+const maxPresenceQuery = 100
+
+type presenceResponse struct {
+	Presence []Presence `json:"presence"`
+}
+
+type presenceSettings struct {
+	HideLastSeen *bool `json:"hide_last_seen"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// PresenceHandler serves GET /presence?user_ids=1,2 to callers presenting
+// an access token as a bearer header
+func (h *Hub) PresenceHandler(w http.ResponseWriter, r *http.Request) {
+	viewerID, ok := h.authenticateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	userIDs, ok := parseUserIDs(r.URL.Query().Get("user_ids"))
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"user_ids must list 1 to 100 positive integers separated by commas"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.options.WriteTimeout)
+	defer cancel()
+	presences, err := h.Presences(ctx, viewerID, userIDs)
+	if err != nil {
+		log.Printf("Failed to look up presence for user %s: %v", viewerID, err)
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{"presence temporarily unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, presenceResponse{Presence: presences})
+}
+
+// PresenceSettingsHandler serves PUT /presence/settings, letting the caller
+// hide their last-seen time from other users
+func (h *Hub) PresenceSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.authenticateRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var settings presenceSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil || settings.HideLastSeen == nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{"hide_last_seen must be a boolean"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.options.WriteTimeout)
+	defer cancel()
+	if err := h.options.Presence.SetHideLastSeen(ctx, userID, *settings.HideLastSeen); err != nil {
+		log.Printf("Failed to store presence settings of user %s: %v", userID, err)
+		writeJSON(w, http.StatusServiceUnavailable, errorResponse{"presence temporarily unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// authenticateRequest returns the ID of the user presenting the bearer
+// token, answering with an error if there is none or it is invalid
+func (h *Hub) authenticateRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.options.Presence == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{"presence is disabled"})
+		return "", false
+	}
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{"missing bearer token"})
+		return "", false
+	}
+	claims, err := h.verifier.Verify(strings.TrimPrefix(header, "Bearer "))
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{"invalid token"})
+		return "", false
+	}
+	return claims.Subject(), true
+}
+
+// parseUserIDs splits a comma-separated list of user IDs, dropping duplicates
+func parseUserIDs(value string) ([]string, bool) {
+	if value == "" {
+		return nil, false
+	}
+	seen := make(map[string]bool)
+	var userIDs []string
+	for _, userID := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(userID), 10, 32)
+		if err != nil || id == 0 {
+			return nil, false
+		}
+		userID = strconv.FormatUint(id, 10)
+		if !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, len(userIDs) <= maxPresenceQuery
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
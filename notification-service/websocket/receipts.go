@@ -0,0 +1,36 @@
+package websocket
+
+import (
+	"context"
+	"log"
+)
+
+// ReceiptRecorder forwards delivered and read receipts to message-service,
+// which keeps the marks and tells the senders
+type ReceiptRecorder interface {
+	MarkDelivered(ctx context.Context, userID string, conversationID, messageID int64) error
+	MarkRead(ctx context.Context, userID string, conversationID, messageID int64) error
+}
+
+// receipt records a delivered or read frame of the client. Receipts are
+// handled in the read loop, so a client sending them faster than they are
+// recorded is slowed down instead of piling up requests.
+func (h *Hub) receipt(client *Client, frame *ClientFrame) {
+	if h.options.Receipts == nil {
+		return
+	}
+	if frame.ConversationID <= 0 || frame.MessageID <= 0 {
+		log.Printf("Ignoring %s receipt without conversation or message from user %s", frame.Type, client.UserID)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	record := h.options.Receipts.MarkDelivered
+	if frame.Type == FrameTypeRead {
+		record = h.options.Receipts.MarkRead
+	}
+	if err := record(ctx, client.UserID, frame.ConversationID, frame.MessageID); err != nil {
+		log.Printf("Failed to record %s receipt of message %d from user %s: %v", frame.Type, frame.MessageID, client.UserID, err)
+	}
+}
@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"notification-service/routing"
+	"notification-service/store"
+	"time"
+)
+
+// routed reports whether messages are routed across instances
+func (h *Hub) routed() bool {
+	return h.options.Registry != nil && h.options.Relay != nil
+}
+
+// registerUser records that the user has connections on this instance
+func (h *Hub) registerUser(userID string) {
+	if !h.routed() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	if err := h.options.Registry.Register(ctx, h.options.InstanceID, userID); err != nil {
+		log.Printf("Failed to register user %s on instance %s: %v", userID, h.options.InstanceID, err)
+	}
+}
+
+// unregisterUser removes the user from the registry after the last local
+// connection closed. A connection opened in the meantime registers again.
+func (h *Hub) unregisterUser(userID string) {
+	if !h.routed() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	if err := h.options.Registry.Unregister(ctx, h.options.InstanceID, userID); err != nil {
+		log.Printf("Failed to unregister user %s from instance %s: %v", userID, h.options.InstanceID, err)
+	}
+	if h.ConnectionCount(userID) > 0 {
+		h.registerUser(userID)
+	}
+}
+
+// RefreshRegistry keeps the registry entries of the connected users from
+// expiring until the context is cancelled
+func (h *Hub) RefreshRegistry(ctx context.Context, interval time.Duration) {
+	if !h.routed() {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.mu.RLock()
+			userIDs := make([]string, 0, len(h.clients))
+			for userID := range h.clients {
+				userIDs = append(userIDs, userID)
+			}
+			h.mu.RUnlock()
+
+			if err := h.options.Registry.Register(ctx, h.options.InstanceID, userIDs...); err != nil {
+				log.Printf("Failed to refresh registry of instance %s: %v", h.options.InstanceID, err)
+			}
+			h.seen(ctx, userIDs)
+		}
+	}
+}
+
+// relay sends the event to the other instances holding connections of the user
+func (h *Hub) relay(userID string, event routing.Event) {
+	relay := h.options.Relay
+	if event.Type == routing.EventSignal {
+		relay = h.options.SignalRelay
+	}
+	if !h.routed() || relay == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+
+	instances, err := h.options.Registry.Instances(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to look up instances of user %s: %v", userID, err)
+		return
+	}
+	for _, instanceID := range instances {
+		if instanceID == h.options.InstanceID {
+			continue
+		}
+		if err := relay.Publish(ctx, instanceID, event); err != nil {
+			log.Printf("Failed to relay %s of user %s to instance %s: %v", event.Type, userID, instanceID, err)
+		}
+	}
+}
+
+// HandleEvent processes an event relayed by another instance
+func (h *Hub) HandleEvent(event routing.Event) {
+	switch event.Type {
+	case routing.EventMessage:
+		h.broadcast <- event.Message
+	case routing.EventAck:
+		h.acked(event.Message.UserID, event.Message.ID)
+	case routing.EventSignal:
+		if event.Signal != nil {
+			h.deliverSignal(*event.Signal)
+		}
+	default:
+		log.Printf("Ignoring relayed event of unknown type %q", event.Type)
+	}
+}
+
+// acked stops the redelivery of the message to the user's local connections
+func (h *Hub) acked(userID string, id int64) {
+	for _, connection := range h.connections(userID) {
+		connection.acked(id)
+	}
+}
+
+// sendSignal hands the ephemeral signal to the receiver's connections, here
+// and on the other instances the receiver is connected to
+func (h *Hub) sendSignal(signal routing.Signal) {
+	h.deliverSignal(signal)
+	h.relay(signal.UserID, routing.Event{Type: routing.EventSignal, Signal: &signal})
+}
+
+// deliverSignal queues the signal for the receiver's local connections.
+// Signals about a user only go to connections subscribed to them.
+func (h *Hub) deliverSignal(signal routing.Signal) {
+	for _, connection := range h.connections(signal.UserID) {
+		if signal.About != "" && !connection.subscribedTo(signal.About) {
+			continue
+		}
+		connection.signal(signal)
+	}
+}
+
+func ackEvent(userID string, id int64) routing.Event {
+	return routing.Event{Type: routing.EventAck, Message: store.Message{ID: id, UserID: userID}}
+}
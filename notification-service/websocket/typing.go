@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"notification-service/routing"
+	"time"
+)
+
+// ConversationDirectory tells who takes part in a conversation
+type ConversationDirectory interface {
+	// Participants returns the user IDs of the conversation's participants,
+	// failing unless the user is one of them
+	Participants(ctx context.Context, userID string, conversationID int64) ([]string, error)
+	// Contacts returns the users sharing a conversation with the user
+	Contacts(ctx context.Context, userID string) ([]string, error)
+}
+
+// maxTypingLookups bounds the typing frames being relayed at once
+const maxTypingLookups = 256
+
+// typingEvent is the event of the typing frames sent to other participants
+type typingEvent struct {
+	ConversationID int64     `json:"conversation_id"`
+	UserID         string    `json:"user_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// typing relays a typing frame of the client to the other participants of
+// the conversation. Frames arriving faster than the typing interval are
+// dropped, and none of them is stored.
+func (h *Hub) typing(client *Client, frame *ClientFrame) {
+	if h.options.Conversations == nil {
+		return
+	}
+	if frame.ConversationID <= 0 {
+		log.Printf("Ignoring typing frame without conversation from user %s", client.UserID)
+		return
+	}
+	if !client.allowTyping(frame.ConversationID, h.options.TypingInterval) {
+		return
+	}
+	// Looking up participants and their instances may take a while, the
+	// read loop carries on meanwhile. Typing signals are lossy, so one
+	// arriving while too many lookups are running is dropped.
+	select {
+	case h.typingLookups <- struct{}{}:
+	default:
+		log.Printf("Too many typing lookups running, dropping typing frame of user %s", client.UserID)
+		return
+	}
+	go func() {
+		defer func() { <-h.typingLookups }()
+		h.relayTyping(client.UserID, frame.ConversationID)
+	}()
+}
+
+func (h *Hub) relayTyping(userID string, conversationID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	participants, err := h.options.Conversations.Participants(ctx, userID, conversationID)
+	if err != nil {
+		log.Printf("Failed to look up participants of conversation %d for user %s: %v", conversationID, userID, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(h.options.TypingTTL)
+	event, err := json.Marshal(typingEvent{ConversationID: conversationID, UserID: userID, ExpiresAt: expiresAt})
+	if err != nil {
+		log.Printf("Failed to serialize typing event: %v", err)
+		return
+	}
+	for _, participant := range participants {
+		if participant == userID {
+			continue
+		}
+		h.sendSignal(routing.Signal{UserID: participant, Type: FrameTypeTyping, Event: event, ExpiresAt: expiresAt})
+	}
+}
@@ -1,109 +1,396 @@
 package websocket
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"net/http"
+	"notification-service/auth"
+	"notification-service/presence"
+	"notification-service/routing"
+	"notification-service/store"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-type Client struct {
-	UserID string
-	Conn   *websocket.Conn
+type Hub struct {
+	clients   map[string]map[string]*Client // Maps user IDs to their connections by connection ID
+	mu        sync.RWMutex                  // Protects the `clients` map
+	broadcast chan store.Message            // Channel for broadcasting persisted Kafka messages
+	register  chan *Client                  // Connections waiting to be added by the Broadcast loop
+	verifier  TokenVerifier                 // Validates access tokens of connecting clients
+	options   Options
+	closing   bool // Set once Shutdown started, protected by `mu`
+
+	typingLookups chan struct{} // Slots of the typing frames being relayed
 }
 
-type Hub struct {
-	clients   map[string]*Client // Maps user IDs to WebSocket connections
-	mu        sync.RWMutex       // Protects the `clients` map
-	broadcast chan KafkaMessage  // Channel for broadcasting Kafka messages
+type Options struct {
+	AuthTimeout    time.Duration  // Time a client has to send its first-frame auth message
+	SendBufferSize int            // Messages queued per connection before the overflow policy applies
+	WriteTimeout   time.Duration  // Deadline of a single socket write
+	OverflowPolicy OverflowPolicy // What to do with messages for a client whose queue is full
+	PingInterval   time.Duration  // How often idle connections are pinged
+	PongTimeout    time.Duration  // Connections silent for this long, pongs included, are reaped
+	AckTimeout     time.Duration  // Time a client has to acknowledge a message before it is redelivered
+	// Upper bound of the exponential backoff between redeliveries
+	MaxRetryInterval time.Duration
+	// Unacknowledged messages tracked per connection before the overflow
+	// policy applies; zero leaves them unbounded
+	MaxInflight int
+	// Store keeps every message until it is acknowledged; required, and
+	// shared between instances when they are routed
+	Store store.PendingStore
+	// InstanceID identifies this instance in the Registry
+	InstanceID string
+	// Registry and Relay route messages to users connected to other
+	// instances; without them only local connections are served
+	Registry routing.Registry
+	Relay    routing.Relay
+	// Receipts records delivered and read frames; without it they are ignored
+	Receipts ReceiptRecorder
+	// Conversations resolves the participants typing frames are relayed to;
+	// without it typing frames are ignored
+	Conversations ConversationDirectory
+	// Typing frames relayed per connection and conversation, at most one per interval
+	TypingInterval time.Duration
+	// How long receivers show a typing indicator
+	TypingTTL time.Duration
+	// SignalRelay carries ephemeral signals to other instances. It is kept
+	// apart from Relay, since signals must never be written to Kafka.
+	SignalRelay routing.Relay
+	// Presence keeps statuses and last-seen times; without it presence is
+	// neither tracked nor served
+	Presence presence.Store
 }
 
 type KafkaMessage struct {
 	Receiver string
-	Content  string
+	Content  string // JSON mapping of the event envelope
+	// MessageID is the chat message whose text the envelope carries, 0 if none
+	MessageID int64
+	// Retracts is the chat message deleted for everyone by this event, whose
+	// undelivered notifications are removed, 0 if none
+	Retracts int64
 }
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-func NewHub() *Hub {
+func NewHub(verifier TokenVerifier, options Options) *Hub {
 	return &Hub{
-		clients:   make(map[string]*Client),
-		broadcast: make(chan KafkaMessage),
+		clients:   make(map[string]map[string]*Client),
+		broadcast: make(chan store.Message),
+		register:  make(chan *Client),
+		verifier:  verifier,
+		options:   options,
+
+		typingLookups: make(chan struct{}, maxTypingLookups),
 	}
 }
 
-// WebSocketHandler establishes WebSocket connections
+// WebSocketHandler establishes WebSocket connections. Clients authenticate
+// with an access token passed as a bearer header, through the
+// Sec-WebSocket-Protocol header or in an auth frame sent right after the
+// handshake; the user ID is taken from the token claims.
 func (h *Hub) WebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	token, subprotocol := handshakeToken(r)
+
+	var claims *auth.Claims
+	if token != "" {
+		var err error
+		if claims, err = h.verifier.Verify(token); err != nil {
+			log.Printf("Rejected WebSocket handshake: %v", err)
+			http.Error(w, "Unauthorized - Invalid token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	var responseHeader http.Header
+	if subprotocol != "" {
+		responseHeader = http.Header{"Sec-WebSocket-Protocol": {subprotocol}}
+	}
+
 	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		log.Printf("Failed to upgrade to WebSocket: %v", err)
 		http.Error(w, "Failed to upgrade to WebSocket", http.StatusInternalServerError)
 		return
 	}
 
-	// Extract user ID from query parameters
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		log.Println("Missing user_id in query parameters")
-		conn.Close()
-		http.Error(w, "Missing user_id query parameter", http.StatusBadRequest)
+	if claims == nil {
+		if claims, err = h.authenticateFirstFrame(conn); err != nil {
+			log.Printf("WebSocket authentication failed: %v", err)
+			closeWithCode(conn, websocket.ClosePolicyViolation, "authentication required")
+			return
+		}
+	}
+	userID := claims.Subject()
+
+	connectionID, err := newConnectionID()
+	if err != nil {
+		log.Printf("Failed to generate connection ID: %v", err)
+		closeWithCode(conn, websocket.CloseInternalServerErr, "internal error")
 		return
 	}
 
 	// Add client to the hub
-	client := &Client{UserID: userID, Conn: conn}
-	h.mu.Lock()
-	h.clients[userID] = client
-	h.mu.Unlock()
+	client := newClient(connectionID, userID, conn, h.options.SendBufferSize)
+	client.expiry = time.AfterFunc(time.Until(claims.Expiry()), func() {
+		client.setCloseReason("token expired")
+		closeWithCode(conn, CloseTokenExpired, "token expired")
+	})
+	// Looked up before registering, so that the user's first connection
+	// announces them online
+	previous := h.currentStatus(userID)
+	// Registered before the replay starts, so that any message stored after
+	// the replay has read the backlog is relayed to this instance
+	h.registerUser(userID)
+	h.userConnected(client, previous)
+	h.register <- client
+	client.extendReadDeadline(h.options.PongTimeout)
+	conn.SetPongHandler(func(string) error {
+		client.extendReadDeadline(h.options.PongTimeout)
+		return nil
+	})
+	go client.writePump(h.options)
 
-	log.Printf("User %s connected via WebSocket", userID)
+	log.Printf("User %s connected via WebSocket (connection %s)", userID, client.ID)
 
 	// Listen for WebSocket close events
 	go func() {
+		var readErr error
 		defer func() {
-			h.mu.Lock()
-			delete(h.clients, userID)
-			h.mu.Unlock()
+			client.expiry.Stop()
+			previous := h.currentStatus(userID)
+			if last := h.unregister(client); last {
+				h.unregisterUser(userID)
+				h.userDisconnected(userID)
+			} else {
+				h.connectionClosed(userID, previous)
+			}
+			client.close()
 			conn.Close()
-			log.Printf("User %s disconnected", userID)
+			log.Printf("User %s disconnected (connection %s): %s", userID, client.ID, client.disconnectReason(readErr))
 		}()
 
 		for {
-			// ignoring client messages
-			_, _, err := conn.ReadMessage()
+			_, data, err := conn.ReadMessage()
 			if err != nil {
-				log.Printf("Error reading from WebSocket for user %s: %v", userID, err)
+				readErr = err
 				break
 			}
+			client.extendReadDeadline(h.options.PongTimeout)
+
+			frame, err := parseClientFrame(data)
+			if err != nil {
+				log.Printf("Ignoring malformed frame from user %s: %v", userID, err)
+				continue
+			}
+
+			switch frame.Type {
+			case FrameTypeAuth:
+				h.reauthenticate(client, frame.Token)
+			case FrameTypeAck:
+				h.ack(client, frame.ID)
+			case FrameTypeDelivered, FrameTypeRead:
+				h.receipt(client, frame)
+			case FrameTypeTyping:
+				h.typing(client, frame)
+			case FrameTypePresence:
+				h.reportStatus(client, frame.Status)
+			case FrameTypePresenceSubscribe:
+				client.subscribePresence(frame.UserIDs)
+			}
 		}
 	}()
 }
 
-func (h *Hub) AddMessage(message KafkaMessage) {
-	h.broadcast <- message
+// reauthenticate extends the connection lifetime with a fresh access token
+func (h *Hub) reauthenticate(client *Client, token string) {
+	claims, err := h.verifier.Verify(token)
+	if err != nil || claims.Subject() != client.UserID {
+		client.setCloseReason("in-band re-authentication failed")
+		closeWithCode(client.Conn, websocket.ClosePolicyViolation, "invalid token")
+		return
+	}
+	client.expiry.Reset(time.Until(claims.Expiry()))
+}
+
+// ack removes the message from the store and stops its redelivery to all of
+// the user's devices
+func (h *Hub) ack(client *Client, id int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	if err := h.options.Store.Ack(ctx, client.UserID, id); err != nil {
+		log.Printf("Failed to acknowledge message %d of user %s: %v", id, client.UserID, err)
+	}
+	h.acked(client.UserID, id)
+	h.relay(client.UserID, ackEvent(client.UserID, id))
 }
 
-// Broadcast sends Kafka messages to connected WebSocket clients
-func (h *Hub) Broadcast() {
-	for msg := range h.broadcast {
+func (h *Hub) addClient(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		client.setCloseReason("server shutting down")
+		go closeWithCode(client.Conn, websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	if h.clients[client.UserID] == nil {
+		h.clients[client.UserID] = make(map[string]*Client)
+	}
+	h.clients[client.UserID][client.ID] = client
+}
+
+// unregister removes only the given connection, leaving the user's other
+// devices connected. It reports whether that was the user's last connection.
+func (h *Hub) unregister(client *Client) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients[client.UserID], client.ID)
+	if len(h.clients[client.UserID]) == 0 {
+		delete(h.clients, client.UserID)
+		return true
+	}
+	return false
+}
+
+// connections returns a snapshot of the user's connections
+func (h *Hub) connections(userID string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*Client, 0, len(h.clients[userID]))
+	for _, client := range h.clients[userID] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Shutdown closes every connection with a going away frame, so that clients
+// reconnect to another instance, and waits until they are all unregistered.
+// Unacknowledged messages stay in the store and are replayed there.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closing = true
+	var clients []*Client
+	for _, connections := range h.clients {
+		for _, client := range connections {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		client.setCloseReason("server shutting down")
+		closeWithCode(client.Conn, websocket.CloseGoingAway, "server shutting down")
+	}
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
 		h.mu.RLock()
-		client, exists := h.clients[msg.Receiver]
+		remaining := len(h.clients)
 		h.mu.RUnlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
 
-		if exists {
-			err := client.Conn.WriteMessage(websocket.TextMessage, []byte(msg.Content))
-			if err != nil {
-				log.Printf("Failed to send message to user %s: %v", msg.Receiver, err)
-			} else {
-				log.Printf("Sent message to user %s", msg.Receiver)
+// ConnectionCount returns the number of open connections of the user
+func (h *Hub) ConnectionCount(userID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID])
+}
+
+// SubscriberCount returns the number of open connections subscribed to the
+// presence changes of the user
+func (h *Hub) SubscriberCount(userID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	count := 0
+	for _, clients := range h.clients {
+		for _, client := range clients {
+			if client.subscribedTo(userID) {
+				count++
 			}
-		} else {
-			// todo send push notification (apple / android) if user uses mobile app
-			log.Printf("User %s is not connected;", msg.Receiver)
 		}
 	}
+	return count
+}
+
+func newConnectionID() (string, error) {
+	buffer := make([]byte, 8)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// AddMessage persists the message and hands it over for delivery, here and
+// on the other instances the receiver is connected to. Once it returns
+// without error the message is redelivered until acknowledged, so the Kafka
+// offset may be committed.
+func (h *Hub) AddMessage(message KafkaMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.options.WriteTimeout)
+	defer cancel()
+	if message.Retracts != 0 {
+		retracted, err := h.options.Store.Retract(ctx, message.Receiver, message.Retracts)
+		if err != nil {
+			return err
+		}
+		if retracted > 0 {
+			log.Printf("Removed %d pending notifications of deleted message %d for user %s", retracted, message.Retracts, message.Receiver)
+		}
+	}
+	saved, err := h.options.Store.Save(ctx, message.Receiver, message.Content, message.MessageID)
+	if err != nil {
+		return err
+	}
+	h.broadcast <- saved
+	h.relay(saved.UserID, routing.Event{Type: routing.EventMessage, Message: saved})
+	return nil
+}
+
+// Broadcast sends persisted messages to every connected device of the
+// receiver. Messages are stored before they get here, so users connecting in
+// the meantime receive them through the replay.
+func (h *Hub) Broadcast() {
+	for {
+		select {
+		case client := <-h.register:
+			h.addClient(client)
+		case msg, ok := <-h.broadcast:
+			if !ok {
+				return
+			}
+			h.deliver(msg)
+		}
+	}
+}
+
+func (h *Hub) deliver(msg store.Message) {
+	clients := h.connections(msg.UserID)
+
+	if len(clients) > 0 {
+		for _, client := range clients {
+			// Never blocks, so a stalled socket can't hold up other users
+			client.enqueue(msg, h.options)
+		}
+	} else {
+		// todo send push notification (apple / android) if user uses mobile app
+		log.Printf("User %s is not connected, keeping message %d for replay", msg.UserID, msg.ID)
+	}
 }
@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"user-service/proto"
+	"user-service/repositories"
+)
+
+// BlockUser hides the blocked user and the caller from each other
+func (c *UserServiceServer) BlockUser(ctx context.Context, request *proto.BlockUserRequest) (*proto.BlockUserResponse, error) {
+	if err := validateBlock(request.UserId, request.BlockedUserId); err != nil {
+		return nil, err
+	}
+
+	if _, err := c.UserRepo.FindUserByID(uint(request.BlockedUserId)); errors.Is(err, repositories.ErrNotFound) {
+		return nil, errUserNotFound
+	} else if err != nil {
+		return nil, unavailable("look up user", err)
+	}
+
+	if err := c.UserRepo.BlockUser(uint(request.UserId), uint(request.BlockedUserId)); err != nil {
+		return nil, unavailable("block user", err)
+	}
+	return &proto.BlockUserResponse{Message: "user blocked"}, nil
+}
+
+// UnblockUser lifts the caller's block of the user, if any. The users stay
+// hidden from each other while the other user blocks the caller.
+func (c *UserServiceServer) UnblockUser(ctx context.Context, request *proto.UnblockUserRequest) (*proto.UnblockUserResponse, error) {
+	if err := validateBlock(request.UserId, request.BlockedUserId); err != nil {
+		return nil, err
+	}
+
+	if err := c.UserRepo.UnblockUser(uint(request.UserId), uint(request.BlockedUserId)); err != nil {
+		return nil, unavailable("unblock user", err)
+	}
+	return &proto.UnblockUserResponse{Message: "user unblocked"}, nil
+}
+
+func validateBlock(userID, blockedUserID int32) error {
+	if blockedUserID <= 0 {
+		return invalidArgument("invalid user", fieldViolation{"blockedUserId", "must be positive"})
+	}
+	if blockedUserID == userID {
+		return invalidArgument("invalid user", fieldViolation{"blockedUserId", "must not be the caller"})
+	}
+	return nil
+}
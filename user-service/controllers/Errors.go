@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+)
+
+var (
+	errInvalidCredentials  = status.Error(codes.Unauthenticated, "invalid credentials")
+	errInvalidRefreshToken = status.Error(codes.Unauthenticated, "invalid or expired refresh token")
+	errSessionNotFound     = status.Error(codes.NotFound, "session not found")
+	errUserAlreadyExists   = status.Error(codes.AlreadyExists, "user already exists")
+	errUserDeactivated     = status.Error(codes.PermissionDenied, "account deactivated")
+	errUserNotFound        = status.Error(codes.NotFound, "user not found")
+)
+
+// fieldViolation describes why a single request field was rejected
+type fieldViolation struct {
+	field       string
+	description string
+}
+
+// invalidArgument rejects the request, listing every offending field
+func invalidArgument(message string, violations ...fieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.field,
+			Description: violation.description,
+		})
+	}
+
+	st, err := status.New(codes.InvalidArgument, message).WithDetails(badRequest)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, message)
+	}
+	return st.Err()
+}
+
+// unavailable logs a storage failure and hides its details from the caller,
+// who may retry once the database is back
+func unavailable(operation string, err error) error {
+	log.Printf("Failed to %s: %v", operation, err)
+	return status.Error(codes.Unavailable, "service temporarily unavailable")
+}
+
+// internal logs an unexpected failure and hides its details from the caller
+func internal(operation string, err error) error {
+	log.Printf("Failed to %s: %v", operation, err)
+	return status.Error(codes.Internal, "internal error")
+}
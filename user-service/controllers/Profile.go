@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/text/language"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"user-service/models"
+	"user-service/proto"
+	"user-service/repositories"
+)
+
+// Longest display name and bio, in characters
+const (
+	maxDisplayNameLength = 64
+	maxBioLength         = 500
+)
+
+// profileFields maps the paths of update masks to the fields of
+// models.Profile they cover
+var profileFields = map[string][]string{
+	"displayName":        {"DisplayName"},
+	"bio":                {"Bio"},
+	"avatarAttachmentId": {"AvatarAttachmentID", "AvatarKey"},
+	"locale":             {"Locale"},
+	"timeZone":           {"TimeZone"},
+}
+
+// GetUser returns the user with their profile, unless they are hidden from
+// the viewer
+func (c *UserServiceServer) GetUser(ctx context.Context, request *proto.GetUserRequest) (*proto.GetUserResponse, error) {
+	if request.UserId <= 0 {
+		return nil, invalidArgument("invalid user", fieldViolation{"userId", "must be positive"})
+	}
+
+	fields, err := readFields(request.GetReadMask())
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := c.UserRepo.FindVisibleUsers(uint(request.ViewerId), []uint{uint(request.UserId)})
+	if err != nil {
+		return nil, unavailable("look up user", err)
+	}
+	if len(users) == 0 {
+		return nil, errUserNotFound
+	}
+
+	return &proto.GetUserResponse{User: maskUser(toProtoUser(&users[0]), fields)}, nil
+}
+
+// readFields returns the profile fields listed in the read mask, or nil
+// when it is empty, meaning all of them
+func readFields(mask *fieldmaskpb.FieldMask) ([]string, error) {
+	var violations []fieldViolation
+	for _, path := range mask.GetPaths() {
+		if _, known := profileFields[path]; !known {
+			violations = append(violations, fieldViolation{"readMask", fmt.Sprintf("unknown field %q", path)})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid read mask", violations...)
+	}
+	return mask.GetPaths(), nil
+}
+
+// maskUser clears the profile fields of the user that aren't listed, unless
+// none are
+func maskUser(user *proto.User, fields []string) *proto.User {
+	if len(fields) == 0 {
+		return user
+	}
+	profile := user.Profile
+	if !slices.Contains(fields, "displayName") {
+		profile.DisplayName = ""
+	}
+	if !slices.Contains(fields, "bio") {
+		profile.Bio = ""
+	}
+	if !slices.Contains(fields, "avatarAttachmentId") {
+		profile.AvatarAttachmentId = 0
+		user.AvatarKey = ""
+	}
+	if !slices.Contains(fields, "locale") {
+		profile.Locale = ""
+	}
+	if !slices.Contains(fields, "timeZone") {
+		profile.TimeZone = ""
+	}
+	return user
+}
+
+// UpdateProfile changes the fields of the user's profile listed in the
+// update mask, leaving the others as they are. Services caching users are
+// told about the change.
+func (c *UserServiceServer) UpdateProfile(ctx context.Context, request *proto.UpdateProfileRequest) (*proto.UpdateProfileResponse, error) {
+	if request.UserId <= 0 {
+		return nil, invalidArgument("invalid user", fieldViolation{"userId", "must be positive"})
+	}
+	paths := request.GetUpdateMask().GetPaths()
+	if len(paths) == 0 {
+		return nil, invalidArgument("invalid update mask", fieldViolation{"updateMask", "must list the fields to update"})
+	}
+
+	var changed, fields []string
+	var violations []fieldViolation
+	for _, path := range paths {
+		columns, known := profileFields[path]
+		if !known {
+			violations = append(violations, fieldViolation{"updateMask", fmt.Sprintf("unknown field %q", path)})
+			continue
+		}
+		if !slices.Contains(changed, path) {
+			changed = append(changed, path)
+			fields = append(fields, columns...)
+		}
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid update mask", violations...)
+	}
+
+	profile, violations := validateProfile(request, changed)
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid profile", violations...)
+	}
+
+	user, err := c.UserRepo.FindUserByID(uint(request.UserId))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, unavailable("look up user", err)
+	}
+
+	for _, path := range changed {
+		switch path {
+		case "displayName":
+			user.Profile.DisplayName = profile.DisplayName
+		case "bio":
+			user.Profile.Bio = profile.Bio
+		case "avatarAttachmentId":
+			user.Profile.AvatarAttachmentID = profile.AvatarAttachmentID
+			user.Profile.AvatarKey = profile.AvatarKey
+		case "locale":
+			user.Profile.Locale = profile.Locale
+		case "timeZone":
+			user.Profile.TimeZone = profile.TimeZone
+		}
+	}
+
+	err = c.UserRepo.UpdateProfile(user.ID, &user.Profile, fields)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, unavailable("update profile", err)
+	}
+
+	// The profile is stored either way, caches expire on their own
+	if err := c.Publisher.ProfileUpdated(ctx, user, changed, time.Now()); err != nil {
+		log.Printf("Failed to publish profile update of user %d: %v", user.ID, err)
+	}
+
+	return &proto.UpdateProfileResponse{User: toProtoUser(user)}, nil
+}
+
+// validateProfile checks the given fields of the requested profile,
+// returning them normalized
+func validateProfile(request *proto.UpdateProfileRequest, paths []string) (models.Profile, []fieldViolation) {
+	requested := request.GetProfile()
+	var profile models.Profile
+	var violations []fieldViolation
+	for _, path := range paths {
+		switch path {
+		case "displayName":
+			profile.DisplayName = strings.TrimSpace(requested.GetDisplayName())
+			if description := checkText(profile.DisplayName, maxDisplayNameLength, false); description != "" {
+				violations = append(violations, fieldViolation{"profile.displayName", description})
+			}
+		case "bio":
+			profile.Bio = strings.TrimSpace(strings.ReplaceAll(requested.GetBio(), "\r\n", "\n"))
+			if description := checkText(profile.Bio, maxBioLength, true); description != "" {
+				violations = append(violations, fieldViolation{"profile.bio", description})
+			}
+		case "avatarAttachmentId":
+			switch id := requested.GetAvatarAttachmentId(); {
+			case id < 0:
+				violations = append(violations, fieldViolation{"profile.avatarAttachmentId", "must not be negative"})
+			case id > 0 && request.AvatarKey == "":
+				violations = append(violations, fieldViolation{"avatarKey", "must be set along with the avatar"})
+			case id > 0:
+				profile.AvatarAttachmentID = uint(id)
+				profile.AvatarKey = request.AvatarKey
+			}
+		case "locale":
+			if requested.GetLocale() == "" {
+				continue
+			}
+			tag, err := language.Parse(requested.GetLocale())
+			if err != nil || tag == language.Und {
+				violations = append(violations, fieldViolation{"profile.locale", "must be a BCP 47 language tag"})
+				continue
+			}
+			profile.Locale = tag.String()
+		case "timeZone":
+			profile.TimeZone = requested.GetTimeZone()
+			if profile.TimeZone == "" {
+				continue
+			}
+			if _, err := time.LoadLocation(profile.TimeZone); err != nil || profile.TimeZone == "Local" {
+				violations = append(violations, fieldViolation{"profile.timeZone", "must be an IANA time zone"})
+			}
+		}
+	}
+	return profile, violations
+}
+
+// checkText describes why the text is rejected, or returns "" when it is
+// fine. Line breaks are only allowed when multiline is set.
+func checkText(text string, maxLength int, multiline bool) string {
+	if utf8.RuneCountInString(text) > maxLength {
+		return fmt.Sprintf("must be at most %d characters long", maxLength)
+	}
+	for _, r := range text {
+		if unicode.IsControl(r) && !(multiline && r == '\n') {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// toProtoUser maps the user to its protobuf representation
+func toProtoUser(user *models.User) *proto.User {
+	return &proto.User{
+		UserId: int32(user.ID),
+		Name:   user.Name,
+		Profile: &proto.Profile{
+			DisplayName:        user.Profile.DisplayName,
+			Bio:                user.Profile.Bio,
+			AvatarAttachmentId: int64(user.Profile.AvatarAttachmentID),
+			Locale:             user.Profile.Locale,
+			TimeZone:           user.Profile.TimeZone,
+		},
+		AvatarKey: user.Profile.AvatarKey,
+	}
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+	"user-service/proto"
+	"user-service/repositories"
+)
+
+// Bounds of search queries, in characters. Shorter queries would match
+// most of the directory.
+const (
+	minQueryLength = 2
+	maxQueryLength = 64
+)
+
+// Page sizes of search results
+const (
+	defaultPageSize = 20
+	maxPageSize     = 50
+)
+
+// SearchUsers finds the users whose name or display name starts with or
+// resembles the query, best matches first. Deactivated users are left out,
+// as are the caller and the users they blocked or were blocked by.
+func (c *UserServiceServer) SearchUsers(ctx context.Context, request *proto.SearchUsersRequest) (*proto.SearchUsersResponse, error) {
+	var violations []fieldViolation
+	query := strings.TrimSpace(request.Query)
+	if length := utf8.RuneCountInString(query); length < minQueryLength || length > maxQueryLength {
+		violations = append(violations, fieldViolation{"query", fmt.Sprintf("must be %d to %d characters long", minQueryLength, maxQueryLength)})
+	}
+	if request.PageSize < 0 {
+		violations = append(violations, fieldViolation{"pageSize", "must not be negative"})
+	}
+	var after *repositories.UserHit
+	if request.Cursor != "" {
+		var ok bool
+		if after, ok = decodeSearchCursor(request.Cursor); !ok {
+			violations = append(violations, fieldViolation{"cursor", "must be a cursor returned by a previous page"})
+		}
+	}
+	if len(violations) > 0 {
+		return nil, invalidArgument("invalid search", violations...)
+	}
+
+	limit := int(request.PageSize)
+	if limit == 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	// One extra hit tells whether another page follows
+	hits, err := c.UserRepo.SearchUsers(uint(request.UserId), query, after, limit+1)
+	if err != nil {
+		return nil, unavailable("search users", err)
+	}
+
+	response := &proto.SearchUsersResponse{Users: []*proto.User{}}
+	if len(hits) > limit {
+		hits = hits[:limit]
+		response.NextCursor = encodeSearchCursor(&hits[limit-1])
+	}
+	for i := range hits {
+		response.Users = append(response.Users, toProtoUser(&hits[i].User))
+	}
+	return response, nil
+}
+
+// encodeSearchCursor packs the position of the hit into an opaque cursor
+func encodeSearchCursor(hit *repositories.UserHit) string {
+	position := strconv.FormatUint(math.Float64bits(hit.Rank), 10) + "." + strconv.FormatUint(uint64(hit.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(position))
+}
+
+// decodeSearchCursor unpacks a cursor made by encodeSearchCursor
+func decodeSearchCursor(cursor string) (*repositories.UserHit, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+	rank, id, found := strings.Cut(string(raw), ".")
+	if !found {
+		return nil, false
+	}
+	rankBits, err := strconv.ParseUint(rank, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	userID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil || userID == 0 {
+		return nil, false
+	}
+
+	hit := &repositories.UserHit{Rank: math.Float64frombits(rankBits)}
+	hit.ID = uint(userID)
+	return hit, true
+}
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"user-service/models"
+	"user-service/proto"
+	"user-service/repositories"
+)
+
+// Logout revokes the session the caller is signed in with
+func (c *UserServiceServer) Logout(ctx context.Context, request *proto.LogoutRequest) (*proto.LogoutResponse, error) {
+	if _, err := c.findUserSession(uint(request.UserId), request.SessionId); err != nil {
+		return nil, err
+	}
+
+	if err := c.revokeSession(request.SessionId); err != nil {
+		return nil, unavailable("log out", err)
+	}
+
+	return &proto.LogoutResponse{Message: "logout successful"}, nil
+}
+
+// ListSessions returns every active session of the user
+func (c *UserServiceServer) ListSessions(ctx context.Context, request *proto.ListSessionsRequest) (*proto.ListSessionsResponse, error) {
+	sessions, err := c.SessionRepo.ListActiveSessions(uint(request.UserId))
+	if err != nil {
+		return nil, unavailable("list sessions", err)
+	}
+
+	response := &proto.ListSessionsResponse{Sessions: make([]*proto.Session, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, &proto.Session{
+			SessionId:  session.ID,
+			DeviceName: session.DeviceName,
+			IpAddress:  session.IPAddress,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.Created.Unix(),
+			LastUsedAt: session.LastUsedAt.Unix(),
+			Current:    session.ID == request.CurrentSessionId,
+		})
+	}
+
+	return response, nil
+}
+
+// RevokeSession signs out a single session, or every session but the current one
+func (c *UserServiceServer) RevokeSession(ctx context.Context, request *proto.RevokeSessionRequest) (*proto.RevokeSessionResponse, error) {
+	userID := uint(request.UserId)
+
+	if !request.AllOtherSessions {
+		if _, err := c.findUserSession(userID, request.SessionId); err != nil {
+			return nil, err
+		}
+		if err := c.revokeSession(request.SessionId); err != nil {
+			return nil, unavailable("revoke session", err)
+		}
+		return &proto.RevokeSessionResponse{RevokedSessions: 1, Message: "session revoked"}, nil
+	}
+
+	sessions, err := c.SessionRepo.ListActiveSessions(userID)
+	if err != nil {
+		return nil, unavailable("list sessions", err)
+	}
+
+	revoked := int32(0)
+	for _, session := range sessions {
+		if session.ID == request.CurrentSessionId {
+			continue
+		}
+		if err := c.revokeSession(session.ID); err != nil {
+			return nil, unavailable("revoke session", err)
+		}
+		revoked++
+	}
+
+	return &proto.RevokeSessionResponse{RevokedSessions: revoked, Message: "other sessions revoked"}, nil
+}
+
+// findUserSession makes sure the session exists, is active and belongs to the user
+func (c *UserServiceServer) findUserSession(userID uint, sessionID string) (*models.Session, error) {
+	session, err := c.SessionRepo.FindSessionByID(sessionID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, unavailable("look up session", err)
+	}
+	if err != nil || session.UserID != userID || session.RevokedAt != nil {
+		return nil, errSessionNotFound
+	}
+	return session, nil
+}
+
+// revokeSession revokes the session together with its refresh token family
+func (c *UserServiceServer) revokeSession(sessionID string) error {
+	if err := c.SessionRepo.RevokeSession(sessionID); err != nil {
+		return err
+	}
+	return c.RefreshTokenRepo.RevokeRefreshTokenFamily(sessionID)
+}
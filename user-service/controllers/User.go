@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"golang.org/x/crypto/bcrypt"
+	"log"
+	"time"
+	"user-service/events"
 	"user-service/models"
 	"user-service/proto"
 	"user-service/repositories"
@@ -12,30 +15,48 @@ import (
 
 type UserServiceServer struct {
 	proto.UnimplementedUserServiceServer
-	UserRepo repositories.UserRepository
+	UserRepo         repositories.UserRepository
+	RefreshTokenRepo repositories.RefreshTokenRepository
+	SessionRepo      repositories.SessionRepository
+	Publisher        events.Publisher
+}
+
+type tokenPair struct {
+	accessToken           string
+	accessTokenExpiresAt  time.Time
+	refreshToken          string
+	refreshTokenExpiresAt time.Time
 }
 
 // Register a new user
 func (c *UserServiceServer) Register(ctx context.Context, request *proto.RegisterRequest) (*proto.RegisterResponse, error) {
 	// Simple check for username
 	if len(request.Name) < 1 {
-		return nil, fmt.Errorf("invalid name")
+		return nil, invalidArgument("invalid name", fieldViolation{"name", "must not be empty"})
 	}
 
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return nil, invalidArgument("invalid password", fieldViolation{"password", "must be at most 72 bytes long"})
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %v", err)
+		return nil, internal("hash password", err)
 	}
 
 	// Create user in DB
 	user := models.User{Name: request.Name, Password: string(hashedPassword)}
 	if _, err := c.UserRepo.FindUserByName(user.Name); err == nil {
-		return nil, fmt.Errorf("user already exists")
+		return nil, errUserAlreadyExists
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, unavailable("look up user", err)
 	}
 
-	if err := c.UserRepo.CreateUser(&user); err != nil {
-		return nil, fmt.Errorf("failed to create user: %v", err)
+	// The name may have been taken since the lookup
+	if err := c.UserRepo.CreateUser(&user); errors.Is(err, repositories.ErrAlreadyExists) {
+		return nil, errUserAlreadyExists
+	} else if err != nil {
+		return nil, unavailable("create user", err)
 	}
 
 	// Return success response
@@ -48,65 +69,183 @@ func (c *UserServiceServer) Register(ctx context.Context, request *proto.Registe
 // Login an existing user
 func (c *UserServiceServer) Login(ctx context.Context, request *proto.LoginRequest) (*proto.LoginResponse, error) {
 	if !request.IsValid() {
-		return nil, fmt.Errorf("invalid input")
+		var violations []fieldViolation
+		if len(request.Name) == 0 {
+			violations = append(violations, fieldViolation{"name", "must not be empty"})
+		}
+		if len(request.Password) == 0 {
+			violations = append(violations, fieldViolation{"password", "must not be empty"})
+		}
+		return nil, invalidArgument("invalid input", violations...)
 	}
 
+	// Unknown users get the same answer as wrong passwords, so names can't be probed
 	user, err := c.UserRepo.FindUserByName(request.Name)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errInvalidCredentials
+	}
 	if err != nil {
-		return nil, fmt.Errorf("user not found: %v", err)
+		return nil, unavailable("look up user", err)
 	}
 
 	// Compare password with hashed password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)); err != nil {
-		return nil, fmt.Errorf("invalid credentials: %v", err)
+		return nil, errInvalidCredentials
+	}
+	if user.DeactivatedAt != nil {
+		return nil, errUserDeactivated
 	}
 
-	// Generate access and refresh tokens
-	accessToken, accessTokenExpiresAt, err := utils.GenerateJWT(user.ID)
+	sessionID, err := utils.GenerateSessionID()
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %v", err)
+		return nil, internal("generate session ID", err)
 	}
 
-	refreshToken, refreshTokenExpiresAt, err := utils.GenerateRefreshToken(user.ID)
+	now := time.Now()
+	err = c.SessionRepo.CreateSession(&models.Session{
+		ID:         sessionID,
+		UserID:     user.ID,
+		DeviceName: request.DeviceName,
+		IPAddress:  request.IpAddress,
+		UserAgent:  request.UserAgent,
+		LastUsedAt: now,
+		Created:    now,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %v", err)
+		return nil, unavailable("create session", err)
+	}
+
+	// Generate access and refresh tokens
+	tokens, err := c.issueTokens(user.ID, sessionID)
+	if err != nil {
+		return nil, err
 	}
 
 	// Return login response with tokens
 	return &proto.LoginResponse{
 		UserId:                int32(user.ID),
-		AccessToken:           accessToken,
-		AccessTokenExpiresAt:  accessTokenExpiresAt.Unix(),
-		RefreshToken:          refreshToken,
-		RefreshTokenExpiresAt: refreshTokenExpiresAt.Unix(),
+		AccessToken:           tokens.accessToken,
+		AccessTokenExpiresAt:  tokens.accessTokenExpiresAt.Unix(),
+		RefreshToken:          tokens.refreshToken,
+		RefreshTokenExpiresAt: tokens.refreshTokenExpiresAt.Unix(),
 		Message:               "login successful",
+		SessionId:             sessionID,
 	}, nil
 }
 
-func (c *UserServiceServer) RefreshToken(ctx context.Context, request *proto.RefreshTokenRequest) (*proto.RefreshTokenResponse, error) {
-	userID, refreshToken := uint(request.UserId), request.RefreshToken
-	// Verify the provided refresh token
-	if isVerified, _ := utils.VerifyRefreshToken(refreshToken, userID); !isVerified {
-		return nil, fmt.Errorf("invalid or expired refresh token")
+// DeactivateUser deactivates the account and signs out all its sessions.
+// Deactivating again signs out any session a failed attempt left behind.
+func (c *UserServiceServer) DeactivateUser(ctx context.Context, request *proto.DeactivateUserRequest) (*proto.DeactivateUserResponse, error) {
+	userID := uint(request.UserId)
+	if err := c.UserRepo.DeactivateUser(userID); errors.Is(err, repositories.ErrNotFound) {
+		return nil, errUserNotFound
+	} else if err != nil {
+		return nil, unavailable("deactivate user", err)
 	}
 
-	// Generate a new access token
-	newAccessToken, newAccessTokenExpiresAt, err := utils.GenerateJWT(userID)
+	sessions, err := c.SessionRepo.ListActiveSessions(userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %v", err)
+		return nil, unavailable("list sessions", err)
+	}
+	revoked := int32(0)
+	for _, session := range sessions {
+		if err := c.revokeSession(session.ID); err != nil {
+			return nil, unavailable("revoke session", err)
+		}
+		revoked++
+	}
+	// Also covers refresh tokens whose session was already revoked or expired
+	if err := c.RefreshTokenRepo.RevokeUserRefreshTokens(userID); err != nil {
+		return nil, unavailable("revoke refresh tokens", err)
+	}
+
+	return &proto.DeactivateUserResponse{RevokedSessions: revoked, Message: "account deactivated"}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Every refresh
+// token can be used once; presenting one that was already rotated revokes
+// the whole token family, since either the client or an attacker holds a
+// stolen copy.
+func (c *UserServiceServer) RefreshToken(ctx context.Context, request *proto.RefreshTokenRequest) (*proto.RefreshTokenResponse, error) {
+	userID := uint(request.UserId)
+
+	storedToken, err := c.RefreshTokenRepo.FindRefreshTokenByHash(utils.HashRefreshToken(request.RefreshToken))
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, unavailable("look up refresh token", err)
+	}
+	if err != nil || storedToken.UserID != userID || storedToken.RevokedAt != nil {
+		return nil, errInvalidRefreshToken
+	}
+
+	if storedToken.UsedAt != nil {
+		c.revokeTokenFamily(storedToken)
+		return nil, errInvalidRefreshToken
 	}
 
-	// Generate a new refresh token
-	newRefreshToken, newRefreshTokenExpiresAt, err := utils.GenerateRefreshToken(userID)
+	if storedToken.IsExpired(time.Now()) {
+		return nil, errInvalidRefreshToken
+	}
+
+	if err := c.RefreshTokenRepo.MarkRefreshTokenUsed(storedToken.ID); err != nil {
+		// Lost a race against a concurrent refresh with the same token
+		if errors.Is(err, repositories.ErrRefreshTokenAlreadyUsed) {
+			c.revokeTokenFamily(storedToken)
+			return nil, errInvalidRefreshToken
+		}
+		return nil, unavailable("rotate refresh token", err)
+	}
+
+	tokens, err := c.issueTokens(userID, storedToken.FamilyID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %v", err)
+		return nil, err
+	}
+
+	if err := c.SessionRepo.TouchSession(storedToken.FamilyID); err != nil {
+		log.Printf("Failed to update session %s: %v", storedToken.FamilyID, err)
 	}
 
 	return &proto.RefreshTokenResponse{
 		UserId:                int32(userID),
-		AccessToken:           newAccessToken,
-		AccessTokenExpiresAt:  newAccessTokenExpiresAt.Unix(),
-		RefreshToken:          newRefreshToken,
-		RefreshTokenExpiresAt: newRefreshTokenExpiresAt.Unix(),
+		AccessToken:           tokens.accessToken,
+		AccessTokenExpiresAt:  tokens.accessTokenExpiresAt.Unix(),
+		RefreshToken:          tokens.refreshToken,
+		RefreshTokenExpiresAt: tokens.refreshTokenExpiresAt.Unix(),
 	}, nil
 }
+
+// issueTokens generates an access token and persists a new refresh token for the given session
+func (c *UserServiceServer) issueTokens(userID uint, sessionID string) (*tokenPair, error) {
+	accessToken, accessTokenExpiresAt, err := utils.GenerateJWT(userID, sessionID)
+	if err != nil {
+		return nil, internal("generate access token", err)
+	}
+
+	refreshToken, refreshTokenExpiresAt, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, internal("generate refresh token", err)
+	}
+
+	err = c.RefreshTokenRepo.CreateRefreshToken(&models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  sessionID,
+		TokenHash: utils.HashRefreshToken(refreshToken),
+		ExpiresAt: refreshTokenExpiresAt,
+	})
+	if err != nil {
+		return nil, unavailable("store refresh token", err)
+	}
+
+	return &tokenPair{
+		accessToken:           accessToken,
+		accessTokenExpiresAt:  accessTokenExpiresAt,
+		refreshToken:          refreshToken,
+		refreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil
+}
+
+func (c *UserServiceServer) revokeTokenFamily(token *models.RefreshToken) {
+	log.Printf("Refresh token reuse detected for user %d, revoking token family %s", token.UserID, token.FamilyID)
+	if err := c.revokeSession(token.FamilyID); err != nil {
+		log.Printf("Failed to revoke token family %s: %v", token.FamilyID, err)
+	}
+}
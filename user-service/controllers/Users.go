@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"user-service/proto"
+)
+
+// maxBatchSize bounds the number of users looked up at once
+const maxBatchSize = 500
+
+// GetUsersBatch looks up several users at once, leaving out unknown IDs and
+// the users hidden from the viewer
+func (c *UserServiceServer) GetUsersBatch(ctx context.Context, request *proto.GetUsersBatchRequest) (*proto.GetUsersBatchResponse, error) {
+	if len(request.UserIds) > maxBatchSize {
+		return nil, invalidArgument("too many users", fieldViolation{"userIds", fmt.Sprintf("must list at most %d users", maxBatchSize)})
+	}
+
+	fields, err := readFields(request.GetReadMask())
+	if err != nil {
+		return nil, err
+	}
+
+	response := &proto.GetUsersBatchResponse{Users: []*proto.User{}}
+	if len(request.UserIds) == 0 {
+		return response, nil
+	}
+
+	ids := make([]uint, 0, len(request.UserIds))
+	for _, id := range request.UserIds {
+		ids = append(ids, uint(id))
+	}
+	users, err := c.UserRepo.FindVisibleUsers(uint(request.ViewerId), ids)
+	if err != nil {
+		return nil, unavailable("look up users", err)
+	}
+
+	for i := range users {
+		response.Users = append(response.Users, maskUser(toProtoUser(&users[i]), fields))
+	}
+	return response, nil
+}
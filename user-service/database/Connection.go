@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"log"
 	"os"
 	"user-service/models"
 )
@@ -24,6 +25,26 @@ func ConnectDatabase() {
 		panic("Failed to connect to database!")
 	}
 
-	db.AutoMigrate(&models.User{})
+	if err := Migrate(db); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
 	DB = db
 }
+
+// Migrate creates or updates the tables of the models
+func Migrate(db *gorm.DB) error {
+	// Trigram indexes of names back fuzzy user searches
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		return fmt.Errorf("create pg_trgm extension: %w", err)
+	}
+	return db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.Session{}, &models.Block{})
+}
+
+// Close closes the connection pool
+func Close() error {
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
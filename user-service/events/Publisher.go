@@ -0,0 +1,96 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"strconv"
+	"time"
+	"user-service/models"
+	notification "user-service/proto/notification"
+)
+
+// envelopeVersion is the version of the payloads published here
+const envelopeVersion = 1
+
+// Publisher announces changes of users to the services caching them
+type Publisher interface {
+	// ProfileUpdated tells that the user changed the given profile fields,
+	// named as in the Profile message
+	ProfileUpdated(ctx context.Context, user *models.User, fields []string, updated time.Time) error
+}
+
+// KafkaPublisher writes envelopes to the user events topic, keyed by user
+// so the changes of a user stay in order
+type KafkaPublisher struct {
+	Writer *kafka.Writer
+	Topic  string
+}
+
+func (publisher *KafkaPublisher) ProfileUpdated(ctx context.Context, user *models.User, fields []string, updated time.Time) error {
+	envelope, err := ProfileUpdatedEnvelope(user, fields, updated)
+	if err != nil {
+		return err
+	}
+
+	value, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	return publisher.Writer.WriteMessages(ctx, kafka.Message{
+		Topic:   publisher.Topic,
+		Key:     []byte(strconv.FormatUint(uint64(user.ID), 10)),
+		Value:   value,
+		Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/x-protobuf")}},
+	})
+}
+
+// ProfileUpdatedEnvelope wraps the profile in the envelope announcing its
+// change. It has no recipients, since it is meant for services rather than
+// devices.
+func ProfileUpdatedEnvelope(user *models.User, fields []string, updated time.Time) (*notification.Envelope, error) {
+	changedFields := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		changedFields = append(changedFields, field)
+	}
+
+	payload, err := structpb.NewStruct(map[string]interface{}{
+		"user_id":              float64(user.ID),
+		"name":                 user.Name,
+		"changed_fields":       changedFields,
+		"display_name":         user.Profile.DisplayName,
+		"bio":                  user.Profile.Bio,
+		"avatar_attachment_id": float64(user.Profile.AvatarAttachmentID),
+		"locale":               user.Profile.Locale,
+		"time_zone":            user.Profile.TimeZone,
+	})
+	if err != nil {
+		return nil, err
+	}
+	id, err := newEventID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &notification.Envelope{
+		Id:        id,
+		Type:      notification.EventType_EVENT_TYPE_PROFILE_UPDATED,
+		Version:   envelopeVersion,
+		Sender:    strconv.FormatUint(uint64(user.ID), 10),
+		CreatedAt: timestamppb.New(updated),
+		Payload:   payload,
+	}, nil
+}
+
+func newEventID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
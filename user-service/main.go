@@ -1,36 +1,127 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"github.com/segmentio/kafka-go"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// Time zones of profiles are checked against the embedded database, so
+	// images without one still accept them
+	_ "time/tzdata"
 	"user-service/controllers"
 	"user-service/database"
+	"user-service/events"
 	"user-service/proto"
 	"user-service/repositories"
+	"user-service/utils"
 )
 
 func main() {
 	server := grpc.NewServer()
 	database.ConnectDatabase()
 
-	repository := &repositories.GormUserRepository{}
-	userServiceServer := &controllers.UserServiceServer{UserRepo: repository}
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+
+	kafkaWriter := &kafka.Writer{
+		Addr:                   kafka.TCP(os.Getenv("KAFKA_BROKER")),
+		Balancer:               &kafka.Hash{},
+		AllowAutoTopicCreation: true,
+	}
+
+	userServiceServer := &controllers.UserServiceServer{
+		UserRepo:         &repositories.GormUserRepository{},
+		RefreshTokenRepo: &repositories.GormRefreshTokenRepository{},
+		SessionRepo:      &repositories.GormSessionRepository{},
+		Publisher:        &events.KafkaPublisher{Writer: kafkaWriter, Topic: userEventsTopic()},
+	}
 	proto.RegisterUserServiceServer(server, userServiceServer)
 
 	// Enable gRPC reflection
 	reflection.Register(server)
 
+	// Publish the public signing keys for token verifiers
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/jwks.json", utils.SigningKeys.JWKSHandler)
+	jwksServer := &http.Server{Addr: ":" + os.Getenv("HTTP_PORT"), Handler: mux}
+	go func() {
+		log.Printf("JWKS endpoint is running on port %s", os.Getenv("HTTP_PORT"))
+		if err := jwksServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("failed to start JWKS endpoint: %v", err)
+		}
+	}()
+
 	listener, err := net.Listen("tcp", ":"+os.Getenv("PORT"))
 	if err != nil {
 		log.Fatalf("failed to listen on port 50051: %v", err)
 	}
 
-	log.Println("gRPC server is running on port 50051")
-	if err := server.Serve(listener); err != nil {
-		log.Fatalf("failed to start gRPC server: %v", err)
+	go func() {
+		log.Println("gRPC server is running on port 50051")
+		if err := server.Serve(listener); err != nil {
+			log.Fatalf("failed to start gRPC server: %v", err)
+		}
+	}()
+
+	interruption := make(chan os.Signal, 1)
+	signal.Notify(interruption, syscall.SIGINT, syscall.SIGTERM)
+	<-interruption
+
+	log.Println("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+
+	stopServer(ctx, server)
+
+	if err := jwksServer.Shutdown(ctx); err != nil {
+		log.Printf("failed to shut down JWKS endpoint: %v", err)
+	}
+	if err := kafkaWriter.Close(); err != nil {
+		log.Printf("failed to flush Kafka writer: %v", err)
+	}
+	if err := database.Close(); err != nil {
+		log.Printf("failed to close database: %v", err)
+	}
+	log.Println("shutdown complete")
+}
+
+// shutdownTimeout reads SHUTDOWN_TIMEOUT, defaulting to 25 seconds
+func shutdownTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(os.Getenv("SHUTDOWN_TIMEOUT")); err == nil {
+		return timeout
+	}
+	return 25 * time.Second
+}
+
+// userEventsTopic reads USER_EVENTS_TOPIC, defaulting to "user-events"
+func userEventsTopic() string {
+	if topic := os.Getenv("USER_EVENTS_TOPIC"); topic != "" {
+		return topic
 	}
+	return "user-events"
+}
 
+// stopServer lets in-flight calls finish, cancelling them once the deadline
+// passes
+func stopServer(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("gRPC calls did not finish in time, cancelling them")
+		server.Stop()
+	}
 }
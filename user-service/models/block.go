@@ -0,0 +1,12 @@
+package models
+
+import (
+	"time"
+)
+
+// Block hides the blocked user from the blocker, and the blocker from them
+type Block struct {
+	BlockerID uint      `gorm:"primaryKey" json:"blocker_id"`
+	BlockedID uint      `gorm:"primaryKey;index" json:"blocked_id"`
+	Created   time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+// Profile is what a user tells others about themselves. Empty fields are
+// unset, the avatar is an image attachment uploaded through the gateway.
+type Profile struct {
+	DisplayName        string `gorm:"not null;default:'';index:idx_users_display_name_trgm,type:gin,expression:display_name gin_trgm_ops" json:"display_name"`
+	Bio                string `gorm:"not null;default:''" json:"bio"`
+	AvatarAttachmentID uint   `gorm:"not null;default:0" json:"avatar_attachment_id"`
+	// AvatarKey is the storage key of the attachment's thumbnail
+	AvatarKey string `gorm:"not null;default:''" json:"-"`
+	Locale    string `gorm:"not null;default:''" json:"locale"`
+	TimeZone  string `gorm:"not null;default:''" json:"time_zone"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is a persisted, hashed refresh token. Tokens issued by
+// rotating one another share a FamilyID, so replaying a token that was
+// already used can revoke every descendant at once.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `gorm:"index;not null"`
+	FamilyID  string     `gorm:"index;not null"`
+	TokenHash string     `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // set once the token has been exchanged
+	RevokedAt *time.Time // set when the token or its family is revoked
+	Created   time.Time
+}
+
+func (token *RefreshToken) IsExpired(now time.Time) bool {
+	return !token.ExpiresAt.After(now)
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is a single signed-in device. Its ID doubles as the family ID of
+// the refresh tokens issued to that device.
+type Session struct {
+	ID         string `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index;not null"`
+	DeviceName string
+	IPAddress  string
+	UserAgent  string
+	LastUsedAt time.Time
+	RevokedAt  *time.Time
+	Created    time.Time
+}
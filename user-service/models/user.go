@@ -6,8 +6,11 @@ import (
 
 type User struct {
 	ID       uint      `gorm:"primaryKey;autoIncrement"`
-	Name     string    `gorm:"unique;not null" json:"name"`
+	Name     string    `gorm:"unique;not null;index:idx_users_name_trgm,type:gin,expression:name gin_trgm_ops" json:"name"`
 	Password string    `gorm:"not null" json:"-"`
+	Profile  Profile   `gorm:"embedded" json:"profile"`
 	Created  time.Time `json:"created_at"`
 	Updated  time.Time `json:"updated_at"`
+	// Deactivated accounts are hidden from searches
+	DeactivatedAt *time.Time `json:"-"`
 }
@@ -0,0 +1,28 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned by lookups that match no record, so callers can
+// tell a missing record apart from a failing database
+var ErrNotFound = errors.New("record not found")
+
+// ErrAlreadyExists is returned by inserts that violate a unique constraint
+var ErrAlreadyExists = errors.New("record already exists")
+
+// uniqueViolation is the SQLSTATE of unique constraint violations
+const uniqueViolation = "23505"
+
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrAlreadyExists
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+	"user-service/database"
+	"user-service/models"
+)
+
+var ErrRefreshTokenAlreadyUsed = errors.New("refresh token already used")
+
+// RefreshTokenRepository defines the interface for refresh token storage
+type RefreshTokenRepository interface {
+	CreateRefreshToken(token *models.RefreshToken) error
+	FindRefreshTokenByHash(hash string) (*models.RefreshToken, error)
+	// MarkRefreshTokenUsed atomically flags the token as used and returns
+	// ErrRefreshTokenAlreadyUsed if it has been used before.
+	MarkRefreshTokenUsed(id uint) error
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID uint) error
+}
+
+type GormRefreshTokenRepository struct{}
+
+func (repo *GormRefreshTokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	return database.DB.Create(token).Error
+}
+
+func (repo *GormRefreshTokenRepository) FindRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := database.DB.Where("token_hash = ?", hash).First(&token).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (repo *GormRefreshTokenRepository) MarkRefreshTokenUsed(id uint) error {
+	result := database.DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenAlreadyUsed
+	}
+	return nil
+}
+
+func (repo *GormRefreshTokenRepository) RevokeRefreshTokenFamily(familyID string) error {
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (repo *GormRefreshTokenRepository) RevokeUserRefreshTokens(userID uint) error {
+	return database.DB.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
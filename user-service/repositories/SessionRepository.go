@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"time"
+	"user-service/database"
+	"user-service/models"
+)
+
+// SessionRepository defines the interface for session data access
+type SessionRepository interface {
+	CreateSession(session *models.Session) error
+	FindSessionByID(id string) (*models.Session, error)
+	ListActiveSessions(userID uint) ([]models.Session, error)
+	TouchSession(id string) error
+	RevokeSession(id string) error
+}
+
+type GormSessionRepository struct{}
+
+func (repo *GormSessionRepository) CreateSession(session *models.Session) error {
+	return database.DB.Create(session).Error
+}
+
+func (repo *GormSessionRepository) FindSessionByID(id string) (*models.Session, error) {
+	var session models.Session
+	err := database.DB.Where("id = ?", id).First(&session).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &session, nil
+}
+
+func (repo *GormSessionRepository) ListActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("last_used_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (repo *GormSessionRepository) TouchSession(id string) error {
+	return database.DB.Model(&models.Session{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
+
+func (repo *GormSessionRepository) RevokeSession(id string) error {
+	return database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
@@ -1,6 +1,10 @@
 package repositories
 
 import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
 	"user-service/database"
 	"user-service/models"
 )
@@ -9,19 +13,144 @@ import (
 type UserRepository interface {
 	CreateUser(user *models.User) error
 	FindUserByName(name string) (*models.User, error)
+	FindUserByID(id uint) (*models.User, error)
+	// FindVisibleUsers returns the active users among the given ones,
+	// leaving out those the viewer blocked or was blocked by. A viewer of 0
+	// sees every active user.
+	FindVisibleUsers(viewerID uint, ids []uint) ([]models.User, error)
+	// UpdateProfile stores the given fields of the profile, named as in
+	// models.Profile, leaving the others as they are
+	UpdateProfile(id uint, profile *models.Profile, fields []string) error
+	// SearchUsers finds the active users whose name or display name starts
+	// with or resembles the query, best matches first. The searcher is left
+	// out, along with the users they blocked or were blocked by. A page
+	// continues after the given hit, if any.
+	SearchUsers(searcherID uint, query string, after *UserHit, limit int) ([]UserHit, error)
+	// BlockUser hides the users from each other; blocking twice is harmless
+	BlockUser(blockerID, blockedID uint) error
+	UnblockUser(blockerID, blockedID uint) error
+	// DeactivateUser marks the user deactivated, keeping the time of an
+	// earlier deactivation, or returns ErrNotFound if they don't exist
+	DeactivateUser(id uint) error
+}
+
+// UserHit is a user matching a search, with how well they match
+type UserHit struct {
+	models.User
+	Rank float64
 }
 
 type GormUserRepository struct{}
 
 func (repo *GormUserRepository) CreateUser(user *models.User) error {
-	return database.DB.Create(user).Error
+	return translateError(database.DB.Create(user).Error)
 }
 
 func (repo *GormUserRepository) FindUserByName(name string) (*models.User, error) {
 	var user models.User
 	err := database.DB.Where("name = ?", name).First(&user).Error
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (repo *GormUserRepository) FindUserByID(id uint) (*models.User, error) {
+	var user models.User
+	err := database.DB.First(&user, id).Error
+	if err != nil {
+		return nil, translateError(err)
 	}
 	return &user, nil
 }
+
+func (repo *GormUserRepository) FindVisibleUsers(viewerID uint, ids []uint) ([]models.User, error) {
+	var users []models.User
+	err := database.DB.
+		Where("id IN ? AND deactivated_at IS NULL", ids).
+		Where(notBlocked, map[string]interface{}{"viewer": viewerID}).
+		Find(&users).Error
+	return users, err
+}
+
+func (repo *GormUserRepository) UpdateProfile(id uint, profile *models.Profile, fields []string) error {
+	result := database.DB.Model(&models.User{ID: id}).
+		Select(append(fields, "Updated")).
+		Updates(&models.User{Profile: *profile, Updated: time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (repo *GormUserRepository) BlockUser(blockerID, blockedID uint) error {
+	block := models.Block{BlockerID: blockerID, BlockedID: blockedID, Created: time.Now()}
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error
+}
+
+func (repo *GormUserRepository) UnblockUser(blockerID, blockedID uint) error {
+	return database.DB.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.Block{}).Error
+}
+
+func (repo *GormUserRepository) DeactivateUser(id uint) error {
+	result := database.DB.Model(&models.User{}).
+		Where("id = ?", id).
+		Update("deactivated_at", gorm.Expr("COALESCE(deactivated_at, ?)", time.Now()))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// notBlocked keeps the users that the @viewer neither blocked nor was
+// blocked by
+const notBlocked = `NOT EXISTS (
+	SELECT 1 FROM blocks
+	WHERE (blocks.blocker_id = @viewer AND blocks.blocked_id = users.id)
+		OR (blocks.blocker_id = users.id AND blocks.blocked_id = @viewer)
+)`
+
+// searchRank scores how well a user matches the query: exact names beat
+// prefixes, which beat names that merely look alike
+const searchRank = `(GREATEST(similarity(users.name, @query), similarity(users.display_name, @query)) +
+	CASE WHEN lower(users.name) = @query OR lower(users.display_name) = @query THEN 2
+		WHEN users.name ILIKE @prefix OR users.display_name ILIKE @prefix THEN 1
+		ELSE 0 END)::float8`
+
+func (repo *GormUserRepository) SearchUsers(searcherID uint, query string, after *UserHit, limit int) ([]UserHit, error) {
+	query = strings.ToLower(query)
+	arguments := map[string]interface{}{
+		"viewer":  searcherID,
+		"query":   query,
+		"prefix":  likeEscaper.Replace(query) + "%",
+		"afterID": uint(0),
+		"rank":    float64(0),
+		"limit":   limit,
+	}
+	if after != nil {
+		arguments["afterID"], arguments["rank"] = after.ID, after.Rank
+	}
+
+	var hits []UserHit
+	err := database.DB.Raw(`SELECT * FROM (
+			SELECT users.*, `+searchRank+` AS rank
+			FROM users
+			WHERE users.deactivated_at IS NULL AND users.id <> @viewer
+				AND (users.name ILIKE @prefix OR users.display_name ILIKE @prefix
+					OR users.name % @query OR users.display_name % @query)
+				AND `+notBlocked+`
+		) AS hits
+		WHERE @afterID = 0 OR hits.rank < @rank OR (hits.rank = @rank AND hits.id > @afterID)
+		ORDER BY hits.rank DESC, hits.id
+		LIMIT @limit`, arguments).Scan(&hits).Error
+	return hits, err
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
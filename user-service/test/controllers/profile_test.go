@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"strings"
+	"testing"
+	"user-service/controllers"
+	"user-service/models"
+	"user-service/proto"
+	"user-service/test"
+)
+
+// TestGetUser checks that the profile is returned and unknown users are not found
+func TestGetUser(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "alice", Profile: models.Profile{DisplayName: "Alice", Locale: "en-GB"}})
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	response, err := client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 1})
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	assert.Equal(t, "alice", response.User.Name)
+	assert.Equal(t, "Alice", response.User.Profile.DisplayName)
+	assert.Equal(t, "en-GB", response.User.Profile.Locale)
+
+	_, err = client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestReadMask checks that only the profile fields listed in the read mask are returned
+func TestReadMask(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "alice", Profile: models.Profile{
+		DisplayName: "Alice", Bio: "hello", AvatarAttachmentID: 7, AvatarKey: "1/avatar-thumbnail", Locale: "en-GB",
+	}})
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"displayName", "avatarAttachmentId"}}
+	response, err := client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 1, ReadMask: mask})
+	if err != nil {
+		t.Fatalf("GetUser failed: %v", err)
+	}
+	assert.Equal(t, "alice", response.User.Name)
+	assert.Equal(t, &proto.Profile{DisplayName: "Alice", AvatarAttachmentId: 7}, response.User.Profile)
+	assert.Equal(t, "1/avatar-thumbnail", response.User.AvatarKey)
+
+	batch, err := client.GetUsersBatch(context.Background(), &proto.GetUsersBatchRequest{
+		UserIds:  []int32{1},
+		ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"bio"}},
+	})
+	if err != nil {
+		t.Fatalf("GetUsersBatch failed: %v", err)
+	}
+	if assert.Len(t, batch.Users, 1) {
+		assert.Equal(t, &proto.Profile{Bio: "hello"}, batch.Users[0].Profile)
+		assert.Empty(t, batch.Users[0].AvatarKey)
+	}
+
+	_, err = client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 1, ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"password"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetUsersBatch(context.Background(), &proto.GetUsersBatchRequest{UserIds: []int32{1}, ReadMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestUpdateProfile checks that only the masked fields change and the change is published
+func TestUpdateProfile(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "alice", Profile: models.Profile{DisplayName: "Alice", Bio: "hello"}})
+	publisher := &test.MockPublisher{}
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository, Publisher: publisher})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	response, err := client.UpdateProfile(context.Background(), &proto.UpdateProfileRequest{
+		UserId:     1,
+		Profile:    &proto.Profile{DisplayName: "ignored", Bio: " Hi\r\nthere ", AvatarAttachmentId: 7, Locale: "en-gb", TimeZone: "Europe/London"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"bio", "avatarAttachmentId", "locale", "timeZone"}},
+		AvatarKey:  "1/avatar-thumbnail",
+	})
+	if err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+
+	profile := response.User.Profile
+	assert.Equal(t, "Alice", profile.DisplayName)
+	assert.Equal(t, "Hi\nthere", profile.Bio)
+	assert.Equal(t, int64(7), profile.AvatarAttachmentId)
+	assert.Equal(t, "en-GB", profile.Locale)
+	assert.Equal(t, "Europe/London", profile.TimeZone)
+	assert.Equal(t, "1/avatar-thumbnail", response.User.AvatarKey)
+
+	stored, _ := repository.FindUserByID(1)
+	assert.Equal(t, "Alice", stored.Profile.DisplayName)
+	assert.Equal(t, "1/avatar-thumbnail", stored.Profile.AvatarKey)
+
+	if assert.Len(t, publisher.ProfileUpdates, 1) {
+		assert.Equal(t, []string{"bio", "avatarAttachmentId", "locale", "timeZone"}, publisher.ProfileUpdates[0].Fields)
+	}
+
+	// Clearing the avatar drops its storage keys
+	_, err = client.UpdateProfile(context.Background(), &proto.UpdateProfileRequest{
+		UserId:     1,
+		Profile:    &proto.Profile{},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"avatarAttachmentId"}},
+	})
+	assert.NoError(t, err)
+	stored, _ = repository.FindUserByID(1)
+	assert.Zero(t, stored.Profile.AvatarAttachmentID)
+	assert.Empty(t, stored.Profile.AvatarKey)
+}
+
+// TestUpdateProfileValidation checks that bad masks and values are rejected without storing anything
+func TestUpdateProfileValidation(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "alice"})
+	publisher := &test.MockPublisher{}
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository, Publisher: publisher})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	requests := map[string]*proto.UpdateProfileRequest{
+		"empty mask":     {UserId: 1, Profile: &proto.Profile{DisplayName: "Alice"}},
+		"unknown field":  {UserId: 1, Profile: &proto.Profile{}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}}},
+		"long name":      {UserId: 1, Profile: &proto.Profile{DisplayName: strings.Repeat("a", 65)}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"displayName"}}},
+		"line break":     {UserId: 1, Profile: &proto.Profile{DisplayName: "Al\nice"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"displayName"}}},
+		"bad locale":     {UserId: 1, Profile: &proto.Profile{Locale: "not a locale"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"locale"}}},
+		"bad time zone":  {UserId: 1, Profile: &proto.Profile{TimeZone: "Mars/Olympus"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"timeZone"}}},
+		"unresolved key": {UserId: 1, Profile: &proto.Profile{AvatarAttachmentId: 7}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"avatarAttachmentId"}}},
+		"no user":        {Profile: &proto.Profile{Bio: "hi"}, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"bio"}}},
+	}
+	for name, request := range requests {
+		_, err := client.UpdateProfile(context.Background(), request)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), name)
+	}
+
+	_, err := client.UpdateProfile(context.Background(), &proto.UpdateProfileRequest{
+		UserId:     2,
+		Profile:    &proto.Profile{Bio: "hi"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"bio"}},
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Empty(t, publisher.ProfileUpdates)
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+	"user-service/controllers"
+	"user-service/models"
+	"user-service/proto"
+	"user-service/test"
+)
+
+func userIDs(users []*proto.User) []int32 {
+	ids := make([]int32, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.UserId)
+	}
+	return ids
+}
+
+// TestSearchUsers checks that better matches come first and pages continue where they stopped
+func TestSearchUsers(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "searcher"})
+	repository.CreateUser(&models.User{ID: 2, Name: "annabel"})
+	repository.CreateUser(&models.User{ID: 3, Name: "joanna"})
+	repository.CreateUser(&models.User{ID: 4, Name: "x1", Profile: models.Profile{DisplayName: "Anna"}})
+	repository.CreateUser(&models.User{ID: 5, Name: "anne"})
+	repository.CreateUser(&models.User{ID: 6, Name: "bob"})
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	response, err := client.SearchUsers(context.Background(), &proto.SearchUsersRequest{UserId: 1, Query: " ANN "})
+	if err != nil {
+		t.Fatalf("SearchUsers failed: %v", err)
+	}
+	assert.Equal(t, []int32{2, 4, 5, 3}, userIDs(response.Users))
+	assert.Empty(t, response.NextCursor)
+
+	var paged []int32
+	request := &proto.SearchUsersRequest{UserId: 1, Query: "anna", PageSize: 1}
+	for {
+		page, err := client.SearchUsers(context.Background(), request)
+		if err != nil {
+			t.Fatalf("SearchUsers failed: %v", err)
+		}
+		paged = append(paged, userIDs(page.Users)...)
+		if page.NextCursor == "" {
+			break
+		}
+		request.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []int32{4, 2, 3}, paged)
+}
+
+// TestSearchUsersHidden checks that the searcher, blocked and deactivated users are left out
+func TestSearchUsersHidden(t *testing.T) {
+	deactivated := time.Now()
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "sam"})
+	repository.CreateUser(&models.User{ID: 2, Name: "samantha"})
+	repository.CreateUser(&models.User{ID: 3, Name: "samuel"})
+	repository.CreateUser(&models.User{ID: 4, Name: "samira", DeactivatedAt: &deactivated})
+	repository.CreateUser(&models.User{ID: 5, Name: "samson"})
+	repository.Blocks = []models.Block{{BlockerID: 1, BlockedID: 2}, {BlockerID: 3, BlockedID: 1}}
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	response, err := client.SearchUsers(context.Background(), &proto.SearchUsersRequest{UserId: 1, Query: "sam"})
+	if err != nil {
+		t.Fatalf("SearchUsers failed: %v", err)
+	}
+	assert.Equal(t, []int32{5}, userIDs(response.Users))
+
+	requests := map[string]*proto.SearchUsersRequest{
+		"short query":    {UserId: 1, Query: " s "},
+		"negative page":  {UserId: 1, Query: "sam", PageSize: -1},
+		"invalid cursor": {UserId: 1, Query: "sam", Cursor: "not a cursor"},
+	}
+	for name, request := range requests {
+		_, err := client.SearchUsers(context.Background(), request)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), name)
+	}
+}
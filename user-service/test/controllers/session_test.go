@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+	"user-service/controllers"
+	"user-service/models"
+	"user-service/proto"
+	"user-service/test"
+)
+
+func newSessionServer() *controllers.UserServiceServer {
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{
+		ID:       uint(1),
+		Name:     "testuser",
+		Password: string(passwordHash),
+	})
+
+	return &controllers.UserServiceServer{
+		UserRepo:         repository,
+		RefreshTokenRepo: test.NewMockRefreshTokenRepository(),
+		SessionRepo:      test.NewMockSessionRepository(),
+	}
+}
+
+func loginFrom(t *testing.T, client proto.UserServiceClient, deviceName string) *proto.LoginResponse {
+	response, err := client.Login(context.Background(), &proto.LoginRequest{
+		Name:       "testuser",
+		Password:   "password123",
+		DeviceName: deviceName,
+		IpAddress:  "127.0.0.1",
+		UserAgent:  "test-agent",
+	})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	return response
+}
+
+// TestListSessions checks that every login is listed with its device details
+func TestListSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := test.InitGrpcServer(t, newSessionServer())
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	phone := loginFrom(t, client, "phone")
+	loginFrom(t, client, "laptop")
+
+	response, err := client.ListSessions(context.Background(), &proto.ListSessionsRequest{
+		UserId:           phone.UserId,
+		CurrentSessionId: phone.SessionId,
+	})
+	if err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+
+	assert.Len(t, response.Sessions, 2)
+	for _, session := range response.Sessions {
+		assert.Equal(t, "127.0.0.1", session.IpAddress)
+		assert.Equal(t, "test-agent", session.UserAgent)
+		assert.Equal(t, session.DeviceName == "phone", session.Current)
+	}
+}
+
+// TestLogout checks that logging out invalidates the session's refresh token
+func TestLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := test.InitGrpcServer(t, newSessionServer())
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	login := loginFrom(t, client, "phone")
+
+	_, err := client.Logout(context.Background(), &proto.LogoutRequest{UserId: login.UserId, SessionId: login.SessionId})
+	if err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+
+	_, err = client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{
+		UserId:       login.UserId,
+		RefreshToken: login.RefreshToken,
+	})
+	assert.Contains(t, err.Error(), "invalid or expired refresh token")
+
+	_, err = client.Logout(context.Background(), &proto.LogoutRequest{UserId: login.UserId, SessionId: login.SessionId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, err.Error(), "session not found")
+}
+
+// TestRevokeSessionOfAnotherUser checks that a user can't revoke foreign sessions
+func TestRevokeSessionOfAnotherUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := test.InitGrpcServer(t, newSessionServer())
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	login := loginFrom(t, client, "phone")
+
+	_, err := client.RevokeSession(context.Background(), &proto.RevokeSessionRequest{
+		UserId:    login.UserId + 1,
+		SessionId: login.SessionId,
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Contains(t, err.Error(), "session not found")
+}
+
+// TestRevokeAllOtherSessions checks that only the current session survives
+func TestRevokeAllOtherSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := test.InitGrpcServer(t, newSessionServer())
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	laptop := loginFrom(t, client, "laptop")
+	phone := loginFrom(t, client, "phone")
+	loginFrom(t, client, "tablet")
+
+	response, err := client.RevokeSession(context.Background(), &proto.RevokeSessionRequest{
+		UserId:           laptop.UserId,
+		CurrentSessionId: laptop.SessionId,
+		AllOtherSessions: true,
+	})
+	if err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	assert.Equal(t, int32(2), response.RevokedSessions)
+
+	_, err = client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{
+		UserId:       phone.UserId,
+		RefreshToken: phone.RefreshToken,
+	})
+	assert.Contains(t, err.Error(), "invalid or expired refresh token")
+
+	_, err = client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{
+		UserId:       laptop.UserId,
+		RefreshToken: laptop.RefreshToken,
+	})
+	assert.NoError(t, err)
+}
+
+// TestDeactivateUser checks that deactivating signs out every session,
+// revokes every refresh token and keeps the user from logging in again
+func TestDeactivateUser(t *testing.T) {
+	server := newSessionServer()
+	conn := test.InitGrpcServer(t, server)
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	phone := loginFrom(t, client, "phone")
+	loginFrom(t, client, "laptop")
+	// A token outside of any active session
+	orphan := &models.RefreshToken{UserID: 1, FamilyID: "revoked-session", TokenHash: "orphan", ExpiresAt: time.Now().Add(time.Hour)}
+	assert.NoError(t, server.RefreshTokenRepo.CreateRefreshToken(orphan))
+
+	response, err := client.DeactivateUser(context.Background(), &proto.DeactivateUserRequest{UserId: phone.UserId})
+	if err != nil {
+		t.Fatalf("DeactivateUser failed: %v", err)
+	}
+	assert.EqualValues(t, 2, response.RevokedSessions)
+	stored, err := server.RefreshTokenRepo.FindRefreshTokenByHash("orphan")
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.RevokedAt)
+
+	_, err = client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{UserId: phone.UserId, RefreshToken: phone.RefreshToken})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.Login(context.Background(), &proto.LoginRequest{Name: "testuser", Password: "password123"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Deactivating again is harmless
+	response, err = client.DeactivateUser(context.Background(), &proto.DeactivateUserRequest{UserId: phone.UserId})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, response.GetRevokedSessions())
+
+	_, err = client.DeactivateUser(context.Background(), &proto.DeactivateUserRequest{UserId: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
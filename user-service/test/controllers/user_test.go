@@ -5,11 +5,16 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"strings"
 	"testing"
 	"time"
 	"user-service/controllers"
 	"user-service/models"
 	"user-service/proto"
+	"user-service/repositories"
 	"user-service/test"
 )
 
@@ -59,7 +64,34 @@ func TestRegisterInvalidInput(t *testing.T) {
 		t.Error("Expected error for invalid input, got nil:")
 	}
 
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 	assert.Contains(t, err.Error(), "invalid name")
+	assert.Equal(t, []string{"name"}, violatedFields(err))
+}
+
+// TestRegisterPasswordTooLong checks that bcrypt's limit is reported as a field violation
+func TestRegisterPasswordTooLong(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := &controllers.UserServiceServer{UserRepo: test.NewMockUserRepository()}
+	conn := test.InitGrpcServer(t, server)
+	defer conn.Close()
+
+	request := proto.RegisterRequest{
+		Name:     "testuser",
+		Password: strings.Repeat("x", 73),
+	}
+
+	client := proto.NewUserServiceClient(conn)
+	_, err := client.Register(context.Background(), &request)
+	if err == nil {
+		t.Fatal("Expected error for too long password, got nil")
+	}
+
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.NotContains(t, err.Error(), "bcrypt")
+	assert.Equal(t, []string{"password"}, violatedFields(err))
 }
 
 // TestRegisterUserAlreadyExists rejects registration if user exists
@@ -86,9 +118,33 @@ func TestRegisterUserAlreadyExists(t *testing.T) {
 		t.Error("Expected error for invalid input, got nil")
 	}
 
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
 	assert.Contains(t, err.Error(), "user already exists")
 }
 
+// lateCreateRepository misses a user created between the lookup and the insert
+type lateCreateRepository struct {
+	*test.MockUserRepository
+}
+
+func (r lateCreateRepository) FindUserByName(string) (*models.User, error) {
+	return nil, repositories.ErrNotFound
+}
+
+// TestRegisterRace checks that a name taken after the lookup is still reported as existing
+func TestRegisterRace(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{Name: "existinguser"})
+
+	server := &controllers.UserServiceServer{UserRepo: lateCreateRepository{repository}}
+	conn := test.InitGrpcServer(t, server)
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	_, err := client.Register(context.Background(), &proto.RegisterRequest{Name: "existinguser", Password: "password"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
 // TestLoginSuccess checks correct login attempt
 func TestLoginSuccess(t *testing.T) {
 	ctrl := gomock.NewController(t)
@@ -104,7 +160,11 @@ func TestLoginSuccess(t *testing.T) {
 		Password: string(passwordHash),
 	})
 
-	server := &controllers.UserServiceServer{UserRepo: repository}
+	server := &controllers.UserServiceServer{
+		UserRepo:         repository,
+		RefreshTokenRepo: test.NewMockRefreshTokenRepository(),
+		SessionRepo:      test.NewMockSessionRepository(),
+	}
 	conn := test.InitGrpcServer(t, server)
 	defer conn.Close()
 
@@ -152,7 +212,9 @@ func TestLoginInvalidInput(t *testing.T) {
 		t.Errorf("Expected error for invalid input, got nil")
 	}
 
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
 	assert.Contains(t, err.Error(), "invalid input")
+	assert.Equal(t, []string{"password"}, violatedFields(err))
 }
 
 // TestLoginInvalidCredentials checks wrong password case
@@ -183,10 +245,11 @@ func TestLoginInvalidCredentials(t *testing.T) {
 		t.Errorf("Expected error for invalid input, got nil")
 	}
 
-	assert.Contains(t, err.Error(), "invalid credentials")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid credentials", status.Convert(err).Message())
 }
 
-// TestLoginUserNotFound checks case when user doesn't exist
+// TestLoginUserNotFound checks that unknown users can't be told apart from wrong passwords
 func TestLoginUserNotFound(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -208,5 +271,46 @@ func TestLoginUserNotFound(t *testing.T) {
 		t.Errorf("Expected error for invalid input, got nil")
 	}
 
-	assert.Contains(t, err.Error(), "user not found")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "invalid credentials", status.Convert(err).Message())
+}
+
+// TestLoginDeactivated checks that deactivated users can't log in, even with the right password
+func TestLoginDeactivated(t *testing.T) {
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	deactivatedAt := time.Now()
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{
+		Name:          "testuser",
+		Password:      string(passwordHash),
+		DeactivatedAt: &deactivatedAt,
+	})
+
+	server := &controllers.UserServiceServer{
+		UserRepo:         repository,
+		RefreshTokenRepo: test.NewMockRefreshTokenRepository(),
+		SessionRepo:      test.NewMockSessionRepository(),
+	}
+	conn := test.InitGrpcServer(t, server)
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	_, err := client.Login(context.Background(), &proto.LoginRequest{Name: "testuser", Password: "password123"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.Login(context.Background(), &proto.LoginRequest{Name: "testuser", Password: "wrongpassword"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// violatedFields lists the fields named in the error's BadRequest details
+func violatedFields(err error) []string {
+	var fields []string
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, violation := range badRequest.FieldViolations {
+				fields = append(fields, violation.Field)
+			}
+		}
+	}
+	return fields
 }
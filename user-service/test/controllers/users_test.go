@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+	"user-service/controllers"
+	"user-service/models"
+	"user-service/proto"
+	"user-service/test"
+)
+
+// TestGetUsersBatch checks that known users are returned and unknown IDs left out
+func TestGetUsersBatch(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "alice"})
+	repository.CreateUser(&models.User{ID: 2, Name: "bob"})
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	response, err := client.GetUsersBatch(context.Background(), &proto.GetUsersBatchRequest{UserIds: []int32{2, 3}})
+	if err != nil {
+		t.Fatalf("GetUsersBatch failed: %v", err)
+	}
+
+	assert.Len(t, response.Users, 1)
+	assert.Equal(t, int32(2), response.Users[0].UserId)
+	assert.Equal(t, "bob", response.Users[0].Name)
+
+	_, err = client.GetUsersBatch(context.Background(), &proto.GetUsersBatchRequest{UserIds: make([]int32, 501)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestHiddenUsers checks that deactivated users are hidden from everyone, and
+// blocked users from the users they blocked or were blocked by
+func TestHiddenUsers(t *testing.T) {
+	deactivatedAt := time.Now()
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "alice"})
+	repository.CreateUser(&models.User{ID: 2, Name: "bob"})
+	repository.CreateUser(&models.User{ID: 3, Name: "carol"})
+	repository.CreateUser(&models.User{ID: 4, Name: "dave", DeactivatedAt: &deactivatedAt})
+	repository.Blocks = []models.Block{{BlockerID: 2, BlockedID: 1}}
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	visible := func(viewerID int32) []string {
+		response, err := client.GetUsersBatch(context.Background(), &proto.GetUsersBatchRequest{UserIds: []int32{1, 2, 3, 4}, ViewerId: viewerID})
+		if err != nil {
+			t.Fatalf("GetUsersBatch failed: %v", err)
+		}
+		var names []string
+		for _, user := range response.Users {
+			names = append(names, user.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"alice", "carol"}, visible(1))
+	assert.Equal(t, []string{"bob", "carol"}, visible(2))
+	assert.Equal(t, []string{"alice", "bob", "carol"}, visible(3))
+	assert.Equal(t, []string{"alice", "bob", "carol"}, visible(0))
+
+	_, err := client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 2, ViewerId: 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 1, ViewerId: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 4})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 2, ViewerId: 3})
+	assert.NoError(t, err)
+}
+
+// TestBlockUser checks that blocking hides the users from each other until
+// the block is lifted
+func TestBlockUser(t *testing.T) {
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{ID: 1, Name: "alice"})
+	repository.CreateUser(&models.User{ID: 2, Name: "bob"})
+
+	conn := test.InitGrpcServer(t, &controllers.UserServiceServer{UserRepo: repository})
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	for i := 0; i < 2; i++ {
+		_, err := client.BlockUser(context.Background(), &proto.BlockUserRequest{UserId: 1, BlockedUserId: 2})
+		assert.NoError(t, err)
+	}
+	assert.Len(t, repository.Blocks, 1)
+	_, err := client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 1, ViewerId: 2})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	// Only the blocker can lift the block
+	_, err = client.UnblockUser(context.Background(), &proto.UnblockUserRequest{UserId: 2, BlockedUserId: 1})
+	assert.NoError(t, err)
+	assert.Len(t, repository.Blocks, 1)
+	_, err = client.UnblockUser(context.Background(), &proto.UnblockUserRequest{UserId: 1, BlockedUserId: 2})
+	assert.NoError(t, err)
+	assert.Empty(t, repository.Blocks)
+	_, err = client.GetUser(context.Background(), &proto.GetUserRequest{UserId: 1, ViewerId: 2})
+	assert.NoError(t, err)
+
+	_, err = client.BlockUser(context.Background(), &proto.BlockUserRequest{UserId: 1, BlockedUserId: 1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.BlockUser(context.Background(), &proto.BlockUserRequest{UserId: 1, BlockedUserId: 0})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.BlockUser(context.Background(), &proto.BlockUserRequest{UserId: 1, BlockedUserId: 3})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -2,18 +2,38 @@ package test
 
 import (
 	"context"
-	"errors"
+	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/test/bufconn"
 	_ "google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 	"net"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+	"user-service/database"
 	"user-service/models"
 	"user-service/proto"
+	"user-service/repositories"
+	"user-service/utils"
 )
 
+func init() {
+	key, err := utils.GenerateSigningKey("test", jwt.SigningMethodEdDSA)
+	if err != nil {
+		panic(err)
+	}
+	utils.SigningKeys, _ = utils.NewKeySet(key.ID, key)
+}
+
 type MockUserRepository struct {
-	users map[string]*models.User // Simulates an in-memory storage of users by email
+	users  map[string]*models.User // Simulates an in-memory storage of users by email
+	Blocks []models.Block
 }
 
 func NewMockUserRepository() *MockUserRepository {
@@ -24,7 +44,7 @@ func NewMockUserRepository() *MockUserRepository {
 
 func (m *MockUserRepository) CreateUser(user *models.User) error {
 	if _, exists := m.users[user.Name]; exists {
-		return errors.New("user already exists")
+		return repositories.ErrAlreadyExists
 	}
 	m.users[user.Name] = user
 	return nil
@@ -33,11 +53,279 @@ func (m *MockUserRepository) CreateUser(user *models.User) error {
 func (m *MockUserRepository) FindUserByName(name string) (*models.User, error) {
 	user, exists := m.users[name]
 	if !exists {
-		return nil, errors.New("user not found")
+		return nil, repositories.ErrNotFound
 	}
 	return user, nil
 }
 
+func (m *MockUserRepository) FindUserByID(id uint) (*models.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			stored := *user
+			return &stored, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (m *MockUserRepository) FindVisibleUsers(viewerID uint, ids []uint) ([]models.User, error) {
+	var users []models.User
+	for _, id := range ids {
+		for _, user := range m.users {
+			if user.ID == id && user.DeactivatedAt == nil && !m.blocked(viewerID, user.ID) {
+				users = append(users, *user)
+			}
+		}
+	}
+	return users, nil
+}
+
+func (m *MockUserRepository) UpdateProfile(id uint, profile *models.Profile, fields []string) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			stored := reflect.ValueOf(&user.Profile).Elem()
+			for _, field := range fields {
+				stored.FieldByName(field).Set(reflect.ValueOf(profile).Elem().FieldByName(field))
+			}
+			return nil
+		}
+	}
+	return repositories.ErrNotFound
+}
+
+// SearchUsers ranks exact names over prefixes over names containing the
+// query, which stand in for the trigram similarity of the database
+func (m *MockUserRepository) SearchUsers(searcherID uint, query string, after *repositories.UserHit, limit int) ([]repositories.UserHit, error) {
+	query = strings.ToLower(query)
+	var hits []repositories.UserHit
+	for _, user := range m.users {
+		if user.ID == searcherID || user.DeactivatedAt != nil || m.blocked(searcherID, user.ID) {
+			continue
+		}
+		var rank float64
+		for _, name := range []string{strings.ToLower(user.Name), strings.ToLower(user.Profile.DisplayName)} {
+			switch {
+			case name == "":
+			case name == query:
+				rank = max(rank, 2)
+			case strings.HasPrefix(name, query):
+				rank = max(rank, 1)
+			case strings.Contains(name, query):
+				rank = max(rank, 0.5)
+			}
+		}
+		if rank == 0 {
+			continue
+		}
+		if after != nil && (rank > after.Rank || rank == after.Rank && user.ID <= after.ID) {
+			continue
+		}
+		hits = append(hits, repositories.UserHit{User: *user, Rank: rank})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func (m *MockUserRepository) BlockUser(blockerID, blockedID uint) error {
+	for _, block := range m.Blocks {
+		if block.BlockerID == blockerID && block.BlockedID == blockedID {
+			return nil
+		}
+	}
+	m.Blocks = append(m.Blocks, models.Block{BlockerID: blockerID, BlockedID: blockedID, Created: time.Now()})
+	return nil
+}
+
+func (m *MockUserRepository) UnblockUser(blockerID, blockedID uint) error {
+	m.Blocks = slices.DeleteFunc(m.Blocks, func(block models.Block) bool {
+		return block.BlockerID == blockerID && block.BlockedID == blockedID
+	})
+	return nil
+}
+
+func (m *MockUserRepository) DeactivateUser(id uint) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			if user.DeactivatedAt == nil {
+				now := time.Now()
+				user.DeactivatedAt = &now
+			}
+			return nil
+		}
+	}
+	return repositories.ErrNotFound
+}
+
+func (m *MockUserRepository) blocked(first, second uint) bool {
+	for _, block := range m.Blocks {
+		if block.BlockerID == first && block.BlockedID == second || block.BlockerID == second && block.BlockedID == first {
+			return true
+		}
+	}
+	return false
+}
+
+// PublishedProfileUpdate is a profile update announced through MockPublisher
+type PublishedProfileUpdate struct {
+	User   models.User
+	Fields []string
+}
+
+// MockPublisher records the events instead of writing them to Kafka
+type MockPublisher struct {
+	ProfileUpdates []PublishedProfileUpdate
+}
+
+func (m *MockPublisher) ProfileUpdated(ctx context.Context, user *models.User, fields []string, updated time.Time) error {
+	m.ProfileUpdates = append(m.ProfileUpdates, PublishedProfileUpdate{User: *user, Fields: fields})
+	return nil
+}
+
+type MockRefreshTokenRepository struct {
+	tokens []*models.RefreshToken // Simulates an in-memory storage of refresh tokens
+}
+
+func NewMockRefreshTokenRepository() *MockRefreshTokenRepository {
+	return &MockRefreshTokenRepository{}
+}
+
+func (m *MockRefreshTokenRepository) CreateRefreshToken(token *models.RefreshToken) error {
+	token.ID = uint(len(m.tokens) + 1)
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) FindRefreshTokenByHash(hash string) (*models.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			stored := *token
+			return &stored, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (m *MockRefreshTokenRepository) MarkRefreshTokenUsed(id uint) error {
+	for _, token := range m.tokens {
+		if token.ID == id {
+			if token.UsedAt != nil {
+				return repositories.ErrRefreshTokenAlreadyUsed
+			}
+			now := time.Now()
+			token.UsedAt = &now
+			return nil
+		}
+	}
+	return repositories.ErrNotFound
+}
+
+func (m *MockRefreshTokenRepository) RevokeRefreshTokenFamily(familyID string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *MockRefreshTokenRepository) RevokeUserRefreshTokens(userID uint) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type MockSessionRepository struct {
+	sessions map[string]*models.Session // Simulates an in-memory storage of sessions by ID
+}
+
+func NewMockSessionRepository() *MockSessionRepository {
+	return &MockSessionRepository{
+		sessions: make(map[string]*models.Session),
+	}
+}
+
+func (m *MockSessionRepository) CreateSession(session *models.Session) error {
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *MockSessionRepository) FindSessionByID(id string) (*models.Session, error) {
+	session, exists := m.sessions[id]
+	if !exists {
+		return nil, repositories.ErrNotFound
+	}
+	stored := *session
+	return &stored, nil
+}
+
+func (m *MockSessionRepository) ListActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			sessions = append(sessions, *session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *MockSessionRepository) TouchSession(id string) error {
+	if session, exists := m.sessions[id]; exists {
+		session.LastUsedAt = time.Now()
+	}
+	return nil
+}
+
+func (m *MockSessionRepository) RevokeSession(id string) error {
+	if session, exists := m.sessions[id]; exists && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+// UseTestDatabase points the repositories at the Postgres database of
+// TEST_DATABASE_URL, skipping the test if it is unset. Everything runs in a
+// transaction rolled back when the test ends, so tests leave no rows behind.
+func UseTestDatabase(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	tx := db.Begin()
+	if err := database.Migrate(tx); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = tx
+	t.Cleanup(func() {
+		database.DB = previous
+		tx.Rollback()
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
 var listener *bufconn.Listener
 
 func InitGrpcServer(t *testing.T, server proto.UserServiceServer) *grpc.ClientConn {
@@ -47,7 +335,7 @@ func InitGrpcServer(t *testing.T, server proto.UserServiceServer) *grpc.ClientCo
 
 	go func() {
 		if err := s.Serve(listener); err != nil {
-			t.Fatalf("Server failed to start: %v", err)
+			t.Errorf("Server failed to start: %v", err)
 		}
 	}()
 
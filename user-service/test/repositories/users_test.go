@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"github.com/stretchr/testify/assert"
+	"slices"
+	"testing"
+	"user-service/models"
+	"user-service/repositories"
+	"user-service/test"
+)
+
+func createUser(t *testing.T, repo repositories.UserRepository, name, displayName string) uint {
+	user := &models.User{Name: name, Password: "hash", Profile: models.Profile{DisplayName: displayName}}
+	if err := repo.CreateUser(user); err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	return user.ID
+}
+
+// searchIDs pages through the search, returning the hits among the given
+// users, in order
+func searchIDs(t *testing.T, repo repositories.UserRepository, searcherID uint, query string, pageSize int, among []uint) []uint {
+	ids := []uint{}
+	var after *repositories.UserHit
+	for {
+		hits, err := repo.SearchUsers(searcherID, query, after, pageSize)
+		if err != nil {
+			t.Fatalf("SearchUsers failed: %v", err)
+		}
+		for _, hit := range hits {
+			if slices.Contains(among, hit.ID) {
+				ids = append(ids, hit.ID)
+			}
+		}
+		if len(hits) < pageSize {
+			return ids
+		}
+		after = &hits[len(hits)-1]
+	}
+}
+
+// TestSearchUsers checks the user search against Postgres: exact names come
+// first, then prefixes of names and display names, and names only resembling
+// the query are found by trigram similarity. The searcher, deactivated users
+// and users blocked either way are left out.
+func TestSearchUsers(t *testing.T) {
+	test.UseTestDatabase(t)
+	repo := &repositories.GormUserRepository{}
+
+	searcher := createUser(t, repo, "jonathan_searcher", "")
+	exact := createUser(t, repo, "jonathan", "")
+	prefix := createUser(t, repo, "jonathan_smith", "")
+	displayName := createUser(t, repo, "js42", "Jonathan S.")
+	similar := createUser(t, repo, "jonathon", "")
+	deactivated := createUser(t, repo, "jonathan_gone", "")
+	blocked := createUser(t, repo, "jonathan_blocked", "")
+	blocker := createUser(t, repo, "jonathan_blocker", "")
+	unrelated := createUser(t, repo, "margaret", "")
+	all := []uint{searcher, exact, prefix, displayName, similar, deactivated, blocked, blocker, unrelated}
+
+	assert.NoError(t, repo.DeactivateUser(deactivated))
+	assert.NoError(t, repo.BlockUser(searcher, blocked))
+	assert.NoError(t, repo.BlockUser(blocker, searcher))
+
+	ids := searchIDs(t, repo, searcher, "jonathan", 50, all)
+	if assert.Len(t, ids, 4) {
+		assert.Equal(t, exact, ids[0])
+		assert.ElementsMatch(t, []uint{prefix, displayName}, ids[1:3])
+		assert.Equal(t, similar, ids[3])
+	}
+
+	// Pages continue where the previous one ended
+	assert.Equal(t, ids, searchIDs(t, repo, searcher, "jonathan", 1, all))
+
+	// Wildcards of the query are matched literally
+	assert.Empty(t, searchIDs(t, repo, searcher, "jo%an", 50, []uint{exact, prefix}))
+
+	// Others still find the users hidden from the searcher
+	assert.Contains(t, searchIDs(t, repo, exact, "jonathan", 50, all), blocked)
+}
+
+// TestFindVisibleUsers checks that deactivated users are hidden from
+// everyone, and blocked users from the users on either side of the block
+func TestFindVisibleUsers(t *testing.T) {
+	test.UseTestDatabase(t)
+	repo := &repositories.GormUserRepository{}
+
+	alice := createUser(t, repo, "visible_alice", "")
+	bob := createUser(t, repo, "visible_bob", "")
+	carol := createUser(t, repo, "visible_carol", "")
+	dave := createUser(t, repo, "visible_dave", "")
+	all := []uint{alice, bob, carol, dave}
+
+	assert.NoError(t, repo.BlockUser(alice, bob))
+	assert.NoError(t, repo.BlockUser(alice, bob))
+	assert.NoError(t, repo.DeactivateUser(dave))
+	assert.NoError(t, repo.DeactivateUser(dave))
+	assert.ErrorIs(t, repo.DeactivateUser(dave+1000), repositories.ErrNotFound)
+
+	visible := func(viewerID uint) []uint {
+		users, err := repo.FindVisibleUsers(viewerID, all)
+		if err != nil {
+			t.Fatalf("FindVisibleUsers failed: %v", err)
+		}
+		ids := []uint{}
+		for _, user := range users {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+	assert.ElementsMatch(t, []uint{alice, carol}, visible(alice))
+	assert.ElementsMatch(t, []uint{bob, carol}, visible(bob))
+	assert.ElementsMatch(t, []uint{alice, bob, carol}, visible(carol))
+	assert.ElementsMatch(t, []uint{alice, bob, carol}, visible(0))
+
+	assert.NoError(t, repo.UnblockUser(alice, bob))
+	assert.ElementsMatch(t, []uint{alice, bob, carol}, visible(alice))
+}
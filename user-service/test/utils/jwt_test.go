@@ -2,9 +2,9 @@ package utils
 
 import (
 	"context"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	"testing"
 	"time"
 	"user-service/controllers"
@@ -14,48 +14,53 @@ import (
 	"user-service/utils"
 )
 
-func generateExpiredToken(userID uint, expiration time.Time) string {
-	claims := &utils.Claims{
-		UserID: userID,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expiration),
-		},
+const userName, password = "test@example.com", "password123"
+
+// newServer creates a server with a single registered user
+func newServer() (*controllers.UserServiceServer, *test.MockRefreshTokenRepository) {
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	repository := test.NewMockUserRepository()
+	repository.CreateUser(&models.User{
+		ID:       uint(1),
+		Name:     userName,
+		Password: string(passwordHash),
+	})
+
+	refreshTokenRepository := test.NewMockRefreshTokenRepository()
+	server := &controllers.UserServiceServer{
+		UserRepo:         repository,
+		RefreshTokenRepo: refreshTokenRepository,
+		SessionRepo:      test.NewMockSessionRepository(),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	expiredToken, _ := token.SignedString(utils.JwtSecret)
-	return expiredToken
+	return server, refreshTokenRepository
 }
 
-// Mock time setup for expired tokens
-var expiredTokenTime = time.Now().Add(-24 * time.Hour) // 24 hours in the past
+func login(t *testing.T, client proto.UserServiceClient) *proto.LoginResponse {
+	response, err := client.Login(context.Background(), &proto.LoginRequest{Name: userName, Password: password})
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	return response
+}
 
 // TestRefreshTokenSuccess checks correct refresh token attempt
 func TestRefreshTokenSuccess(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	userID := uint(1)
-	repository := test.NewMockUserRepository()
-	repository.CreateUser(&models.User{
-		ID:   userID,
-		Name: "test@example.com",
-	})
-
-	server := &controllers.UserServiceServer{UserRepo: repository}
+	server, _ := newServer()
 	conn := test.InitGrpcServer(t, server)
 	defer conn.Close()
 
-	// Generate a valid refresh token for the user
-	refreshToken, _, err := utils.GenerateRefreshToken(userID)
-	assert.NoError(t, err)
+	client := proto.NewUserServiceClient(conn)
+	loginResponse := login(t, client)
 
 	request := proto.RefreshTokenRequest{
-		UserId:       int32(userID),
-		RefreshToken: refreshToken,
+		UserId:       loginResponse.UserId,
+		RefreshToken: loginResponse.RefreshToken,
 	}
 
-	client := proto.NewUserServiceClient(conn)
 	response, err := client.RefreshToken(context.Background(), &request)
 	if err != nil {
 		t.Fatalf("Refresh token failed: %v", err)
@@ -64,6 +69,7 @@ func TestRefreshTokenSuccess(t *testing.T) {
 	// Check tokens and expiration dates
 	assert.NotEmpty(t, response.AccessToken)
 	assert.NotEmpty(t, response.RefreshToken)
+	assert.NotEqual(t, loginResponse.RefreshToken, response.RefreshToken)
 
 	atExpiresAt, rtExpiresAt := time.Unix(response.AccessTokenExpiresAt, 0), time.Unix(response.RefreshTokenExpiresAt, 0)
 
@@ -76,21 +82,20 @@ func TestRefreshTokenExpiredToken(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	userID := uint(1)
-	repository := test.NewMockUserRepository()
-	repository.CreateUser(&models.User{
-		ID:   userID,
-		Name: "test@example.com",
-	})
-
-	server := &controllers.UserServiceServer{UserRepo: repository}
+	server, refreshTokenRepository := newServer()
 	conn := test.InitGrpcServer(t, server)
 	defer conn.Close()
 
-	expiredToken := generateExpiredToken(userID, expiredTokenTime)
+	expiredToken, _, _ := utils.GenerateRefreshToken()
+	refreshTokenRepository.CreateRefreshToken(&models.RefreshToken{
+		UserID:    uint(1),
+		FamilyID:  "family",
+		TokenHash: utils.HashRefreshToken(expiredToken),
+		ExpiresAt: time.Now().Add(-24 * time.Hour),
+	})
 
 	request := proto.RefreshTokenRequest{
-		UserId:       int32(userID),
+		UserId:       int32(1),
 		RefreshToken: expiredToken,
 	}
 
@@ -105,9 +110,7 @@ func TestRefreshTokenInvalidToken(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
-	repository := test.NewMockUserRepository()
-
-	server := &controllers.UserServiceServer{UserRepo: repository}
+	server, _ := newServer()
 	conn := test.InitGrpcServer(t, server)
 	defer conn.Close()
 
@@ -122,3 +125,67 @@ func TestRefreshTokenInvalidToken(t *testing.T) {
 
 	assert.Contains(t, err.Error(), "invalid or expired refresh token")
 }
+
+// TestRefreshTokenWrongUser checks that a token can't be used on behalf of another user
+func TestRefreshTokenWrongUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server, _ := newServer()
+	conn := test.InitGrpcServer(t, server)
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	loginResponse := login(t, client)
+
+	request := proto.RefreshTokenRequest{
+		UserId:       loginResponse.UserId + 1,
+		RefreshToken: loginResponse.RefreshToken,
+	}
+
+	_, err := client.RefreshToken(context.Background(), &request)
+
+	assert.Contains(t, err.Error(), "invalid or expired refresh token")
+}
+
+// TestRefreshTokenReuseRevokesFamily checks that replaying a rotated token revokes its descendants
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server, _ := newServer()
+	conn := test.InitGrpcServer(t, server)
+	defer conn.Close()
+
+	client := proto.NewUserServiceClient(conn)
+	loginResponse := login(t, client)
+
+	// A second, independent login must survive the revocation
+	otherLoginResponse := login(t, client)
+
+	rotated, err := client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{
+		UserId:       loginResponse.UserId,
+		RefreshToken: loginResponse.RefreshToken,
+	})
+	assert.NoError(t, err)
+
+	// Replay the already rotated token
+	_, err = client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{
+		UserId:       loginResponse.UserId,
+		RefreshToken: loginResponse.RefreshToken,
+	})
+	assert.Contains(t, err.Error(), "invalid or expired refresh token")
+
+	// The token issued by the rotation belongs to the revoked family
+	_, err = client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{
+		UserId:       rotated.UserId,
+		RefreshToken: rotated.RefreshToken,
+	})
+	assert.Contains(t, err.Error(), "invalid or expired refresh token")
+
+	_, err = client.RefreshToken(context.Background(), &proto.RefreshTokenRequest{
+		UserId:       otherLoginResponse.UserId,
+		RefreshToken: otherLoginResponse.RefreshToken,
+	})
+	assert.NoError(t, err)
+}
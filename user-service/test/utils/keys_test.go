@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"user-service/utils"
+)
+
+func signedClaims(userID uint) *utils.Claims {
+	return &utils.Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+}
+
+// TestKeyRotation checks that tokens signed by a retired key are still accepted
+func TestKeyRotation(t *testing.T) {
+	oldKey, err := utils.GenerateSigningKey("2024-01", jwt.SigningMethodRS256)
+	assert.NoError(t, err)
+	newKey, err := utils.GenerateSigningKey("2024-02", jwt.SigningMethodEdDSA)
+	assert.NoError(t, err)
+
+	before, _ := utils.NewKeySet(oldKey.ID, oldKey)
+	oldToken, err := before.Sign(signedClaims(1))
+	assert.NoError(t, err)
+
+	after, _ := utils.NewKeySet(newKey.ID, oldKey, newKey)
+	newToken, err := after.Sign(signedClaims(2))
+	assert.NoError(t, err)
+
+	for _, tokenString := range []string{oldToken, newToken} {
+		_, err := jwt.ParseWithClaims(tokenString, &utils.Claims{}, after.Keyfunc)
+		assert.NoError(t, err)
+	}
+
+	token, _, _ := jwt.NewParser().ParseUnverified(newToken, &utils.Claims{})
+	assert.Equal(t, "2024-02", token.Header["kid"])
+	assert.Equal(t, "EdDSA", token.Header["alg"])
+
+	// A verifier that never learned about the new key rejects its tokens
+	_, err = jwt.ParseWithClaims(newToken, &utils.Claims{}, before.Keyfunc)
+	assert.Error(t, err)
+}
+
+// TestJWKS checks that every key is published with its public parameters only
+func TestJWKS(t *testing.T) {
+	rsaKey, _ := utils.GenerateSigningKey("rsa", jwt.SigningMethodRS256)
+	edKey, _ := utils.GenerateSigningKey("ed", jwt.SigningMethodEdDSA)
+	keySet, _ := utils.NewKeySet(rsaKey.ID, rsaKey, edKey)
+
+	jwks := keySet.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+
+	assert.Equal(t, "ed", jwks.Keys[0].KeyID)
+	assert.Equal(t, "OKP", jwks.Keys[0].KeyType)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Curve)
+	assert.NotEmpty(t, jwks.Keys[0].X)
+
+	assert.Equal(t, "rsa", jwks.Keys[1].KeyID)
+	assert.Equal(t, "RSA", jwks.Keys[1].KeyType)
+	assert.Equal(t, "RS256", jwks.Keys[1].Algorithm)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+}
+
+// TestUnknownActiveKey checks that the active key must belong to the set
+func TestUnknownActiveKey(t *testing.T) {
+	key, _ := utils.GenerateSigningKey("known", jwt.SigningMethodEdDSA)
+	_, err := utils.NewKeySet("unknown", key)
+	assert.Error(t, err)
+}
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SigningKeys is the key set used to sign and verify access tokens
+var SigningKeys *KeySet
+
+// SigningKey is a private key identified by the `kid` header of the tokens it signs
+type SigningKey struct {
+	ID         string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.Signer
+}
+
+// KeySet holds every key whose tokens are still accepted. Only the active key
+// signs new tokens; the rest stay published so that tokens signed before a
+// rotation remain verifiable until they expire.
+type KeySet struct {
+	activeID string
+	keys     map[string]*SigningKey
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewKeySet(activeID string, keys ...*SigningKey) (*KeySet, error) {
+	keySet := &KeySet{activeID: activeID, keys: make(map[string]*SigningKey)}
+	for _, key := range keys {
+		keySet.keys[key.ID] = key
+	}
+	if _, exists := keySet.keys[activeID]; !exists {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+	return keySet, nil
+}
+
+// LoadSigningKeys loads PEM encoded private keys named <kid>.pem from
+// JWT_KEYS_DIR. JWT_ACTIVE_KEY_ID picks the signing key, defaulting to the
+// last kid in lexical order. Without JWT_KEYS_DIR an ephemeral Ed25519 key is
+// generated, which is only suitable for local development.
+func LoadSigningKeys() error {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		log.Println("JWT_KEYS_DIR is not set, signing tokens with an ephemeral key")
+		key, err := GenerateSigningKey("ephemeral", jwt.SigningMethodEdDSA)
+		if err != nil {
+			return err
+		}
+		SigningKeys, err = NewKeySet(key.ID, key)
+		return err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no signing keys found in %s", dir)
+	}
+	sort.Strings(paths)
+
+	var keys []*SigningKey
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := ParseSigningKey(strings.TrimSuffix(filepath.Base(path), ".pem"), data)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %v", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	activeID := os.Getenv("JWT_ACTIVE_KEY_ID")
+	if activeID == "" {
+		activeID = keys[len(keys)-1].ID
+	}
+
+	SigningKeys, err = NewKeySet(activeID, keys...)
+	return err
+}
+
+// ParseSigningKey parses a PKCS#8 (RSA or Ed25519) or PKCS#1 (RSA) private key
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM data")
+	}
+
+	var privateKey interface{}
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodRS256, PrivateKey: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, PrivateKey: key}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", privateKey)
+	}
+}
+
+// GenerateSigningKey generates a fresh RS256 or EdDSA key
+func GenerateSigningKey(id string, method jwt.SigningMethod) (*SigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+	switch method {
+	case jwt.SigningMethodRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing method %s", method.Alg())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: id, Method: method, PrivateKey: privateKey}, nil
+}
+
+// Sign signs the claims with the active key
+func (keySet *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := keySet.keys[keySet.activeID]
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// Keyfunc resolves the verification key of a token by its `kid` header
+func (keySet *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, exists := keySet.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.PrivateKey.Public(), nil
+}
+
+// JWKS returns the public part of every key in the set
+func (keySet *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(keySet.keys))}
+	for _, key := range keySet.keys {
+		jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch publicKey := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID })
+	return jwks
+}
+
+// JWKSHandler serves the key set at /.well-known/jwks.json
+func (keySet *KeySet) JWKSHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(keySet.JWKS())
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+// GenerateRefreshToken generates an opaque long-lived refresh token. Only its
+// hash (see HashRefreshToken) is meant to be persisted.
+func GenerateRefreshToken() (string, time.Time, error) {
+	buffer := make([]byte, 32)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buffer), time.Now().Add(RefreshTokenTTL), nil
+}
+
+// HashRefreshToken returns the value stored in place of the raw refresh token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateSessionID generates a session identifier, which is also shared by
+// all refresh tokens descending from a single login.
+func GenerateSessionID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buffer), nil
+}